@@ -191,6 +191,7 @@ func (m *UplinkMessage) GetTrace() *trace.Trace {
 }
 
 // received from the Handler, sent to the Router, used as Template
+
 type DownlinkMessage struct {
 	Payload        []byte                                             `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
 	Message        *protocol.Message                                  `protobuf:"bytes,2,opt,name=message" json:"message,omitempty"`
@@ -199,7 +200,9 @@ type DownlinkMessage struct {
 	AppId          string                                             `protobuf:"bytes,13,opt,name=app_id,json=appId,proto3" json:"app_id,omitempty"`
 	DevId          string                                             `protobuf:"bytes,14,opt,name=dev_id,json=devId,proto3" json:"dev_id,omitempty"`
 	DownlinkOption *DownlinkOption                                    `protobuf:"bytes,21,opt,name=downlink_option,json=downlinkOption" json:"downlink_option,omitempty"`
-	Trace          *trace.Trace                                       `protobuf:"bytes,31,opt,name=trace" json:"trace,omitempty"`
+	// The downlink options of all gateways that received the uplink, ranked by preference, so that another gateway or receive window can be used if the DownlinkOption is not available
+	DownlinkOptions []*DownlinkOption `protobuf:"bytes,22,rep,name=downlink_options,json=downlinkOptions" json:"downlink_options,omitempty"`
+	Trace           *trace.Trace      `protobuf:"bytes,31,opt,name=trace" json:"trace,omitempty"`
 }
 
 func (m *DownlinkMessage) Reset()                    { *m = DownlinkMessage{} }
@@ -242,6 +245,13 @@ func (m *DownlinkMessage) GetDownlinkOption() *DownlinkOption {
 	return nil
 }
 
+func (m *DownlinkMessage) GetDownlinkOptions() []*DownlinkOption {
+	if m != nil {
+		return m.DownlinkOptions
+	}
+	return nil
+}
+
 func (m *DownlinkMessage) GetTrace() *trace.Trace {
 	if m != nil {
 		return m.Trace
@@ -1377,6 +1387,20 @@ func (m *DownlinkMessage) MarshalTo(dAtA []byte) (int, error) {
 		}
 		i += n12
 	}
+	if len(m.DownlinkOptions) > 0 {
+		for _, msg := range m.DownlinkOptions {
+			dAtA[i] = 0xb2
+			i++
+			dAtA[i] = 0x1
+			i++
+			i = encodeVarintBroker(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
 	if m.Trace != nil {
 		dAtA[i] = 0xfa
 		i++
@@ -2236,6 +2260,12 @@ func (m *DownlinkMessage) Size() (n int) {
 		l = m.DownlinkOption.Size()
 		n += 2 + l + sovBroker(uint64(l))
 	}
+	if len(m.DownlinkOptions) > 0 {
+		for _, e := range m.DownlinkOptions {
+			l = e.Size()
+			n += 2 + l + sovBroker(uint64(l))
+		}
+	}
 	if m.Trace != nil {
 		l = m.Trace.Size()
 		n += 2 + l + sovBroker(uint64(l))
@@ -3368,6 +3398,37 @@ func (m *DownlinkMessage) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 22:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DownlinkOptions", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowBroker
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthBroker
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DownlinkOptions = append(m.DownlinkOptions, &DownlinkOption{})
+			if err := m.DownlinkOptions[len(m.DownlinkOptions)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		case 31:
 			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field Trace", wireType)
@@ -5766,81 +5827,81 @@ func init() {
 }
 
 var fileDescriptorBroker = []byte{
-	// 1208 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xec, 0x58, 0x4d, 0x8f, 0xdb, 0x44,
-	0x18, 0x96, 0xf7, 0x23, 0xdb, 0x7d, 0xb3, 0xd9, 0x24, 0xd3, 0xee, 0xae, 0x9b, 0xd2, 0x4d, 0x08,
-	0x52, 0x15, 0x28, 0x4d, 0xda, 0x20, 0xbe, 0x24, 0x44, 0x95, 0xed, 0x56, 0xb0, 0x48, 0x29, 0x95,
-	0x9b, 0x72, 0x40, 0x48, 0xd1, 0xc4, 0x7e, 0xeb, 0x8c, 0xea, 0xd8, 0xae, 0x67, 0x9c, 0x36, 0x7f,
-	0x80, 0x0b, 0x12, 0xbf, 0x01, 0xf8, 0x07, 0x1c, 0xb9, 0x70, 0x44, 0x1c, 0x39, 0x73, 0x00, 0xd4,
-	0x5f, 0x82, 0x3c, 0x9e, 0xb1, 0x93, 0xdd, 0xa6, 0xad, 0xaa, 0x8a, 0x0f, 0x75, 0x2f, 0x89, 0xe7,
-	0x79, 0x1f, 0x3f, 0x33, 0xf3, 0x7e, 0x79, 0x6c, 0x78, 0xdf, 0x65, 0x62, 0x1c, 0x8f, 0xda, 0x76,
-	0x30, 0xe9, 0x0c, 0xc6, 0x38, 0x18, 0x33, 0xdf, 0xe5, 0xb7, 0x50, 0x3c, 0x0c, 0xa2, 0xfb, 0x1d,
-	0x21, 0xfc, 0x0e, 0x0d, 0x59, 0x67, 0x14, 0x05, 0xf7, 0x31, 0x52, 0x7f, 0xed, 0x30, 0x0a, 0x44,
-	0x40, 0x0a, 0xe9, 0xa8, 0x76, 0xc1, 0x0d, 0x02, 0xd7, 0xc3, 0x8e, 0x44, 0x47, 0xf1, 0xbd, 0x0e,
-	0x4e, 0x42, 0x31, 0x4b, 0x49, 0xb5, 0x2b, 0x73, 0xea, 0x6e, 0xe0, 0x06, 0x39, 0x2b, 0x19, 0xc9,
-	0x81, 0xbc, 0x52, 0xf4, 0xaa, 0x9e, 0x90, 0x86, 0x4c, 0x41, 0x75, 0x0d, 0xc9, 0xa1, 0x1d, 0x78,
-	0xd9, 0x85, 0x22, 0x5c, 0xd4, 0x04, 0x97, 0x0a, 0x7c, 0x48, 0x67, 0xfa, 0x5f, 0x99, 0xcf, 0x6b,
-	0xb3, 0x88, 0xa8, 0x8d, 0xe9, 0x6f, 0x6a, 0x6a, 0x7e, 0xbd, 0x02, 0xdb, 0x87, 0xc1, 0x43, 0xdf,
-	0x63, 0xfe, 0xfd, 0xcf, 0x43, 0xc1, 0x02, 0x9f, 0xec, 0x03, 0x30, 0x07, 0x7d, 0xc1, 0xee, 0x31,
-	0x8c, 0x4c, 0xa3, 0x61, 0xb4, 0x36, 0xad, 0x39, 0x84, 0x5c, 0x04, 0x50, 0xf2, 0x43, 0xe6, 0x98,
-	0x2b, 0xd2, 0xbe, 0xa9, 0x90, 0x23, 0x87, 0x9c, 0x83, 0x75, 0x6e, 0x07, 0x11, 0x9a, 0xab, 0x0d,
-	0xa3, 0x55, 0xb2, 0xd2, 0x01, 0xa9, 0xc1, 0x19, 0x07, 0xa9, 0xe3, 0x31, 0x1f, 0xcd, 0xb5, 0x86,
-	0xd1, 0x5a, 0xb5, 0xb2, 0x31, 0x39, 0x80, 0xb2, 0xde, 0xcf, 0xd0, 0x0e, 0xfc, 0x7b, 0xcc, 0x35,
-	0xd7, 0x1b, 0x46, 0xab, 0xd8, 0x3d, 0xdf, 0xce, 0xf6, 0x39, 0x78, 0x74, 0x43, 0x5a, 0xe2, 0x88,
-	0x26, 0x8b, 0xb4, 0xb6, 0xb5, 0x25, 0x85, 0xc9, 0x75, 0xd8, 0xd6, 0x8b, 0x52, 0x12, 0x05, 0x29,
-	0x61, 0xb6, 0xb5, 0x2b, 0x8e, 0x2b, 0x94, 0x94, 0x21, 0x45, 0x9b, 0xdf, 0xae, 0x41, 0xe9, 0x6e,
-	0x98, 0xb8, 0xa1, 0x8f, 0x9c, 0x53, 0x17, 0x89, 0x09, 0x1b, 0x21, 0x9d, 0x79, 0x01, 0x75, 0xa4,
-	0x13, 0xb6, 0x2c, 0x3d, 0x24, 0x97, 0x61, 0x63, 0x92, 0x92, 0xe4, 0xf6, 0x8b, 0xdd, 0x6a, 0xbe,
-	0x50, 0x75, 0xb7, 0xa5, 0x19, 0xe4, 0x16, 0x6c, 0x38, 0x38, 0x1d, 0x62, 0xcc, 0xcc, 0x62, 0x22,
-	0x73, 0xf0, 0xee, 0xef, 0x7f, 0xd4, 0xaf, 0x3d, 0x2b, 0xe3, 0x12, 0xa7, 0x75, 0xc4, 0x2c, 0x44,
-	0xde, 0x3e, 0xc4, 0xe9, 0xcd, 0xbb, 0x47, 0x56, 0xc1, 0xc1, 0xe9, 0xcd, 0x98, 0x25, 0x7a, 0x34,
-	0x0c, 0xa5, 0xde, 0xd6, 0x0b, 0xe9, 0xf5, 0xc2, 0x50, 0xea, 0xd1, 0x30, 0x4c, 0xf4, 0x76, 0x20,
-	0xb9, 0x4a, 0x42, 0x59, 0x92, 0xa1, 0x5c, 0xa7, 0x61, 0x78, 0xe4, 0x24, 0x70, 0xb2, 0x6c, 0xe6,
-	0x98, 0xdb, 0x29, 0xec, 0xe0, 0xf4, 0xc8, 0x21, 0x3d, 0xa8, 0x66, 0xb1, 0x9a, 0xa0, 0xa0, 0x0e,
-	0x15, 0xd4, 0xdc, 0x91, 0x4e, 0x38, 0x97, 0x3b, 0xc1, 0x7a, 0xd4, 0x57, 0x36, 0xab, 0xa2, 0x41,
-	0x8d, 0x90, 0x8f, 0xa1, 0xa2, 0x43, 0x95, 0x29, 0xec, 0x4a, 0x85, 0xb3, 0x59, 0xb0, 0xe6, 0x04,
-	0xca, 0x0a, 0xcb, 0xee, 0xef, 0x41, 0xc5, 0x51, 0x19, 0x3b, 0x0c, 0x64, 0xca, 0x72, 0xb3, 0xde,
-	0x58, 0x6d, 0x15, 0xbb, 0xbb, 0x6d, 0x55, 0x9d, 0x8b, 0x19, 0x6d, 0x95, 0x9d, 0x85, 0x31, 0x27,
-	0x4d, 0x58, 0x97, 0x45, 0x60, 0xbe, 0x29, 0xe7, 0xdd, 0x6a, 0xa7, 0x25, 0x31, 0x48, 0x7e, 0xad,
-	0xd4, 0xd4, 0xfc, 0x66, 0x15, 0xca, 0x5a, 0xe7, 0x34, 0x25, 0x9e, 0x92, 0x12, 0xd7, 0xa1, 0x7c,
-	0x2c, 0x1e, 0x2a, 0x21, 0x96, 0x85, 0x63, 0x7b, 0x31, 0x1c, 0x79, 0x34, 0xea, 0xcb, 0xa3, 0xf1,
-	0x8b, 0x01, 0xe6, 0x21, 0x4e, 0x99, 0x8d, 0x3d, 0x5b, 0xb0, 0x69, 0x5a, 0xc2, 0xc8, 0xc3, 0xc0,
-	0xe7, 0x2f, 0x2d, 0x2c, 0x4f, 0xd8, 0x48, 0xf1, 0xc5, 0x36, 0xb2, 0xb3, 0x7c, 0x23, 0x3f, 0xaf,
-	0xc1, 0xf9, 0x43, 0x74, 0xe2, 0xd0, 0x63, 0x36, 0x15, 0xe8, 0x9c, 0xf6, 0x9c, 0x7f, 0xaf, 0xe7,
-	0xac, 0x3e, 0x77, 0xcf, 0xa9, 0x43, 0x91, 0x63, 0x34, 0xc5, 0x68, 0x28, 0xd8, 0x04, 0xcd, 0x3d,
-	0xf9, 0x04, 0x83, 0x14, 0x1a, 0xb0, 0x09, 0x92, 0x43, 0xa8, 0x46, 0x2a, 0x1d, 0x87, 0x02, 0x27,
-	0xa1, 0x47, 0x85, 0xce, 0xe7, 0xbd, 0xe3, 0xd9, 0xa3, 0xc3, 0x55, 0xd1, 0x77, 0x0c, 0xd4, 0x0d,
-	0xcf, 0xd5, 0x97, 0x7e, 0x5a, 0x83, 0xbd, 0x93, 0x95, 0xf0, 0x20, 0x46, 0x2e, 0x5e, 0x95, 0xf4,
-	0xf9, 0x0f, 0x3c, 0x84, 0xfa, 0x70, 0x96, 0x66, 0xee, 0xcf, 0x25, 0xf6, 0xa4, 0xc4, 0x6b, 0xf9,
-	0x22, 0xf2, 0x18, 0x65, 0x5a, 0x84, 0x9e, 0xc0, 0xfe, 0xa9, 0x67, 0xda, 0x77, 0xeb, 0xf0, 0xc6,
-	0x7c, 0xf3, 0x79, 0xc5, 0xf3, 0xe8, 0x7f, 0xd7, 0x86, 0x5e, 0x72, 0xd6, 0x1d, 0xeb, 0x6a, 0xe6,
-	0x89, 0xae, 0xd6, 0x5f, 0xde, 0xd5, 0x1a, 0x59, 0x5e, 0x2e, 0x79, 0x2a, 0xbf, 0x60, 0x7b, 0xfb,
-	0x71, 0x05, 0x6a, 0xb9, 0xd8, 0x8d, 0x31, 0xf5, 0x3c, 0xf4, 0x5d, 0x3c, 0xcd, 0xcc, 0xe5, 0x99,
-	0xd9, 0x74, 0xe0, 0xc2, 0x13, 0x5d, 0xf6, 0x52, 0x8f, 0x47, 0x4d, 0x02, 0x95, 0x3b, 0xf1, 0x88,
-	0xdb, 0x11, 0x1b, 0xe9, 0x70, 0x34, 0xcb, 0x50, 0xba, 0x23, 0xa8, 0x88, 0xb9, 0x06, 0xfe, 0x5c,
-	0x85, 0x42, 0x8a, 0x90, 0x16, 0x14, 0xf8, 0x8c, 0x0b, 0x9c, 0xc8, 0x59, 0x8b, 0xdd, 0x4a, 0x3b,
-	0x79, 0xa3, 0xbd, 0x23, 0xa1, 0x84, 0xc2, 0x2d, 0x65, 0x27, 0xd7, 0x60, 0xd3, 0x0e, 0x26, 0x61,
-	0xe0, 0xa3, 0x2f, 0xd4, 0x42, 0xce, 0x4a, 0xf2, 0x0d, 0x8d, 0xa6, 0xfc, 0x9c, 0x45, 0x9a, 0x50,
-	0x88, 0xe5, 0xc9, 0x49, 0x1d, 0xd1, 0x40, 0xf2, 0x2d, 0x2a, 0x90, 0x5b, 0xca, 0x42, 0x3a, 0x50,
-	0x4a, 0xaf, 0x86, 0xb1, 0xcf, 0x1e, 0xc4, 0x28, 0x43, 0xb3, 0x48, 0xdd, 0x4a, 0x09, 0x77, 0xa5,
-	0x9d, 0x5c, 0x82, 0x33, 0xba, 0xab, 0x4a, 0xbf, 0x2f, 0x72, 0x33, 0x1b, 0x79, 0x1b, 0x8a, 0x79,
-	0x35, 0x71, 0x19, 0x8b, 0x45, 0xea, 0xbc, 0x99, 0x7c, 0x08, 0x73, 0xb5, 0xc7, 0xf5, 0x5a, 0xca,
-	0x27, 0x6e, 0xaa, 0xce, 0xb1, 0xd4, 0x82, 0xde, 0x83, 0x92, 0x93, 0xb5, 0xeb, 0xe4, 0x3c, 0x5a,
-	0x99, 0xf3, 0xe4, 0x6d, 0x8c, 0xec, 0xe4, 0xa5, 0xdc, 0x43, 0x6e, 0x2d, 0xd2, 0xc8, 0x65, 0xa8,
-	0xda, 0x81, 0xef, 0xa3, 0x2d, 0xd0, 0x19, 0x46, 0x41, 0x2c, 0x30, 0xe2, 0xb2, 0x55, 0x95, 0xac,
-	0x4a, 0x66, 0xb0, 0x52, 0x9c, 0x5c, 0x01, 0x92, 0x93, 0xc7, 0xd4, 0x77, 0xbc, 0x84, 0xbd, 0x2b,
-	0xd9, 0xb9, 0xcc, 0xa7, 0xca, 0xd0, 0xfc, 0x02, 0xf6, 0x7b, 0x61, 0x36, 0x95, 0x82, 0x2d, 0x74,
-	0x19, 0x17, 0xe9, 0x9b, 0xf5, 0x5c, 0xf2, 0x1a, 0xf3, 0xc9, 0x7b, 0x11, 0x40, 0xa9, 0xcf, 0x7d,
-	0x37, 0x50, 0xc8, 0x91, 0xd3, 0xfd, 0x61, 0x05, 0x0a, 0x07, 0xb2, 0xa5, 0x90, 0xeb, 0xb0, 0xd9,
-	0xe3, 0x3c, 0xb0, 0x59, 0xd2, 0x34, 0x76, 0x74, 0xa3, 0x59, 0x38, 0x29, 0xd7, 0x96, 0x9d, 0xaa,
-	0x5a, 0xc6, 0x55, 0x83, 0x7c, 0x06, 0x9b, 0x59, 0xaa, 0x12, 0x53, 0x33, 0x8f, 0x67, 0x6f, 0xed,
-	0xf5, 0xbc, 0x87, 0x2d, 0x39, 0x90, 0x5f, 0x35, 0xc8, 0x47, 0xb0, 0x71, 0x3b, 0x1e, 0x79, 0x8c,
-	0x8f, 0xc9, 0xb2, 0x39, 0x6b, 0xbb, 0xed, 0xf4, 0x03, 0x50, 0x5b, 0x7f, 0xda, 0x69, 0xdf, 0x9c,
-	0x84, 0x62, 0xd6, 0x32, 0x48, 0x1f, 0xce, 0xa8, 0xd2, 0x44, 0x52, 0x5f, 0xde, 0x32, 0xd3, 0xf5,
-	0x3c, 0xb3, 0xa7, 0x76, 0xbf, 0x37, 0xa0, 0x94, 0x3a, 0xa9, 0x4f, 0x7d, 0xea, 0x62, 0x44, 0xbe,
-	0x82, 0x5a, 0xea, 0x7c, 0x8c, 0x4e, 0x86, 0x85, 0x5c, 0xd2, 0x8a, 0x4f, 0x0f, 0xd9, 0xb2, 0x0d,
-	0x90, 0x2e, 0x6c, 0x7e, 0x82, 0x42, 0x15, 0x74, 0x16, 0x89, 0x85, 0x92, 0xaf, 0x6d, 0x2f, 0xc2,
-	0x07, 0x1f, 0xfc, 0xfa, 0x78, 0xdf, 0xf8, 0xed, 0xf1, 0xbe, 0xf1, 0xd7, 0xe3, 0x7d, 0xe3, 0xcb,
-	0xb7, 0x9e, 0xff, 0xdb, 0xda, 0xa8, 0x20, 0x67, 0x7f, 0xe7, 0xef, 0x00, 0x00, 0x00, 0xff, 0xff,
-	0x4b, 0x13, 0x77, 0x15, 0x90, 0x13, 0x00, 0x00,
+	// 1213 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xec, 0x58, 0xcb, 0x6e, 0xdb, 0x46,
+	0x17, 0x06, 0x7d, 0x91, 0xe3, 0x23, 0xeb, 0xe2, 0x49, 0x6c, 0x33, 0xca, 0x1f, 0xdb, 0xbf, 0x0a,
+	0x04, 0x6a, 0xd3, 0x50, 0x89, 0x8a, 0xde, 0x80, 0xa2, 0x81, 0x1c, 0x07, 0xad, 0x0b, 0x28, 0x0d,
+	0x18, 0xa5, 0x8b, 0xa2, 0x80, 0x30, 0x22, 0x4f, 0xa8, 0x41, 0x28, 0x92, 0xe1, 0x0c, 0x95, 0xf8,
+	0x05, 0xba, 0xec, 0x33, 0xb4, 0x7d, 0x83, 0x2e, 0xbb, 0xe9, 0xb2, 0xe8, 0xaa, 0xe8, 0xba, 0x8b,
+	0xb6, 0xc8, 0x93, 0x14, 0x1c, 0xce, 0x90, 0x92, 0x15, 0x25, 0x69, 0x10, 0xf4, 0x82, 0x78, 0x63,
+	0x73, 0xbe, 0xf3, 0xf1, 0x9b, 0xe1, 0x39, 0xdf, 0x1c, 0x8e, 0x08, 0xef, 0x7a, 0x4c, 0x8c, 0x92,
+	0xa1, 0xe5, 0x84, 0xe3, 0x76, 0x7f, 0x84, 0xfd, 0x11, 0x0b, 0x3c, 0x7e, 0x0b, 0xc5, 0xc3, 0x30,
+	0xbe, 0xdf, 0x16, 0x22, 0x68, 0xd3, 0x88, 0xb5, 0x87, 0x71, 0x78, 0x1f, 0x63, 0xf5, 0xcf, 0x8a,
+	0xe2, 0x50, 0x84, 0xa4, 0x94, 0x8d, 0x1a, 0x17, 0xbc, 0x30, 0xf4, 0x7c, 0x6c, 0x4b, 0x74, 0x98,
+	0xdc, 0x6b, 0xe3, 0x38, 0x12, 0xc7, 0x19, 0xa9, 0x71, 0x65, 0x4a, 0xdd, 0x0b, 0xbd, 0xb0, 0x60,
+	0xa5, 0x23, 0x39, 0x90, 0x57, 0x8a, 0xbe, 0xa9, 0x27, 0xa4, 0x11, 0x53, 0xd0, 0x9e, 0x86, 0xe4,
+	0xd0, 0x09, 0xfd, 0xfc, 0x42, 0x11, 0x2e, 0x6a, 0x82, 0x47, 0x05, 0x3e, 0xa4, 0xc7, 0xfa, 0xbf,
+	0x0a, 0x9f, 0xd7, 0x61, 0x11, 0x53, 0x07, 0xb3, 0xbf, 0x59, 0xa8, 0xf9, 0xe5, 0x12, 0x54, 0x0f,
+	0xc3, 0x87, 0x81, 0xcf, 0x82, 0xfb, 0x9f, 0x46, 0x82, 0x85, 0x01, 0xd9, 0x05, 0x60, 0x2e, 0x06,
+	0x82, 0xdd, 0x63, 0x18, 0x9b, 0xc6, 0xbe, 0xd1, 0x5a, 0xb7, 0xa7, 0x10, 0x72, 0x11, 0x40, 0xc9,
+	0x0f, 0x98, 0x6b, 0x2e, 0xc9, 0xf8, 0xba, 0x42, 0x8e, 0x5c, 0x72, 0x0e, 0x56, 0xb9, 0x13, 0xc6,
+	0x68, 0x2e, 0xef, 0x1b, 0xad, 0x8a, 0x9d, 0x0d, 0x48, 0x03, 0xce, 0xb8, 0x48, 0x5d, 0x9f, 0x05,
+	0x68, 0xae, 0xec, 0x1b, 0xad, 0x65, 0x3b, 0x1f, 0x93, 0x03, 0xa8, 0xe9, 0xe7, 0x19, 0x38, 0x61,
+	0x70, 0x8f, 0x79, 0xe6, 0xea, 0xbe, 0xd1, 0x2a, 0x77, 0xce, 0x5b, 0xf9, 0x73, 0xf6, 0x1f, 0xdd,
+	0x90, 0x91, 0x24, 0xa6, 0xe9, 0x22, 0xed, 0xaa, 0x8e, 0x64, 0x30, 0xb9, 0x0e, 0x55, 0xbd, 0x28,
+	0x25, 0x51, 0x92, 0x12, 0xa6, 0xa5, 0x53, 0x71, 0x52, 0xa1, 0xa2, 0x02, 0x19, 0xda, 0xfc, 0x6a,
+	0x05, 0x2a, 0x77, 0xa3, 0x34, 0x0d, 0x3d, 0xe4, 0x9c, 0x7a, 0x48, 0x4c, 0x58, 0x8b, 0xe8, 0xb1,
+	0x1f, 0x52, 0x57, 0x26, 0x61, 0xc3, 0xd6, 0x43, 0x72, 0x19, 0xd6, 0xc6, 0x19, 0x49, 0x3e, 0x7e,
+	0xb9, 0xb3, 0x59, 0x2c, 0x54, 0xdd, 0x6d, 0x6b, 0x06, 0xb9, 0x05, 0x6b, 0x2e, 0x4e, 0x06, 0x98,
+	0x30, 0xb3, 0x9c, 0xca, 0x1c, 0xbc, 0xfd, 0xeb, 0x6f, 0x7b, 0xd7, 0x9e, 0xe5, 0xb8, 0x34, 0x69,
+	0x6d, 0x71, 0x1c, 0x21, 0xb7, 0x0e, 0x71, 0x72, 0xf3, 0xee, 0x91, 0x5d, 0x72, 0x71, 0x72, 0x33,
+	0x61, 0xa9, 0x1e, 0x8d, 0x22, 0xa9, 0xb7, 0xf1, 0x42, 0x7a, 0xdd, 0x28, 0x92, 0x7a, 0x34, 0x8a,
+	0x52, 0xbd, 0x2d, 0x48, 0xaf, 0xd2, 0x52, 0x56, 0x64, 0x29, 0x57, 0x69, 0x14, 0x1d, 0xb9, 0x29,
+	0x9c, 0x2e, 0x9b, 0xb9, 0x66, 0x35, 0x83, 0x5d, 0x9c, 0x1c, 0xb9, 0xa4, 0x0b, 0x9b, 0x79, 0xad,
+	0xc6, 0x28, 0xa8, 0x4b, 0x05, 0x35, 0xb7, 0x64, 0x12, 0xce, 0x15, 0x49, 0xb0, 0x1f, 0xf5, 0x54,
+	0xcc, 0xae, 0x6b, 0x50, 0x23, 0xe4, 0x43, 0xa8, 0xeb, 0x52, 0xe5, 0x0a, 0xdb, 0x52, 0xe1, 0x6c,
+	0x5e, 0xac, 0x29, 0x81, 0x9a, 0xc2, 0xf2, 0xfb, 0xbb, 0x50, 0x77, 0x95, 0x63, 0x07, 0xa1, 0xb4,
+	0x2c, 0x37, 0xf7, 0xf6, 0x97, 0x5b, 0xe5, 0xce, 0xb6, 0xa5, 0x76, 0xe7, 0xac, 0xa3, 0xed, 0x9a,
+	0x3b, 0x33, 0xe6, 0xa4, 0x09, 0xab, 0x72, 0x13, 0x98, 0xaf, 0xcb, 0x79, 0x37, 0x2c, 0x39, 0xb2,
+	0xfa, 0xe9, 0x5f, 0x3b, 0x0b, 0x35, 0x7f, 0x5e, 0x86, 0x9a, 0xd6, 0x39, 0xb5, 0xc4, 0x53, 0x2c,
+	0x71, 0x1d, 0x6a, 0x27, 0xea, 0xa1, 0x0c, 0xb1, 0xa8, 0x1c, 0xd5, 0xd9, 0x72, 0x14, 0xd5, 0xd8,
+	0x5b, 0x58, 0x8d, 0x27, 0x16, 0x7d, 0xfb, 0x2f, 0x15, 0xbd, 0xf9, 0xa3, 0x01, 0xe6, 0x21, 0x4e,
+	0x98, 0x83, 0x5d, 0x47, 0xb0, 0x49, 0xd6, 0x05, 0x90, 0x47, 0x61, 0xc0, 0x5f, 0x5a, 0x65, 0x9f,
+	0x90, 0x8b, 0xf2, 0x8b, 0xe5, 0x62, 0x6b, 0xb1, 0x33, 0x7f, 0x58, 0x81, 0xf3, 0x87, 0xe8, 0x26,
+	0x91, 0xcf, 0x1c, 0x2a, 0xd0, 0x3d, 0x6d, 0x5b, 0xff, 0x5c, 0xdb, 0x5a, 0x7e, 0xee, 0xb6, 0xb5,
+	0x07, 0x65, 0x8e, 0xf1, 0x04, 0xe3, 0x81, 0x60, 0x63, 0x34, 0x77, 0xe4, 0x4b, 0x10, 0x32, 0xa8,
+	0xcf, 0xc6, 0x48, 0x0e, 0x61, 0x33, 0x56, 0x76, 0x1c, 0x08, 0x1c, 0x47, 0x3e, 0x15, 0x7a, 0x4b,
+	0xec, 0x9c, 0x74, 0x8f, 0x2e, 0x57, 0x5d, 0xdf, 0xd1, 0x57, 0x37, 0x3c, 0x57, 0x6b, 0xfb, 0x7e,
+	0x05, 0x76, 0xe6, 0x77, 0xc2, 0x83, 0x04, 0xb9, 0x78, 0x55, 0xec, 0xf3, 0x2f, 0x78, 0x8f, 0xf5,
+	0xe0, 0x2c, 0xcd, 0xd3, 0x5f, 0x48, 0xec, 0x48, 0x89, 0xff, 0x15, 0x8b, 0x28, 0x6a, 0x94, 0x6b,
+	0x11, 0x3a, 0x87, 0xfd, 0x5d, 0xaf, 0xc5, 0xaf, 0x57, 0xe1, 0xb5, 0xe9, 0xe6, 0xf3, 0x8a, 0xfb,
+	0xe8, 0x3f, 0xd7, 0x86, 0x5e, 0xb2, 0xeb, 0x4e, 0x74, 0x35, 0x73, 0xae, 0xab, 0xf5, 0x16, 0x77,
+	0xb5, 0xfd, 0xdc, 0x97, 0x0b, 0xde, 0xca, 0x2f, 0xd8, 0xde, 0xbe, 0x5b, 0x82, 0x46, 0x21, 0x76,
+	0x63, 0x44, 0x7d, 0x1f, 0x03, 0x0f, 0x4f, 0x9d, 0xb9, 0xd8, 0x99, 0x4d, 0x17, 0x2e, 0x3c, 0x31,
+	0x65, 0x2f, 0xf5, 0x78, 0xd4, 0x24, 0x50, 0xbf, 0x93, 0x0c, 0xb9, 0x13, 0xb3, 0xa1, 0x2e, 0x47,
+	0xb3, 0x06, 0x95, 0x3b, 0x82, 0x8a, 0x84, 0x6b, 0xe0, 0xf7, 0x65, 0x28, 0x65, 0x08, 0x69, 0x41,
+	0x89, 0x1f, 0x73, 0x81, 0x63, 0x39, 0x6b, 0xb9, 0x53, 0xb7, 0xd2, 0x1f, 0xc5, 0x77, 0x24, 0x94,
+	0x52, 0xb8, 0xad, 0xe2, 0xe4, 0x1a, 0xac, 0x3b, 0xe1, 0x38, 0x0a, 0x03, 0x0c, 0x84, 0x5a, 0xc8,
+	0x59, 0x49, 0xbe, 0xa1, 0xd1, 0x8c, 0x5f, 0xb0, 0x48, 0x13, 0x4a, 0x89, 0x3c, 0x39, 0xa9, 0x23,
+	0x1a, 0x48, 0xbe, 0x4d, 0x05, 0x72, 0x5b, 0x45, 0x48, 0x1b, 0x2a, 0xd9, 0xd5, 0x20, 0x09, 0xd8,
+	0x83, 0x04, 0xcd, 0x8d, 0x39, 0xea, 0x46, 0x46, 0xb8, 0x2b, 0xe3, 0xe4, 0x12, 0x9c, 0xd1, 0x5d,
+	0xd5, 0xac, 0xcc, 0x71, 0xf3, 0x18, 0x79, 0x13, 0xca, 0xc5, 0x6e, 0xe2, 0x66, 0x75, 0x8e, 0x3a,
+	0x1d, 0x26, 0xef, 0xc3, 0xd4, 0xde, 0xe3, 0x7a, 0x2d, 0xb5, 0xb9, 0x9b, 0x36, 0xa7, 0x58, 0x6a,
+	0x41, 0xef, 0x40, 0xc5, 0xcd, 0xdb, 0x75, 0x7a, 0x1e, 0xad, 0x4f, 0x65, 0xf2, 0x36, 0xc6, 0x0e,
+	0x06, 0x82, 0xf9, 0xc8, 0xed, 0x59, 0x1a, 0xb9, 0x0c, 0x9b, 0x4e, 0x18, 0x04, 0xe8, 0x08, 0x74,
+	0x07, 0x71, 0x98, 0x08, 0x8c, 0xb9, 0x6c, 0x55, 0x15, 0xbb, 0x9e, 0x07, 0xec, 0x0c, 0x27, 0x57,
+	0x80, 0x14, 0xe4, 0x11, 0x0d, 0x5c, 0x3f, 0x65, 0x6f, 0x4b, 0x76, 0x21, 0xf3, 0xb1, 0x0a, 0x34,
+	0x3f, 0x83, 0xdd, 0x6e, 0x94, 0x4f, 0xa5, 0x60, 0x1b, 0x3d, 0xc6, 0x45, 0xf6, 0xe3, 0x7c, 0xca,
+	0xbc, 0xc6, 0xb4, 0x79, 0x2f, 0x02, 0x28, 0xf5, 0xa9, 0x4f, 0x0f, 0x0a, 0x39, 0x72, 0x3b, 0xdf,
+	0x2e, 0x41, 0xe9, 0x40, 0xb6, 0x14, 0x72, 0x1d, 0xd6, 0xbb, 0x9c, 0x87, 0x0e, 0x4b, 0x9b, 0xc6,
+	0x96, 0x6e, 0x34, 0x33, 0x27, 0xe5, 0xc6, 0xa2, 0x53, 0x55, 0xcb, 0xb8, 0x6a, 0x90, 0x4f, 0x60,
+	0x3d, 0xb7, 0x2a, 0x31, 0x35, 0xf3, 0xa4, 0x7b, 0x1b, 0xff, 0xcf, 0x35, 0x16, 0x1d, 0xc8, 0xaf,
+	0x1a, 0xe4, 0x03, 0x58, 0xbb, 0x9d, 0x0c, 0x7d, 0xc6, 0x47, 0x64, 0xd1, 0x9c, 0x8d, 0x6d, 0x2b,
+	0xfb, 0x86, 0x64, 0xe9, 0xaf, 0x43, 0xd6, 0xcd, 0xf4, 0x1b, 0x52, 0xcb, 0x20, 0x3d, 0x38, 0xa3,
+	0xb6, 0x26, 0x92, 0xbd, 0xc5, 0x2d, 0x33, 0x5b, 0xcf, 0x33, 0x7b, 0x6a, 0xe7, 0x1b, 0x03, 0x2a,
+	0x59, 0x92, 0x7a, 0x34, 0xa0, 0x1e, 0xc6, 0xe4, 0x0b, 0x68, 0x64, 0xc9, 0xc7, 0x78, 0xbe, 0x2c,
+	0xe4, 0x92, 0x56, 0x7c, 0x7a, 0xc9, 0x16, 0x3d, 0x00, 0xe9, 0xc0, 0xfa, 0x47, 0x28, 0xd4, 0x86,
+	0xce, 0x2b, 0x31, 0xb3, 0xe5, 0x1b, 0xd5, 0x59, 0xf8, 0xe0, 0xbd, 0x9f, 0x1e, 0xef, 0x1a, 0xbf,
+	0x3c, 0xde, 0x35, 0xfe, 0x78, 0xbc, 0x6b, 0x7c, 0xfe, 0xc6, 0xf3, 0x7f, 0x9e, 0x1b, 0x96, 0xe4,
+	0xec, 0x6f, 0xfd, 0x39, 0x00, 0x71, 0xbc, 0xf7, 0x32, 0xd3, 0x13, 0x00, 0x00,
 }
@@ -50,6 +50,8 @@ type DevicesRequest struct {
 	DevAddr *github_com_TheThingsNetwork_ttn_core_types.DevAddr `protobuf:"bytes,1,opt,name=dev_addr,json=devAddr,proto3,customtype=github.com/TheThingsNetwork/ttn/core/types.DevAddr" json:"dev_addr,omitempty"`
 	// Frame counter from the uplink message
 	FCnt uint32 `protobuf:"varint,2,opt,name=f_cnt,json=fCnt,proto3" json:"f_cnt,omitempty"`
+	// Include devices without an active session, for diagnostics
+	IncludeInactive bool `protobuf:"varint,3,opt,name=include_inactive,json=includeInactive,proto3" json:"include_inactive,omitempty"`
 }
 
 func (m *DevicesRequest) Reset()                    { *m = DevicesRequest{} }
@@ -64,6 +66,13 @@ func (m *DevicesRequest) GetFCnt() uint32 {
 	return 0
 }
 
+func (m *DevicesRequest) GetIncludeInactive() bool {
+	if m != nil {
+		return m.IncludeInactive
+	}
+	return false
+}
+
 type DevicesResponse struct {
 	Results []*lorawan.Device `protobuf:"bytes,1,rep,name=results" json:"results,omitempty"`
 }
@@ -461,6 +470,16 @@ func (m *DevicesRequest) MarshalTo(dAtA []byte) (int, error) {
 		i++
 		i = encodeVarintNetworkserver(dAtA, i, uint64(m.FCnt))
 	}
+	if m.IncludeInactive {
+		dAtA[i] = 0x18
+		i++
+		if m.IncludeInactive {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i++
+	}
 	return i, nil
 }
 
@@ -629,6 +648,9 @@ func (m *DevicesRequest) Size() (n int) {
 	if m.FCnt != 0 {
 		n += 1 + sovNetworkserver(uint64(m.FCnt))
 	}
+	if m.IncludeInactive {
+		n += 2
+	}
 	return n
 }
 
@@ -773,6 +795,26 @@ func (m *DevicesRequest) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field IncludeInactive", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowNetworkserver
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.IncludeInactive = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipNetworkserver(dAtA[iNdEx:])
@@ -1283,43 +1325,44 @@ func init() {
 }
 
 var fileDescriptorNetworkserver = []byte{
-	// 603 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x94, 0x5d, 0x4f, 0x13, 0x4f,
-	0x14, 0xc6, 0xb3, 0xf0, 0xff, 0x97, 0x72, 0x4a, 0x45, 0x06, 0x89, 0x4d, 0x95, 0x0a, 0x4d, 0x34,
-	0x35, 0xea, 0x6e, 0xa8, 0x89, 0x57, 0x24, 0xf2, 0x52, 0xc3, 0x85, 0x81, 0xd4, 0x05, 0x13, 0xe3,
-	0x0d, 0x99, 0xee, 0x1e, 0xda, 0x0d, 0xdb, 0x99, 0x75, 0x66, 0xb6, 0xc8, 0xc7, 0xf1, 0xda, 0x2f,
-	0xe2, 0xa5, 0xd7, 0x5e, 0x18, 0xc3, 0x27, 0x31, 0x9d, 0x97, 0xc2, 0x0a, 0xa4, 0xe1, 0x6a, 0xf7,
-	0x3c, 0xcf, 0x6f, 0x67, 0xce, 0xce, 0x73, 0x76, 0xe1, 0x5d, 0x3f, 0x51, 0x83, 0xbc, 0xe7, 0x47,
-	0x7c, 0x18, 0x1c, 0x0d, 0xf0, 0x68, 0x90, 0xb0, 0xbe, 0x3c, 0x40, 0x75, 0xc6, 0xc5, 0x69, 0xa0,
-	0x14, 0x0b, 0x68, 0x96, 0x04, 0xcc, 0xd4, 0x12, 0xc5, 0x08, 0x45, 0xb1, 0xf2, 0x33, 0xc1, 0x15,
-	0x27, 0xd5, 0x82, 0x58, 0x7f, 0x75, 0x65, 0xd5, 0x3e, 0xef, 0xf3, 0x40, 0x53, 0xbd, 0xfc, 0x44,
-	0x57, 0xba, 0xd0, 0x77, 0xe6, 0xe9, 0xfa, 0x92, 0xdb, 0x88, 0x66, 0x89, 0x95, 0x9e, 0x3a, 0x49,
-	0x97, 0x11, 0x4f, 0x83, 0x94, 0x0b, 0x7a, 0x46, 0x59, 0x10, 0xe3, 0x28, 0x89, 0xd0, 0x62, 0x8f,
-	0x1c, 0xd6, 0x13, 0xfc, 0x14, 0x85, 0xbd, 0x58, 0x73, 0xd5, 0x99, 0x03, 0xca, 0xe2, 0x14, 0x85,
-	0xbb, 0x1a, 0xbb, 0xf9, 0x15, 0xee, 0x75, 0xf4, 0x5a, 0x32, 0xc4, 0x2f, 0x39, 0x4a, 0x45, 0x3e,
-	0x40, 0x39, 0xc6, 0xd1, 0x31, 0x8d, 0x63, 0x51, 0xf3, 0xd6, 0xbc, 0xd6, 0xc2, 0xce, 0x9b, 0x5f,
-	0xbf, 0x9f, 0xb4, 0xa7, 0x1d, 0x51, 0xc4, 0x05, 0x06, 0xea, 0x3c, 0x43, 0xe9, 0x77, 0x70, 0xb4,
-	0x1d, 0xc7, 0x22, 0x9c, 0x8b, 0xcd, 0x0d, 0x59, 0x86, 0xff, 0x4f, 0x8e, 0x23, 0xa6, 0x6a, 0x33,
-	0x6b, 0x5e, 0xab, 0x1a, 0xfe, 0x77, 0xb2, 0xcb, 0x54, 0x73, 0x13, 0x16, 0x27, 0x3b, 0xcb, 0x8c,
-	0x33, 0x89, 0xe4, 0x39, 0xcc, 0x09, 0x94, 0x79, 0xaa, 0x64, 0xcd, 0x5b, 0x9b, 0x6d, 0x55, 0xda,
-	0x8b, 0xbe, 0x7d, 0x61, 0xdf, 0xa0, 0xa1, 0xf3, 0x9b, 0x8b, 0x50, 0x3d, 0x54, 0x54, 0xe5, 0xae,
-	0xed, 0xe6, 0xb7, 0x19, 0x28, 0x19, 0x85, 0xb4, 0xa0, 0x24, 0xcf, 0xa5, 0xc2, 0xa1, 0xee, 0xbf,
-	0xd2, 0xbe, 0xef, 0x8f, 0x8f, 0xf4, 0x50, 0x4b, 0x63, 0x44, 0x86, 0xd6, 0x27, 0x1b, 0x30, 0x1f,
-	0xf1, 0x61, 0xc6, 0x19, 0xda, 0xe6, 0x2a, 0xed, 0x65, 0x0d, 0xef, 0x3a, 0xd5, 0xf0, 0x97, 0x14,
-	0x69, 0x42, 0x29, 0xcf, 0xd2, 0x84, 0x9d, 0xd6, 0x2a, 0x9a, 0x07, 0xcd, 0x87, 0x54, 0xa1, 0x0c,
-	0xad, 0x43, 0x9e, 0x41, 0x39, 0xe6, 0x67, 0x4c, 0x53, 0x0b, 0xd7, 0xa8, 0x89, 0x47, 0x5e, 0x42,
-	0x85, 0x46, 0x2a, 0x19, 0x51, 0x95, 0x70, 0x26, 0x6b, 0xd5, 0x6b, 0xe8, 0x55, 0x9b, 0x6c, 0xc1,
-	0xb2, 0x89, 0x5d, 0x1e, 0x67, 0x28, 0x74, 0x40, 0x28, 0x65, 0x6d, 0xe5, 0xca, 0x3b, 0x76, 0x51,
-	0x44, 0xc8, 0x54, 0x92, 0xa2, 0x0c, 0x97, 0x2c, 0xdc, 0x45, 0xb1, 0x6d, 0xd0, 0xf6, 0xf7, 0x59,
-	0xa8, 0xda, 0xcc, 0x0e, 0xf5, 0x8c, 0x92, 0xf7, 0x00, 0x7b, 0xa8, 0x6c, 0x0e, 0x64, 0xd5, 0x2f,
-	0x8e, 0x75, 0x71, 0x32, 0xea, 0x8d, 0xdb, 0x6c, 0x1b, 0xdf, 0x10, 0x96, 0xba, 0x02, 0x33, 0x2a,
-	0x70, 0x7b, 0xd2, 0x36, 0x79, 0xe1, 0xdb, 0x71, 0xec, 0x60, 0x3c, 0x3e, 0x9e, 0x88, 0x2a, 0x8c,
-	0xcd, 0x93, 0x97, 0x94, 0xdb, 0xe1, 0x2e, 0x30, 0xe9, 0x42, 0xd9, 0x8a, 0x48, 0xd6, 0x7d, 0x37,
-	0xd6, 0xd7, 0x69, 0xd3, 0x5d, 0x7d, 0x3a, 0x42, 0x0e, 0xa0, 0xf4, 0xd1, 0x24, 0xb8, 0x7e, 0x53,
-	0x23, 0xc6, 0xdb, 0x47, 0x29, 0x69, 0x7f, 0xbc, 0xde, 0x34, 0x84, 0x6c, 0x42, 0xb9, 0xe3, 0xb2,
-	0x7e, 0x38, 0xc1, 0xad, 0xe2, 0xd6, 0xb9, 0xcd, 0x68, 0x7f, 0x82, 0x07, 0x85, 0xb0, 0xf6, 0x29,
-	0xa3, 0x7d, 0x14, 0x64, 0x0b, 0xe6, 0xf7, 0x50, 0xd9, 0x59, 0x7f, 0xfc, 0x4f, 0x26, 0x85, 0x8f,
-	0xa2, 0xbe, 0x72, 0xa3, 0xbb, 0xf3, 0xf6, 0xc7, 0x45, 0xc3, 0xfb, 0x79, 0xd1, 0xf0, 0xfe, 0x5c,
-	0x34, 0xbc, 0xcf, 0x1b, 0x77, 0xfe, 0xfb, 0xf5, 0x4a, 0xfa, 0xe7, 0xf1, 0xfa, 0x6f, 0x00, 0x00,
-	0x00, 0xff, 0xff, 0x4f, 0x28, 0xd8, 0x5e, 0x39, 0x05, 0x00, 0x00,
+	// 623 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x94, 0x4d, 0x4f, 0x13, 0x41,
+	0x18, 0xc7, 0xb3, 0xa0, 0xa5, 0x3c, 0xa5, 0x16, 0x06, 0x89, 0x9b, 0x2a, 0xb5, 0x34, 0xd1, 0x94,
+	0xa8, 0xbb, 0xa1, 0x26, 0x9e, 0x48, 0xe4, 0xa5, 0x86, 0x18, 0x03, 0xa9, 0x0b, 0x26, 0xc6, 0x4b,
+	0x33, 0xdd, 0x7d, 0x68, 0x37, 0x6c, 0x67, 0xd6, 0x99, 0xd9, 0x12, 0x3e, 0x8e, 0xf1, 0xe8, 0x17,
+	0xf1, 0xe8, 0xd9, 0x83, 0x31, 0x7c, 0x12, 0xc3, 0xcc, 0x6c, 0xa1, 0x02, 0x69, 0x38, 0xed, 0x3e,
+	0xff, 0xff, 0x6f, 0x67, 0xe7, 0x79, 0x99, 0x81, 0x77, 0xfd, 0x58, 0x0d, 0xb2, 0x9e, 0x17, 0xf2,
+	0xa1, 0x7f, 0x34, 0xc0, 0xa3, 0x41, 0xcc, 0xfa, 0xf2, 0x00, 0xd5, 0x29, 0x17, 0x27, 0xbe, 0x52,
+	0xcc, 0xa7, 0x69, 0xec, 0x33, 0x13, 0x4b, 0x14, 0x23, 0x14, 0x93, 0x91, 0x97, 0x0a, 0xae, 0x38,
+	0x29, 0x4f, 0x88, 0xd5, 0x57, 0x57, 0x56, 0xed, 0xf3, 0x3e, 0xf7, 0x35, 0xd5, 0xcb, 0x8e, 0x75,
+	0xa4, 0x03, 0xfd, 0x66, 0xbe, 0xae, 0x2e, 0xe5, 0x3f, 0xa2, 0x69, 0x6c, 0xa5, 0x67, 0xb9, 0xa4,
+	0xc3, 0x90, 0x27, 0x7e, 0xc2, 0x05, 0x3d, 0xa5, 0xcc, 0x8f, 0x70, 0x14, 0x87, 0x68, 0xb1, 0xc7,
+	0x39, 0xd6, 0x13, 0xfc, 0x04, 0x85, 0x7d, 0x58, 0x73, 0x35, 0x37, 0x07, 0x94, 0x45, 0x09, 0x8a,
+	0xfc, 0x69, 0xec, 0xc6, 0x77, 0x07, 0x1e, 0xb4, 0xf5, 0x62, 0x32, 0xc0, 0xaf, 0x19, 0x4a, 0x45,
+	0x3e, 0x42, 0x31, 0xc2, 0x51, 0x97, 0x46, 0x91, 0x70, 0x9d, 0xba, 0xd3, 0x5c, 0xd8, 0x79, 0xf3,
+	0xfb, 0xcf, 0xd3, 0xd6, 0xb4, 0x1a, 0x85, 0x5c, 0xa0, 0xaf, 0xce, 0x52, 0x94, 0x5e, 0x1b, 0x47,
+	0xdb, 0x51, 0x24, 0x82, 0xb9, 0xc8, 0xbc, 0x90, 0x65, 0xb8, 0x7f, 0xdc, 0x0d, 0x99, 0x72, 0x67,
+	0xea, 0x4e, 0xb3, 0x1c, 0xdc, 0x3b, 0xde, 0x65, 0x8a, 0xac, 0xc3, 0x62, 0xcc, 0xc2, 0x24, 0x8b,
+	0xb0, 0x1b, 0x33, 0x1a, 0xaa, 0x78, 0x84, 0xee, 0x6c, 0xdd, 0x69, 0x16, 0x83, 0x8a, 0xd5, 0xdf,
+	0x5b, 0xb9, 0xb1, 0x09, 0x95, 0xf1, 0x26, 0x65, 0xca, 0x99, 0x44, 0xb2, 0x0e, 0x73, 0x02, 0x65,
+	0x96, 0x28, 0xe9, 0x3a, 0xf5, 0xd9, 0x66, 0xa9, 0x55, 0xf1, 0x6c, 0x71, 0x3c, 0x83, 0x06, 0xb9,
+	0xdf, 0xa8, 0x40, 0xf9, 0x50, 0x51, 0x95, 0xe5, 0x19, 0x36, 0xbe, 0xcd, 0x40, 0xc1, 0x28, 0xa4,
+	0x09, 0x05, 0x79, 0x26, 0x15, 0x0e, 0x75, 0xaa, 0xa5, 0xd6, 0xa2, 0x77, 0x51, 0xfe, 0x43, 0x2d,
+	0x5d, 0x20, 0x32, 0xb0, 0x3e, 0xd9, 0x80, 0xf9, 0x90, 0x0f, 0x53, 0xce, 0xd0, 0xe6, 0x51, 0x6a,
+	0x2d, 0x6b, 0x78, 0x37, 0x57, 0x0d, 0x7f, 0x49, 0x91, 0x06, 0x14, 0xb2, 0x34, 0x89, 0xd9, 0x89,
+	0x5b, 0xd2, 0x3c, 0x68, 0x3e, 0xa0, 0x0a, 0x65, 0x60, 0x1d, 0xf2, 0x1c, 0x8a, 0x11, 0x3f, 0x65,
+	0x9a, 0x5a, 0xb8, 0x46, 0x8d, 0x3d, 0xf2, 0x12, 0x4a, 0xba, 0x18, 0x54, 0xc5, 0x9c, 0x49, 0xb7,
+	0x7c, 0x0d, 0xbd, 0x6a, 0x93, 0x2d, 0x58, 0x36, 0x23, 0x22, 0xbb, 0x29, 0x0a, 0xdd, 0x4b, 0x94,
+	0xd2, 0x5d, 0xb9, 0x92, 0x63, 0x07, 0x45, 0x88, 0x4c, 0xc5, 0x09, 0xca, 0x60, 0xc9, 0xc2, 0x1d,
+	0x14, 0xdb, 0x06, 0x6d, 0xfd, 0x98, 0x85, 0xb2, 0x6d, 0xef, 0xa1, 0x9e, 0x67, 0xf2, 0x01, 0x60,
+	0x0f, 0x95, 0xed, 0x03, 0x59, 0xf5, 0x26, 0x8f, 0xc0, 0xe4, 0x10, 0x55, 0x6b, 0xb7, 0xd9, 0xb6,
+	0x7d, 0x43, 0x58, 0xea, 0x08, 0x4c, 0xa9, 0xc0, 0xed, 0xf1, 0xb6, 0xc9, 0x0b, 0xcf, 0x8e, 0x6e,
+	0x1b, 0xa3, 0x8b, 0xf2, 0x84, 0x54, 0x61, 0x64, 0xbe, 0xbc, 0xa4, 0xf2, 0x3f, 0xdc, 0x05, 0x26,
+	0x1d, 0x28, 0x5a, 0x11, 0xc9, 0x9a, 0x97, 0x1f, 0x81, 0xeb, 0xb4, 0xd9, 0x5d, 0x75, 0x3a, 0x42,
+	0x0e, 0xa0, 0xf0, 0xc9, 0x74, 0x70, 0xed, 0xa6, 0x8d, 0x18, 0x6f, 0x1f, 0xa5, 0xa4, 0x7d, 0xac,
+	0x4e, 0x47, 0xc8, 0x26, 0x14, 0xdb, 0x79, 0xaf, 0x1f, 0x8d, 0x71, 0xab, 0xe4, 0xeb, 0xdc, 0x66,
+	0xb4, 0x3e, 0xc3, 0xc3, 0x89, 0x66, 0xed, 0x53, 0x46, 0xfb, 0x28, 0xc8, 0x16, 0xcc, 0xef, 0xa1,
+	0xb2, 0xb3, 0xfe, 0xe4, 0xbf, 0x9e, 0x4c, 0x1c, 0x8a, 0xea, 0xca, 0x8d, 0xee, 0xce, 0xdb, 0x9f,
+	0xe7, 0x35, 0xe7, 0xd7, 0x79, 0xcd, 0xf9, 0x7b, 0x5e, 0x73, 0xbe, 0x6c, 0xdc, 0xf9, 0xa6, 0xec,
+	0x15, 0xf4, 0x45, 0xf3, 0xfa, 0xdf, 0x00, 0xd1, 0x8a, 0xbe, 0x20, 0x65, 0x05, 0x00, 0x00,
 }
@@ -84,6 +84,10 @@ type Device struct {
 	ActivationConstraints string `protobuf:"bytes,13,opt,name=activation_constraints,json=activationConstraints,proto3" json:"activation_constraints,omitempty"`
 	// When the device was last seen (Unix nanoseconds)
 	LastSeen int64 `protobuf:"varint,21,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"`
+	// The SecurityPosture of the device (secure, fcnt-check-disabled or no-session), only set by the NetworkServer in the results of GetDevices.
+	SecurityPosture string `protobuf:"bytes,22,opt,name=security_posture,json=securityPosture,proto3" json:"security_posture,omitempty"`
+	// The LoRaWANVersion that the device implements (1.0 or 1.1), empty for LoRaWAN 1.0.
+	LorawanVersion string `protobuf:"bytes,23,opt,name=lorawan_version,json=lorawanVersion,proto3" json:"lorawan_version,omitempty"`
 }
 
 func (m *Device) Reset()                    { *m = Device{} }
@@ -147,6 +151,20 @@ func (m *Device) GetLastSeen() int64 {
 	return 0
 }
 
+func (m *Device) GetSecurityPosture() string {
+	if m != nil {
+		return m.SecurityPosture
+	}
+	return ""
+}
+
+func (m *Device) GetLorawanVersion() string {
+	if m != nil {
+		return m.LorawanVersion
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*DeviceIdentifier)(nil), "lorawan.DeviceIdentifier")
 	proto.RegisterType((*Device)(nil), "lorawan.Device")
@@ -458,6 +476,22 @@ func (m *Device) MarshalTo(dAtA []byte) (int, error) {
 		i++
 		i = encodeVarintDevice(dAtA, i, uint64(m.LastSeen))
 	}
+	if len(m.SecurityPosture) > 0 {
+		dAtA[i] = 0xb2
+		i++
+		dAtA[i] = 0x1
+		i++
+		i = encodeVarintDevice(dAtA, i, uint64(len(m.SecurityPosture)))
+		i += copy(dAtA[i:], m.SecurityPosture)
+	}
+	if len(m.LorawanVersion) > 0 {
+		dAtA[i] = 0xba
+		i++
+		dAtA[i] = 0x1
+		i++
+		i = encodeVarintDevice(dAtA, i, uint64(len(m.LorawanVersion)))
+		i += copy(dAtA[i:], m.LorawanVersion)
+	}
 	return i, nil
 }
 
@@ -556,6 +590,14 @@ func (m *Device) Size() (n int) {
 	if m.LastSeen != 0 {
 		n += 2 + sovDevice(uint64(m.LastSeen))
 	}
+	l = len(m.SecurityPosture)
+	if l > 0 {
+		n += 2 + l + sovDevice(uint64(l))
+	}
+	l = len(m.LorawanVersion)
+	if l > 0 {
+		n += 2 + l + sovDevice(uint64(l))
+	}
 	return n
 }
 
@@ -1091,6 +1133,64 @@ func (m *Device) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 22:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SecurityPosture", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDevice
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDevice
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.SecurityPosture = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 23:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LorawanVersion", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDevice
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDevice
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.LorawanVersion = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDevice(dAtA[iNdEx:])
@@ -1222,42 +1322,44 @@ func init() {
 }
 
 var fileDescriptorDevice = []byte{
-	// 579 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xcc, 0x94, 0x4f, 0x6f, 0xd3, 0x3e,
-	0x18, 0xc7, 0x95, 0xdf, 0x7e, 0x6b, 0x13, 0xb3, 0x8a, 0xc9, 0x68, 0x93, 0xe9, 0xd0, 0x56, 0xed,
-	0x42, 0x2f, 0x4b, 0xc4, 0xfe, 0xc0, 0xb9, 0xff, 0x40, 0x15, 0x62, 0x12, 0xd9, 0x76, 0xe1, 0x12,
-	0xb9, 0xf1, 0xd3, 0xd4, 0x6a, 0x66, 0x5b, 0x89, 0x93, 0xa8, 0x2f, 0x80, 0x37, 0xc4, 0x3b, 0xe0,
-	0xc6, 0x91, 0xf3, 0x0e, 0x13, 0xda, 0x2b, 0x41, 0x8e, 0x3b, 0x86, 0x2a, 0xa1, 0x89, 0x9e, 0xb8,
-	0x3d, 0xf9, 0x7e, 0xbf, 0xfe, 0x3c, 0x76, 0x5d, 0x3f, 0xa8, 0x97, 0x70, 0x3d, 0x2b, 0x26, 0x7e,
-	0x2c, 0xaf, 0x83, 0xcb, 0x19, 0x5c, 0xce, 0xb8, 0x48, 0xf2, 0x73, 0xd0, 0x95, 0xcc, 0xe6, 0x81,
-	0xd6, 0x22, 0xa0, 0x8a, 0x07, 0x2a, 0x93, 0x5a, 0xc6, 0x32, 0x0d, 0x52, 0x99, 0xd1, 0x8a, 0x8a,
-	0x80, 0x41, 0xc9, 0x63, 0xf0, 0x6b, 0x1d, 0x37, 0x97, 0x6a, 0x7b, 0x2f, 0x91, 0x32, 0x49, 0xc1,
-	0xc6, 0x27, 0xc5, 0x34, 0x80, 0x6b, 0xa5, 0x17, 0x36, 0xd5, 0x3e, 0xfa, 0xad, 0x51, 0x22, 0x13,
-	0xf9, 0x90, 0x32, 0x5f, 0xf5, 0x47, 0x5d, 0xd9, 0xf8, 0xe1, 0x17, 0x07, 0x6d, 0x0f, 0xeb, 0x2e,
-	0x63, 0x06, 0x42, 0xf3, 0x29, 0x87, 0x0c, 0x9f, 0xa3, 0x26, 0x55, 0x2a, 0x82, 0x82, 0x13, 0xa7,
-	0xe3, 0x74, 0xb7, 0xfa, 0x67, 0x37, 0xb7, 0x07, 0xaf, 0x1e, 0x3b, 0x41, 0x2c, 0x33, 0x08, 0xf4,
-	0x42, 0x41, 0xee, 0xf7, 0x94, 0x1a, 0x5d, 0x8d, 0xc3, 0x06, 0x55, 0x6a, 0x54, 0x70, 0xc3, 0x63,
-	0x50, 0xd6, 0xbc, 0xff, 0xd6, 0xe2, 0x0d, 0xa1, 0xac, 0x79, 0x0c, 0xca, 0x51, 0xc1, 0x0f, 0x3f,
-	0x37, 0x50, 0xc3, 0x6e, 0xfa, 0x5f, 0xdf, 0x2a, 0xde, 0x41, 0x86, 0x1c, 0x71, 0x46, 0x36, 0x3a,
-	0x4e, 0xd7, 0x0b, 0x37, 0xa9, 0x52, 0x63, 0x66, 0x64, 0xd3, 0x86, 0x33, 0xf2, 0xbf, 0x95, 0x19,
-	0x94, 0x63, 0x86, 0x3f, 0x22, 0xd7, 0xc8, 0x94, 0xb1, 0x8c, 0x6c, 0xd6, 0xed, 0x5f, 0xdf, 0xdc,
-	0x1e, 0x1c, 0xff, 0x5d, 0xfb, 0x1e, 0x63, 0x59, 0x68, 0x4e, 0x61, 0x0a, 0x1c, 0x22, 0x4f, 0x54,
-	0xf3, 0x28, 0x8f, 0xe6, 0xb0, 0x20, 0x8d, 0xb5, 0x98, 0xe7, 0xd5, 0xfc, 0xe2, 0x3d, 0x2c, 0xc2,
-	0xa6, 0xb0, 0x85, 0x61, 0x9a, 0x43, 0x59, 0x66, 0x73, 0x2d, 0x66, 0x4f, 0x29, 0xcb, 0xa4, 0xb6,
-	0xb8, 0xbf, 0x48, 0x43, 0x74, 0xd7, 0xbd, 0x48, 0x03, 0x34, 0x3f, 0xb7, 0xe1, 0x11, 0xe4, 0x4e,
-	0xa3, 0x58, 0xe8, 0xa8, 0x50, 0xc4, 0xeb, 0x38, 0xdd, 0x56, 0xd8, 0x98, 0x0e, 0x84, 0xbe, 0x52,
-	0xf8, 0x05, 0x42, 0xd6, 0x61, 0xb2, 0x12, 0x04, 0xd5, 0x9e, 0x6b, 0xbc, 0xa1, 0xac, 0x04, 0x3e,
-	0x42, 0xcf, 0x18, 0xcf, 0xe9, 0x24, 0x85, 0xc8, 0xa6, 0xe2, 0x19, 0xc4, 0x73, 0xf2, 0xa4, 0xe3,
-	0x74, 0xdd, 0x70, 0x7b, 0x69, 0xbd, 0x1d, 0x08, 0x3d, 0x30, 0x3a, 0x7e, 0x89, 0xb6, 0x8b, 0x1c,
-	0xf2, 0x93, 0xe3, 0x68, 0xc2, 0xb5, 0x5d, 0x41, 0xb6, 0xea, 0x6c, 0xcb, 0xea, 0x7d, 0xae, 0x4d,
-	0x1a, 0x9f, 0xa1, 0x5d, 0x1a, 0x6b, 0x5e, 0x52, 0xcd, 0xa5, 0x88, 0x62, 0x29, 0x72, 0x9d, 0x51,
-	0x2e, 0x74, 0x4e, 0x5a, 0xf5, 0x3f, 0x60, 0xe7, 0xc1, 0x1d, 0x3c, 0x98, 0x78, 0x0f, 0x79, 0x29,
-	0xcd, 0x75, 0x94, 0x03, 0x08, 0xb2, 0xd3, 0x71, 0xba, 0x1b, 0xa1, 0x6b, 0x84, 0x0b, 0x00, 0x71,
-	0xfc, 0xd5, 0x41, 0x2d, 0xfb, 0x0e, 0x3e, 0x50, 0x41, 0x13, 0xc8, 0xf0, 0x1b, 0xe4, 0xbd, 0x03,
-	0xbd, 0x7c, 0x1b, 0xcf, 0xfd, 0xe5, 0xc4, 0xf0, 0x57, 0x5f, 0x78, 0xfb, 0xe9, 0x8a, 0x85, 0x4f,
-	0x91, 0x77, 0xf1, 0x6b, 0xe1, 0xaa, 0xdb, 0xde, 0xf5, 0xed, 0xc8, 0xf1, 0xef, 0x87, 0x89, 0x3f,
-	0x32, 0x23, 0x07, 0xf7, 0xd0, 0xd6, 0x10, 0x52, 0xd0, 0xf0, 0x78, 0xc7, 0x3f, 0x20, 0xfa, 0xfd,
-	0x6f, 0x77, 0xfb, 0xce, 0xf7, 0xbb, 0x7d, 0xe7, 0xc7, 0xdd, 0xbe, 0xf3, 0xe9, 0x74, 0x9d, 0x31,
-	0x39, 0x69, 0xd4, 0xca, 0xc9, 0xcf, 0x00, 0x00, 0x00, 0xff, 0xff, 0x75, 0x3e, 0x90, 0x84, 0x65,
-	0x05, 0x00, 0x00,
+	// 615 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xcc, 0x94, 0xcb, 0x6e, 0x13, 0x31,
+	0x14, 0x86, 0x35, 0x94, 0xe6, 0x62, 0x1a, 0x1a, 0x19, 0xb5, 0x98, 0x14, 0xb5, 0x51, 0x37, 0x0d,
+	0x8b, 0xce, 0x88, 0x5e, 0x60, 0x9d, 0x1b, 0x28, 0x42, 0x54, 0x30, 0x6d, 0x59, 0xb0, 0x19, 0x39,
+	0xe3, 0x93, 0x89, 0x95, 0xd4, 0xb6, 0x66, 0x3c, 0x13, 0xe5, 0xb5, 0x78, 0x03, 0x76, 0x2c, 0xd9,
+	0xd2, 0x45, 0x85, 0xfa, 0x24, 0xc8, 0x76, 0x4a, 0x51, 0x25, 0x54, 0x91, 0x15, 0xbb, 0x33, 0xff,
+	0xff, 0xfb, 0x3b, 0x76, 0x1c, 0x1f, 0xd4, 0x4e, 0xb8, 0x1e, 0xe7, 0x43, 0x3f, 0x96, 0x17, 0xc1,
+	0xd9, 0x18, 0xce, 0xc6, 0x5c, 0x24, 0xd9, 0x09, 0xe8, 0x99, 0x4c, 0x27, 0x81, 0xd6, 0x22, 0xa0,
+	0x8a, 0x07, 0x2a, 0x95, 0x5a, 0xc6, 0x72, 0x1a, 0x4c, 0x65, 0x4a, 0x67, 0x54, 0x04, 0x0c, 0x0a,
+	0x1e, 0x83, 0x6f, 0x75, 0x5c, 0x5e, 0xa8, 0x8d, 0xad, 0x44, 0xca, 0x64, 0x0a, 0x2e, 0x3e, 0xcc,
+	0x47, 0x01, 0x5c, 0x28, 0x3d, 0x77, 0xa9, 0xc6, 0xfe, 0x1f, 0x8d, 0x12, 0x99, 0xc8, 0xdb, 0x94,
+	0xf9, 0xb2, 0x1f, 0xb6, 0x72, 0xf1, 0xdd, 0x2f, 0x1e, 0xaa, 0xf7, 0x6c, 0x97, 0x01, 0x03, 0xa1,
+	0xf9, 0x88, 0x43, 0x8a, 0x4f, 0x50, 0x99, 0x2a, 0x15, 0x41, 0xce, 0x89, 0xd7, 0xf4, 0x5a, 0x6b,
+	0x9d, 0xe3, 0xcb, 0xab, 0x9d, 0x97, 0xf7, 0x9d, 0x20, 0x96, 0x29, 0x04, 0x7a, 0xae, 0x20, 0xf3,
+	0xdb, 0x4a, 0xf5, 0xcf, 0x07, 0x61, 0x89, 0x2a, 0xd5, 0xcf, 0xb9, 0xe1, 0x31, 0x28, 0x2c, 0xef,
+	0xc1, 0x52, 0xbc, 0x1e, 0x14, 0x96, 0xc7, 0xa0, 0xe8, 0xe7, 0x7c, 0xf7, 0x47, 0x09, 0x95, 0xdc,
+	0xa6, 0xff, 0xf7, 0xad, 0xe2, 0x0d, 0x64, 0xc8, 0x11, 0x67, 0x64, 0xa5, 0xe9, 0xb5, 0xaa, 0xe1,
+	0x2a, 0x55, 0x6a, 0xc0, 0x8c, 0x6c, 0xda, 0x70, 0x46, 0x1e, 0x3a, 0x99, 0x41, 0x31, 0x60, 0xf8,
+	0x23, 0xaa, 0x18, 0x99, 0x32, 0x96, 0x92, 0x55, 0xdb, 0xfe, 0xd5, 0xe5, 0xd5, 0xce, 0xc1, 0xbf,
+	0xb5, 0x6f, 0x33, 0x96, 0x86, 0x65, 0xe6, 0x0a, 0x1c, 0xa2, 0xaa, 0x98, 0x4d, 0xa2, 0x2c, 0x9a,
+	0xc0, 0x9c, 0x94, 0x96, 0x62, 0x9e, 0xcc, 0x26, 0xa7, 0xef, 0x60, 0x1e, 0x96, 0x85, 0x2b, 0x0c,
+	0xd3, 0x1c, 0xca, 0x31, 0xcb, 0x4b, 0x31, 0xdb, 0x4a, 0x39, 0x26, 0x75, 0xc5, 0xcd, 0x45, 0x1a,
+	0x62, 0x65, 0xd9, 0x8b, 0x34, 0x40, 0xf3, 0x73, 0x1b, 0x1e, 0x41, 0x95, 0x51, 0x14, 0x0b, 0x1d,
+	0xe5, 0x8a, 0x54, 0x9b, 0x5e, 0xab, 0x16, 0x96, 0x46, 0x5d, 0xa1, 0xcf, 0x15, 0x7e, 0x8e, 0x90,
+	0x73, 0x98, 0x9c, 0x09, 0x82, 0xac, 0x57, 0x31, 0x5e, 0x4f, 0xce, 0x04, 0xde, 0x47, 0x4f, 0x18,
+	0xcf, 0xe8, 0x70, 0x0a, 0x91, 0x4b, 0xc5, 0x63, 0x88, 0x27, 0xe4, 0x51, 0xd3, 0x6b, 0x55, 0xc2,
+	0xfa, 0xc2, 0x7a, 0xd3, 0x15, 0xba, 0x6b, 0x74, 0xbc, 0x87, 0xea, 0x79, 0x06, 0xd9, 0xe1, 0x41,
+	0x34, 0xe4, 0xda, 0xad, 0x20, 0x6b, 0x36, 0x5b, 0x73, 0x7a, 0x87, 0x6b, 0x93, 0xc6, 0xc7, 0x68,
+	0x93, 0xc6, 0x9a, 0x17, 0x54, 0x73, 0x29, 0xa2, 0x58, 0x8a, 0x4c, 0xa7, 0x94, 0x0b, 0x9d, 0x91,
+	0x9a, 0xfd, 0x07, 0x6c, 0xdc, 0xba, 0xdd, 0x5b, 0x13, 0x6f, 0xa1, 0xea, 0x94, 0x66, 0x3a, 0xca,
+	0x00, 0x04, 0xd9, 0x68, 0x7a, 0xad, 0x95, 0xb0, 0x62, 0x84, 0x53, 0x00, 0x81, 0x5f, 0xa0, 0x7a,
+	0x06, 0x71, 0x9e, 0x72, 0x3d, 0x8f, 0x94, 0xcc, 0x74, 0x9e, 0x02, 0xd9, 0xb4, 0xb4, 0xf5, 0x1b,
+	0xfd, 0x83, 0x93, 0xf1, 0x1e, 0x5a, 0x5f, 0x8c, 0x8f, 0xa8, 0x80, 0x34, 0xe3, 0x52, 0x90, 0xa7,
+	0x36, 0xf9, 0x78, 0x21, 0x7f, 0x72, 0xea, 0xc1, 0x57, 0x0f, 0xd5, 0xdc, 0xdb, 0x7a, 0x4f, 0x05,
+	0x4d, 0x20, 0xc5, 0xaf, 0x51, 0xf5, 0x2d, 0xe8, 0xc5, 0x7b, 0x7b, 0xe6, 0x2f, 0xf2, 0xfe, 0xdd,
+	0xa9, 0xd1, 0x58, 0xbf, 0x63, 0xe1, 0x23, 0x54, 0x3d, 0xfd, 0xbd, 0xf0, 0xae, 0xdb, 0xd8, 0xf4,
+	0xdd, 0x18, 0xf3, 0x6f, 0x06, 0x94, 0xdf, 0x37, 0x63, 0x0c, 0xb7, 0xd1, 0x5a, 0x0f, 0xa6, 0xa0,
+	0xe1, 0xfe, 0x8e, 0x7f, 0x41, 0x74, 0x3a, 0xdf, 0xae, 0xb7, 0xbd, 0xef, 0xd7, 0xdb, 0xde, 0xcf,
+	0xeb, 0x6d, 0xef, 0xf3, 0xd1, 0x32, 0xa3, 0x77, 0x58, 0xb2, 0xca, 0xe1, 0xaf, 0x01, 0x00, 0x5f,
+	0x69, 0x3b, 0xf8, 0xb9, 0x05, 0x00, 0x00,
 }
@@ -284,6 +284,8 @@ type ActivationMetadata struct {
 	RxDelay       uint32                                              `protobuf:"varint,13,opt,name=rx_delay,json=rxDelay,proto3" json:"rx_delay,omitempty"`
 	CfList        *CFList                                             `protobuf:"bytes,14,opt,name=cf_list,json=cfList" json:"cf_list,omitempty"`
 	FrequencyPlan FrequencyPlan                                       `protobuf:"varint,15,opt,name=frequency_plan,json=frequencyPlan,proto3,enum=lorawan.FrequencyPlan" json:"frequency_plan,omitempty"`
+	// DevAddrRequested is set by the NetworkServer if it requested the DevAddr from its DevAddr coordinator
+	DevAddrRequested bool `protobuf:"varint,16,opt,name=dev_addr_requested,json=devAddrRequested,proto3" json:"dev_addr_requested,omitempty"`
 }
 
 func (m *ActivationMetadata) Reset()                    { *m = ActivationMetadata{} }
@@ -326,6 +328,13 @@ func (m *ActivationMetadata) GetFrequencyPlan() FrequencyPlan {
 	return FrequencyPlan_EU_863_870
 }
 
+func (m *ActivationMetadata) GetDevAddrRequested() bool {
+	if m != nil {
+		return m.DevAddrRequested
+	}
+	return false
+}
+
 type Message struct {
 	MHDR `protobuf:"bytes,1,opt,name=m_hdr,json=mHdr,embedded=m_hdr" json:"m_hdr"`
 	Mic  []byte `protobuf:"bytes,2,opt,name=mic,proto3" json:"mic,omitempty"`
@@ -916,6 +925,18 @@ func (m *ActivationMetadata) MarshalTo(dAtA []byte) (int, error) {
 		i++
 		i = encodeVarintLorawan(dAtA, i, uint64(m.FrequencyPlan))
 	}
+	if m.DevAddrRequested {
+		dAtA[i] = 0x80
+		i++
+		dAtA[i] = 0x1
+		i++
+		if m.DevAddrRequested {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i++
+	}
 	return i, nil
 }
 
@@ -1490,6 +1511,9 @@ func (m *ActivationMetadata) Size() (n int) {
 	if m.FrequencyPlan != 0 {
 		n += 1 + sovLorawan(uint64(m.FrequencyPlan))
 	}
+	if m.DevAddrRequested {
+		n += 3
+	}
 	return n
 }
 
@@ -2302,6 +2326,26 @@ func (m *ActivationMetadata) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 16:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DevAddrRequested", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowLorawan
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.DevAddrRequested = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipLorawan(dAtA[iNdEx:])
@@ -3841,88 +3885,89 @@ func init() {
 }
 
 var fileDescriptorLorawan = []byte{
-	// 1327 bytes of a gzipped FileDescriptorProto
+	// 1339 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xcc, 0x57, 0xcb, 0x52, 0x1b, 0xc7,
-	0x1a, 0x66, 0xd0, 0x8c, 0x24, 0x7e, 0x21, 0x18, 0xb7, 0xed, 0x73, 0x74, 0x6c, 0x17, 0x50, 0xaa,
-	0x73, 0xaa, 0x28, 0xea, 0x84, 0x8b, 0x64, 0x0c, 0x24, 0x65, 0x57, 0xe9, 0x46, 0x8c, 0x0d, 0x12,
-	0x6e, 0x50, 0x39, 0x95, 0x4d, 0x57, 0x33, 0xd3, 0x03, 0x83, 0x34, 0x17, 0xb7, 0x9a, 0x8b, 0xf2,
-	0x20, 0x59, 0xe4, 0x05, 0xb2, 0xc8, 0x36, 0x8b, 0x3c, 0x82, 0x97, 0xde, 0x64, 0xe3, 0x05, 0x95,
-	0xf2, 0x3a, 0x0f, 0x91, 0xea, 0x9e, 0xd1, 0x15, 0xc7, 0x29, 0x70, 0x16, 0x59, 0xcd, 0x7f, 0xfd,
-	0xfa, 0xef, 0xfe, 0x6f, 0x12, 0x94, 0x8f, 0x5d, 0x71, 0x72, 0x76, 0xb4, 0x6c, 0x05, 0xde, 0xca,
-	0xe1, 0x09, 0x3b, 0x3c, 0x71, 0xfd, 0xe3, 0x4e, 0x9d, 0x89, 0x8b, 0x80, 0xb7, 0x56, 0x84, 0xf0,
-	0x57, 0x68, 0xe8, 0xae, 0x84, 0x3c, 0x10, 0x81, 0x15, 0xb4, 0x57, 0xda, 0x01, 0xa7, 0x17, 0xd4,
-	0xef, 0x7d, 0x97, 0x95, 0x02, 0xa5, 0x62, 0xf6, 0xc1, 0x17, 0x43, 0x60, 0xc7, 0xc1, 0x71, 0x10,
-	0x39, 0x1e, 0x9d, 0x39, 0x8a, 0x53, 0x8c, 0xa2, 0x22, 0xbf, 0xfc, 0xef, 0x1a, 0xa4, 0xf7, 0x98,
-	0xa0, 0x36, 0x15, 0x14, 0x15, 0x01, 0xbc, 0xc0, 0x3e, 0x6b, 0x53, 0xe1, 0x06, 0x7e, 0x2e, 0xb3,
-	0xa0, 0x2d, 0xce, 0x14, 0xee, 0x2e, 0xf7, 0x0e, 0xda, 0xeb, 0xab, 0xf0, 0x90, 0x19, 0x7a, 0x08,
-	0x53, 0xd2, 0x99, 0x70, 0x2a, 0x58, 0x6e, 0x7a, 0x41, 0x5b, 0x9c, 0xc2, 0x69, 0x29, 0xc0, 0x54,
-	0x30, 0xf4, 0x1f, 0x48, 0x1f, 0xb9, 0x22, 0xd2, 0x65, 0x17, 0xb4, 0xc5, 0x2c, 0x4e, 0x1d, 0xb9,
-	0x42, 0xa9, 0xe6, 0x21, 0x63, 0x05, 0xb6, 0xeb, 0x1f, 0x47, 0xda, 0x19, 0xe5, 0x09, 0x91, 0x48,
-	0x19, 0xdc, 0x05, 0xc3, 0x21, 0x96, 0x2f, 0x72, 0xb3, 0xca, 0x51, 0x77, 0x2a, 0xbe, 0x40, 0x4f,
-	0x61, 0xc6, 0xe1, 0xec, 0xcd, 0x19, 0xf3, 0xad, 0x2e, 0x09, 0xdb, 0xd4, 0xcf, 0x99, 0x2a, 0xcc,
-	0x7f, 0xf5, 0xc3, 0xdc, 0xee, 0xa9, 0xf7, 0xdb, 0xd4, 0xc7, 0x59, 0x67, 0x98, 0xcd, 0xff, 0xac,
-	0xc1, 0xec, 0xe1, 0x65, 0x25, 0xf0, 0x1d, 0xf7, 0xf8, 0x8c, 0x47, 0x17, 0xf8, 0xe7, 0xdf, 0x3a,
-	0xff, 0x83, 0x0e, 0xa8, 0x64, 0x09, 0xf7, 0x5c, 0x1d, 0xde, 0xcf, 0x57, 0x1d, 0x52, 0x34, 0x0c,
-	0x09, 0x3b, 0x73, 0x73, 0xda, 0x82, 0xb6, 0x38, 0x5d, 0x5e, 0x7f, 0x7f, 0x35, 0xbf, 0xf6, 0x57,
-	0xd5, 0x64, 0x05, 0x9c, 0xad, 0x88, 0x6e, 0xc8, 0x3a, 0xcb, 0xa5, 0x30, 0xac, 0x35, 0x77, 0x70,
-	0x92, 0x86, 0x61, 0xed, 0xcc, 0x95, 0x78, 0x36, 0x3b, 0x57, 0x78, 0x93, 0xb7, 0xc2, 0xab, 0xb2,
-	0x73, 0x85, 0x67, 0xb3, 0x73, 0x89, 0xf7, 0x0a, 0xd2, 0x12, 0x8f, 0xda, 0x36, 0xcf, 0x25, 0x14,
-	0xe0, 0x93, 0xf7, 0x57, 0xf3, 0x85, 0x9b, 0x01, 0x96, 0x6c, 0x9b, 0x63, 0x19, 0x97, 0x24, 0x10,
-	0x86, 0x29, 0xff, 0xa2, 0x45, 0x3a, 0xa4, 0xc5, 0xba, 0x39, 0xfd, 0x56, 0x98, 0xf5, 0x8b, 0xd6,
-	0xc1, 0x4b, 0xd6, 0xc5, 0x29, 0x3f, 0x22, 0x50, 0x1e, 0xb2, 0xfc, 0x72, 0x8d, 0xd8, 0x9c, 0x04,
-	0x8e, 0xd3, 0x61, 0x42, 0xd5, 0x40, 0x16, 0x67, 0xf8, 0xe5, 0x5a, 0x95, 0x37, 0x94, 0x08, 0xdd,
-	0x87, 0x24, 0xbf, 0x2c, 0x10, 0x9b, 0xab, 0x64, 0x67, 0xb1, 0xc1, 0x2f, 0x0b, 0x55, 0x2e, 0x33,
-	0xcd, 0x2f, 0x89, 0xcd, 0xda, 0xb4, 0xdb, 0xcb, 0x34, 0xbf, 0xac, 0x4a, 0x16, 0x2d, 0x42, 0xca,
-	0x72, 0x48, 0xdb, 0xed, 0x08, 0x95, 0xe5, 0x4c, 0x61, 0xb6, 0x5f, 0x53, 0x95, 0xed, 0x5d, 0xb7,
-	0x23, 0x70, 0xd2, 0x72, 0xe4, 0xf7, 0x23, 0x35, 0x3d, 0x7b, 0x93, 0x9a, 0xfe, 0x69, 0x12, 0x52,
-	0x7b, 0xac, 0xd3, 0xa1, 0xc7, 0x0c, 0xfd, 0x1f, 0x0c, 0x8f, 0x9c, 0xd8, 0x5c, 0xd5, 0x43, 0xa6,
-	0x90, 0x1d, 0x94, 0xf1, 0xf3, 0x2a, 0x2e, 0xa7, 0xdf, 0x5e, 0xcd, 0x4f, 0xbc, 0xbb, 0x9a, 0xd7,
-	0xb0, 0xee, 0x3d, 0xb7, 0x39, 0x32, 0x21, 0xe1, 0xb9, 0x56, 0x94, 0x6b, 0x2c, 0x49, 0xf4, 0x04,
-	0x32, 0x1e, 0xb5, 0x48, 0x48, 0xbb, 0xed, 0x80, 0xda, 0x2a, 0x69, 0x99, 0xe1, 0x66, 0x28, 0x55,
-	0xf6, 0x23, 0xd5, 0xf3, 0x09, 0x0c, 0x1e, 0xb5, 0x62, 0x0e, 0x35, 0xe0, 0xde, 0x69, 0xe0, 0xfa,
-	0x44, 0x05, 0xd6, 0x11, 0x7d, 0x00, 0x5d, 0x01, 0x3c, 0xec, 0x03, 0xbc, 0x08, 0x5c, 0x1f, 0x47,
-	0x36, 0x03, 0x20, 0x74, 0x7a, 0x4d, 0x8a, 0x76, 0xe1, 0xae, 0x02, 0xa4, 0x96, 0xc5, 0xc2, 0x01,
-	0x9e, 0xa1, 0xf0, 0x1e, 0x8c, 0xe0, 0x95, 0x94, 0xc9, 0x00, 0xee, 0xce, 0xe9, 0xb8, 0xb0, 0x3c,
-	0x05, 0xa9, 0x98, 0xcc, 0x1f, 0x80, 0x2e, 0xdf, 0x02, 0xfd, 0x0f, 0x92, 0x1e, 0x91, 0x05, 0xa1,
-	0x9e, 0x6a, 0xa6, 0x30, 0x33, 0xb8, 0xe4, 0x61, 0x37, 0x64, 0xd8, 0xf0, 0xe4, 0x07, 0xfd, 0x17,
-	0x0c, 0x8f, 0x9e, 0x06, 0x5c, 0x3d, 0xd2, 0x88, 0x95, 0x94, 0xe2, 0x48, 0x99, 0xe7, 0x00, 0x83,
-	0xa7, 0x91, 0x49, 0x70, 0x3e, 0x9a, 0x84, 0xed, 0xb1, 0x24, 0x38, 0x32, 0x09, 0xf7, 0x21, 0xe9,
-	0x90, 0x30, 0xe0, 0x42, 0x1d, 0x61, 0x60, 0xc3, 0xd9, 0x0f, 0xb8, 0x90, 0x83, 0xc2, 0xe1, 0xde,
-	0x48, 0x26, 0xa6, 0x31, 0x38, 0xdc, 0xeb, 0x5d, 0xe4, 0x57, 0x0d, 0x74, 0x09, 0x88, 0x9a, 0x43,
-	0x5d, 0x16, 0x8d, 0x81, 0x2f, 0xe5, 0x11, 0x9f, 0xdb, 0x69, 0x2b, 0x32, 0x2e, 0x4b, 0xf0, 0xb6,
-	0x8a, 0x2b, 0x33, 0x74, 0xf5, 0xed, 0x8a, 0xe0, 0xed, 0xa1, 0x7b, 0x18, 0x8e, 0x14, 0x0c, 0x26,
-	0x57, 0x62, 0x68, 0x5e, 0xaf, 0x4a, 0x94, 0x20, 0x14, 0x9d, 0x9c, 0xbe, 0x90, 0x18, 0xaf, 0xa5,
-	0x4a, 0xe0, 0x79, 0xd4, 0xb7, 0xcb, 0xba, 0x84, 0xc2, 0x86, 0xd3, 0x08, 0x45, 0x27, 0x7f, 0x02,
-	0x86, 0x3a, 0x40, 0x56, 0x27, 0x8d, 0xaf, 0x94, 0xc6, 0x92, 0x44, 0x73, 0x90, 0xa1, 0x36, 0x27,
-	0xd4, 0x6a, 0xc9, 0x42, 0x53, 0x71, 0xa5, 0xf1, 0x14, 0xb5, 0x79, 0xc9, 0x6a, 0x61, 0xf6, 0x46,
-	0x79, 0x58, 0x2d, 0x75, 0xbe, 0xf4, 0xb0, 0x5a, 0x72, 0x4c, 0x3b, 0x24, 0x64, 0xbe, 0x1c, 0xaf,
-	0xaa, 0x18, 0xd3, 0x38, 0xed, 0xec, 0x47, 0x7c, 0x7e, 0x53, 0x65, 0x2d, 0x0e, 0x42, 0x3a, 0x5b,
-	0xae, 0xad, 0x8e, 0xcb, 0x62, 0x49, 0xa2, 0x1c, 0xa4, 0x7a, 0xcf, 0x1f, 0xb5, 0x48, 0x8f, 0xcd,
-	0x7f, 0x3f, 0x09, 0xe8, 0x7a, 0x29, 0x23, 0x3c, 0x3e, 0x8f, 0xb7, 0xe2, 0x44, 0x7c, 0xc6, 0x4c,
-	0xc6, 0xe3, 0x33, 0xf9, 0x36, 0x98, 0x63, 0x73, 0xf9, 0x1b, 0x98, 0x92, 0x98, 0x7e, 0xe0, 0x5b,
-	0x2c, 0x1e, 0xcc, 0x5f, 0xc5, 0xa8, 0xc5, 0x9b, 0xa1, 0xd6, 0x25, 0x04, 0x96, 0xf5, 0xa7, 0xa8,
-	0xfc, 0x2f, 0x09, 0xb8, 0x73, 0xad, 0x27, 0xd1, 0x23, 0x98, 0x62, 0xbe, 0xc5, 0xbb, 0xa1, 0x60,
-	0xd1, 0x03, 0x4f, 0xe3, 0x81, 0x40, 0x46, 0x23, 0x5f, 0x2d, 0x8a, 0x66, 0xf2, 0xd6, 0xd1, 0x94,
-	0xc2, 0x30, 0x8e, 0x86, 0xc6, 0x14, 0x6a, 0x40, 0xd2, 0x67, 0x82, 0xb8, 0x71, 0xfb, 0x94, 0x37,
-	0x63, 0xd8, 0xd5, 0x9b, 0x6c, 0x0b, 0x26, 0x76, 0xaa, 0xd8, 0xf0, 0x99, 0xd8, 0xb1, 0x47, 0x5a,
-	0x4d, 0xff, 0xfb, 0x5a, 0xed, 0x19, 0x64, 0xec, 0x36, 0xe9, 0x30, 0x21, 0xa4, 0x57, 0x3c, 0xe4,
-	0x06, 0x9d, 0x52, 0xdd, 0x3d, 0x88, 0x55, 0x43, 0x4d, 0x07, 0x76, 0xbb, 0x27, 0x1d, 0xd9, 0x42,
-	0xc9, 0x3f, 0xdd, 0x42, 0xa9, 0x4f, 0x6e, 0xa1, 0xfc, 0xd7, 0x00, 0x83, 0x83, 0xae, 0xef, 0x44,
-	0xed, 0x53, 0x3b, 0x71, 0x72, 0x68, 0x27, 0xe6, 0x1f, 0x41, 0x32, 0x82, 0x46, 0x08, 0x74, 0xb9,
-	0xaa, 0x72, 0xda, 0x42, 0x42, 0x0d, 0x04, 0xce, 0xde, 0x2c, 0xcd, 0x03, 0x0c, 0x7e, 0x52, 0xa1,
-	0x34, 0xe8, 0xbb, 0x0d, 0x5c, 0x32, 0x27, 0x50, 0x0a, 0x12, 0xdb, 0x07, 0x2f, 0x4d, 0x6d, 0xe9,
-	0x47, 0x0d, 0xb2, 0x23, 0xfb, 0x0e, 0xcd, 0x00, 0xd4, 0x9a, 0x64, 0xf3, 0x49, 0x91, 0x6c, 0x6e,
-	0xac, 0x9a, 0x13, 0x92, 0x6f, 0x1e, 0x90, 0xad, 0xd5, 0x02, 0xd9, 0x2a, 0x6c, 0x9a, 0x9a, 0xe4,
-	0x2b, 0x75, 0xb2, 0xb1, 0xb1, 0x45, 0x36, 0x36, 0x37, 0xcc, 0x49, 0x04, 0x90, 0xac, 0x35, 0xc9,
-	0xe3, 0x62, 0xd1, 0x4c, 0x48, 0x5d, 0xa9, 0x49, 0xb6, 0xd6, 0xd6, 0x95, 0xad, 0x1e, 0xdb, 0x3e,
-	0xde, 0x58, 0x25, 0xeb, 0x6b, 0xab, 0xa6, 0x21, 0x6d, 0x4b, 0x07, 0x64, 0xab, 0x50, 0x34, 0x93,
-	0xca, 0x56, 0xd2, 0xab, 0x8a, 0x7f, 0xda, 0xe7, 0x8b, 0x64, 0xab, 0xb0, 0x6e, 0x3e, 0x93, 0xfc,
-	0x4b, 0xdc, 0xd7, 0xa7, 0x96, 0xfe, 0x0d, 0x86, 0xda, 0x02, 0x52, 0x21, 0x6f, 0xf1, 0xba, 0x54,
-	0x27, 0x78, 0xcd, 0x9c, 0x58, 0xfa, 0x0e, 0x0c, 0xb5, 0x44, 0x90, 0x09, 0xd3, 0x2f, 0x1a, 0x3b,
-	0x75, 0x82, 0x6b, 0xaf, 0x9a, 0xb5, 0x83, 0x43, 0x73, 0x02, 0xcd, 0x42, 0x46, 0x49, 0x4a, 0x95,
-	0x4a, 0x6d, 0xff, 0xd0, 0xd4, 0x10, 0x82, 0x99, 0x66, 0xbd, 0xd2, 0xa8, 0x6f, 0xef, 0xe0, 0xbd,
-	0x5a, 0x95, 0x34, 0xf7, 0xcd, 0x49, 0x74, 0x0f, 0xcc, 0x61, 0x59, 0xb5, 0xf1, 0xba, 0x6e, 0x26,
-	0x24, 0xd8, 0x88, 0x9d, 0x2e, 0x7d, 0xc7, 0xac, 0x8c, 0x72, 0xf9, 0xed, 0x87, 0x39, 0xed, 0xdd,
-	0x87, 0x39, 0xed, 0xb7, 0x0f, 0x73, 0xda, 0xb7, 0x8f, 0x6f, 0xf3, 0xd7, 0xe2, 0x28, 0xa9, 0x24,
-	0xc5, 0x3f, 0x02, 0x00, 0x00, 0xff, 0xff, 0x5c, 0xfb, 0x13, 0x90, 0x99, 0x0c, 0x00, 0x00,
+	0x1a, 0x66, 0xa4, 0x19, 0x49, 0xfc, 0x42, 0x30, 0x6e, 0xdb, 0xe7, 0xe8, 0xd8, 0x2e, 0xa0, 0x54,
+	0xe7, 0x54, 0x51, 0x94, 0x0f, 0x17, 0xc9, 0x18, 0x48, 0xca, 0xae, 0xd2, 0x8d, 0x18, 0x1b, 0x24,
+	0xdc, 0xa0, 0x72, 0x2a, 0x9b, 0xae, 0x66, 0xa6, 0x07, 0x06, 0x69, 0x2e, 0x6e, 0x35, 0x17, 0xe5,
+	0x41, 0xf2, 0x0a, 0x59, 0x64, 0x9b, 0x45, 0x1e, 0xc1, 0x4b, 0x6f, 0xb2, 0xf1, 0x82, 0x4a, 0x79,
+	0x9d, 0x87, 0x48, 0x75, 0xcf, 0xe8, 0x82, 0x70, 0x9c, 0x02, 0x67, 0x91, 0xd5, 0xfc, 0xd7, 0xaf,
+	0xff, 0xee, 0xff, 0x26, 0x41, 0xe5, 0xc8, 0x15, 0xc7, 0xa7, 0x87, 0x4b, 0x56, 0xe0, 0x2d, 0x1f,
+	0x1c, 0xb3, 0x83, 0x63, 0xd7, 0x3f, 0xea, 0x36, 0x98, 0x38, 0x0f, 0x78, 0x7b, 0x59, 0x08, 0x7f,
+	0x99, 0x86, 0xee, 0x72, 0xc8, 0x03, 0x11, 0x58, 0x41, 0x67, 0xb9, 0x13, 0x70, 0x7a, 0x4e, 0xfd,
+	0xfe, 0x77, 0x49, 0x29, 0x50, 0x3a, 0x66, 0x1f, 0xfc, 0x7f, 0x04, 0xec, 0x28, 0x38, 0x0a, 0x22,
+	0xc7, 0xc3, 0x53, 0x47, 0x71, 0x8a, 0x51, 0x54, 0xe4, 0x57, 0xf8, 0x5d, 0x83, 0xcc, 0x2e, 0x13,
+	0xd4, 0xa6, 0x82, 0xa2, 0x12, 0x80, 0x17, 0xd8, 0xa7, 0x1d, 0x2a, 0xdc, 0xc0, 0xcf, 0x67, 0xe7,
+	0xb5, 0x85, 0xe9, 0xe2, 0xdd, 0xa5, 0xfe, 0x41, 0xbb, 0x03, 0x15, 0x1e, 0x31, 0x43, 0x0f, 0x61,
+	0x52, 0x3a, 0x13, 0x4e, 0x05, 0xcb, 0x4f, 0xcd, 0x6b, 0x0b, 0x93, 0x38, 0x23, 0x05, 0x98, 0x0a,
+	0x86, 0xfe, 0x03, 0x99, 0x43, 0x57, 0x44, 0xba, 0xdc, 0xbc, 0xb6, 0x90, 0xc3, 0xe9, 0x43, 0x57,
+	0x28, 0xd5, 0x1c, 0x64, 0xad, 0xc0, 0x76, 0xfd, 0xa3, 0x48, 0x3b, 0xad, 0x3c, 0x21, 0x12, 0x29,
+	0x83, 0xbb, 0x60, 0x38, 0xc4, 0xf2, 0x45, 0x7e, 0x46, 0x39, 0xea, 0x4e, 0xd5, 0x17, 0xe8, 0x19,
+	0x4c, 0x3b, 0x9c, 0xbd, 0x3d, 0x65, 0xbe, 0xd5, 0x23, 0x61, 0x87, 0xfa, 0x79, 0x53, 0x85, 0xf9,
+	0xaf, 0x41, 0x98, 0x5b, 0x7d, 0xf5, 0x5e, 0x87, 0xfa, 0x38, 0xe7, 0x8c, 0xb2, 0x85, 0x9f, 0x35,
+	0x98, 0x39, 0xb8, 0xa8, 0x06, 0xbe, 0xe3, 0x1e, 0x9d, 0xf2, 0xe8, 0x02, 0xff, 0xfc, 0x5b, 0x17,
+	0xde, 0xe9, 0x80, 0xca, 0x96, 0x70, 0xcf, 0xd4, 0xe1, 0x83, 0x7c, 0x35, 0x20, 0x4d, 0xc3, 0x90,
+	0xb0, 0x53, 0x37, 0xaf, 0xcd, 0x6b, 0x0b, 0x53, 0x95, 0xb5, 0x0f, 0x97, 0x73, 0xab, 0x7f, 0x55,
+	0x4d, 0x56, 0xc0, 0xd9, 0xb2, 0xe8, 0x85, 0xac, 0xbb, 0x54, 0x0e, 0xc3, 0x7a, 0x6b, 0x1b, 0xa7,
+	0x68, 0x18, 0xd6, 0x4f, 0x5d, 0x89, 0x67, 0xb3, 0x33, 0x85, 0x97, 0xb8, 0x15, 0x5e, 0x8d, 0x9d,
+	0x29, 0x3c, 0x9b, 0x9d, 0x49, 0xbc, 0xd7, 0x90, 0x91, 0x78, 0xd4, 0xb6, 0x79, 0x3e, 0xa9, 0x00,
+	0x9f, 0x7e, 0xb8, 0x9c, 0x2b, 0xde, 0x0c, 0xb0, 0x6c, 0xdb, 0x1c, 0xa7, 0xed, 0x88, 0x40, 0x18,
+	0x26, 0xfd, 0xf3, 0x36, 0xe9, 0x92, 0x36, 0xeb, 0xe5, 0xf5, 0x5b, 0x61, 0x36, 0xce, 0xdb, 0xfb,
+	0xaf, 0x58, 0x0f, 0xa7, 0xfd, 0x88, 0x40, 0x05, 0xc8, 0xf1, 0x8b, 0x55, 0x62, 0x73, 0x12, 0x38,
+	0x4e, 0x97, 0x09, 0x55, 0x03, 0x39, 0x9c, 0xe5, 0x17, 0xab, 0x35, 0xde, 0x54, 0x22, 0x74, 0x1f,
+	0x52, 0xfc, 0xa2, 0x48, 0x6c, 0xae, 0x92, 0x9d, 0xc3, 0x06, 0xbf, 0x28, 0xd6, 0xb8, 0xcc, 0x34,
+	0xbf, 0x20, 0x36, 0xeb, 0xd0, 0x5e, 0x3f, 0xd3, 0xfc, 0xa2, 0x26, 0x59, 0xb4, 0x00, 0x69, 0xcb,
+	0x21, 0x1d, 0xb7, 0x2b, 0x54, 0x96, 0xb3, 0xc5, 0x99, 0x41, 0x4d, 0x55, 0xb7, 0x76, 0xdc, 0xae,
+	0xc0, 0x29, 0xcb, 0x91, 0xdf, 0x4f, 0xd4, 0xf4, 0xcc, 0x0d, 0x6a, 0x1a, 0x3d, 0x06, 0xd4, 0x7f,
+	0x65, 0xa2, 0x14, 0x5d, 0xc1, 0x6c, 0xd5, 0x16, 0x19, 0x6c, 0xc6, 0xef, 0x86, 0xfb, 0xf2, 0xc2,
+	0x4f, 0x09, 0x48, 0xef, 0xb2, 0x6e, 0x97, 0x1e, 0x31, 0xf4, 0x18, 0x0c, 0x8f, 0x1c, 0xdb, 0x5c,
+	0x55, 0x4f, 0xb6, 0x98, 0x1b, 0x16, 0xfd, 0x8b, 0x1a, 0xae, 0x64, 0xde, 0x5d, 0xce, 0x4d, 0xbc,
+	0xbf, 0x9c, 0xd3, 0xb0, 0xee, 0xbd, 0xb0, 0x39, 0x32, 0x21, 0xe9, 0xb9, 0x56, 0x54, 0x19, 0x58,
+	0x92, 0xe8, 0x29, 0x64, 0x3d, 0x6a, 0x91, 0x90, 0xf6, 0x3a, 0x01, 0xb5, 0x55, 0x8a, 0xb3, 0xa3,
+	0xad, 0x53, 0xae, 0xee, 0x45, 0xaa, 0x17, 0x13, 0x18, 0x3c, 0x6a, 0xc5, 0x1c, 0x6a, 0xc2, 0xbd,
+	0x93, 0xc0, 0xf5, 0xfb, 0xd1, 0x0e, 0x00, 0x74, 0x05, 0xf0, 0x70, 0x00, 0xf0, 0x32, 0x70, 0xfd,
+	0x38, 0xf2, 0x21, 0x10, 0x3a, 0xb9, 0x26, 0x45, 0x3b, 0x70, 0x57, 0x01, 0x52, 0xcb, 0x62, 0xe1,
+	0x10, 0xcf, 0x50, 0x78, 0x0f, 0xae, 0xe0, 0x95, 0x95, 0xc9, 0x10, 0xee, 0xce, 0xc9, 0xb8, 0xb0,
+	0x32, 0x09, 0xe9, 0x98, 0x2c, 0xec, 0x83, 0x2e, 0xdf, 0x02, 0xfd, 0x0f, 0x52, 0x1e, 0x91, 0xe5,
+	0xa3, 0x9e, 0x6a, 0xba, 0x38, 0x3d, 0xbc, 0xe4, 0x41, 0x2f, 0x64, 0xd8, 0xf0, 0xe4, 0x07, 0xfd,
+	0x17, 0x0c, 0x8f, 0x9e, 0x04, 0x3c, 0x9f, 0x18, 0xb7, 0x92, 0x52, 0x1c, 0x29, 0x0b, 0x1c, 0x60,
+	0xf8, 0x34, 0x32, 0x09, 0xce, 0x27, 0x93, 0xb0, 0x35, 0x96, 0x04, 0x47, 0x26, 0xe1, 0x3e, 0xa4,
+	0x1c, 0x12, 0x06, 0x5c, 0xa8, 0x23, 0x0c, 0x6c, 0x38, 0x7b, 0x01, 0x17, 0x72, 0xac, 0x38, 0xdc,
+	0xbb, 0x92, 0x89, 0x29, 0x0c, 0x0e, 0xf7, 0xfa, 0x17, 0xf9, 0x55, 0x03, 0x5d, 0x02, 0xa2, 0xd6,
+	0x48, 0x4f, 0x46, 0x43, 0xe3, 0x2b, 0x79, 0xc4, 0x97, 0xf6, 0xe5, 0xb2, 0x8c, 0xcb, 0x12, 0xbc,
+	0xa3, 0xe2, 0xca, 0x8e, 0x5c, 0x7d, 0xab, 0x2a, 0x78, 0x67, 0xe4, 0x1e, 0x86, 0x23, 0x05, 0xc3,
+	0x39, 0x97, 0x1c, 0x99, 0xee, 0x2b, 0x12, 0x25, 0x08, 0x45, 0x37, 0xaf, 0xcf, 0x27, 0xc7, 0x6b,
+	0xa9, 0x1a, 0x78, 0x1e, 0xf5, 0xed, 0x8a, 0x2e, 0xa1, 0xb0, 0xe1, 0x34, 0x43, 0xd1, 0x2d, 0x1c,
+	0x83, 0xa1, 0x0e, 0x90, 0xd5, 0x49, 0xe3, 0x2b, 0x65, 0xb0, 0x24, 0xd1, 0x2c, 0x64, 0xa9, 0xcd,
+	0x09, 0xb5, 0xda, 0xb2, 0xd0, 0x54, 0x5c, 0x19, 0x3c, 0x49, 0x6d, 0x5e, 0xb6, 0xda, 0x98, 0xbd,
+	0x55, 0x1e, 0x56, 0x3b, 0x9f, 0x8c, 0x3d, 0xac, 0xb6, 0x1c, 0xea, 0x0e, 0x09, 0x99, 0x2f, 0x87,
+	0xb1, 0x2a, 0xc6, 0x0c, 0xce, 0x38, 0x7b, 0x11, 0x5f, 0xd8, 0x00, 0x18, 0x06, 0x21, 0x9d, 0x2d,
+	0xd7, 0x56, 0xc7, 0xe5, 0xb0, 0x24, 0x51, 0x1e, 0xd2, 0xfd, 0xe7, 0x8f, 0x5a, 0xa4, 0xcf, 0x16,
+	0x7e, 0x48, 0x00, 0xba, 0x5e, 0xca, 0x08, 0x8f, 0x4f, 0xef, 0xcd, 0x38, 0x11, 0x5f, 0x30, 0xc1,
+	0xf1, 0xf8, 0x04, 0xbf, 0x0d, 0xe6, 0xd8, 0x14, 0xff, 0x16, 0x26, 0x25, 0xa6, 0x1f, 0xf8, 0x16,
+	0x8b, 0xc7, 0xf8, 0xd7, 0x31, 0x6a, 0xe9, 0x66, 0xa8, 0x0d, 0x09, 0x81, 0x33, 0x76, 0x4c, 0x15,
+	0x7e, 0x49, 0xc2, 0x9d, 0x6b, 0x3d, 0x89, 0x1e, 0xc1, 0x24, 0xf3, 0x2d, 0xde, 0x0b, 0xe5, 0x18,
+	0x53, 0x2f, 0x83, 0x87, 0x02, 0x19, 0x8d, 0x7c, 0xb5, 0x28, 0x9a, 0xc4, 0xad, 0xa3, 0x29, 0x87,
+	0x61, 0x1c, 0x0d, 0x8d, 0x29, 0xd4, 0x84, 0x94, 0xcf, 0x04, 0x71, 0xe3, 0xf6, 0xa9, 0x6c, 0xc4,
+	0xb0, 0x2b, 0x37, 0xd9, 0x2d, 0x4c, 0x6c, 0xd7, 0xb0, 0xe1, 0x33, 0xb1, 0x6d, 0x5f, 0x69, 0x35,
+	0xfd, 0xef, 0x6b, 0xb5, 0xe7, 0x90, 0xb5, 0x3b, 0xa4, 0xcb, 0x84, 0x90, 0x5e, 0xf1, 0x90, 0x1b,
+	0x76, 0x4a, 0x6d, 0x67, 0x3f, 0x56, 0x8d, 0x34, 0x1d, 0xd8, 0x9d, 0xbe, 0xf4, 0xca, 0xce, 0x4a,
+	0xfd, 0xe9, 0xce, 0x4a, 0x7f, 0x76, 0x67, 0x15, 0xbe, 0x01, 0x18, 0x1e, 0x74, 0x7d, 0x83, 0x6a,
+	0x9f, 0xdb, 0xa0, 0x89, 0x91, 0x0d, 0x5a, 0x78, 0x04, 0xa9, 0x08, 0x1a, 0x21, 0xd0, 0xe5, 0x62,
+	0xcb, 0x6b, 0xf3, 0x49, 0x35, 0x10, 0x38, 0x7b, 0xbb, 0x38, 0x07, 0x30, 0xfc, 0x01, 0x86, 0x32,
+	0xa0, 0xef, 0x34, 0x71, 0xd9, 0x9c, 0x40, 0x69, 0x48, 0x6e, 0xed, 0xbf, 0x32, 0xb5, 0xc5, 0x1f,
+	0x35, 0xc8, 0x5d, 0xd9, 0x8e, 0x68, 0x1a, 0xa0, 0xde, 0x22, 0x1b, 0x4f, 0x4b, 0x64, 0x63, 0x7d,
+	0xc5, 0x9c, 0x90, 0x7c, 0x6b, 0x9f, 0x6c, 0xae, 0x14, 0xc9, 0x66, 0x71, 0xc3, 0xd4, 0x24, 0x5f,
+	0x6d, 0x90, 0xf5, 0xf5, 0x4d, 0xb2, 0xbe, 0xb1, 0x6e, 0x26, 0x10, 0x40, 0xaa, 0xde, 0x22, 0x4f,
+	0x4a, 0x25, 0x33, 0x29, 0x75, 0xe5, 0x16, 0xd9, 0x5c, 0x5d, 0x53, 0xb6, 0x7a, 0x6c, 0xfb, 0x64,
+	0x7d, 0x85, 0xac, 0xad, 0xae, 0x98, 0x86, 0xb4, 0x2d, 0xef, 0x93, 0xcd, 0x62, 0xc9, 0x4c, 0x29,
+	0x5b, 0x49, 0xaf, 0x28, 0xfe, 0xd9, 0x80, 0x2f, 0x91, 0xcd, 0xe2, 0x9a, 0xf9, 0x5c, 0xf2, 0xaf,
+	0xf0, 0x40, 0x9f, 0x5e, 0xfc, 0x37, 0x18, 0x6a, 0x0b, 0x48, 0x85, 0xbc, 0xc5, 0x9b, 0x72, 0x83,
+	0xe0, 0x55, 0x73, 0x62, 0xf1, 0x7b, 0x30, 0xd4, 0x12, 0x41, 0x26, 0x4c, 0xbd, 0x6c, 0x6e, 0x37,
+	0x08, 0xae, 0xbf, 0x6e, 0xd5, 0xf7, 0x0f, 0xcc, 0x09, 0x34, 0x03, 0x59, 0x25, 0x29, 0x57, 0xab,
+	0xf5, 0xbd, 0x03, 0x53, 0x43, 0x08, 0xa6, 0x5b, 0x8d, 0x6a, 0xb3, 0xb1, 0xb5, 0x8d, 0x77, 0xeb,
+	0x35, 0xd2, 0xda, 0x33, 0x13, 0xe8, 0x1e, 0x98, 0xa3, 0xb2, 0x5a, 0xf3, 0x4d, 0xc3, 0x4c, 0x4a,
+	0xb0, 0x2b, 0x76, 0xba, 0xf4, 0x1d, 0xb3, 0x32, 0x2a, 0x95, 0x77, 0x1f, 0x67, 0xb5, 0xf7, 0x1f,
+	0x67, 0xb5, 0xdf, 0x3e, 0xce, 0x6a, 0xdf, 0x3d, 0xb9, 0xcd, 0x1f, 0x91, 0xc3, 0x94, 0x92, 0x94,
+	0xfe, 0x18, 0x00, 0x93, 0xc4, 0xdc, 0xb7, 0xc7, 0x0c, 0x00, 0x00,
 }
@@ -54,12 +54,13 @@ func (msg *Message_MacPayload) Payload() lorawan.Payload {
 	for _, cmd := range m.FOpts {
 		mac.FHDR.FOpts = append(mac.FHDR.FOpts, cmd.MACCommand())
 	}
+	// A negative FPort means that the frame has no FPort and no FRMPayload
 	if m.FPort >= 0 {
 		fPort := uint8(m.FPort)
 		mac.FPort = &fPort
-	}
-	mac.FRMPayload = []lorawan.Payload{
-		&lorawan.DataPayload{Bytes: m.FrmPayload},
+		mac.FRMPayload = []lorawan.Payload{
+			&lorawan.DataPayload{Bytes: m.FrmPayload},
+		}
 	}
 	return &mac
 }
@@ -81,3 +81,22 @@ func (m *Message) EncryptFRMPayload(appSKey types.AppSKey) error {
 func (m *Message) DecryptFRMPayload(appSKey types.AppSKey) error {
 	return m.cryptFRMPayload(appSKey)
 }
+
+// Security postures of a Device
+const (
+	PostureSecure            = "secure"
+	PostureFCntCheckDisabled = "fcnt-check-disabled"
+	PostureNoSession         = "no-session"
+)
+
+// ComputeSecurityPosture returns the security posture of the device: PostureNoSession if it has no NwkSKey,
+// PostureFCntCheckDisabled if its frame counter is not checked and PostureSecure otherwise
+func (m *Device) ComputeSecurityPosture() string {
+	switch {
+	case m.NwkSKey == nil || m.NwkSKey.IsEmpty():
+		return PostureNoSession
+	case m.DisableFCntCheck:
+		return PostureFCntCheckDisabled
+	}
+	return PostureSecure
+}
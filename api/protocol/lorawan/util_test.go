@@ -52,3 +52,12 @@ func TestEncryptDecrypt(t *testing.T) {
 		a.So(m.GetMacPayload().FrmPayload, ShouldResemble, payload)
 	}
 }
+
+func TestDeviceSecurityPosture(t *testing.T) {
+	a := New(t)
+	nwkSKey := types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+	a.So((&Device{}).ComputeSecurityPosture(), ShouldEqual, PostureNoSession)
+	a.So((&Device{NwkSKey: &types.NwkSKey{}, DisableFCntCheck: true}).ComputeSecurityPosture(), ShouldEqual, PostureNoSession)
+	a.So((&Device{NwkSKey: &nwkSKey, DisableFCntCheck: true}).ComputeSecurityPosture(), ShouldEqual, PostureFCntCheckDisabled)
+	a.So((&Device{NwkSKey: &nwkSKey}).ComputeSecurityPosture(), ShouldEqual, PostureSecure)
+}
@@ -4,16 +4,19 @@
 package cmd
 
 import (
+	"encoding/hex"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	ttnlog "github.com/TheThingsNetwork/go-utils/log"
 	"github.com/TheThingsNetwork/ttn/core/component"
 	"github.com/TheThingsNetwork/ttn/core/networkserver"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
 	"github.com/TheThingsNetwork/ttn/core/types"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -47,14 +50,103 @@ var networkserverCmd = &cobra.Command{
 			ctx.WithError(err).Fatal("Could not initialize database connection")
 		}
 
+		// Redis Replica Client, if configured
+		var replica *redis.Client
+		if replicaAddress := viper.GetString("networkserver.redis-replica-address"); replicaAddress != "" {
+			replica = redis.NewClient(&redis.Options{
+				Addr:     replicaAddress,
+				Password: viper.GetString("networkserver.redis-password"),
+				DB:       viper.GetInt("networkserver.redis-db"),
+			})
+			if err := connectRedis(replica); err != nil {
+				ctx.WithError(err).Fatal("Could not initialize replica database connection")
+			}
+		}
+
 		// Component
 		component, err := component.New(ttnlog.Get(), "networkserver", fmt.Sprintf("%s:%d", viper.GetString("networkserver.server-address-announce"), viper.GetInt("networkserver.server-port")))
 		if err != nil {
 			ctx.WithError(err).Fatal("Could not initialize component")
 		}
 
+		networkserver.NetIDType = viper.GetInt("networkserver.net-id-type")
+		networkserver.CheckJoinAcceptNetID = viper.GetBool("networkserver.check-join-accept-net-id")
+		networkserver.IndexRepairInterval = viper.GetDuration("networkserver.index-repair-interval")
+		networkserver.DeviceCache = viper.GetBool("networkserver.device-cache")
+		networkserver.DeviceCacheSize = viper.GetInt("networkserver.device-cache-size")
+		networkserver.DeviceCacheWarmUp = viper.GetInt("networkserver.device-cache-warm-up")
+		networkserver.DeviceCodec, err = device.ParseCodec(viper.GetString("networkserver.device-codec"))
+		if err != nil {
+			ctx.WithError(err).Fatal("Could not parse device codec")
+		}
+		networkserver.FCntCheck, err = networkserver.ParseFCntCheckMode(viper.GetString("networkserver.fcnt-check"))
+		if err != nil {
+			ctx.WithError(err).Fatal("Could not parse frame counter check mode")
+		}
+		networkserver.MaxFCntGap = uint32(viper.GetInt("networkserver.max-fcnt-gap"))
+		networkserver.FCntPersistMessages = uint32(viper.GetInt("networkserver.fcnt-persist-messages"))
+		networkserver.FCntPersistInterval = viper.GetDuration("networkserver.fcnt-persist-interval")
+		networkserver.DownlinkSkewTolerance = viper.GetDuration("networkserver.downlink-skew-tolerance")
+		networkserver.DownlinkPriority = networkserver.DownlinkPriorityPolicy(viper.GetString("networkserver.downlink-priority"))
+		networkserver.DownlinkPadding = viper.GetInt("networkserver.downlink-padding")
+		networkserver.MACOnlyDownlinks = networkserver.MACOnlyDownlinkMode(viper.GetString("networkserver.mac-only-downlinks"))
+		networkserver.DownlinkDeduplicationWindow = viper.GetDuration("networkserver.downlink-deduplication-window")
+		networkserver.FCntCeilingThreshold = viper.GetFloat64("networkserver.fcnt-ceiling-threshold")
+		networkserver.ReportSkippedFrames = viper.GetBool("networkserver.report-skipped-frames")
+		networkserver.RFUBits = networkserver.RFUBitsPolicy(viper.GetString("networkserver.rfu-bits"))
+		networkserver.AllowFCntUpRewind = viper.GetBool("networkserver.allow-fcnt-up-rewind")
+		networkserver.MissingResponseTemplate = networkserver.MissingResponseTemplatePolicy(viper.GetString("networkserver.missing-response-template"))
+		networkserver.GatewayTieBreak = networkserver.GatewayTieBreakPolicy(viper.GetString("networkserver.gateway-tie-break"))
+		networkserver.MaxSessionLifetime = viper.GetDuration("networkserver.max-session-lifetime")
+		networkserver.SessionExpiryGracePeriod = viper.GetDuration("networkserver.session-expiry-grace-period")
+		networkserver.CrossAppActivation = networkserver.CrossAppActivationPolicy(viper.GetString("networkserver.cross-app-activation"))
+		networkserver.ConfirmClassSwitches = viper.GetBool("networkserver.confirm-class-switches")
+		networkserver.ActivationStoreRetries = viper.GetInt("networkserver.activation-store-retries")
+		networkserver.DownlinkPower = networkserver.DownlinkPowerPolicy(viper.GetString("networkserver.downlink-power"))
+		networkserver.DownlinkTargetRSSI = viper.GetInt("networkserver.downlink-target-rssi")
+		networkserver.GuaranteeAcks = viper.GetBool("networkserver.guarantee-acks")
+		networkserver.MaxGetDevicesCandidates = viper.GetInt("networkserver.max-devaddr-candidates")
+		networkserver.UnknownDevAddr = networkserver.UnknownDevAddrPolicy(viper.GetString("networkserver.unknown-devaddr"))
+		networkserver.ExposeAppSKey = viper.GetBool("networkserver.expose-app-s-key")
+		networkserver.DeterministicDevAddrs = viper.GetBool("networkserver.deterministic-devaddr")
+		networkserver.CFListOverflow = networkserver.CFListOverflowPolicy(viper.GetString("networkserver.cflist-overflow"))
+		if fallback := viper.GetStringSlice("networkserver.devaddr-fallback-constraints"); len(fallback) > 0 {
+			networkserver.DevAddrFallbackConstraints = fallback
+		}
+		for _, prefix := range viper.GetStringSlice("networkserver.deveui-allowlist") {
+			prefix, err := networkserver.ParseDevEUIPrefix(prefix)
+			if err != nil {
+				ctx.WithError(err).Fatal("Could not parse DevEUI allowlist")
+			}
+			networkserver.DevEUIAllowlist = append(networkserver.DevEUIAllowlist, prefix)
+		}
+		for _, priority := range viper.GetStringSlice("networkserver.mac-command-priorities") {
+			cid, priority, err := networkserver.ParseMACCommandPriority(priority)
+			if err != nil {
+				ctx.WithError(err).Fatal("Could not parse MAC command priorities")
+			}
+			networkserver.MACCommandPriorities[cid] = priority
+		}
+		for _, rxDelay := range viper.GetStringSlice("networkserver.region-rx-delays") {
+			region, rxDelay, err := networkserver.ParseRegionRXDelay(rxDelay)
+			if err != nil {
+				ctx.WithError(err).Fatal("Could not parse region RX delays")
+			}
+			networkserver.RegionRXDelays[region] = rxDelay
+		}
+
+		concurrencyPolicy := networkserver.QueueOperations
+		if viper.GetBool("networkserver.reject-when-busy") {
+			concurrencyPolicy = networkserver.RejectOperations
+		}
+
+		var uplinkMiddleware []networkserver.UplinkMiddleware
+		if limit := viper.GetInt("networkserver.uplink-rate-limit"); limit > 0 {
+			uplinkMiddleware = append(uplinkMiddleware, networkserver.UplinkRateLimit(limit, time.Hour))
+		}
+
 		// networkserver Server
-		networkserver := networkserver.NewRedisNetworkServer(client, viper.GetInt("networkserver.net-id"))
+		networkserver := networkserver.NewRedisNetworkServerWithReplica(client, replica, viper.GetInt("networkserver.net-id"))
 
 		// Register Prefixes
 		for prefix, usage := range viper.GetStringMapString("networkserver.prefixes") {
@@ -71,6 +163,19 @@ var networkserverCmd = &cobra.Command{
 			ctx.Infof("Using DevAddr prefix %s (%v)", prefix, usage)
 		}
 
+		networkserver.SetConcurrencyLimit(viper.GetInt("networkserver.max-concurrent-operations"), concurrencyPolicy)
+		networkserver.UseUplinkMiddleware(uplinkMiddleware...)
+
+		if key := viper.GetString("networkserver.session-key-encryption-key"); key != "" {
+			masterKey, err := hex.DecodeString(key)
+			if err != nil {
+				ctx.WithError(err).Fatal("Could not parse session key encryption key")
+			}
+			if err := networkserver.EncryptSessionKeys(masterKey); err != nil {
+				ctx.WithError(err).Fatal("Could not enable session key encryption")
+			}
+		}
+
 		err = networkserver.Init(component)
 		if err != nil {
 			ctx.WithError(err).Fatal("Could not initialize networkserver")
@@ -107,9 +212,106 @@ func init() {
 	viper.BindPFlag("networkserver.redis-password", networkserverCmd.Flags().Lookup("redis-password"))
 	networkserverCmd.Flags().Int("redis-db", 0, "Redis database")
 	viper.BindPFlag("networkserver.redis-db", networkserverCmd.Flags().Lookup("redis-db"))
+	networkserverCmd.Flags().String("redis-replica-address", "", "Redis read-only replica and port, used for looking up devices by DevAddr")
+	viper.BindPFlag("networkserver.redis-replica-address", networkserverCmd.Flags().Lookup("redis-replica-address"))
 
 	networkserverCmd.Flags().Int("net-id", 19, "LoRaWAN NetID")
 	viper.BindPFlag("networkserver.net-id", networkserverCmd.Flags().Lookup("net-id"))
+	networkserverCmd.Flags().Int("net-id-type", -1, "Type of the LoRaWAN NetID, to validate the NetID (-1 to derive it from the NetID)")
+	viper.BindPFlag("networkserver.net-id-type", networkserverCmd.Flags().Lookup("net-id-type"))
+	networkserverCmd.Flags().Bool("check-join-accept-net-id", true, "Reject activations of which the DevAddr does not match the NwkID of the NetID")
+	viper.BindPFlag("networkserver.check-join-accept-net-id", networkserverCmd.Flags().Lookup("check-join-accept-net-id"))
+
+	networkserverCmd.Flags().Duration("index-repair-interval", 0, "Interval for checking and repairing the DevAddr and DevEUI indexes (0 to disable)")
+	viper.BindPFlag("networkserver.index-repair-interval", networkserverCmd.Flags().Lookup("index-repair-interval"))
+
+	networkserverCmd.Flags().Bool("device-cache", false, "Cache devices by DevAddr in memory (only if this is the only networkserver on the database)")
+	viper.BindPFlag("networkserver.device-cache", networkserverCmd.Flags().Lookup("device-cache"))
+	networkserverCmd.Flags().Int("device-cache-size", 100000, "Maximum number of DevAddrs in the device cache, the least recently used are evicted")
+	viper.BindPFlag("networkserver.device-cache-size", networkserverCmd.Flags().Lookup("device-cache-size"))
+
+	networkserverCmd.Flags().String("device-codec", "hash", "Format of devices in the database (hash, json, gob or protobuf); records in another format than hash can only be read in that format")
+	viper.BindPFlag("networkserver.device-codec", networkserverCmd.Flags().Lookup("device-codec"))
+
+	networkserverCmd.Flags().Int("device-cache-warm-up", 0, "Number of most recently seen devices to load into the device cache on startup")
+	viper.BindPFlag("networkserver.device-cache-warm-up", networkserverCmd.Flags().Lookup("device-cache-warm-up"))
+
+	networkserverCmd.Flags().String("fcnt-check", "window", "Frame counter check mode (strict, relaxed or window)")
+	viper.BindPFlag("networkserver.fcnt-check", networkserverCmd.Flags().Lookup("fcnt-check"))
+	networkserverCmd.Flags().Int("max-fcnt-gap", 0, "Maximum gap between the stored and the uplink frame counter in window mode (0 for no limit)")
+	viper.BindPFlag("networkserver.max-fcnt-gap", networkserverCmd.Flags().Lookup("max-fcnt-gap"))
+	networkserverCmd.Flags().Int("fcnt-persist-messages", 0, "Write uplink frame counters to the database every this many uplinks (0 to write every uplink)")
+	viper.BindPFlag("networkserver.fcnt-persist-messages", networkserverCmd.Flags().Lookup("fcnt-persist-messages"))
+	networkserverCmd.Flags().Duration("fcnt-persist-interval", 0, "Write uplink frame counters to the database at least at this interval when batching (0 to disable)")
+	viper.BindPFlag("networkserver.fcnt-persist-interval", networkserverCmd.Flags().Lookup("fcnt-persist-interval"))
+	networkserverCmd.Flags().Duration("downlink-skew-tolerance", 0, "How long a receive window may have passed before the downlink is moved to RX2 or dropped")
+	viper.BindPFlag("networkserver.downlink-skew-tolerance", networkserverCmd.Flags().Lookup("downlink-skew-tolerance"))
+	networkserverCmd.Flags().String("downlink-priority", "mac", "What to send when MAC commands and payload do not fit in one downlink (mac or payload)")
+	viper.BindPFlag("networkserver.downlink-priority", networkserverCmd.Flags().Lookup("downlink-priority"))
+	networkserverCmd.Flags().Int("downlink-padding", 0, "Minimum FRMPayload length of downlinks, shorter payloads are padded with zeros (0 to disable, requires expose-app-s-key)")
+	viper.BindPFlag("networkserver.downlink-padding", networkserverCmd.Flags().Lookup("downlink-padding"))
+	networkserverCmd.Flags().String("mac-only-downlinks", "fopts", "How downlinks with only MAC commands are sent (fopts without FPort, or fport0)")
+	viper.BindPFlag("networkserver.mac-only-downlinks", networkserverCmd.Flags().Lookup("mac-only-downlinks"))
+	networkserverCmd.Flags().Duration("downlink-deduplication-window", 0, "How long a retried downlink gets the frame that was built the first time, instead of a new FCntDown (0 to disable)")
+	viper.BindPFlag("networkserver.downlink-deduplication-window", networkserverCmd.Flags().Lookup("downlink-deduplication-window"))
+	networkserverCmd.Flags().Float64("fcnt-ceiling-threshold", 0.9, "Fraction of the 32-bit frame counter at which to warn that a device should be re-keyed (0 to disable)")
+	viper.BindPFlag("networkserver.fcnt-ceiling-threshold", networkserverCmd.Flags().Lookup("fcnt-ceiling-threshold"))
+	networkserverCmd.Flags().Bool("report-skipped-frames", false, "Count and log the frames that devices skip within the frame counter window")
+	viper.BindPFlag("networkserver.report-skipped-frames", networkserverCmd.Flags().Lookup("report-skipped-frames"))
+	networkserverCmd.Flags().String("rfu-bits", "ignore", "What to do with uplinks that have RFU bits set (ignore or reject)")
+	viper.BindPFlag("networkserver.rfu-bits", networkserverCmd.Flags().Lookup("rfu-bits"))
+	networkserverCmd.Flags().Bool("allow-fcnt-up-rewind", false, "Store the frame counter of uplinks that arrive after uplinks with a higher frame counter")
+	viper.BindPFlag("networkserver.allow-fcnt-up-rewind", networkserverCmd.Flags().Lookup("allow-fcnt-up-rewind"))
+	networkserverCmd.Flags().String("missing-response-template", "defer", "What to do with uplinks without response template while there are MAC commands to send (defer or strict)")
+	viper.BindPFlag("networkserver.missing-response-template", networkserverCmd.Flags().Lookup("missing-response-template"))
+	networkserverCmd.Flags().String("gateway-tie-break", "first", "How to select a downlink gateway from gateways with an equal signal (first, lru or utilization)")
+	viper.BindPFlag("networkserver.gateway-tie-break", networkserverCmd.Flags().Lookup("gateway-tie-break"))
+	networkserverCmd.Flags().Duration("max-session-lifetime", 0, "Maximum age of a session, after which uplinks are rejected until the device joins again (0 for no limit)")
+	viper.BindPFlag("networkserver.max-session-lifetime", networkserverCmd.Flags().Lookup("max-session-lifetime"))
+	networkserverCmd.Flags().Duration("session-expiry-grace-period", 0, "How long uplinks of an expired session are still accepted after the first uplink after expiry, so that the device stays reachable until it joins again")
+	viper.BindPFlag("networkserver.session-expiry-grace-period", networkserverCmd.Flags().Lookup("session-expiry-grace-period"))
+	networkserverCmd.Flags().String("cross-app-activation", "reject", "What to do with a join of a device that is registered under a different AppEUI (reject or rebind)")
+	viper.BindPFlag("networkserver.cross-app-activation", networkserverCmd.Flags().Lookup("cross-app-activation"))
+	networkserverCmd.Flags().Bool("confirm-class-switches", false, "Only schedule downlinks for a class that a device switched to after the device confirmed the switch with an uplink")
+	viper.BindPFlag("networkserver.confirm-class-switches", networkserverCmd.Flags().Lookup("confirm-class-switches"))
+	networkserverCmd.Flags().Int("activation-store-retries", 2, "Number of times to retry storing the session of an activating device after a transient database error")
+	viper.BindPFlag("networkserver.activation-store-retries", networkserverCmd.Flags().Lookup("activation-store-retries"))
+	networkserverCmd.Flags().String("downlink-power", "max", "Transmit power of downlinks (max for the maximum of the frequency plan, or path-loss to compute it from the uplink signal)")
+	viper.BindPFlag("networkserver.downlink-power", networkserverCmd.Flags().Lookup("downlink-power"))
+	networkserverCmd.Flags().Int("downlink-target-rssi", -100, "RSSI (dBm) at the device that the path-loss downlink power aims for")
+	viper.BindPFlag("networkserver.downlink-target-rssi", networkserverCmd.Flags().Lookup("downlink-target-rssi"))
+	networkserverCmd.Flags().Bool("guarantee-acks", false, "Reject confirmed uplinks without response template, of which the device would not get the ACK")
+	viper.BindPFlag("networkserver.guarantee-acks", networkserverCmd.Flags().Lookup("guarantee-acks"))
+	networkserverCmd.Flags().Int("max-devaddr-candidates", 0, "Maximum number of devices with the same DevAddr to consider for an uplink, the most recently seen first (0 for no limit)")
+	viper.BindPFlag("networkserver.max-devaddr-candidates", networkserverCmd.Flags().Lookup("max-devaddr-candidates"))
+	networkserverCmd.Flags().String("unknown-devaddr", "empty", "What to return for a DevAddr that no device has (empty, or not-found to tell it apart from filtered frame counters)")
+	viper.BindPFlag("networkserver.unknown-devaddr", networkserverCmd.Flags().Lookup("unknown-devaddr"))
+	networkserverCmd.Flags().Bool("expose-app-s-key", false, "Store the AppSKey and return it to the handler with the device candidates (only for combined deployments)")
+	viper.BindPFlag("networkserver.expose-app-s-key", networkserverCmd.Flags().Lookup("expose-app-s-key"))
+	networkserverCmd.Flags().Bool("deterministic-devaddr", false, "Derive the DevAddr of OTAA devices from their DevEUI, so that it can be re-derived without the database")
+	viper.BindPFlag("networkserver.deterministic-devaddr", networkserverCmd.Flags().Lookup("deterministic-devaddr"))
+	networkserverCmd.Flags().String("cflist-overflow", "error", "What to do with a CFList that has more channels than the frequency plan supports (error or truncate)")
+	viper.BindPFlag("networkserver.cflist-overflow", networkserverCmd.Flags().Lookup("cflist-overflow"))
+	networkserverCmd.Flags().StringSlice("devaddr-fallback-constraints", []string{}, "Activation constraints to use when no DevAddr prefix matches the constraints of a device (otaa to only require an OTAA prefix)")
+	viper.BindPFlag("networkserver.devaddr-fallback-constraints", networkserverCmd.Flags().Lookup("devaddr-fallback-constraints"))
+	networkserverCmd.Flags().StringSlice("deveui-allowlist", []string{}, "Ranges of DevEUIs that are allowed to activate, in prefix notation (0102030405060708/32)")
+	viper.BindPFlag("networkserver.deveui-allowlist", networkserverCmd.Flags().Lookup("deveui-allowlist"))
+	networkserverCmd.Flags().StringSlice("mac-command-priorities", []string{}, "Priorities of downlink MAC commands that are sent first when not all queued commands fit, in cid=priority notation (0x03=1)")
+	viper.BindPFlag("networkserver.mac-command-priorities", networkserverCmd.Flags().Lookup("mac-command-priorities"))
+	networkserverCmd.Flags().StringSlice("region-rx-delays", []string{}, "Default RXDelay of JoinAccepts per frequency plan, used when not set by the handler or the prefix, in region=delay notation (EU_863_870=5)")
+	viper.BindPFlag("networkserver.region-rx-delays", networkserverCmd.Flags().Lookup("region-rx-delays"))
+
+	networkserverCmd.Flags().Int("max-concurrent-operations", 0, "Maximum number of uplink and downlink operations that are handled at the same time (0 for no limit)")
+	viper.BindPFlag("networkserver.max-concurrent-operations", networkserverCmd.Flags().Lookup("max-concurrent-operations"))
+
+	networkserverCmd.Flags().Bool("reject-when-busy", false, "Reject operations over the limit instead of queueing them")
+	viper.BindPFlag("networkserver.reject-when-busy", networkserverCmd.Flags().Lookup("reject-when-busy"))
+
+	networkserverCmd.Flags().Int("uplink-rate-limit", 0, "Maximum number of uplink messages per device per hour (0 for no limit)")
+	viper.BindPFlag("networkserver.uplink-rate-limit", networkserverCmd.Flags().Lookup("uplink-rate-limit"))
+
+	networkserverCmd.Flags().String("session-key-encryption-key", "", "Hex-encoded AES master key (16, 24 or 32 bytes) for encrypting session keys in the database")
+	viper.BindPFlag("networkserver.session-key-encryption-key", networkserverCmd.Flags().Lookup("session-key-encryption-key"))
 
 	viper.SetDefault("networkserver.prefixes", map[string]string{
 		"26000000/20": "otaa,abp,world,local,private,testing",
@@ -16,6 +16,10 @@ type FrequencyPlan struct {
 	lora.Band
 	ADR    *ADRConfig
 	CFList *lorawan.CFList
+
+	// MaxPayloadSizeNoDwellTime contains the maximum payload sizes when the dwell time limit
+	// is disabled, for bands where that changes the sizes (AS923)
+	MaxPayloadSizeNoDwellTime []lora.MaxPayloadSize
 }
 
 func (f *FrequencyPlan) GetDataRateStringForIndex(drIdx int) (string, error) {
@@ -34,6 +38,18 @@ func (f *FrequencyPlan) GetDataRateIndexFor(dataRate string) (int, error) {
 	return f.Band.GetDataRate(lora.DataRate{Modulation: lora.LoRaModulation, SpreadFactor: int(dr.SpreadingFactor), Bandwidth: int(dr.Bandwidth)})
 }
 
+// GetMaxPayloadSizeFor returns the maximum payload size for the given data rate index, taking the dwell time limit into account
+func (f *FrequencyPlan) GetMaxPayloadSizeFor(drIdx int, dwellTime bool) (lora.MaxPayloadSize, error) {
+	sizes := f.MaxPayloadSize
+	if !dwellTime && f.MaxPayloadSizeNoDwellTime != nil {
+		sizes = f.MaxPayloadSizeNoDwellTime
+	}
+	if drIdx < 0 || drIdx >= len(sizes) {
+		return lora.MaxPayloadSize{}, errors.New("core/band: the given data rate does not exist")
+	}
+	return sizes[drIdx], nil
+}
+
 func (f *FrequencyPlan) GetTxPowerIndexFor(txPower int) (int, error) {
 	for i, power := range f.TXPower {
 		if power == txPower {
@@ -100,8 +116,10 @@ func Get(region string) (frequencyPlan FrequencyPlan, err error) {
 		frequencyPlan.Band, err = lora.GetConfig(lora.CN_470_510, false, lorawan.DwellTimeNoLimit)
 	case pb_lorawan.FrequencyPlan_AS_923.String():
 		frequencyPlan.Band, err = lora.GetConfig(lora.AS_923, false, lorawan.DwellTime400ms)
+		frequencyPlan.MaxPayloadSizeNoDwellTime = maxPayloadSizeNoDwellTime(lora.AS_923)
 	case pb_lorawan.FrequencyPlan_AS_920_923.String():
 		frequencyPlan.Band, err = lora.GetConfig(lora.AS_923, false, lorawan.DwellTime400ms)
+		frequencyPlan.MaxPayloadSizeNoDwellTime = maxPayloadSizeNoDwellTime(lora.AS_923)
 		frequencyPlan.UplinkChannels = []lora.Channel{
 			lora.Channel{Frequency: 923200000, DataRates: []int{0, 1, 2, 3, 4, 5}},
 			lora.Channel{Frequency: 923400000, DataRates: []int{0, 1, 2, 3, 4, 5}},
@@ -118,6 +136,7 @@ func Get(region string) (frequencyPlan FrequencyPlan, err error) {
 		frequencyPlan.CFList = &lorawan.CFList{922200000, 922400000, 922600000, 922800000, 923000000}
 	case pb_lorawan.FrequencyPlan_AS_923_925.String():
 		frequencyPlan.Band, err = lora.GetConfig(lora.AS_923, false, lorawan.DwellTime400ms)
+		frequencyPlan.MaxPayloadSizeNoDwellTime = maxPayloadSizeNoDwellTime(lora.AS_923)
 		frequencyPlan.UplinkChannels = []lora.Channel{
 			lora.Channel{Frequency: 923200000, DataRates: []int{0, 1, 2, 3, 4, 5}},
 			lora.Channel{Frequency: 923400000, DataRates: []int{0, 1, 2, 3, 4, 5}},
@@ -152,6 +171,14 @@ func Get(region string) (frequencyPlan FrequencyPlan, err error) {
 	return
 }
 
+func maxPayloadSizeNoDwellTime(name lora.Name) []lora.MaxPayloadSize {
+	b, err := lora.GetConfig(name, false, lorawan.DwellTimeNoLimit)
+	if err != nil {
+		return nil
+	}
+	return b.MaxPayloadSize
+}
+
 var frequencyPlans map[string]FrequencyPlan
 var channels map[int]string
 
@@ -128,3 +128,26 @@ func TestGetTxPower(t *testing.T) {
 		a.So(idx, ShouldEqual, expIdx)
 	}
 }
+
+func TestGetMaxPayloadSizeFor(t *testing.T) {
+	a := New(t)
+
+	{
+		fp, _ := Get("AS_923")
+		dwellTime, err := fp.GetMaxPayloadSizeFor(2, true)
+		a.So(err, ShouldBeNil)
+		noDwellTime, err := fp.GetMaxPayloadSizeFor(2, false)
+		a.So(err, ShouldBeNil)
+		a.So(dwellTime.N, ShouldBeLessThan, noDwellTime.N)
+
+		_, err = fp.GetMaxPayloadSizeFor(16, true)
+		a.So(err, ShouldNotBeNil)
+	}
+
+	{
+		fp, _ := Get("EU_863_870")
+		dwellTime, _ := fp.GetMaxPayloadSizeFor(5, true)
+		noDwellTime, _ := fp.GetMaxPayloadSizeFor(5, false)
+		a.So(dwellTime, ShouldResemble, noDwellTime)
+	}
+}
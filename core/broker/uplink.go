@@ -95,7 +95,11 @@ func (b *broker) HandleUplink(uplink *pb.UplinkMessage) (err error) {
 		FCnt:    macPayload.FHDR.FCnt,
 	})
 	if err != nil {
-		return errors.Wrap(errors.FromGRPCError(err), "NetworkServer did not return devices")
+		err = errors.FromGRPCError(err)
+		if errors.IsNotFound(err) {
+			return errors.NewErrNotFound(fmt.Sprintf("Device with DevAddr %s", devAddr))
+		}
+		return errors.Wrap(err, "NetworkServer did not return devices")
 	}
 	b.status.deduplication.Update(int64(len(getDevicesResp.Results)))
 	if len(getDevicesResp.Results) == 0 {
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"net/http"
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/TheThingsNetwork/go-account-lib/claims"
@@ -41,6 +42,7 @@ type Component struct {
 	TokenKeyProvider tokenkey.Provider
 	status           int64
 	healthServer     *health.Server
+	readinessCheck   atomic.Value
 }
 
 type Interface interface {
@@ -55,6 +57,9 @@ type ManagementInterface interface {
 	RegisterManager(s *grpc.Server)
 }
 
+// readinessTimeout is the time that the readiness check of a component may take
+const readinessTimeout = 5 * time.Second
+
 // New creates a new Component
 func New(ctx ttnlog.Interface, serviceName string, announcedAddress string) (*Component, error) {
 	go func() {
@@ -126,6 +131,17 @@ func New(ctx ttnlog.Interface, serviceName string, announcedAddress string) (*Co
 				return
 			}
 		})
+		http.HandleFunc("/readyz", func(w http.ResponseWriter, req *http.Request) {
+			ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+			defer cancel()
+			if err := component.Ready(ctx); err != nil {
+				w.WriteHeader(503)
+				w.Write([]byte(err.Error()))
+				return
+			}
+			w.WriteHeader(200)
+			w.Write([]byte("Ready"))
+		})
 		go http.ListenAndServe(fmt.Sprintf(":%d", healthPort), nil)
 	}
 
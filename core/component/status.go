@@ -6,6 +6,8 @@ package component
 import (
 	"sync/atomic"
 
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+	"golang.org/x/net/context" // See https://github.com/grpc/grpc-go/issues/711"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
@@ -44,3 +46,23 @@ func (c *Component) RegisterHealthServer(srv *grpc.Server) {
 	c.healthServer = health.NewServer()
 	healthpb.RegisterHealthServer(srv, c.healthServer)
 }
+
+// ReadinessCheck actively checks whether the component can handle traffic right now, for example by checking
+// that its database can be reached
+type ReadinessCheck func(ctx context.Context) error
+
+// SetReadinessCheck sets the check that is used by Ready
+func (c *Component) SetReadinessCheck(check ReadinessCheck) {
+	c.readinessCheck.Store(check)
+}
+
+// Ready returns an error if the component is not healthy, or if its readiness check fails
+func (c *Component) Ready(ctx context.Context) error {
+	if c.GetStatus() != StatusHealthy {
+		return errors.New("Status is UNHEALTHY")
+	}
+	if check, ok := c.readinessCheck.Load().(ReadinessCheck); ok && check != nil {
+		return check(ctx)
+	}
+	return nil
+}
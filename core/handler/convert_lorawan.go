@@ -4,6 +4,8 @@
 package handler
 
 import (
+	"time"
+
 	ttnlog "github.com/TheThingsNetwork/go-utils/log"
 	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
 	"github.com/TheThingsNetwork/ttn/api/trace"
@@ -74,6 +76,10 @@ func (h *handler) ConvertFromLoRaWAN(ctx ttnlog.Interface, ttnUp *pb_broker.Dedu
 		if dev.CurrentDownlink.Confirmed {
 			// If it's confirmed, we can only unset it if we receive an ack.
 			if macPayload.FHDR.FCtrl.ACK {
+				ackTime := types.BuildTime(ttnUp.ServerTime)
+				if ttnUp.ServerTime == 0 {
+					ackTime = types.JSONTime(time.Now().UTC())
+				}
 				// Send event over MQTT
 				h.mqttEvent <- &types.DeviceEvent{
 					AppID: appUp.AppID,
@@ -81,6 +87,7 @@ func (h *handler) ConvertFromLoRaWAN(ctx ttnlog.Interface, ttnUp *pb_broker.Dedu
 					Event: types.DownlinkAckEvent,
 					Data: types.DownlinkEventData{
 						Message: dev.CurrentDownlink,
+						AckTime: ackTime,
 					},
 				}
 				dev.CurrentDownlink = nil
@@ -59,6 +59,52 @@ func TestConvertFromLoRaWAN(t *testing.T) {
 
 }
 
+func TestConvertFromLoRaWANDownlinkAck(t *testing.T) {
+	a := New(t)
+	h := &handler{
+		Component: &component.Component{Ctx: GetLogger(t, "TestConvertFromLoRaWANDownlinkAck")},
+		devices:   device.NewRedisDeviceStore(GetRedisClient(), "handler-test-convert-from-lorawan-downlink-ack"),
+		mqttEvent: make(chan *types.DeviceEvent, 10),
+	}
+	downlink := &types.DownlinkMessage{
+		AppID:      "appid",
+		DevID:      "devid",
+		FPort:      1,
+		PayloadRaw: []byte{0x01, 0x02},
+		Confirmed:  true,
+	}
+	device := &device.Device{
+		DevID:           "devid",
+		AppID:           "appid",
+		CurrentDownlink: downlink,
+	}
+
+	// The uplink has the ACK bit set
+	ttnUp, appUp := buildLorawanUplink([]byte{0x40, 0x04, 0x03, 0x02, 0x01, 0x20, 0x01, 0x00, 0x0A, 0x46, 0x55, 0x96, 0x42, 0x92, 0xF2})
+	ttnUp.ServerTime = 1500000000000000000
+	err := h.ConvertFromLoRaWAN(h.Ctx, ttnUp, appUp, device)
+	a.So(err, ShouldBeNil)
+	a.So(device.CurrentDownlink, ShouldBeNil)
+	a.So(h.mqttEvent, ShouldHaveLength, 1)
+
+	evt := <-h.mqttEvent
+	a.So(evt.Event, ShouldEqual, types.DownlinkAckEvent)
+	a.So(evt.AppID, ShouldEqual, "appid")
+	a.So(evt.DevID, ShouldEqual, "devid")
+	data, ok := evt.Data.(types.DownlinkEventData)
+	a.So(ok, ShouldBeTrue)
+	a.So(data.Message, ShouldEqual, downlink)
+	a.So(data.AckTime, ShouldResemble, types.BuildTime(ttnUp.ServerTime))
+
+	// A retransmission of the same uplink does not deliver the ack again
+	device.CurrentDownlink = downlink
+	_, appUp = buildLorawanUplink(ttnUp.Payload)
+	err = h.ConvertFromLoRaWAN(h.Ctx, ttnUp, appUp, device)
+	a.So(err, ShouldBeNil)
+	a.So(appUp.IsRetry, ShouldBeTrue)
+	a.So(h.mqttEvent, ShouldBeEmpty)
+}
+
 func buildLorawanDownlink(payload []byte) (*types.DownlinkMessage, *pb_broker.DownlinkMessage) {
 	appDown := &types.DownlinkMessage{
 		DevID:      "devid",
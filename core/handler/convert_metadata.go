@@ -25,6 +25,8 @@ func (h *handler) ConvertMetadata(ctx ttnlog.Interface, ttnUp *pb_broker.Dedupli
 
 	// Transform Gateway Metadata
 	appUp.Metadata.Gateways = make([]types.GatewayMetadata, 0, len(ttnUp.GatewayMetadata))
+	appUp.Metadata.GatewayCount = 0
+	gatewayIDs := make(map[string]bool, len(ttnUp.GatewayMetadata))
 	for i, in := range ttnUp.GatewayMetadata {
 
 		// Same for all gateways, take first one
@@ -50,6 +52,11 @@ func (h *handler) ConvertMetadata(ctx ttnlog.Interface, ttnUp *pb_broker.Dedupli
 		}
 
 		appUp.Metadata.Gateways = append(appUp.Metadata.Gateways, gatewayMetadata)
+
+		if in.GatewayId == "" || !gatewayIDs[in.GatewayId] {
+			appUp.Metadata.GatewayCount++
+			gatewayIDs[in.GatewayId] = true
+		}
 	}
 
 	// Inject Device Metadata
@@ -47,6 +47,7 @@ func TestConvertMetadata(t *testing.T) {
 	err = h.ConvertMetadata(h.Ctx, ttnUp, appUp, device)
 	a.So(err, ShouldBeNil)
 	a.So(appUp.Metadata.Gateways, ShouldHaveLength, 2)
+	a.So(appUp.Metadata.GatewayCount, ShouldEqual, 1) // The same gateway twice
 
 	ttnUp.ProtocolMetadata = &pb_protocol.RxMetadata{Protocol: &pb_protocol.RxMetadata_Lorawan{
 		Lorawan: &pb_lorawan.Metadata{
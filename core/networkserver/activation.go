@@ -5,47 +5,249 @@ package networkserver
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/TheThingsNetwork/go-utils/pseudorandom"
 	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
 	pb_handler "github.com/TheThingsNetwork/ttn/api/handler"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
 	"github.com/TheThingsNetwork/ttn/api/trace"
+	"github.com/TheThingsNetwork/ttn/core/band"
 	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
 	"github.com/TheThingsNetwork/ttn/core/types"
 	"github.com/TheThingsNetwork/ttn/utils/errors"
 	"github.com/brocaar/lorawan"
+	errs "github.com/pkg/errors"
 )
 
-func (n *networkServer) getDevAddr(constraints ...string) (types.DevAddr, error) {
-	// Generate random DevAddr bytes
-	var devAddr types.DevAddr
-	pseudorandom.FillBytes(devAddr[:])
+// DefaultRXDelay is the RXDelay (in seconds) that is used in JoinAccepts when it is not set
+var DefaultRXDelay uint32 = 1
+
+// RegionRXDelays contains the RXDelay (in seconds) by frequency plan, that is used in JoinAccepts when it is not
+// set by the caller or the prefix. Frequency plans without RXDelay use the DefaultRXDelay.
+var RegionRXDelays = map[string]uint32{}
+
+// ParseRegionRXDelay parses the RXDelay of a frequency plan in the region=delay notation (EU_863_870=5)
+func ParseRegionRXDelay(rxDelayString string) (region string, rxDelay uint32, err error) {
+	parts := strings.Split(rxDelayString, "=")
+	if len(parts) != 2 {
+		return region, rxDelay, errors.NewErrInvalidArgument("RXDelay", "should be in region=delay notation")
+	}
+	if _, err := band.Get(parts[0]); err != nil {
+		return region, rxDelay, errors.NewErrInvalidArgument("RXDelay", "unknown region")
+	}
+	parsed, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil || parsed == 0 || parsed > maxRXDelay {
+		return region, rxDelay, errors.NewErrInvalidArgument("RXDelay", fmt.Sprintf("delay should be between 1 and %d", maxRXDelay))
+	}
+	return parts[0], uint32(parsed), nil
+}
+
+// defaultRXDelay returns the RXDelay of the frequency plan, or the DefaultRXDelay
+func defaultRXDelay(region string) uint32 {
+	if rxDelay, ok := RegionRXDelays[region]; ok {
+		return rxDelay
+	}
+	return DefaultRXDelay
+}
+
+// Limits of the fields of the JoinAccept
+const (
+	maxRXDelay      = 15
+	maxRx1DrOffset  = 7
+	maxRx2Dr        = 15
+	maxCFListLength = 5
+	maxCFListFreq   = (1<<24 - 1) * 100
+)
+
+// validateJoinAcceptMetadata checks that the LoRaWAN activation metadata can be encoded in a JoinAccept.
+// The RXDelay must already be defaulted and the CFList must already be fitted.
+func validateJoinAcceptMetadata(meta *pb_lorawan.ActivationMetadata) error {
+	if meta.RxDelay > maxRXDelay {
+		return errors.NewErrInvalidArgument("RxDelay", fmt.Sprintf("%d is more than %d seconds", meta.RxDelay, maxRXDelay))
+	}
+	if meta.Rx1DrOffset > maxRx1DrOffset {
+		return errors.NewErrInvalidArgument("Rx1DrOffset", fmt.Sprintf("%d is more than %d", meta.Rx1DrOffset, maxRx1DrOffset))
+	}
+	if meta.Rx2Dr > maxRx2Dr {
+		return errors.NewErrInvalidArgument("Rx2Dr", fmt.Sprintf("%d is more than %d", meta.Rx2Dr, maxRx2Dr))
+	}
+	if meta.CfList == nil {
+		return nil
+	}
+	channels, ok := cfListChannels[meta.FrequencyPlan]
+	if !ok {
+		return errors.NewErrInvalidArgument("CfList", fmt.Sprintf("not supported in frequency plan %s", meta.FrequencyPlan))
+	}
+	switch {
+	case len(meta.CfList.Freq) == 0:
+		return errors.NewErrInvalidArgument("CfList", "has no frequencies")
+	case len(meta.CfList.Freq) > channels:
+		return errors.NewErrInvalidArgument("CfList", fmt.Sprintf("has more than %d frequencies in frequency plan %s", channels, meta.FrequencyPlan))
+	}
+	for _, freq := range meta.CfList.Freq {
+		if freq%100 != 0 || freq > maxCFListFreq {
+			return errors.NewErrInvalidArgument("CfList", fmt.Sprintf("frequency %d is not a multiple of 100 Hz up to %d Hz", freq, maxCFListFreq))
+		}
+	}
+	return nil
+}
+
+// Errors for the causes of failed joins, blocked devices get ErrDeviceBlocked and devices outside
+// the DevEUIAllowlist get ErrDevEUINotAllowed
+var (
+	ErrJoinDeviceUnknown        = errors.NewErrNotFound("Device")
+	ErrJoinDeviceBoundElsewhere = errors.NewErrPermissionDenied("Device bound to another application")
+	ErrJoinNoPrefix             = errors.NewErrNotFound("DevAddr prefix")
+	ErrJoinMissingMetadata      = errors.NewErrInvalidArgument("Activation", "missing metadata")
+	ErrJoinReplay               = errors.NewErrPermissionDenied("DevNonce already used")
+	ErrJoinDevAddrOutside       = errors.NewErrInvalidArgument("DevAddr", "not in a prefix of the NetworkServer")
+	ErrJoinNetIDMismatch        = errors.NewErrInternal("DevAddr does not match the NwkID of the NetID")
+)
+
+// JoinFailureCause returns a label for the cause of a failed join, for example for metrics
+func JoinFailureCause(err error) string {
+	switch errs.Cause(err) {
+	case nil:
+		return ""
+	case ErrJoinDeviceUnknown:
+		return "device unknown"
+	case ErrJoinDeviceBoundElsewhere:
+		return "device bound elsewhere"
+	case ErrJoinNoPrefix:
+		return "no prefix"
+	case ErrJoinMissingMetadata:
+		return "missing metadata"
+	case ErrJoinReplay:
+		return "replay"
+	case ErrJoinDevAddrOutside:
+		return "devaddr outside prefixes"
+	case ErrJoinNetIDMismatch:
+		return "netid mismatch"
+	case ErrDeviceBlocked:
+		return "blocked"
+	case ErrDevEUINotAllowed:
+		return "devEUI not allowed"
+	case ErrZeroAppEUI, ErrZeroDevEUI:
+		return "zero EUI"
+	}
+	return "other"
+}
 
-	// Get a random prefix that matches the constraints
+// getJoinDevice returns the device for a join, or the device with the DevEUI under a different AppEUI
+// according to the CrossAppActivation policy
+func (n *networkServer) getJoinDevice(appEUI types.AppEUI, devEUI types.DevEUI) (*device.Device, error) {
+	dev, err := n.devices.Get(appEUI, devEUI)
+	if errors.IsNotFound(err) {
+		return n.getCrossAppDevice(devEUI)
+	}
+	return dev, err
+}
+
+// getDevAddr requests a DevAddr in a prefix that matches the constraints from the DevAddrCoordinator
+func (n *networkServer) getDevAddr(constraints ...string) (types.DevAddr, error) {
+	// Get the prefixes that match the constraints
 	prefixes := n.GetPrefixesFor(constraints...)
 	if len(prefixes) == 0 {
-		return types.DevAddr{}, errors.NewErrNotFound(fmt.Sprintf("DevAddr prefix with constraints %v", constraints))
+		return types.DevAddr{}, errors.Wrapf(ErrJoinNoPrefix, "constraints %v", constraints)
 	}
 
-	// Select a prefix
-	prefix := prefixes[pseudorandom.Intn(len(prefixes))]
-
-	// Apply the prefix
-	devAddr = devAddr.WithPrefix(prefix)
+	coordinator := n.getDevAddrCoordinator()
+	devAddr, err := coordinator.RequestDevAddr(prefixes)
+	if err != nil {
+		return types.DevAddr{}, err
+	}
+	if err := checkCoordinatedDevAddr(devAddr, prefixes); err != nil {
+		coordinator.ReleaseDevAddr(devAddr)
+		return types.DevAddr{}, err
+	}
 
 	return devAddr, nil
 }
 
+// DevAddrFallbackConstraints are the activation constraints that are used when no prefix matches the constraints
+// of a device, so that the device still gets a best-effort DevAddr. The "otaa" constraint is always added. The
+// default of nil disables the fallback.
+var DevAddrFallbackConstraints []string
+
+// getDevAddrWithFallback requests a DevAddr for the constraints, or for the DevAddrFallbackConstraints if no prefix
+// matches the constraints
+func (n *networkServer) getDevAddrWithFallback(constraints ...string) (types.DevAddr, error) {
+	devAddr, err := n.getDevAddr(constraints...)
+	if errs.Cause(err) != ErrJoinNoPrefix || DevAddrFallbackConstraints == nil {
+		return devAddr, err
+	}
+	fallback := append(append([]string{}, DevAddrFallbackConstraints...), "otaa")
+	n.Ctx.WithField("Constraints", constraints).WithField("FallbackConstraints", fallback).Warn("No prefix matches the activation constraints, using fallback constraints")
+	return n.getDevAddr(fallback...)
+}
+
+// checkDevAddr checks that a DevAddr that was assigned by the caller is in a prefix that matches the constraints
+func (n *networkServer) checkDevAddr(devAddr types.DevAddr, constraints ...string) (types.DevAddr, error) {
+	for _, prefix := range n.GetPrefixesFor(constraints...) {
+		if devAddr.HasPrefix(prefix) {
+			return devAddr, nil
+		}
+	}
+	return types.DevAddr{}, errors.Wrapf(ErrJoinDevAddrOutside, "DevAddr %s with constraints %v", devAddr, constraints)
+}
+
+// JoinAcceptKeyFunc returns the AppKey of a device
+type JoinAcceptKeyFunc func(appEUI types.AppEUI, devEUI types.DevEUI) (types.AppKey, error)
+
+// SetJoinAcceptKey makes the NetworkServer set the MIC and encrypt the JoinAccept itself,
+// using the AppKey returned by the given function. Normally the Handler owns the AppKey
+// and does this, so this should only be used for testing the full join procedure.
+func (n *networkServer) SetJoinAcceptKey(key JoinAcceptKeyFunc) {
+	n.joinAcceptKey = key
+}
+
 func (n *networkServer) HandlePrepareActivation(activation *pb_broker.DeduplicatedDeviceActivationRequest) (*pb_broker.DeduplicatedDeviceActivationRequest, error) {
+	start := time.Now()
+	res, err := n.prepareActivation(activation)
+	n.observeActivationPhase(PrepareActivationPhase, start)
+	if err == nil && activation.DevEui != nil {
+		n.prepareActivationStarted(*activation.DevEui, start)
+	}
+	if err != nil {
+		meta := &pb_lorawan.ActivationMetadata{AppEui: activation.AppEui, DevEui: activation.DevEui}
+		if lorawanMeta := activation.GetActivationMetadata().GetLorawan(); lorawanMeta != nil {
+			meta.DevAddr = lorawanMeta.DevAddr
+		}
+		n.auditActivation(meta, err)
+	}
+	return res, err
+}
+
+func (n *networkServer) prepareActivation(activation *pb_broker.DeduplicatedDeviceActivationRequest) (_ *pb_broker.DeduplicatedDeviceActivationRequest, err error) {
 	if activation.AppEui == nil || activation.DevEui == nil {
-		return nil, errors.NewErrInvalidArgument("Activation", "missing AppEUI or DevEUI")
+		return nil, ErrJoinMissingMetadata
+	}
+	if err := validateEUIs(activation.AppEui, activation.DevEui); err != nil {
+		return nil, err
+	}
+	if !devEUIAllowed(*activation.DevEui) {
+		activation.Trace = activation.Trace.WithEvent(trace.DropEvent, "reason", "DevEUI not allowed")
+		return nil, ErrDevEUINotAllowed
 	}
-	dev, err := n.devices.Get(*activation.AppEui, *activation.DevEui)
+	getStart := time.Now()
+	dev, err := n.getJoinDevice(*activation.AppEui, *activation.DevEui)
+	n.observeActivationPhase(GetDevicePhase, getStart)
 	if err != nil {
 		return nil, err
 	}
+	if dev.Blocked {
+		activation.Trace = activation.Trace.WithEvent(trace.DropEvent, "reason", "device blocked")
+		return nil, ErrDeviceBlocked
+	}
+
+	// A JoinRequest with the DevNonce of the current session is a replay
+	joinReq := activation.GetMessage().GetLorawan().GetJoinRequestPayload()
+	if joinReq != nil && !dev.DevAddr.IsEmpty() && joinReq.DevNonce == dev.LastDevNonce {
+		activation.Trace = activation.Trace.WithEvent(trace.DropEvent, "reason", "DevNonce already used")
+		return nil, ErrJoinReplay
+	}
 	activation.AppId = dev.AppID
 	activation.DevId = dev.DevID
 
@@ -64,20 +266,77 @@ func (n *networkServer) HandlePrepareActivation(activation *pb_broker.Deduplicat
 	// We can only activate LoRaWAN devices
 	lorawanMeta := activation.GetActivationMetadata().GetLorawan()
 	if lorawanMeta == nil {
-		return nil, errors.NewErrInvalidArgument("Activation", "missing LoRaWAN metadata")
+		return nil, ErrJoinMissingMetadata
 	}
 
-	// Allocate a  device address
-	activation.Trace = activation.Trace.WithEvent("allocate devaddr")
-	devAddr, err := n.getDevAddr(activationConstraints...)
+	// Allocate a device address, unless the caller assigned one
+	allocateStart := time.Now()
+	var devAddr types.DevAddr
+	lorawanMeta.DevAddrRequested = false
+	if lorawanMeta.DevAddr != nil && !lorawanMeta.DevAddr.IsEmpty() {
+		activation.Trace = activation.Trace.WithEvent("check assigned devaddr")
+		devAddr, err = n.checkDevAddr(*lorawanMeta.DevAddr, activationConstraints...)
+	} else if DeterministicDevAddrs {
+		activation.Trace = activation.Trace.WithEvent("derive devaddr")
+		devAddr, err = n.getDerivedDevAddr(*activation.DevEui, activationConstraints...)
+	} else {
+		activation.Trace = activation.Trace.WithEvent("allocate devaddr")
+		devAddr, err = n.getDevAddrWithFallback(activationConstraints...)
+		if err == nil {
+			// HandleActivate confirms or releases the DevAddr, as the Handler returns the activation metadata
+			lorawanMeta.DevAddrRequested = true
+			// Release the allocated DevAddr if the rest of the preparation fails
+			defer func() {
+				if err != nil {
+					n.confirmDevAddr(&devAddr, err)
+				}
+			}()
+		}
+	}
+	n.observeActivationPhase(AllocateDevAddrPhase, allocateStart)
 	if err != nil {
 		return nil, err
 	}
+	if CheckJoinAcceptNetID {
+		if err = n.checkDevAddrNetID(devAddr); err != nil {
+			n.Ctx.WithField("DevAddr", devAddr).WithField("NetID", types.NetID(n.netID)).Error("DevAddr does not match the NetID of the JoinAccept")
+			return nil, err
+		}
+	}
 
 	// Set the DevAddr in the Activation Metadata
 	lorawanMeta.DevAddr = &devAddr
+	if prefix, ok := n.getPrefix(devAddr); ok {
+		activation.Trace = activation.Trace.WithEvent("select devaddr prefix", "prefix", prefix.String())
+	}
+
+	// Use the defaults of the prefix for downlink settings that are not set
+	if settings, ok := n.getDownlinkSettings(devAddr); ok {
+		if lorawanMeta.Rx1DrOffset == 0 {
+			lorawanMeta.Rx1DrOffset = settings.Rx1DrOffset
+		}
+		if lorawanMeta.Rx2Dr == 0 {
+			lorawanMeta.Rx2Dr = settings.Rx2Dr
+		}
+		if lorawanMeta.RxDelay == 0 {
+			lorawanMeta.RxDelay = settings.RxDelay
+		}
+	}
+
+	if lorawanMeta.RxDelay == 0 {
+		lorawanMeta.RxDelay = defaultRXDelay(lorawanMeta.FrequencyPlan.String())
+	}
+	fitCFList(lorawanMeta)
+	if err = validateJoinAcceptMetadata(lorawanMeta); err != nil {
+		return nil, err
+	}
 
 	// Build JoinAccept Payload
+	buildStart := time.Now()
+	cfList, cfListType := buildCFList(lorawanMeta)
+	if cfList != nil {
+		activation.Trace = activation.Trace.WithEvent(cfListTypeEvent, "type", cfListType)
+	}
 	phy := lorawan.PHYPayload{
 		MHDR: lorawan.MHDR{
 			MType: lorawan.JoinAccept,
@@ -88,14 +347,22 @@ func (n *networkServer) HandlePrepareActivation(activation *pb_broker.Deduplicat
 			DLSettings: lorawan.DLSettings{RX2DataRate: uint8(lorawanMeta.Rx2Dr), RX1DROffset: uint8(lorawanMeta.Rx1DrOffset)},
 			RXDelay:    uint8(lorawanMeta.RxDelay),
 			DevAddr:    lorawan.DevAddr(devAddr),
+			CFList:     cfList,
 		},
 	}
-	if lorawanMeta.CfList != nil {
-		var cfList lorawan.CFList
-		for i, cfListItem := range lorawanMeta.CfList.Freq {
-			cfList[i] = cfListItem
+
+	// Encrypt the JoinAccept if the NetworkServer has the AppKey
+	if n.joinAcceptKey != nil {
+		appKey, err := n.joinAcceptKey(*activation.AppEui, *activation.DevEui)
+		if err != nil {
+			return nil, err
+		}
+		if err := phy.SetMIC(lorawan.AES128Key(appKey)); err != nil {
+			return nil, err
+		}
+		if err := phy.EncryptJoinAcceptPayload(lorawan.AES128Key(appKey)); err != nil {
+			return nil, err
 		}
-		phy.MACPayload.(*lorawan.JoinAcceptPayload).CFList = &cfList
 	}
 
 	// Set the Payload
@@ -104,54 +371,195 @@ func (n *networkServer) HandlePrepareActivation(activation *pb_broker.Deduplicat
 		return nil, err
 	}
 	activation.ResponseTemplate.Payload = phyBytes
+	n.observeActivationPhase(BuildJoinAcceptPhase, buildStart)
+
+	if joinReq != nil && joinReq.DevNonce != dev.LastDevNonce {
+		dev.StartUpdate()
+		dev.LastDevNonce = joinReq.DevNonce
+		if err := n.devices.Set(dev); err != nil {
+			return nil, err
+		}
+	}
 
 	return activation, nil
 }
 
 func (n *networkServer) HandleActivate(activation *pb_handler.DeviceActivationResponse) (*pb_handler.DeviceActivationResponse, error) {
+	start := time.Now()
+	res, err := n.handleActivate(activation)
+	n.observeActivationPhase(ActivatePhase, start)
+	meta := activation.GetActivationMetadata().GetLorawan()
+	if err == nil && meta != nil && meta.DevEui != nil {
+		n.observeActivationRoundTrip(*meta.DevEui)
+	}
+	n.auditActivation(meta, err)
+	if meta.GetDevAddrRequested() {
+		n.confirmDevAddr(meta.DevAddr, err)
+	}
+	return res, err
+}
+
+func (n *networkServer) handleActivate(activation *pb_handler.DeviceActivationResponse) (*pb_handler.DeviceActivationResponse, error) {
 	meta := activation.GetActivationMetadata()
 	if meta == nil {
-		return nil, errors.NewErrInvalidArgument("Activation", "missing ActivationMetadata")
+		return nil, ErrJoinMissingMetadata
 	}
 	lorawan := meta.GetLorawan()
 	if lorawan == nil {
-		return nil, errors.NewErrInvalidArgument("Activation", "missing LoRaWAN ActivationMetadata")
+		return nil, ErrJoinMissingMetadata
+	}
+	if lorawan.AppEui == nil || lorawan.DevEui == nil || lorawan.DevAddr == nil || lorawan.NwkSKey == nil {
+		return nil, ErrJoinMissingMetadata
+	}
+	if err := validateEUIs(lorawan.AppEui, lorawan.DevEui); err != nil {
+		return nil, err
+	}
+	if !devEUIAllowed(*lorawan.DevEui) {
+		activation.Trace = activation.Trace.WithEvent(trace.DropEvent, "reason", "DevEUI not allowed")
+		return nil, ErrDevEUINotAllowed
 	}
 	n.status.activations.Mark(1)
 
-	dev, err := n.devices.Get(*lorawan.AppEui, *lorawan.DevEui)
+	getStart := time.Now()
+	dev, err := n.getJoinDevice(*lorawan.AppEui, *lorawan.DevEui)
+	n.observeActivationPhase(GetDevicePhase, getStart)
 	if err != nil {
 		return nil, err
 	}
+	if dev.Blocked {
+		activation.Trace = activation.Trace.WithEvent(trace.DropEvent, "reason", "device blocked")
+		return nil, ErrDeviceBlocked
+	}
+
+	// The Handler authenticated the join, so a device that is registered under a different AppEUI can be moved
+	if dev.AppEUI != *lorawan.AppEui {
+		activation.Trace = activation.Trace.WithEvent("rebind device", "app-eui", lorawan.AppEui.String())
+		dev, err = n.rebindDevice(dev, *lorawan.AppEui)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// HandlePrepareActivation stored the DevNonce of the JoinRequest that is activated. If the current session was
+	// started by that JoinRequest and has the same DevAddr and NwkSKey, this is a retry of an activation that was
+	// already handled. A new join with the same DevAddr has another DevNonce and starts a new session.
+	if !dev.NwkSKey.IsEmpty() && dev.SessionDevNonce == dev.LastDevNonce &&
+		dev.DevAddr == *lorawan.DevAddr && dev.NwkSKey == *lorawan.NwkSKey {
+		activation.Trace = activation.Trace.WithEvent(trace.AcceptEvent, "reason", "activation already handled")
+		lorawan.DevAddrRequested = false // The DevAddr was confirmed when the activation was handled
+		setSession(lorawan, dev)
+		return activation, nil
+	}
 
 	activation.Trace = activation.Trace.WithEvent(trace.UpdateStateEvent)
 	dev.StartUpdate()
 
-	dev.LastSeen = time.Now()
+	dev.LastSeen = n.now()
 	dev.UpdatedAt = time.Now()
 	dev.DevAddr = *lorawan.DevAddr
+	dev.DevAddrPrefix, _ = n.getPrefix(dev.DevAddr)
+	dev.SessionStartedAt = n.now()
+	dev.SessionGraceDeadline = time.Time{}
 	dev.NwkSKey = *lorawan.NwkSKey
-	dev.FCntUp = 0
-	dev.FCntDown = 0
-	dev.ADR = device.ADRSettings{Band: dev.ADR.Band, Margin: dev.ADR.Margin}
+	dev.SessionDevNonce = dev.LastDevNonce
+	dev.RXDelay = uint8(lorawan.RxDelay)
+	err = resetSession(dev, joinRequest) // Rejoin-requests are not forwarded to the NetworkServer
+	if err != nil {
+		return nil, err
+	}
 
 	if band := meta.GetLorawan().GetFrequencyPlan().String(); band != "" {
 		dev.ADR.Band = band
 	}
+	dev.RX2DataRate = dataRateName(dev.ADR.Band, int(lorawan.Rx2Dr))
 
-	err = n.devices.Set(dev)
+	setStart := time.Now()
+	err = n.retryActivationStore(func() error {
+		if err := n.devices.Set(dev); err != nil {
+			return err
+		}
+		frames, err := n.devices.Frames(dev.AppEUI, dev.DevEUI)
+		if err != nil {
+			return err
+		}
+		return frames.Clear()
+	})
 	if err != nil {
 		return nil, err
 	}
+	n.observeActivationPhase(SetDevicePhase, setStart)
 
-	frames, err := n.devices.Frames(dev.AppEUI, dev.DevEUI)
-	if err != nil {
-		return nil, err
+	setSession(lorawan, dev)
+
+	return activation, nil
+}
+
+// setSession sets the session of the device in the activation metadata,
+// so that the response confirms the session that is actually stored
+func setSession(meta *pb_lorawan.ActivationMetadata, dev *device.Device) {
+	meta.AppEui = &dev.AppEUI
+	meta.DevEui = &dev.DevEUI
+	meta.DevAddr = &dev.DevAddr
+	meta.NwkSKey = &dev.NwkSKey
+}
+
+type joinType uint8
+
+const (
+	joinRequest joinType = iota
+	rejoinType0
+	rejoinType1
+	rejoinType2
+)
+
+func (t joinType) String() string {
+	switch t {
+	case joinRequest:
+		return "join-request"
+	case rejoinType0:
+		return "rejoin-request type 0"
+	case rejoinType1:
+		return "rejoin-request type 1"
+	case rejoinType2:
+		return "rejoin-request type 2"
 	}
-	err = frames.Clear()
-	if err != nil {
-		return nil, err
+	return "unknown"
+}
+
+// resetSession resets the session state of the device for a new session that
+// was started by a join of the given type:
+//
+//	Version  Join            FCntUp  FCntDown  RJCount0  ADR and RX2
+//	1.0.x    join-request    reset   reset     -         reset
+//	1.0.x    rejoin-request  not supported
+//	1.1      join-request    reset   reset     reset     reset
+//	1.1      rejoin type 0   reset   reset     reset     reset
+//	1.1      rejoin type 1   reset   reset     reset     reset
+//	1.1      rejoin type 2   reset   reset     reset     keep
+//
+// A rejoin-request type 2 only rekeys the device, it keeps its radio
+// parameters, so the ADR and RX2 state stays valid.
+func resetSession(dev *device.Device, t joinType) error {
+	switch dev.MinorVersion {
+	case device.LoRaWAN1_0:
+		if t != joinRequest {
+			return errors.NewErrInvalidArgument("Activation", fmt.Sprintf("%s not supported by LoRaWAN %s devices", t, dev.MinorVersion))
+		}
+	case device.LoRaWAN1_1:
+		dev.RJCount0 = 0
+	default:
+		return errors.NewErrInvalidArgument("Activation", fmt.Sprintf("unknown LoRaWAN minor version %d", dev.MinorVersion))
 	}
 
-	return activation, nil
+	dev.FCntUp = 0
+	dev.FCntDown = 0
+	dev.AppSKey = types.AppSKey{} // The AppSKey of the new session is not known by the network server
+
+	if t != rejoinType2 {
+		dev.ADR = device.ADRSettings{Band: dev.ADR.Band, Margin: dev.ADR.Margin}
+		dev.RX2Frequency = 0
+		dev.RX2DataRate = ""
+	}
+
+	return nil
 }
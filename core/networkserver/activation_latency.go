@@ -0,0 +1,105 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/rcrowley/go-metrics"
+)
+
+// ActivationPhase is a phase of the activation procedure of which the latency is measured
+type ActivationPhase string
+
+// Activation phases
+const (
+	// PrepareActivationPhase is the handling of the JoinRequest in HandlePrepareActivation
+	PrepareActivationPhase ActivationPhase = "prepare"
+	// ActivatePhase is the handling of the session in HandleActivate
+	ActivatePhase ActivationPhase = "activate"
+	// RoundTripPhase is the time between a HandlePrepareActivation and the HandleActivate of the same device
+	RoundTripPhase ActivationPhase = "round_trip"
+	// GetDevicePhase is the reading of the device from the store
+	GetDevicePhase ActivationPhase = "get_device"
+	// AllocateDevAddrPhase is the allocation, derivation or check of the DevAddr
+	AllocateDevAddrPhase ActivationPhase = "allocate_devaddr"
+	// BuildJoinAcceptPhase is the building (and encryption) of the JoinAccept
+	BuildJoinAcceptPhase ActivationPhase = "build_join_accept"
+	// SetDevicePhase is the writing of the activated device to the store
+	SetDevicePhase ActivationPhase = "set_device"
+)
+
+var activationPhases = []ActivationPhase{
+	PrepareActivationPhase,
+	ActivatePhase,
+	RoundTripPhase,
+	GetDevicePhase,
+	AllocateDevAddrPhase,
+	BuildJoinAcceptPhase,
+	SetDevicePhase,
+}
+
+// maxActivationRoundTrip is how long a prepared activation is remembered for the RoundTripPhase
+const maxActivationRoundTrip = time.Minute
+
+func newActivationLatency() map[ActivationPhase]metrics.Histogram {
+	latency := make(map[ActivationPhase]metrics.Histogram, len(activationPhases))
+	for _, phase := range activationPhases {
+		latency[phase] = metrics.NewHistogram(metrics.NewExpDecaySample(1028, 0.015))
+	}
+	return latency
+}
+
+type activationStartCache struct {
+	sync.Mutex
+	prepared map[types.DevEUI]time.Time
+}
+
+// observeActivationPhase records the latency of the phase that started at the given time, in nanoseconds
+func (n *networkServer) observeActivationPhase(phase ActivationPhase, start time.Time) {
+	if n.status == nil {
+		return
+	}
+	n.status.activationLatency[phase].Update(int64(time.Since(start)))
+}
+
+// prepareActivationStarted remembers when the activation of the device was prepared
+func (n *networkServer) prepareActivationStarted(devEUI types.DevEUI, start time.Time) {
+	n.activationStarts.Lock()
+	defer n.activationStarts.Unlock()
+	if n.activationStarts.prepared == nil {
+		n.activationStarts.prepared = make(map[types.DevEUI]time.Time)
+	}
+	for prepared, preparedAt := range n.activationStarts.prepared {
+		if start.Sub(preparedAt) > maxActivationRoundTrip {
+			delete(n.activationStarts.prepared, prepared)
+		}
+	}
+	n.activationStarts.prepared[devEUI] = start
+}
+
+// observeActivationRoundTrip records the RoundTripPhase if the activation of the device was prepared
+func (n *networkServer) observeActivationRoundTrip(devEUI types.DevEUI) {
+	n.activationStarts.Lock()
+	start, ok := n.activationStarts.prepared[devEUI]
+	delete(n.activationStarts.prepared, devEUI)
+	n.activationStarts.Unlock()
+	if ok && time.Since(start) <= maxActivationRoundTrip {
+		n.observeActivationPhase(RoundTripPhase, start)
+	}
+}
+
+// GetActivationLatency returns snapshots of the latency histograms of the activation phases, in nanoseconds
+func (n *networkServer) GetActivationLatency() map[ActivationPhase]metrics.Histogram {
+	latency := make(map[ActivationPhase]metrics.Histogram, len(activationPhases))
+	if n.status == nil {
+		return latency
+	}
+	for phase, histogram := range n.status.activationLatency {
+		latency[phase] = histogram.Snapshot()
+	}
+	return latency
+}
@@ -0,0 +1,74 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_handler "github.com/TheThingsNetwork/ttn/api/handler"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestActivationLatency(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{Ctx: GetLogger(t, "TestActivationLatency")},
+		netID:     [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-activation-latency"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(0, 0, 0, 0, 0, 0, 6, 1))
+	devEUI := types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 6, 1))
+	a.So(ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	res, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+		DevEui: &devEUI,
+		AppEui: &appEUI,
+		ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+			Lorawan: &pb_lorawan.ActivationMetadata{},
+		}},
+		ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+	})
+	a.So(err, ShouldBeNil)
+
+	latency := ns.GetActivationLatency()
+	a.So(latency[PrepareActivationPhase].Count(), ShouldEqual, 1)
+	a.So(latency[AllocateDevAddrPhase].Count(), ShouldEqual, 1)
+	a.So(latency[BuildJoinAcceptPhase].Count(), ShouldEqual, 1)
+	a.So(latency[RoundTripPhase].Count(), ShouldEqual, 0)
+
+	nwkSKey := types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+	_, err = ns.HandleActivate(&pb_handler.DeviceActivationResponse{
+		ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+			Lorawan: &pb_lorawan.ActivationMetadata{
+				AppEui:  &appEUI,
+				DevEui:  &devEUI,
+				DevAddr: res.ActivationMetadata.GetLorawan().DevAddr,
+				NwkSKey: &nwkSKey,
+			},
+		}},
+	})
+	a.So(err, ShouldBeNil)
+
+	latency = ns.GetActivationLatency()
+	a.So(latency[ActivatePhase].Count(), ShouldEqual, 1)
+	a.So(latency[GetDevicePhase].Count(), ShouldEqual, 2)
+	a.So(latency[SetDevicePhase].Count(), ShouldEqual, 1)
+	a.So(latency[RoundTripPhase].Count(), ShouldEqual, 1)
+	a.So(latency[RoundTripPhase].Max(), ShouldBeGreaterThan, 0)
+}
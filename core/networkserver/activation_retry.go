@@ -0,0 +1,43 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/utils/backoff"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// ActivationStoreRetries is how often HandleActivate retries storing the session of a device after a transient
+// store error, so that a short database outage does not make the device join again. 0 disables retries.
+var ActivationStoreRetries = 2
+
+// ActivationStoreBackoff is the backoff between the retries of storing the session of a device. The delays should
+// be short, as the JoinAccept has to reach the device in its join receive windows.
+var ActivationStoreBackoff = backoff.Config{
+	MaxDelay:  500 * time.Millisecond,
+	BaseDelay: 50 * time.Millisecond,
+	Factor:    1.6,
+	Jitter:    0.2,
+}
+
+// transientStoreError returns whether a store error may be gone when retrying, such as a lost connection. Errors
+// of a known type, such as invalid device options, are permanent.
+func transientStoreError(err error) bool {
+	return errors.GetErrType(err) == errors.Unknown
+}
+
+// retryActivationStore calls store until it succeeds, fails with a permanent error or the ActivationStoreRetries
+// are used up
+func (n *networkServer) retryActivationStore(store func() error) (err error) {
+	for retries := 0; ; retries++ {
+		err = store()
+		if err == nil || !transientStoreError(err) || retries >= ActivationStoreRetries {
+			return err
+		}
+		n.Ctx.WithError(err).WithField("Retries", retries+1).Warn("Could not store activation, retrying")
+		time.Sleep(ActivationStoreBackoff.Backoff(retries))
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	pb_handler "github.com/TheThingsNetwork/ttn/api/handler"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+// flakyStore fails the next Set calls with the errors
+type flakyStore struct {
+	device.Store
+	errors []error
+	sets   int
+}
+
+func (s *flakyStore) Set(dev *device.Device, properties ...string) error {
+	s.sets++
+	if len(s.errors) > 0 {
+		err := s.errors[0]
+		s.errors = s.errors[1:]
+		return err
+	}
+	return s.Store.Set(dev, properties...)
+}
+
+func TestHandleActivateStoreRetry(t *testing.T) {
+	a := New(t)
+	store := &flakyStore{Store: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-activate-store-retry")}
+	ns := &networkServer{
+		Component: &component.Component{Ctx: GetLogger(t, "TestHandleActivateStoreRetry")},
+		devices:   store,
+	}
+	ns.InitStatus()
+
+	defer func(retries int) { ActivationStoreRetries = retries }(ActivationStoreRetries)
+	ActivationStoreRetries = 2
+	defer func(delay time.Duration) { ActivationStoreBackoff.BaseDelay = delay }(ActivationStoreBackoff.BaseDelay)
+	ActivationStoreBackoff.BaseDelay = time.Millisecond
+
+	appEUI := types.AppEUI(getEUI(0, 0, 0, 0, 0, 0, 9, 1))
+	devEUI := types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 9, 1))
+	a.So(store.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI}), ShouldBeNil)
+	defer func() {
+		store.Delete(appEUI, devEUI)
+	}()
+
+	activate := func(devAddr types.DevAddr) error {
+		nwkSKey := types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+		_, err := ns.HandleActivate(&pb_handler.DeviceActivationResponse{
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: &pb_lorawan.ActivationMetadata{
+					AppEui:  &appEUI,
+					DevEui:  &devEUI,
+					DevAddr: &devAddr,
+					NwkSKey: &nwkSKey,
+				},
+			}},
+		})
+		return err
+	}
+
+	// A transient error is retried
+	store.errors, store.sets = []error{errors.New("connection reset by peer")}, 0
+	a.So(activate(getDevAddr(0x26, 0x00, 0x00, 0x01)), ShouldBeNil)
+	a.So(store.sets, ShouldEqual, 2)
+	dev, err := store.Get(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(dev.DevAddr, ShouldEqual, getDevAddr(0x26, 0x00, 0x00, 0x01))
+
+	// A permanent error is not retried
+	store.errors, store.sets = []error{errors.NewErrInvalidArgument("Options", "invalid")}, 0
+	a.So(activate(getDevAddr(0x26, 0x00, 0x00, 0x02)), ShouldNotBeNil)
+	a.So(store.sets, ShouldEqual, 1)
+
+	// The retries are bounded
+	transient := errors.New("connection reset by peer")
+	store.errors, store.sets = []error{transient, transient, transient}, 0
+	a.So(activate(getDevAddr(0x26, 0x00, 0x00, 0x03)), ShouldNotBeNil)
+	a.So(store.sets, ShouldEqual, 3)
+}
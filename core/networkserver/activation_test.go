@@ -10,8 +10,10 @@ import (
 	pb_handler "github.com/TheThingsNetwork/ttn/api/handler"
 	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
 	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
 	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
 	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
 	. "github.com/TheThingsNetwork/ttn/utils/testing"
 	"github.com/brocaar/lorawan"
 	. "github.com/smartystreets/assertions"
@@ -137,3 +139,917 @@ func TestHandleActivate(t *testing.T) {
 	})
 	a.So(err, ShouldBeNil)
 }
+
+func TestHandleActivateRetry(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-activate-retry"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(0, 0, 0, 0, 0, 0, 3, 2))
+	devEUI := types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 3, 2))
+	// HandlePrepareActivation stores the DevNonce of the JoinRequest
+	a.So(ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI, LastDevNonce: types.DevNonce{1, 2}}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	devAddr := getDevAddr(0, 0, 3, 2)
+	var nwkSKey types.NwkSKey
+	copy(nwkSKey[:], []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 3, 2})
+	activation := func(nwkSKey types.NwkSKey) *pb_handler.DeviceActivationResponse {
+		return &pb_handler.DeviceActivationResponse{
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: &pb_lorawan.ActivationMetadata{
+					AppEui:        &appEUI,
+					DevEui:        &devEUI,
+					DevAddr:       &devAddr,
+					NwkSKey:       &nwkSKey,
+					FrequencyPlan: pb_lorawan.FrequencyPlan_EU_863_870,
+					Rx2Dr:         3,
+				},
+			}},
+		}
+	}
+
+	_, err := ns.HandleActivate(activation(nwkSKey))
+	a.So(err, ShouldBeNil)
+
+	// The session starts, with the RX2 data rate of the JoinAccept
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	a.So(dev.RX2DataRate, ShouldEqual, "SF9BW125")
+	a.So(dev.SessionDevNonce, ShouldEqual, types.DevNonce{1, 2})
+	dev.StartUpdate()
+	dev.FCntUp, dev.FCntDown = 10, 5
+	a.So(ns.devices.Set(dev), ShouldBeNil)
+
+	// A replay of the identical activation does not reset the counters
+	_, err = ns.HandleActivate(activation(nwkSKey))
+	a.So(err, ShouldBeNil)
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.FCntUp, ShouldEqual, 10)
+	a.So(dev.FCntDown, ShouldEqual, 5)
+
+	// A new join with the same DevAddr, but another DevNonce, resets the session
+	dev.StartUpdate()
+	dev.LastDevNonce = types.DevNonce{3, 4}
+	a.So(ns.devices.Set(dev), ShouldBeNil)
+	_, err = ns.HandleActivate(activation(nwkSKey))
+	a.So(err, ShouldBeNil)
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.FCntUp, ShouldEqual, 0)
+	a.So(dev.FCntDown, ShouldEqual, 0)
+	a.So(dev.SessionDevNonce, ShouldEqual, types.DevNonce{3, 4})
+
+	// So does an activation with another NwkSKey
+	dev.StartUpdate()
+	dev.FCntUp, dev.FCntDown = 10, 5
+	a.So(ns.devices.Set(dev), ShouldBeNil)
+	nwkSKey[0] = 1
+	_, err = ns.HandleActivate(activation(nwkSKey))
+	a.So(err, ShouldBeNil)
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.FCntUp, ShouldEqual, 0)
+	a.So(dev.FCntDown, ShouldEqual, 0)
+	a.So(dev.NwkSKey, ShouldEqual, nwkSKey)
+}
+
+func TestResetSession(t *testing.T) {
+	a := New(t)
+
+	type expected struct {
+		err       bool
+		resetADR  bool
+		resetRJC0 bool
+	}
+
+	tests := map[device.MinorVersion]map[joinType]expected{
+		device.LoRaWAN1_0: {
+			joinRequest: {resetADR: true},
+			rejoinType0: {err: true},
+			rejoinType1: {err: true},
+			rejoinType2: {err: true},
+		},
+		device.LoRaWAN1_1: {
+			joinRequest: {resetADR: true, resetRJC0: true},
+			rejoinType0: {resetADR: true, resetRJC0: true},
+			rejoinType1: {resetADR: true, resetRJC0: true},
+			rejoinType2: {resetRJC0: true},
+		},
+	}
+
+	for version, versionTests := range tests {
+		for jt, exp := range versionTests {
+			dev := &device.Device{
+				MinorVersion: version,
+				FCntUp:       10,
+				FCntDown:     5,
+				RJCount0:     2,
+				RX2Frequency: 869100000,
+				RX2DataRate:  "SF7BW125",
+				ADR:          device.ADRSettings{Band: "EU_863_870", Margin: 10, DataRate: "SF7BW125"},
+			}
+			err := resetSession(dev, jt)
+			if exp.err {
+				a.So(err, ShouldNotBeNil)
+				a.So(dev.FCntUp, ShouldEqual, 10)
+				continue
+			}
+			a.So(err, ShouldBeNil)
+			a.So(dev.FCntUp, ShouldEqual, 0)
+			a.So(dev.FCntDown, ShouldEqual, 0)
+			a.So(dev.ADR.Band, ShouldEqual, "EU_863_870")
+			a.So(dev.ADR.Margin, ShouldEqual, 10)
+			if exp.resetADR {
+				a.So(dev.ADR.DataRate, ShouldBeEmpty)
+				a.So(dev.RX2Frequency, ShouldEqual, 0)
+				a.So(dev.RX2DataRate, ShouldBeEmpty)
+			} else {
+				a.So(dev.ADR.DataRate, ShouldEqual, "SF7BW125")
+				a.So(dev.RX2Frequency, ShouldEqual, 869100000)
+				a.So(dev.RX2DataRate, ShouldEqual, "SF7BW125")
+			}
+			if exp.resetRJC0 {
+				a.So(dev.RJCount0, ShouldEqual, 0)
+			} else {
+				a.So(dev.RJCount0, ShouldEqual, 2)
+			}
+		}
+	}
+
+	a.So(resetSession(&device.Device{MinorVersion: 5}, joinRequest), ShouldNotBeNil)
+}
+
+func TestHandlePrepareActivationPrefixDownlinkSettings(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		netID:    [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{},
+		devices:  device.NewRedisDeviceStore(GetRedisClient(), "test-handle-prepare-activation-prefix-settings"),
+	}
+
+	prefixA := types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 8}
+	prefixB := types.DevAddrPrefix{DevAddr: [4]byte{0x27, 0x00, 0x00, 0x00}, Length: 8}
+	a.So(ns.UsePrefix(prefixA, []string{"otaa", "region-a"}), ShouldBeNil)
+	a.So(ns.UsePrefix(prefixB, []string{"otaa", "region-b"}), ShouldBeNil)
+
+	// Unknown prefix
+	err := ns.SetPrefixDownlinkSettings(types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x01, 0x00, 0x00}, Length: 16}, DownlinkSettings{})
+	a.So(err, ShouldNotBeNil)
+
+	a.So(ns.SetPrefixDownlinkSettings(prefixA, DownlinkSettings{Rx2Dr: 3, RxDelay: 1}), ShouldBeNil)
+	a.So(ns.SetPrefixDownlinkSettings(prefixB, DownlinkSettings{Rx1DrOffset: 2, Rx2Dr: 8, RxDelay: 5}), ShouldBeNil)
+
+	appEUI := types.AppEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 9))
+	devEUI := types.DevEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 9))
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	joinAccept := func(constraint string, meta *pb_lorawan.ActivationMetadata) (types.DevAddr, *lorawan.JoinAcceptPayload) {
+		dev, err := ns.devices.Get(appEUI, devEUI)
+		if err != nil {
+			dev = &device.Device{AppEUI: appEUI, DevEUI: devEUI}
+		}
+		dev.StartUpdate()
+		dev.Options.ActivationConstraints = constraint
+		a.So(ns.devices.Set(dev), ShouldBeNil)
+
+		resp, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			DevEui:             &devEUI,
+			AppEui:             &appEUI,
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{Lorawan: meta}},
+			ResponseTemplate:   &pb_broker.DeviceActivationResponse{},
+		})
+		a.So(err, ShouldBeNil)
+
+		var resPHY lorawan.PHYPayload
+		resPHY.UnmarshalBinary(resp.ResponseTemplate.Payload)
+		resMAC, _ := resPHY.MACPayload.(*lorawan.DataPayload)
+		joinAccept := &lorawan.JoinAcceptPayload{}
+		joinAccept.UnmarshalBinary(false, resMAC.Bytes)
+		return *resp.ActivationMetadata.GetLorawan().DevAddr, joinAccept
+	}
+
+	devAddr, res := joinAccept("region-a", &pb_lorawan.ActivationMetadata{})
+	a.So(devAddr.HasPrefix(prefixA), ShouldBeTrue)
+	a.So(res.DLSettings, ShouldResemble, lorawan.DLSettings{RX2DataRate: 3})
+	a.So(res.RXDelay, ShouldEqual, 1)
+
+	devAddr, res = joinAccept("region-b", &pb_lorawan.ActivationMetadata{})
+	a.So(devAddr.HasPrefix(prefixB), ShouldBeTrue)
+	a.So(res.DLSettings, ShouldResemble, lorawan.DLSettings{RX1DROffset: 2, RX2DataRate: 8})
+	a.So(res.RXDelay, ShouldEqual, 5)
+
+	// Settings from the caller take precedence
+	devAddr, res = joinAccept("region-b", &pb_lorawan.ActivationMetadata{Rx2Dr: 9, RxDelay: 2})
+	a.So(devAddr.HasPrefix(prefixB), ShouldBeTrue)
+	a.So(res.DLSettings, ShouldResemble, lorawan.DLSettings{RX1DROffset: 2, RX2DataRate: 9})
+	a.So(res.RXDelay, ShouldEqual, 2)
+}
+
+func TestHandlePrepareActivationJoinAcceptKey(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-prepare-activation-join-accept-key"),
+	}
+
+	appEUI := types.AppEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 10))
+	devEUI := types.DevEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 10))
+	appKey := types.AppKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+
+	a.So(ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	ns.SetJoinAcceptKey(func(appEUI types.AppEUI, devEUI types.DevEUI) (types.AppKey, error) {
+		return appKey, nil
+	})
+
+	resp, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+		DevEui: &devEUI,
+		AppEui: &appEUI,
+		ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+			Lorawan: &pb_lorawan.ActivationMetadata{Rx1DrOffset: 1, Rx2Dr: 3, RxDelay: 1},
+		}},
+		ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+	})
+	a.So(err, ShouldBeNil)
+	devAddr := resp.ActivationMetadata.GetLorawan().DevAddr
+
+	var resPHY lorawan.PHYPayload
+	a.So(resPHY.UnmarshalBinary(resp.ResponseTemplate.Payload), ShouldBeNil)
+	a.So(resPHY.DecryptJoinAcceptPayload(lorawan.AES128Key(appKey)), ShouldBeNil)
+	ok, err := resPHY.ValidateMIC(lorawan.AES128Key(appKey))
+	a.So(err, ShouldBeNil)
+	a.So(ok, ShouldBeTrue)
+
+	joinAccept, ok := resPHY.MACPayload.(*lorawan.JoinAcceptPayload)
+	a.So(ok, ShouldBeTrue)
+	a.So(types.DevAddr(joinAccept.DevAddr), ShouldEqual, *devAddr)
+	a.So(joinAccept.DLSettings, ShouldResemble, lorawan.DLSettings{RX1DROffset: 1, RX2DataRate: 3})
+	a.So(joinAccept.RXDelay, ShouldEqual, 1)
+}
+
+func TestHandleActivateResponse(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-activate-response"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(0, 0, 0, 0, 0, 0, 3, 3))
+	devEUI := types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 3, 3))
+	a.So(ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// Missing session
+	_, err := ns.HandleActivate(&pb_handler.DeviceActivationResponse{
+		ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+			Lorawan: &pb_lorawan.ActivationMetadata{AppEui: &appEUI, DevEui: &devEUI},
+		}},
+	})
+	a.So(err, ShouldNotBeNil)
+
+	prepared, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+		DevEui:             &devEUI,
+		AppEui:             &appEUI,
+		ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{Lorawan: &pb_lorawan.ActivationMetadata{}}},
+		ResponseTemplate:   &pb_broker.DeviceActivationResponse{},
+	})
+	a.So(err, ShouldBeNil)
+	preparedDevAddr := *prepared.ActivationMetadata.GetLorawan().DevAddr
+
+	// The Handler adds the NwkSKey
+	meta := prepared.ActivationMetadata
+	nwkSKey := types.NwkSKey{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 3, 3}
+	meta.GetLorawan().AppEui = &appEUI
+	meta.GetLorawan().DevEui = &devEUI
+	meta.GetLorawan().NwkSKey = &nwkSKey
+
+	res, err := ns.HandleActivate(&pb_handler.DeviceActivationResponse{ActivationMetadata: meta})
+	a.So(err, ShouldBeNil)
+	a.So(*res.ActivationMetadata.GetLorawan().DevAddr, ShouldEqual, preparedDevAddr)
+	a.So(*res.ActivationMetadata.GetLorawan().NwkSKey, ShouldEqual, nwkSKey)
+
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	a.So(dev.DevAddr, ShouldEqual, preparedDevAddr)
+}
+
+func TestHandlePrepareActivationRXDelay(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-prepare-activation-rx-delay"),
+	}
+
+	appEUI := types.AppEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 11))
+	devEUI := types.DevEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 11))
+	a.So(ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	prepare := func(rxDelay uint32) (*lorawan.JoinAcceptPayload, error) {
+		resp, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			DevEui: &devEUI,
+			AppEui: &appEUI,
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: &pb_lorawan.ActivationMetadata{RxDelay: rxDelay},
+			}},
+			ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+		})
+		if err != nil {
+			return nil, err
+		}
+		var resPHY lorawan.PHYPayload
+		resPHY.UnmarshalBinary(resp.ResponseTemplate.Payload)
+		resMAC, _ := resPHY.MACPayload.(*lorawan.DataPayload)
+		joinAccept := &lorawan.JoinAcceptPayload{}
+		joinAccept.UnmarshalBinary(false, resMAC.Bytes)
+		return joinAccept, nil
+	}
+
+	// Unset
+	joinAccept, err := prepare(0)
+	a.So(err, ShouldBeNil)
+	a.So(joinAccept.RXDelay, ShouldEqual, DefaultRXDelay)
+
+	// Valid
+	joinAccept, err = prepare(5)
+	a.So(err, ShouldBeNil)
+	a.So(joinAccept.RXDelay, ShouldEqual, 5)
+
+	joinAccept, err = prepare(15)
+	a.So(err, ShouldBeNil)
+	a.So(joinAccept.RXDelay, ShouldEqual, 15)
+
+	// Out of range
+	_, err = prepare(16)
+	a.So(err, ShouldNotBeNil)
+}
+
+func TestHandlePrepareActivationRegionRXDelay(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-prepare-activation-region-rx-delay"),
+	}
+
+	defer func(rxDelays map[string]uint32) { RegionRXDelays = rxDelays }(RegionRXDelays)
+	RegionRXDelays = map[string]uint32{"US_902_928": 5}
+
+	appEUI := types.AppEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 19))
+	devEUI := types.DevEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 19))
+	a.So(ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	prepare := func(frequencyPlan pb_lorawan.FrequencyPlan, rxDelay uint32) *lorawan.JoinAcceptPayload {
+		resp, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			DevEui: &devEUI,
+			AppEui: &appEUI,
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: &pb_lorawan.ActivationMetadata{FrequencyPlan: frequencyPlan, RxDelay: rxDelay},
+			}},
+			ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+		})
+		a.So(err, ShouldBeNil)
+		var resPHY lorawan.PHYPayload
+		resPHY.UnmarshalBinary(resp.ResponseTemplate.Payload)
+		resMAC, _ := resPHY.MACPayload.(*lorawan.DataPayload)
+		joinAccept := &lorawan.JoinAcceptPayload{}
+		joinAccept.UnmarshalBinary(false, resMAC.Bytes)
+		return joinAccept
+	}
+
+	// Omitted: region default
+	a.So(prepare(pb_lorawan.FrequencyPlan_US_902_928, 0).RXDelay, ShouldEqual, 5)
+
+	// Set by the caller
+	a.So(prepare(pb_lorawan.FrequencyPlan_US_902_928, 2).RXDelay, ShouldEqual, 2)
+
+	// Region without default
+	a.So(prepare(pb_lorawan.FrequencyPlan_AU_915_928, 0).RXDelay, ShouldEqual, DefaultRXDelay)
+}
+
+func TestParseRegionRXDelay(t *testing.T) {
+	a := New(t)
+
+	region, rxDelay, err := ParseRegionRXDelay("EU_863_870=5")
+	a.So(err, ShouldBeNil)
+	a.So(region, ShouldEqual, "EU_863_870")
+	a.So(rxDelay, ShouldEqual, 5)
+
+	for _, invalid := range []string{"EU_863_870", "NOWHERE=5", "EU_863_870=0", "EU_863_870=16", "EU_863_870=x"} {
+		_, _, err := ParseRegionRXDelay(invalid)
+		a.So(err, ShouldNotBeNil)
+	}
+}
+
+func TestHandlePrepareActivationMetadataValidation(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-prepare-activation-metadata-validation"),
+	}
+
+	appEUI := types.AppEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 12))
+	devEUI := types.DevEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 12))
+	a.So(ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	prepare := func(meta *pb_lorawan.ActivationMetadata) error {
+		_, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			DevEui: &devEUI,
+			AppEui: &appEUI,
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: meta,
+			}},
+			ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+		})
+		return err
+	}
+
+	a.So(prepare(&pb_lorawan.ActivationMetadata{
+		Rx1DrOffset: 7,
+		Rx2Dr:       15,
+		RxDelay:     15,
+		CfList:      &pb_lorawan.CFList{Freq: []uint32{867100000, 867300000, 867500000, 0, 867900000}},
+	}), ShouldBeNil)
+
+	for field, meta := range map[string]*pb_lorawan.ActivationMetadata{
+		"RxDelay":     {RxDelay: 16},
+		"Rx1DrOffset": {Rx1DrOffset: 8},
+		"Rx2Dr":       {Rx2Dr: 16},
+		"CfList":      {CfList: &pb_lorawan.CFList{}},
+	} {
+		err := prepare(meta)
+		a.So(err, ShouldNotBeNil)
+		a.So(errors.GetErrType(err), ShouldEqual, errors.InvalidArgument)
+		a.So(err.Error(), ShouldStartWith, field)
+	}
+
+	// Inconsistent CFLists
+	for _, meta := range []*pb_lorawan.ActivationMetadata{
+		{CfList: &pb_lorawan.CFList{Freq: []uint32{867100000, 867300000, 867500000, 867700000, 867900000, 868100000}}},
+		{CfList: &pb_lorawan.CFList{Freq: []uint32{867100050}}},
+		{CfList: &pb_lorawan.CFList{Freq: []uint32{1700000000}}},
+		{CfList: &pb_lorawan.CFList{Freq: []uint32{867100000}}, FrequencyPlan: pb_lorawan.FrequencyPlan_US_902_928},
+	} {
+		err := prepare(meta)
+		a.So(err, ShouldNotBeNil)
+		a.So(err.Error(), ShouldStartWith, "CfList")
+	}
+}
+
+func TestHandlePrepareActivationCFListType(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-prepare-activation-cflist-type"),
+	}
+
+	appEUI := types.AppEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 20))
+	devEUI := types.DevEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 20))
+	a.So(ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	cfListType := func(meta *pb_lorawan.ActivationMetadata) (cfListType string, ok bool) {
+		res, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			DevEui:             &devEUI,
+			AppEui:             &appEUI,
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{Lorawan: meta}},
+			ResponseTemplate:   &pb_broker.DeviceActivationResponse{},
+		})
+		a.So(err, ShouldBeNil)
+		for _, trace := range res.Trace.Flatten() {
+			if trace.Event == cfListTypeEvent {
+				cfListType, ok = trace.Metadata["type"], true
+			}
+		}
+		return
+	}
+
+	// Frequencies
+	typ, ok := cfListType(&pb_lorawan.ActivationMetadata{
+		FrequencyPlan: pb_lorawan.FrequencyPlan_EU_863_870,
+		CfList:        &pb_lorawan.CFList{Freq: []uint32{867100000, 867300000, 867500000, 867700000, 867900000}},
+	})
+	a.So(ok, ShouldBeTrue)
+	a.So(typ, ShouldEqual, CFListFrequencies.String())
+
+	// No CFList
+	_, ok = cfListType(&pb_lorawan.ActivationMetadata{FrequencyPlan: pb_lorawan.FrequencyPlan_US_902_928})
+	a.So(ok, ShouldBeFalse)
+}
+
+func TestHandlePrepareActivationCFList(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-prepare-activation-cflist"),
+	}
+
+	defer func(policy CFListOverflowPolicy) {
+		CFListOverflow = policy
+	}(CFListOverflow)
+
+	appEUI := types.AppEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 13))
+	devEUI := types.DevEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 13))
+	a.So(ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	prepare := func(frequencyPlan pb_lorawan.FrequencyPlan, freqs ...uint32) (*lorawan.CFList, error) {
+		resp, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			DevEui: &devEUI,
+			AppEui: &appEUI,
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: &pb_lorawan.ActivationMetadata{
+					FrequencyPlan: frequencyPlan,
+					CfList:        &pb_lorawan.CFList{Freq: freqs},
+				},
+			}},
+			ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+		})
+		if err != nil {
+			return nil, err
+		}
+		var phy lorawan.PHYPayload
+		a.So(phy.UnmarshalBinary(resp.ResponseTemplate.Payload), ShouldBeNil)
+		joinAccept := &lorawan.JoinAcceptPayload{}
+		a.So(joinAccept.UnmarshalBinary(false, phy.MACPayload.(*lorawan.DataPayload).Bytes), ShouldBeNil)
+		return joinAccept.CFList, nil
+	}
+
+	// The full set of extra channels
+	cfList, err := prepare(pb_lorawan.FrequencyPlan_EU_863_870, 867100000, 867300000, 867500000, 867700000, 867900000)
+	a.So(err, ShouldBeNil)
+	a.So(*cfList, ShouldEqual, lorawan.CFList{867100000, 867300000, 867500000, 867700000, 867900000})
+
+	// KR920-923 has 4 extra channels, the unused fifth channel of the Router is accepted
+	cfList, err = prepare(pb_lorawan.FrequencyPlan_KR_920_923, 922700000, 922900000, 923100000, 923300000, 0)
+	a.So(err, ShouldBeNil)
+	a.So(*cfList, ShouldEqual, lorawan.CFList{922700000, 922900000, 923100000, 923300000, 0})
+
+	// A fifth channel is rejected by default
+	_, err = prepare(pb_lorawan.FrequencyPlan_KR_920_923, 922700000, 922900000, 923100000, 923300000, 923500000)
+	a.So(err, ShouldNotBeNil)
+	a.So(err.Error(), ShouldStartWith, "CfList")
+
+	// or dropped when truncating
+	CFListOverflow = CFListOverflowTruncate
+	cfList, err = prepare(pb_lorawan.FrequencyPlan_KR_920_923, 922700000, 922900000, 923100000, 923300000, 923500000)
+	a.So(err, ShouldBeNil)
+	a.So(*cfList, ShouldEqual, lorawan.CFList{922700000, 922900000, 923100000, 923300000, 0})
+
+	cfList, err = prepare(pb_lorawan.FrequencyPlan_EU_863_870, 867100000, 867300000, 867500000, 867700000, 867900000, 868100000)
+	a.So(err, ShouldBeNil)
+	a.So(*cfList, ShouldEqual, lorawan.CFList{867100000, 867300000, 867500000, 867700000, 867900000})
+
+	// Frequency plans without CFList of frequencies are still rejected
+	_, err = prepare(pb_lorawan.FrequencyPlan_US_902_928, 903900000)
+	a.So(err, ShouldNotBeNil)
+}
+
+func TestHandlePrepareActivationFallbackConstraints(t *testing.T) {
+	a := New(t)
+	prefix := types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandlePrepareActivationFallbackConstraints"),
+		},
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			prefix: []string{"otaa", "local"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-prepare-activation-fallback-constraints"),
+	}
+
+	defer func(constraints []string) {
+		DevAddrFallbackConstraints = constraints
+	}(DevAddrFallbackConstraints)
+
+	appEUI := types.AppEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 13))
+	devEUI := types.DevEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 13))
+	a.So(ns.devices.Set(&device.Device{
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		Options: device.Options{ActivationConstraints: "private"},
+	}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	prepare := func() (*pb_broker.DeduplicatedDeviceActivationRequest, error) {
+		return ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			DevEui: &devEUI,
+			AppEui: &appEUI,
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: &pb_lorawan.ActivationMetadata{},
+			}},
+			ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+		})
+	}
+
+	// No prefix for the private constraint
+	_, err := prepare()
+	a.So(JoinFailureCause(err), ShouldEqual, "no prefix")
+
+	// The fallback constraints match the prefix
+	DevAddrFallbackConstraints = []string{"local"}
+	res, err := prepare()
+	a.So(err, ShouldBeNil)
+	a.So(res.GetActivationMetadata().GetLorawan().DevAddr.HasPrefix(prefix), ShouldBeTrue)
+
+	// Fallback constraints without a prefix
+	DevAddrFallbackConstraints = []string{"abp"}
+	_, err = prepare()
+	a.So(JoinFailureCause(err), ShouldEqual, "no prefix")
+}
+
+func TestJoinFailureCauses(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-join-failure-causes"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devNonce := types.DevNonce{1, 2}
+
+	prepare := func(devNonce types.DevNonce) error {
+		message := new(pb_protocol.Message)
+		message.InitLoRaWAN().Payload = &pb_lorawan.Message_JoinRequestPayload{JoinRequestPayload: &pb_lorawan.JoinRequestPayload{
+			AppEui:   appEUI,
+			DevEui:   devEUI,
+			DevNonce: devNonce,
+		}}
+		_, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			AppEui:  &appEUI,
+			DevEui:  &devEUI,
+			Message: message,
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: &pb_lorawan.ActivationMetadata{},
+			}},
+			ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+		})
+		return err
+	}
+
+	// Missing metadata
+	_, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{})
+	a.So(err, ShouldEqual, ErrJoinMissingMetadata)
+	a.So(JoinFailureCause(err), ShouldEqual, "missing metadata")
+	_, err = ns.HandleActivate(&pb_handler.DeviceActivationResponse{})
+	a.So(err, ShouldEqual, ErrJoinMissingMetadata)
+
+	// Device unknown
+	err = prepare(devNonce)
+	a.So(err, ShouldEqual, ErrJoinDeviceUnknown)
+	a.So(errors.GetErrType(err), ShouldEqual, errors.NotFound)
+	a.So(JoinFailureCause(err), ShouldEqual, "device unknown")
+
+	dev := &device.Device{AppEUI: appEUI, DevEUI: devEUI}
+	ns.devices.Set(dev)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// No prefix
+	err = prepare(devNonce)
+	a.So(errors.GetErrType(err), ShouldEqual, errors.NotFound)
+	a.So(JoinFailureCause(err), ShouldEqual, "no prefix")
+
+	ns.prefixes = map[types.DevAddrPrefix][]string{
+		types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa"},
+	}
+	a.So(prepare(devNonce), ShouldBeNil)
+
+	// Replay of the JoinRequest of the current session
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	dev.StartUpdate()
+	dev.DevAddr = getDevAddr(0x26, 0x00, 0x00, 0x01)
+	ns.devices.Set(dev)
+	err = prepare(devNonce)
+	a.So(err, ShouldEqual, ErrJoinReplay)
+	a.So(JoinFailureCause(err), ShouldEqual, "replay")
+	a.So(prepare(types.DevNonce{1, 3}), ShouldBeNil)
+
+	// Blocked
+	a.So(ns.BlockDevice(appEUI, devEUI), ShouldBeNil)
+	err = prepare(types.DevNonce{1, 4})
+	a.So(err, ShouldEqual, ErrDeviceBlocked)
+	a.So(JoinFailureCause(err), ShouldEqual, "blocked")
+
+	a.So(JoinFailureCause(nil), ShouldEqual, "")
+}
+
+func TestHandlePrepareActivationAssignedDevAddr(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		netID:    [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{},
+		devices:  device.NewRedisDeviceStore(GetRedisClient(), "test-handle-prepare-activation-assigned-devaddr"),
+	}
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 8}, []string{"otaa"}), ShouldBeNil)
+
+	appEUI := types.AppEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 9))
+	devEUI := types.DevEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 9))
+	ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	prepare := func(devAddr types.DevAddr) (*pb_broker.DeduplicatedDeviceActivationRequest, error) {
+		return ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			DevEui: &devEUI,
+			AppEui: &appEUI,
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: &pb_lorawan.ActivationMetadata{DevAddr: &devAddr},
+			}},
+			ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+		})
+	}
+
+	// An assigned DevAddr in the prefix is used
+	assigned := getDevAddr(0x26, 0x01, 0x02, 0x03)
+	resp, err := prepare(assigned)
+	a.So(err, ShouldBeNil)
+	a.So(*resp.ActivationMetadata.GetLorawan().DevAddr, ShouldEqual, assigned)
+
+	var resPHY lorawan.PHYPayload
+	resPHY.UnmarshalBinary(resp.ResponseTemplate.Payload)
+	resMAC, _ := resPHY.MACPayload.(*lorawan.DataPayload)
+	joinAccept := &lorawan.JoinAcceptPayload{}
+	joinAccept.UnmarshalBinary(false, resMAC.Bytes)
+	a.So(types.DevAddr(joinAccept.DevAddr), ShouldEqual, assigned)
+
+	// An assigned DevAddr outside the prefixes is rejected
+	_, err = prepare(getDevAddr(0x27, 0x01, 0x02, 0x03))
+	a.So(err, ShouldNotBeNil)
+	a.So(JoinFailureCause(err), ShouldEqual, "devaddr outside prefixes")
+
+	// Without an assigned DevAddr, one is allocated
+	resp, err = prepare(types.DevAddr{})
+	a.So(err, ShouldBeNil)
+	a.So(resp.ActivationMetadata.GetLorawan().DevAddr.IsEmpty(), ShouldBeFalse)
+}
+
+func TestHandlePrepareActivationNetIDMismatch(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandlePrepareActivationNetIDMismatch"),
+		},
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-prepare-activation-netid-mismatch"),
+	}
+
+	defer func(check bool) {
+		CheckJoinAcceptNetID = check
+	}(CheckJoinAcceptNetID)
+	CheckJoinAcceptNetID = true
+
+	appEUI := types.AppEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 14))
+	devEUI := types.DevEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 14))
+	ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	prepare := func() (*pb_broker.DeduplicatedDeviceActivationRequest, error) {
+		return ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			DevEui: &devEUI,
+			AppEui: &appEUI,
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: &pb_lorawan.ActivationMetadata{},
+			}},
+			ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+		})
+	}
+
+	// The DevAddr contains the NwkID of the NetID
+	resp, err := prepare()
+	a.So(err, ShouldBeNil)
+	var resPHY lorawan.PHYPayload
+	resPHY.UnmarshalBinary(resp.ResponseTemplate.Payload)
+	resMAC, _ := resPHY.MACPayload.(*lorawan.DataPayload)
+	joinAccept := &lorawan.JoinAcceptPayload{}
+	joinAccept.UnmarshalBinary(false, resMAC.Bytes)
+	a.So(types.NetID(joinAccept.NetID), ShouldEqual, types.NetID(ns.netID))
+	a.So(types.DevAddr(joinAccept.DevAddr).NwkID(), ShouldEqual, types.NetID(ns.netID).NwkID())
+
+	// The prefix does not belong to the NetID
+	ns.netID = [3]byte{0x00, 0x00, 0x14}
+	_, err = prepare()
+	a.So(err, ShouldEqual, ErrJoinNetIDMismatch)
+	a.So(errors.GetErrType(err), ShouldEqual, errors.Internal)
+	a.So(JoinFailureCause(err), ShouldEqual, "netid mismatch")
+
+	// The NetID of another type
+	ns.netID = [3]byte{0x60, 0x00, 0x13}
+	_, err = prepare()
+	a.So(err, ShouldEqual, ErrJoinNetIDMismatch)
+
+	// Without the check, the mismatch is not caught
+	CheckJoinAcceptNetID = false
+	_, err = prepare()
+	a.So(err, ShouldBeNil)
+}
+
+func TestHandleActivateDevAddrPrefix(t *testing.T) {
+	a := New(t)
+	prefix := types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x01, 0x00, 0x00}, Length: 16}
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleActivateDevAddrPrefix"),
+		},
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa", "private"},
+			prefix: []string{"otaa", "private"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-activate-devaddr-prefix"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 14))
+	devEUI := types.DevEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 14))
+	a.So(ns.devices.Set(&device.Device{
+		AppEUI: appEUI,
+		DevEUI: devEUI,
+	}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// The DevAddr is assigned, so that it is in both prefixes
+	devAddr := getDevAddr(0x26, 0x01, 0x02, 0x03)
+	res, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+		DevEui: &devEUI,
+		AppEui: &appEUI,
+		ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+			Lorawan: &pb_lorawan.ActivationMetadata{DevAddr: &devAddr},
+		}},
+		ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+	})
+	a.So(err, ShouldBeNil)
+
+	var nwkSKey types.NwkSKey
+	copy(nwkSKey[:], []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 3, 3})
+	lorawanMeta := res.GetActivationMetadata().GetLorawan()
+	lorawanMeta.AppEui = &appEUI
+	lorawanMeta.DevEui = &devEUI
+	lorawanMeta.NwkSKey = &nwkSKey
+	_, err = ns.HandleActivate(&pb_handler.DeviceActivationResponse{
+		ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+			Lorawan: lorawanMeta,
+		}},
+	})
+	a.So(err, ShouldBeNil)
+
+	// The most specific prefix is recorded
+	dev, err := ns.HandleGetDevice(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(dev.DevAddr, ShouldEqual, devAddr)
+	a.So(dev.DevAddrPrefix, ShouldResemble, prefix)
+}
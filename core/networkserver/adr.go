@@ -16,6 +16,52 @@ import (
 // DefaultADRMargin is the default SNR margin for ADR
 var DefaultADRMargin = 15
 
+// MinADRDataRate is the lowest data rate index that ADR may select
+var MinADRDataRate = 0
+
+// MaxADRDataRate is the highest data rate index that ADR may select (0 means no limit)
+var MaxADRDataRate = 0
+
+// DefaultADRAckLimit is the default ADR_ACK_LIMIT: the number of uplinks without downlink after which devices request a downlink
+var DefaultADRAckLimit uint32 = 64
+
+// DefaultADRAckDelay is the default ADR_ACK_DELAY: the number of uplinks after ADR_ACK_LIMIT after which devices lower their data rate
+var DefaultADRAckDelay uint32 = 32
+
+// adrAckParams returns the ADR_ACK_LIMIT and ADR_ACK_DELAY of the device, preferring the device options over the defaults
+func adrAckParams(dev *device.Device) (limit uint32, delay uint32) {
+	limit, delay = DefaultADRAckLimit, DefaultADRAckDelay
+	if dev.Options.ADRAckLimit != 0 {
+		limit = dev.Options.ADRAckLimit
+	}
+	if dev.Options.ADRAckDelay != 0 {
+		delay = dev.Options.ADRAckDelay
+	}
+	return
+}
+
+// adrDataRateLimits returns the data rate limits for the device, preferring the device options over the defaults
+func adrDataRateLimits(dev *device.Device) (min int, max int) {
+	min, max = MinADRDataRate, MaxADRDataRate
+	if dev.Options.MinDataRate != 0 {
+		min = dev.Options.MinDataRate
+	}
+	if dev.Options.MaxDataRate != 0 {
+		max = dev.Options.MaxDataRate
+	}
+	return
+}
+
+func clampDataRate(drIdx, min, max int) int {
+	if max != 0 && drIdx > max {
+		drIdx = max
+	}
+	if drIdx < min {
+		drIdx = min
+	}
+	return drIdx
+}
+
 func maxSNR(frames []*device.Frame) float32 {
 	if len(frames) == 0 {
 		return 0
@@ -64,9 +110,17 @@ func (n *networkServer) handleUplinkADR(message *pb_broker.DeduplicatedUplinkMes
 			dev.ADR.DataRate = dataRate
 			dev.ADR.SendReq = true // schedule a LinkADRReq
 		}
-		if lorawanUplinkMac.AdrAckReq {
+		// The device requests a downlink after ADR_ACK_LIMIT uplinks without downlink, and starts
+		// lowering its data rate after another ADR_ACK_DELAY uplinks
+		dev.ADR.AckCnt++
+		limit, delay := adrAckParams(dev)
+		if lorawanUplinkMac.AdrAckReq || uint32(dev.ADR.AckCnt) >= limit {
 			dev.ADR.SendReq = true        // schedule a LinkADRReq
 			lorawanDownlinkMac.Ack = true // force a downlink
+			message.Trace = message.Trace.WithEvent("adr ack", "adr-ack-cnt", dev.ADR.AckCnt)
+		}
+		if uint32(dev.ADR.AckCnt) >= limit+delay {
+			n.Ctx.WithField("DevEUI", dev.DevEUI).WithField("ADRAckCnt", dev.ADR.AckCnt).Warn("Device is lowering its data rate because it did not receive downlink")
 		}
 	} else {
 		// Clear history and reset settings
@@ -135,6 +189,13 @@ func (n *networkServer) handleDownlinkADR(message *pb_broker.DownlinkMessage, de
 	if err != nil {
 		return err
 	}
+	if clamped := allowedDataRate(dev, clampDataRate(drIdx, adrDataRateLimits(dev))); clamped != drIdx && clamped < len(fp.DataRates) {
+		drIdx = clamped
+		dataRate, err = fp.GetDataRateStringForIndex(drIdx)
+		if err != nil {
+			return err
+		}
+	}
 	powerIdx, err := fp.GetTxPowerIndexFor(txPower)
 	if err != nil {
 		powerIdx, _ = fp.GetTxPowerIndexFor(fp.DefaultTXPower)
@@ -199,5 +260,8 @@ func (n *networkServer) handleDownlinkADR(message *pb_broker.DownlinkMessage, de
 
 	lorawanDownlinkMac.FOpts = fOpts
 
+	// Re-send the LinkADRReq until the device answers it
+	queueMACCommand(dev, lorawan.LinkADRReq, responsePayload, true)
+
 	return nil
 }
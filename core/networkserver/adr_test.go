@@ -133,6 +133,51 @@ func TestHandleUplinkADR(t *testing.T) {
 	}
 }
 
+func TestHandleUplinkADRAckLimit(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-adr-ack-limit"),
+	}
+	ns.InitStatus()
+
+	defer func() {
+		keys, _ := GetRedisClient().Keys("*ns-test-handle-uplink-adr-ack-limit*").Result()
+		for _, key := range keys {
+			GetRedisClient().Del(key).Result()
+		}
+	}()
+
+	dev := &device.Device{AppEUI: types.AppEUI([8]byte{1}), DevEUI: types.DevEUI([8]byte{1})}
+	dev.Options.ADRAckLimit = 4
+
+	uplink := func() bool {
+		message := adrInitUplinkMessage()
+		message.Message.GetLorawan().GetMacPayload().Adr = true
+		err := ns.handleUplinkADR(message, dev)
+		a.So(err, ShouldBeNil)
+		return message.ResponseTemplate.Message.GetLorawan().GetMacPayload().Ack
+	}
+
+	// The downlink is guaranteed from the configured ADR_ACK_LIMIT
+	for i := 1; i < 4; i++ {
+		a.So(uplink(), ShouldBeFalse)
+	}
+	a.So(uplink(), ShouldBeTrue)
+	a.So(dev.ADR.SendReq, ShouldBeTrue)
+	a.So(dev.ADR.AckCnt, ShouldEqual, 4)
+
+	// After a downlink, the count starts again
+	dev.ADR.AckCnt = 0
+	a.So(uplink(), ShouldBeFalse)
+
+	// With the default ADR_ACK_LIMIT
+	dev.Options.ADRAckLimit = 0
+	dev.ADR.AckCnt = 10
+	a.So(uplink(), ShouldBeFalse)
+	dev.ADR.AckCnt = int(DefaultADRAckLimit) - 1
+	a.So(uplink(), ShouldBeTrue)
+}
+
 func TestHandleDownlinkADR(t *testing.T) {
 	a := New(t)
 	ns := &networkServer{
@@ -262,3 +307,90 @@ func TestHandleDownlinkADR(t *testing.T) {
 	shouldReturnError()
 
 }
+
+func TestClampDataRate(t *testing.T) {
+	a := New(t)
+	a.So(clampDataRate(5, 0, 0), ShouldEqual, 5)
+	a.So(clampDataRate(5, 0, 3), ShouldEqual, 3)
+	a.So(clampDataRate(1, 2, 0), ShouldEqual, 2)
+	a.So(clampDataRate(1, 2, 4), ShouldEqual, 2)
+	a.So(clampDataRate(3, 2, 4), ShouldEqual, 3)
+}
+
+func TestHandleDownlinkADRDataRateLimits(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-downlink-adr-limits"),
+	}
+	ns.InitStatus()
+
+	defer func() {
+		keys, _ := GetRedisClient().Keys("*ns-test-handle-downlink-adr-limits*").Result()
+		for _, key := range keys {
+			GetRedisClient().Del(key).Result()
+		}
+	}()
+
+	defer func(min, max int) {
+		MinADRDataRate, MaxADRDataRate = min, max
+	}(MinADRDataRate, MaxADRDataRate)
+
+	appEUI := types.AppEUI([8]byte{1})
+	devEUI := types.DevEUI([8]byte{1})
+	history, _ := ns.devices.Frames(appEUI, devEUI)
+
+	var resetFrames = func(snr float32) {
+		history.Clear()
+		for i := 0; i < 20; i++ {
+			history.Push(&device.Frame{SNR: snr, GatewayCount: 1, FCnt: uint32(i)})
+		}
+	}
+
+	var newDevice = func(dataRate string) *device.Device {
+		return &device.Device{AppEUI: appEUI, DevEUI: devEUI, ADR: device.ADRSettings{
+			SendReq:  true,
+			DataRate: dataRate,
+			Band:     "EU_863_870",
+		}}
+	}
+
+	var shouldHaveDataRate = func(dev *device.Device, dataRate uint8) {
+		a := New(t)
+		message := adrInitDownlinkMessage()
+		err := ns.handleDownlinkADR(message, dev)
+		a.So(err, ShouldBeNil)
+		fOpts := message.Message.GetLorawan().GetMacPayload().FOpts
+		a.So(fOpts, ShouldHaveLength, 2)
+		if len(fOpts) == 2 {
+			payload := new(lorawan.LinkADRReqPayload)
+			payload.UnmarshalBinary(fOpts[1].Payload)
+			a.So(payload.DataRate, ShouldEqual, dataRate)
+		}
+		if a.Failed() {
+			_, file, line, _ := runtime.Caller(1)
+			t.Errorf("\n%s:%d", file, line)
+		}
+	}
+
+	// Good signal: ADR goes up to SF7BW125 unless limited
+	resetFrames(10)
+	shouldHaveDataRate(newDevice("SF10BW125"), 5)
+
+	MaxADRDataRate = 3
+	shouldHaveDataRate(newDevice("SF10BW125"), 3) // SF9BW125
+
+	dev := newDevice("SF10BW125")
+	dev.Options.MaxDataRate = 4
+	shouldHaveDataRate(dev, 4) // SF8BW125
+
+	MaxADRDataRate = 0
+
+	// Bad signal: ADR stays at SF12BW125 unless limited
+	resetFrames(-20)
+	MinADRDataRate = 2
+	shouldHaveDataRate(newDevice("SF12BW125"), 2) // SF10BW125
+
+	dev = newDevice("SF12BW125")
+	dev.Options.MinDataRate = 1
+	shouldHaveDataRate(dev, 1) // SF11BW125
+}
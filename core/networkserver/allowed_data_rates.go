@@ -0,0 +1,92 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	"github.com/TheThingsNetwork/ttn/core/band"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// disallowedDataRateEvent is added to the trace of uplinks with a data rate that the device is not allowed to use
+const disallowedDataRateEvent = "disallowed data rate"
+
+// dataRateAllowed returns whether the device is allowed to use the data rate index. If the device has no allowed
+// data rates, all data rates are allowed.
+func dataRateAllowed(dev *device.Device, drIdx int) bool {
+	if len(dev.Options.AllowedDataRates) == 0 {
+		return true
+	}
+	for _, allowed := range dev.Options.AllowedDataRates {
+		if allowed == drIdx {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedDataRate returns the highest allowed data rate index that is not higher than drIdx. If all allowed data
+// rates are higher, the lowest allowed data rate index is returned.
+func allowedDataRate(dev *device.Device, drIdx int) int {
+	if dataRateAllowed(dev, drIdx) {
+		return drIdx
+	}
+	below, above := -1, -1
+	for _, allowed := range dev.Options.AllowedDataRates {
+		if allowed < drIdx && allowed > below {
+			below = allowed
+		}
+		if allowed > drIdx && (above == -1 || allowed < above) {
+			above = allowed
+		}
+	}
+	if below != -1 {
+		return below
+	}
+	return above
+}
+
+// restrictChannelDataRates narrows the data rate range of the channel to the allowed data rates of the device
+func restrictChannelDataRates(dev *device.Device, channel *device.Channel) error {
+	if len(dev.Options.AllowedDataRates) == 0 || channel.Frequency == 0 {
+		return nil
+	}
+	min, max := -1, -1
+	for dr := int(channel.MinDR); dr <= int(channel.MaxDR); dr++ {
+		if !dataRateAllowed(dev, dr) {
+			continue
+		}
+		if min == -1 {
+			min = dr
+		}
+		max = dr
+	}
+	if min == -1 {
+		return errors.NewErrInvalidArgument("Channel", "none of the data rates is allowed for the device")
+	}
+	channel.MinDR, channel.MaxDR = uint8(min), uint8(max)
+	return nil
+}
+
+// checkUplinkDataRate logs uplinks with a data rate that the device is not allowed to use
+func (n *networkServer) checkUplinkDataRate(message *pb_broker.DeduplicatedUplinkMessage, dev *device.Device) {
+	if len(dev.Options.AllowedDataRates) == 0 {
+		return
+	}
+	lorawan := message.GetProtocolMetadata().GetLorawan()
+	if lorawan == nil || lorawan.DataRate == "" {
+		return
+	}
+	fp, err := band.Get(lorawan.FrequencyPlan.String())
+	if err != nil {
+		return
+	}
+	drIdx, err := fp.GetDataRateIndexFor(lorawan.DataRate)
+	if err != nil || dataRateAllowed(dev, drIdx) {
+		return
+	}
+	n.Ctx.WithField("DevEUI", dev.DevEUI).WithField("DataRate", lorawan.DataRate).Warn("Device used a data rate that is not allowed")
+	message.Trace = message.Trace.WithEvent(disallowedDataRateEvent, "data-rate", lorawan.DataRate)
+}
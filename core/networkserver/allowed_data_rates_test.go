@@ -0,0 +1,116 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestHandleDownlinkADRAllowedDataRates(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-downlink-adr-allowed"),
+	}
+	ns.InitStatus()
+
+	defer func() {
+		keys, _ := GetRedisClient().Keys("*ns-test-handle-downlink-adr-allowed*").Result()
+		for _, key := range keys {
+			GetRedisClient().Del(key).Result()
+		}
+	}()
+
+	appEUI := types.AppEUI([8]byte{1})
+	devEUI := types.DevEUI([8]byte{1})
+	history, _ := ns.devices.Frames(appEUI, devEUI)
+	history.Clear()
+	for i := 0; i < 20; i++ {
+		history.Push(&device.Frame{SNR: 10, GatewayCount: 1, FCnt: uint32(i)})
+	}
+
+	var dataRate = func(allowed ...int) uint8 {
+		dev := &device.Device{AppEUI: appEUI, DevEUI: devEUI, ADR: device.ADRSettings{
+			SendReq:  true,
+			DataRate: "SF10BW125",
+			Band:     "EU_863_870",
+		}}
+		dev.Options.AllowedDataRates = allowed
+		message := adrInitDownlinkMessage()
+		a.So(ns.handleDownlinkADR(message, dev), ShouldBeNil)
+		fOpts := message.Message.GetLorawan().GetMacPayload().FOpts
+		if !a.So(fOpts, ShouldHaveLength, 2) {
+			return 0
+		}
+		payload := new(lorawan.LinkADRReqPayload)
+		payload.UnmarshalBinary(fOpts[1].Payload)
+		return payload.DataRate
+	}
+
+	// The SNR supports SF7BW125
+	a.So(dataRate(), ShouldEqual, 5)
+
+	// ADR does not select a data rate outside the allowed set
+	a.So(dataRate(0, 1, 3), ShouldEqual, 3)
+	a.So(dataRate(3, 4, 5), ShouldEqual, 5)
+	a.So(dataRate(0, 2, 6), ShouldEqual, 2)
+}
+
+func TestRestrictChannelDataRates(t *testing.T) {
+	a := New(t)
+	dev := &device.Device{}
+
+	channel := device.Channel{Index: 3, Frequency: 867100000, MaxDR: 5}
+	a.So(restrictChannelDataRates(dev, &channel), ShouldBeNil)
+	a.So(channel.MinDR, ShouldEqual, 0)
+	a.So(channel.MaxDR, ShouldEqual, 5)
+
+	dev.Options.AllowedDataRates = []int{2, 3, 7}
+	a.So(restrictChannelDataRates(dev, &channel), ShouldBeNil)
+	a.So(channel.MinDR, ShouldEqual, 2)
+	a.So(channel.MaxDR, ShouldEqual, 3)
+
+	channel = device.Channel{Index: 3, Frequency: 867100000, MinDR: 4, MaxDR: 5}
+	a.So(restrictChannelDataRates(dev, &channel), ShouldNotBeNil)
+
+	a.So(configureChannel(dev, device.Channel{Index: 3, Frequency: 867100000, MaxDR: 5}), ShouldBeNil)
+	a.So(dev.MACCommands, ShouldHaveLength, 1)
+	var req lorawan.NewChannelReqPayload
+	a.So(req.UnmarshalBinary(dev.MACCommands[0].Payload), ShouldBeNil)
+	a.So(req.MinDR, ShouldEqual, 2)
+	a.So(req.MaxDR, ShouldEqual, 3)
+}
+
+func TestHandleUplinkDisallowedDataRate(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{Ctx: GetLogger(t, "TestHandleUplinkDisallowedDataRate")},
+	}
+
+	dev := &device.Device{}
+	message := adrInitUplinkMessage() // SF8BW125
+	ns.checkUplinkDataRate(message, dev)
+	a.So(message.Trace, ShouldBeNil)
+
+	dev.Options.AllowedDataRates = []int{4, 5}
+	ns.checkUplinkDataRate(message, dev)
+	a.So(message.Trace, ShouldBeNil)
+
+	dev.Options.AllowedDataRates = []int{5}
+	ns.checkUplinkDataRate(message, dev)
+	var found bool
+	for _, trace := range message.Trace.Flatten() {
+		if trace.Event == disallowedDataRateEvent {
+			found = true
+			a.So(trace.Metadata["data-rate"], ShouldEqual, "SF8BW125")
+		}
+	}
+	a.So(found, ShouldBeTrue)
+}
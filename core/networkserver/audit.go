@@ -0,0 +1,67 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"time"
+
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/types"
+)
+
+// Outcomes of activations in audit records
+const (
+	ActivationAccepted = "accepted"
+	ActivationRejected = "rejected"
+)
+
+// ActivationAuditRecord is a record of an activation or a rejected activation. It never contains keys.
+type ActivationAuditRecord struct {
+	Time    time.Time
+	AppEUI  types.AppEUI
+	DevEUI  types.DevEUI
+	DevAddr types.DevAddr
+	Prefix  types.DevAddrPrefix // Prefix of the DevAddr, if it is in one of the prefixes of the NetworkServer
+	NetID   [3]byte
+	Outcome string
+	Reason  string // The JoinFailureCause of rejected activations
+}
+
+// ActivationAuditSink receives the audit records of activations
+type ActivationAuditSink interface {
+	ActivationAudit(record ActivationAuditRecord)
+}
+
+// SetActivationAuditSink makes the NetworkServer emit an audit record to the sink for each activation,
+// and for each activation that it rejects
+func (n *networkServer) SetActivationAuditSink(sink ActivationAuditSink) {
+	n.activationAuditSink = sink
+}
+
+// auditActivation emits an audit record for the activation with the given metadata and result
+func (n *networkServer) auditActivation(meta *pb_lorawan.ActivationMetadata, err error) {
+	if n.activationAuditSink == nil {
+		return
+	}
+	record := ActivationAuditRecord{
+		Time:    n.now(),
+		NetID:   n.netID,
+		Outcome: ActivationAccepted,
+	}
+	if meta != nil && meta.AppEui != nil {
+		record.AppEUI = *meta.AppEui
+	}
+	if meta != nil && meta.DevEui != nil {
+		record.DevEUI = *meta.DevEui
+	}
+	if meta != nil && meta.DevAddr != nil {
+		record.DevAddr = *meta.DevAddr
+		record.Prefix, _ = n.getPrefix(record.DevAddr)
+	}
+	if err != nil {
+		record.Outcome = ActivationRejected
+		record.Reason = JoinFailureCause(err)
+	}
+	n.activationAuditSink.ActivationAudit(record)
+}
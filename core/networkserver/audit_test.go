@@ -0,0 +1,99 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_handler "github.com/TheThingsNetwork/ttn/api/handler"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+type testActivationAuditSink []ActivationAuditRecord
+
+func (s *testActivationAuditSink) ActivationAudit(record ActivationAuditRecord) {
+	*s = append(*s, record)
+}
+
+func TestActivationAudit(t *testing.T) {
+	a := New(t)
+	now := time.Unix(1500000000, 0)
+	prefix := types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}
+	ns := &networkServer{
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			prefix: []string{"otaa"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-activation-audit"),
+		clock:   func() time.Time { return now },
+	}
+	ns.InitStatus()
+
+	sink := new(testActivationAuditSink)
+	ns.SetActivationAuditSink(sink)
+
+	appEUI := types.AppEUI(getEUI(0, 0, 0, 0, 0, 0, 4, 1))
+	devEUI := types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 4, 1))
+	a.So(ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// Successful activation
+	devAddr := getDevAddr(0x26, 0x01, 0x02, 0x03)
+	nwkSKey := types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+	_, err := ns.HandleActivate(&pb_handler.DeviceActivationResponse{
+		ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+			Lorawan: &pb_lorawan.ActivationMetadata{
+				AppEui:  &appEUI,
+				DevEui:  &devEUI,
+				DevAddr: &devAddr,
+				NwkSKey: &nwkSKey,
+			},
+		}},
+	})
+	a.So(err, ShouldBeNil)
+	a.So(*sink, ShouldHaveLength, 1)
+	a.So((*sink)[0], ShouldResemble, ActivationAuditRecord{
+		Time:    now,
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		DevAddr: devAddr,
+		Prefix:  prefix,
+		NetID:   [3]byte{0x00, 0x00, 0x13},
+		Outcome: ActivationAccepted,
+	})
+
+	// Rejected activation of an unknown device
+	unknownEUI := types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 4, 2))
+	_, err = ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+		AppEui: &appEUI,
+		DevEui: &unknownEUI,
+	})
+	a.So(err, ShouldNotBeNil)
+	a.So(*sink, ShouldHaveLength, 2)
+	a.So((*sink)[1], ShouldResemble, ActivationAuditRecord{
+		Time:    now,
+		AppEUI:  appEUI,
+		DevEUI:  unknownEUI,
+		NetID:   [3]byte{0x00, 0x00, 0x13},
+		Outcome: ActivationRejected,
+		Reason:  "device unknown",
+	})
+
+	// Successful preparations are not activations yet
+	_, err = ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+		AppEui: &appEUI,
+		DevEui: &devEUI,
+	})
+	a.So(err, ShouldBeNil)
+	a.So(*sink, ShouldHaveLength, 2)
+}
@@ -0,0 +1,41 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// ErrDeviceBlocked is returned for activations and uplinks of blocked devices
+var ErrDeviceBlocked = errors.NewErrPermissionDenied("device is blocked")
+
+func (n *networkServer) setBlocked(appEUI types.AppEUI, devEUI types.DevEUI, blocked bool) error {
+	dev, err := n.devices.Get(appEUI, devEUI)
+	if err != nil {
+		return err
+	}
+	if dev.Blocked == blocked {
+		return nil
+	}
+	dev.StartUpdate()
+	dev.Blocked = blocked
+	return n.devices.Set(dev)
+}
+
+// BlockDevice blocks activations and uplinks of a device, without deleting it
+func (n *networkServer) BlockDevice(appEUI types.AppEUI, devEUI types.DevEUI) error {
+	if err := validateEUIs(&appEUI, &devEUI); err != nil {
+		return err
+	}
+	return n.setBlocked(appEUI, devEUI, true)
+}
+
+// UnblockDevice allows activations and uplinks of a blocked device again
+func (n *networkServer) UnblockDevice(appEUI types.AppEUI, devEUI types.DevEUI) error {
+	if err := validateEUIs(&appEUI, &devEUI); err != nil {
+		return err
+	}
+	return n.setBlocked(appEUI, devEUI, false)
+}
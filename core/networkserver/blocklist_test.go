@@ -0,0 +1,78 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestBlockDevice(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestBlockDevice"),
+		},
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-block-device"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	// Unknown device
+	a.So(ns.BlockDevice(appEUI, devEUI), ShouldNotBeNil)
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	activate := func() error {
+		_, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			DevEui:             &devEUI,
+			AppEui:             &appEUI,
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{Lorawan: &pb_lorawan.ActivationMetadata{}}},
+			ResponseTemplate:   &pb_broker.DeviceActivationResponse{},
+		})
+		return err
+	}
+	uplink := func() error {
+		_, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+		return err
+	}
+
+	a.So(activate(), ShouldBeNil)
+	a.So(uplink(), ShouldBeNil)
+
+	// Blocked
+	a.So(ns.BlockDevice(appEUI, devEUI), ShouldBeNil)
+	dev, _ := ns.HandleGetDevice(appEUI, devEUI)
+	a.So(dev.Blocked, ShouldBeTrue)
+	a.So(activate(), ShouldEqual, ErrDeviceBlocked)
+	a.So(uplink(), ShouldEqual, ErrDeviceBlocked)
+
+	// Unblocked
+	a.So(ns.UnblockDevice(appEUI, devEUI), ShouldBeNil)
+	dev, _ = ns.HandleGetDevice(appEUI, devEUI)
+	a.So(dev.Blocked, ShouldBeFalse)
+	a.So(activate(), ShouldBeNil)
+	a.So(uplink(), ShouldBeNil)
+}
@@ -0,0 +1,89 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/brocaar/lorawan"
+)
+
+// CFListType is the type of the CFList of a JoinAccept, which is in its last byte
+type CFListType uint8
+
+// CFList types
+const (
+	// CFListFrequencies is a CFList with the frequencies of extra channels
+	CFListFrequencies CFListType = 0
+	// CFListChannelMask is a CFList with a channel mask, which the NetworkServer does not build (yet)
+	CFListChannelMask CFListType = 1
+)
+
+func (t CFListType) String() string {
+	switch t {
+	case CFListFrequencies:
+		return "frequencies"
+	case CFListChannelMask:
+		return "channel-mask"
+	}
+	return "unknown"
+}
+
+// cfListTypeEvent is the trace event with the type of the CFList in the JoinAccept, as the activation metadata has
+// no field for it
+const cfListTypeEvent = "set cflist type"
+
+// CFListOverflowPolicy determines what happens with a CFList that has more channels than the frequency plan
+// supports
+type CFListOverflowPolicy string
+
+// CFList overflow policies
+const (
+	// CFListOverflowError rejects the activation
+	CFListOverflowError CFListOverflowPolicy = "error"
+	// CFListOverflowTruncate sends the first channels that fit in the frequency plan
+	CFListOverflowTruncate CFListOverflowPolicy = "truncate"
+)
+
+// CFListOverflow is the policy for CFLists with more channels than the frequency plan supports
+var CFListOverflow = CFListOverflowError
+
+// cfListChannels is the number of extra channels that the CFList can carry in each frequency plan. The TTN
+// frequency plan of KR920-923 only has 4 extra channels, and some devices reject a fifth. Frequency plans that are
+// not listed use a channel mask instead of a CFList of frequencies.
+var cfListChannels = map[pb_lorawan.FrequencyPlan]int{
+	pb_lorawan.FrequencyPlan_EU_863_870: maxCFListLength,
+	pb_lorawan.FrequencyPlan_CN_779_787: maxCFListLength,
+	pb_lorawan.FrequencyPlan_EU_433:     maxCFListLength,
+	pb_lorawan.FrequencyPlan_AS_923:     maxCFListLength,
+	pb_lorawan.FrequencyPlan_AS_920_923: maxCFListLength,
+	pb_lorawan.FrequencyPlan_AS_923_925: maxCFListLength,
+	pb_lorawan.FrequencyPlan_KR_920_923: 4,
+}
+
+// fitCFList removes the unused (0) channels at the end of the CFList, which the Router adds for frequency plans
+// with fewer extra channels. If the CFListOverflow policy is to truncate, it also removes the channels that do not
+// fit in the frequency plan.
+func fitCFList(meta *pb_lorawan.ActivationMetadata) {
+	if meta.CfList == nil {
+		return
+	}
+	freqs := meta.CfList.Freq
+	for len(freqs) > 0 && freqs[len(freqs)-1] == 0 {
+		freqs = freqs[:len(freqs)-1]
+	}
+	if max, ok := cfListChannels[meta.FrequencyPlan]; ok && len(freqs) > max && CFListOverflow == CFListOverflowTruncate {
+		freqs = freqs[:max]
+	}
+	meta.CfList.Freq = freqs
+}
+
+// buildCFList returns the CFList of the JoinAccept and its type, the metadata must already be validated
+func buildCFList(meta *pb_lorawan.ActivationMetadata) (*lorawan.CFList, CFListType) {
+	if meta.CfList == nil {
+		return nil, CFListFrequencies
+	}
+	var cfList lorawan.CFList
+	copy(cfList[:], meta.CfList.Freq)
+	return &cfList, CFListFrequencies
+}
@@ -0,0 +1,68 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+	"github.com/brocaar/lorawan"
+)
+
+// configureChannel queues a NewChannelReq that adds, changes or (with a frequency of 0) removes a channel in
+// the channel plan of the device. The stored channel plan is only updated when the device accepts the
+// request. As queued commands are replaced by CID, only one channel can be pending at a time. The data rate range
+// of the channel is narrowed to the allowed data rates of the device.
+func configureChannel(dev *device.Device, channel device.Channel) error {
+	if channel.Frequency == 0 {
+		channel.MinDR, channel.MaxDR = 0, 0
+	}
+	if err := restrictChannelDataRates(dev, &channel); err != nil {
+		return err
+	}
+	req := lorawan.NewChannelReqPayload{
+		ChIndex: channel.Index,
+		Freq:    channel.Frequency,
+		MinDR:   channel.MinDR,
+		MaxDR:   channel.MaxDR,
+	}
+	payload, err := req.MarshalBinary()
+	if err != nil {
+		return errors.NewErrInvalidArgument("Channel", err.Error())
+	}
+	queueMACCommand(dev, lorawan.NewChannelReq, payload, true)
+	return nil
+}
+
+// handleNewChannelAns applies the queued NewChannelReq to the stored channel plan if the device accepted it
+func handleNewChannelAns(dev *device.Device, answer lorawan.NewChannelAnsPayload) {
+	defer answerMACCommand(dev, lorawan.NewChannelReq)
+	if !answer.ChannelFrequencyOK || !answer.DataRateRangeOK {
+		return
+	}
+	defer confirmMACCommand(dev, lorawan.NewChannelReq)
+	for _, queued := range dev.MACCommands {
+		if queued.CID != uint8(lorawan.NewChannelReq) {
+			continue
+		}
+		var req lorawan.NewChannelReqPayload
+		if err := req.UnmarshalBinary(queued.Payload); err != nil {
+			return
+		}
+		var channels []device.Channel
+		for _, channel := range dev.Channels {
+			if channel.Index != req.ChIndex {
+				channels = append(channels, channel)
+			}
+		}
+		if req.Freq != 0 {
+			channels = append(channels, device.Channel{
+				Index:     req.ChIndex,
+				Frequency: req.Freq,
+				MinDR:     req.MinDR,
+				MaxDR:     req.MaxDR,
+			})
+		}
+		dev.Channels = channels
+	}
+}
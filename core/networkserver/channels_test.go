@@ -0,0 +1,73 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestConfigureChannelRemoval(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestConfigureChannelRemoval"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-configure-channel-removal"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	dev := &device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		Channels: []device.Channel{
+			{Index: 3, Frequency: 867100000, MaxDR: 5},
+			{Index: 4, Frequency: 867300000, MaxDR: 5},
+		},
+	}
+
+	// A frequency of 0 removes the channel
+	a.So(configureChannel(dev, device.Channel{Index: 3, MaxDR: 5}), ShouldBeNil)
+	a.So(dev.MACCommands, ShouldHaveLength, 1)
+	a.So(dev.MACCommands[0].CID, ShouldEqual, uint8(lorawan.NewChannelReq))
+	a.So(dev.MACCommands[0].Payload, ShouldResemble, []byte{3, 0, 0, 0, 0})
+	ns.devices.Set(dev)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// The request is sent with the next downlink
+	res, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldBeNil)
+	fOpts := res.ResponseTemplate.Message.GetLorawan().GetMacPayload().FOpts
+	a.So(fOpts, ShouldHaveLength, 1)
+	a.So(fOpts[0].Cid, ShouldEqual, uint32(lorawan.NewChannelReq))
+
+	// A negative answer does not change the channel plan
+	_, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, pb_lorawan.MACCommand{Cid: uint32(lorawan.NewChannelAns), Payload: []byte{0x02}}))
+	a.So(err, ShouldBeNil)
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.Channels, ShouldHaveLength, 2)
+	a.So(dev.MACCommands, ShouldBeEmpty)
+
+	// The confirmed answer removes the channel from the stored plan
+	a.So(configureChannel(dev, device.Channel{Index: 3}), ShouldBeNil)
+	ns.devices.Set(dev)
+	_, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, pb_lorawan.MACCommand{Cid: uint32(lorawan.NewChannelAns), Payload: []byte{0x03}}))
+	a.So(err, ShouldBeNil)
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.Channels, ShouldResemble, []device.Channel{{Index: 4, Frequency: 867300000, MaxDR: 5}})
+	a.So(dev.MACCommands, ShouldBeEmpty)
+}
@@ -0,0 +1,29 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import "github.com/TheThingsNetwork/ttn/core/networkserver/device"
+
+// ConfirmClassSwitches makes the NetworkServer schedule downlinks for the class that a device switched to with
+// DeviceModeInd only after the device confirmed the switch. A device that received the DeviceModeConf stops
+// sending DeviceModeInd, so its next uplink without DeviceModeInd confirms the new class. By default the new class
+// is used as soon as the DeviceModeInd is handled.
+var ConfirmClassSwitches = false
+
+// confirmClassSwitch confirms the class of the device after an uplink, unless the uplink indicated a (new) class
+// and ConfirmClassSwitches is set
+func confirmClassSwitch(dev *device.Device, deviceModeIndicated bool) {
+	if ConfirmClassSwitches && deviceModeIndicated {
+		return
+	}
+	dev.ConfirmedClass = dev.Class
+}
+
+// downlinkClass returns the class that is used for scheduling downlinks to the device
+func downlinkClass(dev *device.Device) device.Class {
+	if ConfirmClassSwitches {
+		return dev.ConfirmedClass
+	}
+	return dev.Class
+}
@@ -0,0 +1,71 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestConfirmClassSwitches(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestConfirmClassSwitches"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-confirm-class-switches"),
+	}
+	ns.InitStatus()
+
+	defer func(confirm bool) { ConfirmClassSwitches = confirm }(ConfirmClassSwitches)
+	ConfirmClassSwitches = true
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 9, 1))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 9, 1))
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// opportunity returns whether a downlink can be scheduled after the device already got one for its last uplink
+	opportunity := func() bool {
+		dev, err := ns.devices.Get(appEUI, devEUI)
+		a.So(err, ShouldBeNil)
+		dev.LastDownlink = dev.LastSeen
+		return downlinkOpportunity(dev)
+	}
+
+	// The device requests Class C, but did not confirm the switch yet
+	_, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, pb_lorawan.MACCommand{Cid: uint32(deviceModeInd), Payload: []byte{byte(device.ClassC)}}))
+	a.So(err, ShouldBeNil)
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	a.So(dev.Class, ShouldEqual, device.ClassC)
+	a.So(dev.ConfirmedClass, ShouldEqual, device.ClassA)
+	a.So(opportunity(), ShouldBeFalse)
+
+	// The next uplink without DeviceModeInd confirms the switch
+	_, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldBeNil)
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.ConfirmedClass, ShouldEqual, device.ClassC)
+	a.So(opportunity(), ShouldBeTrue)
+
+	// Without confirmation, the requested class is used immediately
+	ConfirmClassSwitches = false
+	_, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, pb_lorawan.MACCommand{Cid: uint32(deviceModeInd), Payload: []byte{byte(device.ClassA)}}))
+	a.So(err, ShouldBeNil)
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.ConfirmedClass, ShouldEqual, device.ClassA)
+	a.So(opportunity(), ShouldBeFalse)
+}
@@ -0,0 +1,58 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"golang.org/x/net/context" // See https://github.com/grpc/grpc-go/issues/711"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// ConcurrencyPolicy determines what happens to uplink and downlink operations over the concurrency limit
+type ConcurrencyPolicy int
+
+// Policies for operations over the concurrency limit
+const (
+	// QueueOperations makes operations wait for a running operation to finish, until the context is done
+	QueueOperations ConcurrencyPolicy = iota
+	// RejectOperations rejects operations immediately
+	RejectOperations
+)
+
+// ErrBusy is returned for operations over the concurrency limit. Like the rate limits, it has the ResourceExhausted
+// code, so that callers know that the operation can be retried later.
+var ErrBusy = grpc.Errorf(codes.ResourceExhausted, "NetworkServer is busy")
+
+// SetConcurrencyLimit limits the number of uplink and downlink operations that run at the same time (0 means no limit)
+func (n *networkServer) SetConcurrencyLimit(limit int, policy ConcurrencyPolicy) {
+	if limit <= 0 {
+		n.operations = nil
+		return
+	}
+	n.operations = make(chan struct{}, limit)
+	n.concurrencyPolicy = policy
+}
+
+// acquire reserves a slot for an operation; the returned function releases the slot
+func (n *networkServer) acquire(ctx context.Context) (release func(), err error) {
+	operations := n.operations
+	if operations == nil {
+		return func() {}, nil
+	}
+	release = func() { <-operations }
+	select {
+	case operations <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if n.concurrencyPolicy == RejectOperations {
+		return nil, ErrBusy
+	}
+	select {
+	case operations <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ErrBusy
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+	. "github.com/smartystreets/assertions"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{}
+
+	// No limit
+	release, err := ns.acquire(context.Background())
+	a.So(err, ShouldBeNil)
+	release()
+
+	// Reject
+	ns.SetConcurrencyLimit(2, RejectOperations)
+	release1, err := ns.acquire(context.Background())
+	a.So(err, ShouldBeNil)
+	release2, err := ns.acquire(context.Background())
+	a.So(err, ShouldBeNil)
+	_, err = ns.acquire(context.Background())
+	a.So(err, ShouldEqual, ErrBusy)
+	a.So(grpc.Code(errors.BuildGRPCError(err)), ShouldEqual, codes.ResourceExhausted)
+
+	release1()
+	release3, err := ns.acquire(context.Background())
+	a.So(err, ShouldBeNil)
+	release2()
+	release3()
+
+	// Queue until the context is done
+	ns.SetConcurrencyLimit(1, QueueOperations)
+	release1, err = ns.acquire(context.Background())
+	a.So(err, ShouldBeNil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = ns.acquire(ctx)
+	a.So(err, ShouldEqual, ErrBusy)
+
+	// Queue until an operation finishes
+	acquired := make(chan struct{})
+	go func() {
+		release, err := ns.acquire(context.Background())
+		if err == nil {
+			close(acquired)
+			release()
+		}
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("Operation should be queued")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release1()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Operation should run after the other one finished")
+	}
+}
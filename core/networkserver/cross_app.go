@@ -0,0 +1,62 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+)
+
+// CrossAppActivationPolicy determines what happens when a device joins with an AppEUI while its DevEUI is
+// registered under a different AppEUI
+type CrossAppActivationPolicy string
+
+// Cross-app activation policies
+const (
+	// RejectCrossAppActivation rejects the join with ErrJoinDeviceBoundElsewhere
+	RejectCrossAppActivation CrossAppActivationPolicy = "reject"
+	// RebindCrossAppActivation moves the device to the AppEUI of the join, if it is registered under exactly one
+	// other AppEUI. The device keeps its AppID and DevID.
+	RebindCrossAppActivation CrossAppActivationPolicy = "rebind"
+)
+
+// CrossAppActivation is the policy for joins of devices that are registered under a different AppEUI
+var CrossAppActivation = RejectCrossAppActivation
+
+// getCrossAppDevice returns the device with the DevEUI if it is registered under a different AppEUI, according to
+// the CrossAppActivation policy. The device is looked up in the DevEUI index, or found by a scan if it was stored
+// before the index existed. It is not moved: the join is not authenticated until the Handler checked its MIC.
+func (n *networkServer) getCrossAppDevice(devEUI types.DevEUI) (*device.Device, error) {
+	bound, err := n.devices.ListForDevEUI(devEUI)
+	if err != nil {
+		return nil, err
+	}
+	if len(bound) == 0 {
+		return nil, ErrJoinDeviceUnknown
+	}
+	if CrossAppActivation != RebindCrossAppActivation || len(bound) > 1 {
+		return nil, ErrJoinDeviceBoundElsewhere
+	}
+	return bound[0], nil
+}
+
+// rebindDevice moves the device to the AppEUI of an authenticated join. The device keeps its AppID and DevID.
+func (n *networkServer) rebindDevice(old *device.Device, appEUI types.AppEUI) (*device.Device, error) {
+	if CrossAppActivation != RebindCrossAppActivation {
+		return nil, ErrJoinDeviceBoundElsewhere
+	}
+	n.Ctx.WithField("DevEUI", old.DevEUI).WithField("OldAppEUI", old.AppEUI).WithField("AppEUI", appEUI).Warn("Rebinding device to another application")
+	dev := *old
+	dev.AppEUI = appEUI
+	err := n.devices.WithTransaction(func(devices device.Store) error {
+		if err := devices.Delete(old.AppEUI, old.DevEUI); err != nil {
+			return err
+		}
+		return devices.Set(&dev)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return n.devices.Get(appEUI, old.DevEUI)
+}
@@ -0,0 +1,114 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_handler "github.com/TheThingsNetwork/ttn/api/handler"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestCrossAppActivation(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{Ctx: GetLogger(t, "TestCrossAppActivation")},
+		netID:     [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-cross-app-activation"),
+	}
+	ns.InitStatus()
+
+	defer func(policy CrossAppActivationPolicy) { CrossAppActivation = policy }(CrossAppActivation)
+
+	boundAppEUI := types.AppEUI(getEUI(0, 0, 0, 0, 0, 0, 7, 1))
+	otherAppEUI := types.AppEUI(getEUI(0, 0, 0, 0, 0, 0, 7, 2))
+	unknownDevEUI := types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 7, 2))
+	devEUI := types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 7, 1))
+	a.So(ns.devices.Set(&device.Device{AppEUI: boundAppEUI, DevEUI: devEUI, AppID: "bound-app", DevID: "dev"}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(boundAppEUI, devEUI)
+		ns.devices.Delete(otherAppEUI, devEUI)
+	}()
+
+	prepare := func(appEUI types.AppEUI, devEUI types.DevEUI) (*pb_broker.DeduplicatedDeviceActivationRequest, error) {
+		return ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			DevEui: &devEUI,
+			AppEui: &appEUI,
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: &pb_lorawan.ActivationMetadata{},
+			}},
+			ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+		})
+	}
+
+	// Devices that are not registered under any AppEUI are unknown
+	_, err := prepare(otherAppEUI, unknownDevEUI)
+	a.So(err, ShouldEqual, ErrJoinDeviceUnknown)
+
+	// Reject
+	CrossAppActivation = RejectCrossAppActivation
+	_, err = prepare(otherAppEUI, devEUI)
+	a.So(err, ShouldEqual, ErrJoinDeviceBoundElsewhere)
+	a.So(JoinFailureCause(err), ShouldEqual, "device bound elsewhere")
+	_, err = ns.devices.Get(boundAppEUI, devEUI)
+	a.So(err, ShouldBeNil)
+
+	// Rebind: the join is prepared for the bound device, which is only moved when the authenticated join is activated
+	CrossAppActivation = RebindCrossAppActivation
+	res, err := prepare(otherAppEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(res.AppId, ShouldEqual, "bound-app")
+	_, err = ns.devices.Get(boundAppEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	_, err = ns.devices.Get(otherAppEUI, devEUI)
+	a.So(err, ShouldNotBeNil)
+
+	devAddr := getDevAddr(0x26, 0, 7, 1)
+	nwkSKey := types.NwkSKey{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 7, 1}
+	_, err = ns.HandleActivate(&pb_handler.DeviceActivationResponse{
+		ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+			Lorawan: &pb_lorawan.ActivationMetadata{
+				AppEui:  &otherAppEUI,
+				DevEui:  &devEUI,
+				DevAddr: &devAddr,
+				NwkSKey: &nwkSKey,
+			},
+		}},
+	})
+	a.So(err, ShouldBeNil)
+	_, err = ns.devices.Get(boundAppEUI, devEUI)
+	a.So(err, ShouldNotBeNil)
+	dev, err := ns.devices.Get(otherAppEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(dev.AppID, ShouldEqual, "bound-app")
+	a.So(dev.DevAddr, ShouldEqual, devAddr)
+	bound, err := ns.devices.ListForDevEUI(devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(bound, ShouldHaveLength, 1)
+
+	// Devices that are registered under multiple other AppEUIs are not rebound
+	thirdAppEUI := types.AppEUI(getEUI(0, 0, 0, 0, 0, 0, 7, 3))
+	a.So(ns.devices.Set(&device.Device{AppEUI: boundAppEUI, DevEUI: devEUI}), ShouldBeNil)
+	_, err = prepare(thirdAppEUI, devEUI)
+	a.So(err, ShouldEqual, ErrJoinDeviceBoundElsewhere)
+
+	// Devices that were stored before the DevEUI index existed are found as well
+	a.So(ns.devices.Delete(boundAppEUI, devEUI), ShouldBeNil)
+	GetRedisClient().Del("test-cross-app-activation:dev_eui:" + devEUI.String())
+	_, err = prepare(thirdAppEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	CrossAppActivation = RejectCrossAppActivation
+	_, err = prepare(thirdAppEUI, devEUI)
+	a.So(err, ShouldEqual, ErrJoinDeviceBoundElsewhere)
+}
@@ -0,0 +1,24 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import "github.com/TheThingsNetwork/ttn/core/networkserver/device"
+
+// DataRateHistoryLength is the number of uplink data rates that are kept for each device, to see how ADR
+// changed the data rate of the device (0 to disable)
+var DataRateHistoryLength = 16
+
+// recordDataRate adds the data rate of an uplink to the history of the device, dropping the oldest data rates
+// when the history is full
+func recordDataRate(dev *device.Device, dataRate string) {
+	if DataRateHistoryLength <= 0 || dataRate == "" {
+		return
+	}
+	history := dev.DataRates
+	if len(history) >= DataRateHistoryLength {
+		history = history[len(history)-DataRateHistoryLength+1:]
+	}
+	// Copy the history, so that the history of the old device is not changed
+	dev.DataRates = append(append(make([]string, 0, len(history)+1), history...), dataRate)
+}
@@ -0,0 +1,80 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestRecordDataRate(t *testing.T) {
+	a := New(t)
+
+	defer func(length int) {
+		DataRateHistoryLength = length
+	}(DataRateHistoryLength)
+	DataRateHistoryLength = 3
+
+	dev := &device.Device{}
+	recordDataRate(dev, "SF12BW125")
+	recordDataRate(dev, "")
+	a.So(dev.DataRates, ShouldResemble, []string{"SF12BW125"})
+
+	old := dev.DataRates
+	for _, dataRate := range []string{"SF11BW125", "SF10BW125", "SF9BW125"} {
+		recordDataRate(dev, dataRate)
+	}
+	a.So(dev.DataRates, ShouldResemble, []string{"SF11BW125", "SF10BW125", "SF9BW125"})
+	a.So(old, ShouldResemble, []string{"SF12BW125"})
+
+	DataRateHistoryLength = 0
+	recordDataRate(dev, "SF8BW125")
+	a.So(dev.DataRates, ShouldResemble, []string{"SF11BW125", "SF10BW125", "SF9BW125"})
+}
+
+func TestHandleUplinkDataRateHistory(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkDataRateHistory"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-data-rate-history"),
+	}
+	ns.InitStatus()
+
+	defer func(length int) {
+		DataRateHistoryLength = length
+	}(DataRateHistoryLength)
+	DataRateHistoryLength = 4
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	dataRates := []string{"SF12BW125", "SF11BW125", "SF10BW125", "SF9BW125", "SF8BW125", "SF7BW125"}
+	for i, dataRate := range dataRates {
+		message := uplinkMACInitMessage(appEUI, devEUI)
+		message.Message.GetLorawan().GetMacPayload().FCnt = uint32(i + 1)
+		message.ProtocolMetadata.GetLorawan().DataRate = dataRate
+		_, err := ns.HandleUplink(message)
+		a.So(err, ShouldBeNil)
+	}
+
+	dev, err := ns.HandleGetDevice(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(dev.DataRates, ShouldResemble, dataRates[2:])
+}
@@ -0,0 +1,93 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"github.com/TheThingsNetwork/go-utils/pseudorandom"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// DevAddrCoordinator coordinates the allocation of DevAddrs with an external authority, for example in
+// roaming scenarios where multiple operators allocate DevAddrs from the same NetID
+type DevAddrCoordinator interface {
+	// RequestDevAddr returns a DevAddr in one of the given prefixes
+	RequestDevAddr(prefixes []types.DevAddrPrefix) (types.DevAddr, error)
+	// ConfirmDevAddr is called when a device activated with the DevAddr
+	ConfirmDevAddr(devAddr types.DevAddr) error
+	// ReleaseDevAddr is called when the activation with the DevAddr failed
+	ReleaseDevAddr(devAddr types.DevAddr) error
+}
+
+// SetDevAddrCoordinator makes the NetworkServer request DevAddrs from the coordinator. Only the DevAddrs that
+// were requested from the coordinator are confirmed or released, not the DevAddrs that were assigned by the caller
+// of an activation or derived from the DevEUI.
+func (n *networkServer) SetDevAddrCoordinator(coordinator DevAddrCoordinator) {
+	n.devAddrCoordinator = coordinator
+}
+
+// randomSource is a source of random numbers, which is replaced by a deterministic one in tests
+type randomSource interface {
+	FillBytes(p []byte)
+	Intn(n int) int
+}
+
+// randomDevAddrs is the default DevAddrCoordinator, which allocates random DevAddrs without coordination
+type randomDevAddrs struct {
+	source randomSource
+}
+
+func (r randomDevAddrs) RequestDevAddr(prefixes []types.DevAddrPrefix) (types.DevAddr, error) {
+	// Generate random DevAddr bytes
+	var devAddr types.DevAddr
+	var prefix types.DevAddrPrefix
+	if r.source != nil {
+		r.source.FillBytes(devAddr[:])
+		prefix = prefixes[r.source.Intn(len(prefixes))]
+	} else {
+		pseudorandom.FillBytes(devAddr[:])
+		prefix = prefixes[pseudorandom.Intn(len(prefixes))]
+	}
+
+	// Apply the prefix
+	return devAddr.WithPrefix(prefix), nil
+}
+
+func (randomDevAddrs) ConfirmDevAddr(devAddr types.DevAddr) error { return nil }
+
+func (randomDevAddrs) ReleaseDevAddr(devAddr types.DevAddr) error { return nil }
+
+func (n *networkServer) getDevAddrCoordinator() DevAddrCoordinator {
+	if n.devAddrCoordinator != nil {
+		return n.devAddrCoordinator
+	}
+	return randomDevAddrs{source: n.random}
+}
+
+// confirmDevAddr confirms or releases the DevAddr of an activation, depending on its result
+func (n *networkServer) confirmDevAddr(devAddr *types.DevAddr, activationErr error) {
+	if devAddr == nil || devAddr.IsEmpty() {
+		return
+	}
+	coordinator := n.getDevAddrCoordinator()
+	if activationErr != nil {
+		if err := coordinator.ReleaseDevAddr(*devAddr); err != nil {
+			n.Ctx.WithError(err).WithField("DevAddr", *devAddr).Warn("Could not release DevAddr")
+		}
+		return
+	}
+	if err := coordinator.ConfirmDevAddr(*devAddr); err != nil {
+		n.Ctx.WithError(err).WithField("DevAddr", *devAddr).Warn("Could not confirm DevAddr")
+	}
+}
+
+// checkCoordinatedDevAddr checks that the DevAddr from the coordinator is in one of the prefixes
+func checkCoordinatedDevAddr(devAddr types.DevAddr, prefixes []types.DevAddrPrefix) error {
+	for _, prefix := range prefixes {
+		if devAddr.HasPrefix(prefix) {
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrJoinDevAddrOutside, "DevAddr %s from coordinator", devAddr)
+}
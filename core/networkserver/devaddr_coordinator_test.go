@@ -0,0 +1,169 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_handler "github.com/TheThingsNetwork/ttn/api/handler"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+type testDevAddrCoordinator struct {
+	devAddr   types.DevAddr
+	confirmed []types.DevAddr
+	released  []types.DevAddr
+}
+
+func (c *testDevAddrCoordinator) RequestDevAddr(prefixes []types.DevAddrPrefix) (types.DevAddr, error) {
+	return c.devAddr, nil
+}
+
+func (c *testDevAddrCoordinator) ConfirmDevAddr(devAddr types.DevAddr) error {
+	c.confirmed = append(c.confirmed, devAddr)
+	return nil
+}
+
+func (c *testDevAddrCoordinator) ReleaseDevAddr(devAddr types.DevAddr) error {
+	c.released = append(c.released, devAddr)
+	return nil
+}
+
+func TestDevAddrCoordinator(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-devaddr-coordinator"),
+	}
+	ns.InitStatus()
+
+	coordinator := &testDevAddrCoordinator{devAddr: getDevAddr(0x26, 0x01, 0x02, 0x03)}
+	ns.SetDevAddrCoordinator(coordinator)
+
+	appEUI := types.AppEUI(getEUI(0, 0, 0, 0, 0, 0, 5, 1))
+	devEUI := types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 5, 1))
+	a.So(ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	prepare := func(rxDelay uint32) (*pb_broker.DeduplicatedDeviceActivationRequest, error) {
+		return ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			DevEui: &devEUI,
+			AppEui: &appEUI,
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: &pb_lorawan.ActivationMetadata{RxDelay: rxDelay},
+			}},
+			ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+		})
+	}
+
+	// The address of the coordinator is used
+	res, err := prepare(1)
+	a.So(err, ShouldBeNil)
+	a.So(*res.ActivationMetadata.GetLorawan().DevAddr, ShouldEqual, coordinator.devAddr)
+	a.So(coordinator.released, ShouldBeEmpty)
+
+	// The address is released when the activation fails after the allocation
+	_, err = prepare(16)
+	a.So(err, ShouldNotBeNil)
+	a.So(coordinator.released, ShouldResemble, []types.DevAddr{coordinator.devAddr})
+
+	// And confirmed when the device activates
+	a.So(res.ActivationMetadata.GetLorawan().DevAddrRequested, ShouldBeTrue)
+	activate := func(devAddr types.DevAddr, requested bool) error {
+		nwkSKey := types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+		_, err := ns.HandleActivate(&pb_handler.DeviceActivationResponse{
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: &pb_lorawan.ActivationMetadata{
+					AppEui:           &appEUI,
+					DevEui:           &devEUI,
+					DevAddr:          &devAddr,
+					NwkSKey:          &nwkSKey,
+					DevAddrRequested: requested,
+				},
+			}},
+		})
+		return err
+	}
+	a.So(activate(coordinator.devAddr, true), ShouldBeNil)
+	a.So(coordinator.confirmed, ShouldResemble, []types.DevAddr{coordinator.devAddr})
+
+	// A retry of the activation does not confirm the address again
+	a.So(activate(coordinator.devAddr, true), ShouldBeNil)
+	a.So(coordinator.confirmed, ShouldHaveLength, 1)
+
+	// Addresses that were not requested from the coordinator are not confirmed or released
+	assigned := getDevAddr(0x26, 0x01, 0x02, 0x04)
+	res, err = ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+		DevEui: &devEUI,
+		AppEui: &appEUI,
+		ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+			Lorawan: &pb_lorawan.ActivationMetadata{DevAddr: &assigned, DevAddrRequested: true},
+		}},
+		ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+	})
+	a.So(err, ShouldBeNil)
+	a.So(res.ActivationMetadata.GetLorawan().DevAddrRequested, ShouldBeFalse)
+	a.So(activate(assigned, false), ShouldBeNil)
+	a.So(coordinator.confirmed, ShouldHaveLength, 1)
+	ns.devices.Delete(appEUI, devEUI)
+	a.So(activate(assigned, false), ShouldNotBeNil)
+	a.So(coordinator.released, ShouldHaveLength, 1)
+	a.So(ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI}), ShouldBeNil)
+
+	// Addresses outside the prefixes are released and rejected
+	coordinator.devAddr = getDevAddr(0x01, 0x02, 0x03, 0x04)
+	_, err = prepare(1)
+	a.So(err, ShouldNotBeNil)
+	a.So(coordinator.released, ShouldHaveLength, 2)
+}
+
+type fixedRandom struct {
+	bytes []byte
+}
+
+func (r fixedRandom) FillBytes(p []byte) { copy(p, r.bytes) }
+
+func (r fixedRandom) Intn(n int) int { return n - 1 }
+
+func TestRandomDevAddrs(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7}: []string{"otaa"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-random-devaddrs"),
+		random:  fixedRandom{bytes: []byte{0x01, 0x02, 0x03, 0x04}},
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(0, 0, 0, 0, 0, 0, 5, 2))
+	devEUI := types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 5, 2))
+	a.So(ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	res, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+		DevEui: &devEUI,
+		AppEui: &appEUI,
+		ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+			Lorawan: &pb_lorawan.ActivationMetadata{},
+		}},
+		ResponseTemplate: &pb_broker.DeviceActivationResponse{},
+	})
+	a.So(err, ShouldBeNil)
+	a.So(*res.ActivationMetadata.GetLorawan().DevAddr, ShouldEqual, getDevAddr(0x27, 0x02, 0x03, 0x04))
+}
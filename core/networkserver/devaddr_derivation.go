@@ -0,0 +1,97 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// DeterministicDevAddrs makes the NetworkServer derive the DevAddr of an OTAA activation from the DevEUI instead
+// of requesting a random one, so that the DevAddr of a device can be re-derived without the database
+var DeterministicDevAddrs = false
+
+// maxDevAddrProbes is the number of candidate DevAddrs that are derived before giving up
+const maxDevAddrProbes = 16
+
+// DevAddrDeriver derives DevAddrs from DevEUIs by hashing the DevEUI into the host bits of a prefix. If the
+// DevAddr is in use by another device, the next candidate is derived from the DevEUI and the probe number, so
+// the result only depends on the DevEUI, the set of prefixes and the DevAddrs that are in use.
+type DevAddrDeriver struct {
+	// InUse returns whether the DevAddr is in use by a device other than the one with the DevEUI (optional)
+	InUse func(devAddr types.DevAddr, devEUI types.DevEUI) (bool, error)
+}
+
+// DeriveDevAddr returns the DevAddr for the DevEUI in one of the prefixes
+func (d DevAddrDeriver) DeriveDevAddr(devEUI types.DevEUI, prefixes []types.DevAddrPrefix) (types.DevAddr, error) {
+	if len(prefixes) == 0 {
+		return types.DevAddr{}, ErrJoinNoPrefix
+	}
+	// The prefixes are sorted, so that the result does not depend on their order
+	sorted := make(byDevAddrPrefix, len(prefixes))
+	copy(sorted, prefixes)
+	sort.Sort(sorted)
+
+	for probe := uint32(0); probe < maxDevAddrProbes; probe++ {
+		devAddr := deriveDevAddr(devEUI, sorted, probe)
+		if d.InUse == nil {
+			return devAddr, nil
+		}
+		inUse, err := d.InUse(devAddr, devEUI)
+		if err != nil {
+			return types.DevAddr{}, err
+		}
+		if !inUse {
+			return devAddr, nil
+		}
+	}
+	return types.DevAddr{}, errors.NewErrNotFound(fmt.Sprintf("free DevAddr for DevEUI %s", devEUI))
+}
+
+// deriveDevAddr returns the candidate DevAddr for the probe
+func deriveDevAddr(devEUI types.DevEUI, prefixes []types.DevAddrPrefix, probe uint32) types.DevAddr {
+	var data [12]byte
+	copy(data[:8], devEUI[:])
+	binary.BigEndian.PutUint32(data[8:], probe)
+	hash := sha256.Sum256(data[:])
+
+	prefix := prefixes[binary.BigEndian.Uint32(hash[4:8])%uint32(len(prefixes))]
+	var devAddr types.DevAddr
+	copy(devAddr[:], hash[:4])
+	return devAddr.WithPrefix(prefix)
+}
+
+type byDevAddrPrefix []types.DevAddrPrefix
+
+func (a byDevAddrPrefix) Len() int           { return len(a) }
+func (a byDevAddrPrefix) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byDevAddrPrefix) Less(i, j int) bool { return a[i].String() < a[j].String() }
+
+// devAddrInUse returns whether the DevAddr is in use by a device with another DevEUI
+func (n *networkServer) devAddrInUse(devAddr types.DevAddr, devEUI types.DevEUI) (bool, error) {
+	devices, err := n.devices.ListForAddress(devAddr)
+	if err != nil {
+		return false, err
+	}
+	for _, dev := range devices {
+		if dev != nil && dev.DevEUI != devEUI {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getDerivedDevAddr derives the DevAddr of the device in a prefix that matches the constraints
+func (n *networkServer) getDerivedDevAddr(devEUI types.DevEUI, constraints ...string) (types.DevAddr, error) {
+	prefixes := n.GetPrefixesFor(constraints...)
+	if len(prefixes) == 0 {
+		return types.DevAddr{}, errors.Wrapf(ErrJoinNoPrefix, "constraints %v", constraints)
+	}
+	return DevAddrDeriver{InUse: n.devAddrInUse}.DeriveDevAddr(devEUI, prefixes)
+}
@@ -0,0 +1,51 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestDevAddrDeriver(t *testing.T) {
+	a := New(t)
+
+	prefixes := []types.DevAddrPrefix{
+		{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 7},
+		{DevAddr: [4]byte{0x14, 0x00, 0x00, 0x00}, Length: 7},
+	}
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	// The same DevEUI yields the same DevAddr in independent derivers, regardless of the order of the prefixes
+	devAddr, err := DevAddrDeriver{}.DeriveDevAddr(devEUI, prefixes)
+	a.So(err, ShouldBeNil)
+	a.So(devAddr.HasPrefix(prefixes[0]) || devAddr.HasPrefix(prefixes[1]), ShouldBeTrue)
+	again, err := DevAddrDeriver{}.DeriveDevAddr(devEUI, []types.DevAddrPrefix{prefixes[1], prefixes[0]})
+	a.So(err, ShouldBeNil)
+	a.So(again, ShouldEqual, devAddr)
+
+	// Another DevEUI yields another DevAddr
+	other, err := DevAddrDeriver{}.DeriveDevAddr(types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 9)), prefixes)
+	a.So(err, ShouldBeNil)
+	a.So(other, ShouldNotEqual, devAddr)
+
+	// Collisions are resolved by probing, which is also deterministic
+	taken := func(devAddr types.DevAddr) func(types.DevAddr, types.DevEUI) (bool, error) {
+		return func(candidate types.DevAddr, _ types.DevEUI) (bool, error) {
+			return candidate == devAddr, nil
+		}
+	}
+	probed, err := DevAddrDeriver{InUse: taken(devAddr)}.DeriveDevAddr(devEUI, prefixes)
+	a.So(err, ShouldBeNil)
+	a.So(probed, ShouldNotEqual, devAddr)
+	again, err = DevAddrDeriver{InUse: taken(devAddr)}.DeriveDevAddr(devEUI, prefixes)
+	a.So(err, ShouldBeNil)
+	a.So(again, ShouldEqual, probed)
+
+	// Without free DevAddrs, an error is returned
+	_, err = DevAddrDeriver{InUse: func(types.DevAddr, types.DevEUI) (bool, error) { return true, nil }}.DeriveDevAddr(devEUI, prefixes)
+	a.So(err, ShouldNotBeNil)
+}
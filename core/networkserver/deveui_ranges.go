@@ -0,0 +1,79 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// DevEUIPrefix is a range of DevEUIs that share the first Length bits
+type DevEUIPrefix struct {
+	DevEUI types.DevEUI
+	Length int
+}
+
+// ParseDevEUIPrefix parses a DevEUI in prefix notation (0102030405060708/32) to a prefix
+func ParseDevEUIPrefix(prefixString string) (prefix DevEUIPrefix, err error) {
+	parts := strings.Split(prefixString, "/")
+	if len(parts) != 2 {
+		return prefix, errors.NewErrInvalidArgument("DevEUI prefix", "should be in prefix notation")
+	}
+	prefix.DevEUI, err = types.ParseDevEUI(parts[0])
+	if err != nil {
+		return prefix, errors.NewErrInvalidArgument("DevEUI prefix", err.Error())
+	}
+	prefix.Length, err = strconv.Atoi(parts[1])
+	if err != nil || prefix.Length < 0 || prefix.Length > 64 {
+		return prefix, errors.NewErrInvalidArgument("DevEUI prefix", "length should be between 0 and 64")
+	}
+	return prefix, nil
+}
+
+// String implements the fmt.Stringer interface
+func (prefix DevEUIPrefix) String() string {
+	return fmt.Sprintf("%s/%d", prefix.DevEUI, prefix.Length)
+}
+
+// Matches returns true if the DevEUI is in the range of the prefix
+func (prefix DevEUIPrefix) Matches(devEUI types.DevEUI) bool {
+	k := uint(prefix.Length)
+	for i := 0; i < 8 && k > 0; i++ {
+		mask := byte(0xff)
+		if k < 8 {
+			mask = ^byte(0xff >> k)
+		}
+		if devEUI[i]&mask != prefix.DevEUI[i]&mask {
+			return false
+		}
+		if k < 8 {
+			break
+		}
+		k -= 8
+	}
+	return true
+}
+
+// DevEUIAllowlist contains the ranges of DevEUIs that are allowed to activate. If it is empty, all DevEUIs are allowed.
+var DevEUIAllowlist []DevEUIPrefix
+
+// ErrDevEUINotAllowed is returned for activations of devices with a DevEUI outside the DevEUIAllowlist
+var ErrDevEUINotAllowed = errors.NewErrPermissionDenied("DevEUI not in an allowed range")
+
+// devEUIAllowed returns true if the DevEUI is in one of the ranges of the DevEUIAllowlist
+func devEUIAllowed(devEUI types.DevEUI) bool {
+	if len(DevEUIAllowlist) == 0 {
+		return true
+	}
+	for _, prefix := range DevEUIAllowlist {
+		if prefix.Matches(devEUI) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_handler "github.com/TheThingsNetwork/ttn/api/handler"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestDevEUIPrefix(t *testing.T) {
+	a := New(t)
+
+	prefix, err := ParseDevEUIPrefix("0102030400000000/30")
+	a.So(err, ShouldBeNil)
+	a.So(prefix.Length, ShouldEqual, 30)
+	a.So(prefix.String(), ShouldEqual, "0102030400000000/30")
+
+	a.So(prefix.Matches(types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))), ShouldBeTrue)
+	a.So(prefix.Matches(types.DevEUI(getEUI(1, 2, 3, 7, 0, 0, 0, 0))), ShouldBeTrue)
+	a.So(prefix.Matches(types.DevEUI(getEUI(1, 2, 3, 8, 0, 0, 0, 0))), ShouldBeFalse)
+	a.So(prefix.Matches(types.DevEUI(getEUI(2, 2, 3, 4, 5, 6, 7, 8))), ShouldBeFalse)
+
+	all, _ := ParseDevEUIPrefix("0000000000000000/0")
+	a.So(all.Matches(types.DevEUI(getEUI(0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff))), ShouldBeTrue)
+
+	one, _ := ParseDevEUIPrefix("0102030405060708/64")
+	a.So(one.Matches(types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))), ShouldBeTrue)
+	a.So(one.Matches(types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 9))), ShouldBeFalse)
+
+	for _, invalid := range []string{"", "0102030405060708", "01020304/8", "0102030405060708/65", "0102030405060708/x"} {
+		_, err := ParseDevEUIPrefix(invalid)
+		a.So(err, ShouldNotBeNil)
+	}
+}
+
+func TestDevEUIAllowlist(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-deveui-allowlist"),
+	}
+	ns.InitStatus()
+
+	defer func(allowlist []DevEUIPrefix) {
+		DevEUIAllowlist = allowlist
+	}(DevEUIAllowlist)
+
+	first, _ := ParseDevEUIPrefix("0102030400000000/32")
+	second, _ := ParseDevEUIPrefix("0a0b000000000000/16")
+	DevEUIAllowlist = []DevEUIPrefix{first, second}
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	inRange := types.DevEUI(getEUI(0x0a, 0x0b, 3, 4, 5, 6, 7, 8))
+	outOfRange := types.DevEUI(getEUI(0x0a, 0x0c, 3, 4, 5, 6, 7, 8))
+
+	for _, devEUI := range []types.DevEUI{inRange, outOfRange} {
+		ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI})
+		defer ns.devices.Delete(appEUI, devEUI)
+	}
+
+	prepare := func(devEUI types.DevEUI) error {
+		_, err := ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			AppEui: &appEUI,
+			DevEui: &devEUI,
+		})
+		return err
+	}
+
+	// In range
+	a.So(prepare(inRange), ShouldBeNil)
+
+	// Out of range
+	err := prepare(outOfRange)
+	a.So(err, ShouldEqual, ErrDevEUINotAllowed)
+	a.So(JoinFailureCause(err), ShouldEqual, "devEUI not allowed")
+
+	// ABP activation out of range
+	devAddr := getDevAddr(1, 2, 3, 4)
+	nwkSKey := types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+	_, err = ns.HandleActivate(&pb_handler.DeviceActivationResponse{
+		ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+			Lorawan: &pb_lorawan.ActivationMetadata{
+				AppEui:  &appEUI,
+				DevEui:  &outOfRange,
+				DevAddr: &devAddr,
+				NwkSKey: &nwkSKey,
+			},
+		}},
+	})
+	a.So(err, ShouldEqual, ErrDevEUINotAllowed)
+}
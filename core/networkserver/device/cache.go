@@ -0,0 +1,265 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package device
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/TheThingsNetwork/ttn/core/types"
+)
+
+// DefaultCacheSize is the number of DevAddrs that a CachedStore keeps by default
+const DefaultCacheSize = 100000
+
+// CachedStore is a Store that keeps the results of ListForAddress in memory, so that the DevAddr lookup of
+// uplink messages does not need a database round-trip. The cache is updated on Set and Delete through this
+// store, so it should not be used when other processes write to the same database. When the cache is full,
+// the least recently used DevAddr is evicted.
+type CachedStore struct {
+	Store
+
+	mu         sync.Mutex
+	size       int
+	devAddrs   map[types.DevAddr]*list.Element // Elements of lru
+	lru        *list.List                      // Values are *cacheEntry, the most recently used first
+	index      map[string]types.DevAddr
+	generation uint64 // Incremented on every write, so that a lookup that raced with a write is not cached
+}
+
+// cacheEntry contains the devices with a DevAddr
+type cacheEntry struct {
+	devAddr types.DevAddr
+	devices []*Device
+}
+
+// NewCachedStore wraps the given Store with a DevAddr cache of DefaultCacheSize DevAddrs
+func NewCachedStore(store Store) *CachedStore {
+	return NewCachedStoreWithSize(store, DefaultCacheSize)
+}
+
+// NewCachedStoreWithSize wraps the given Store with a DevAddr cache that keeps at most size DevAddrs
+func NewCachedStoreWithSize(store Store, size int) *CachedStore {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &CachedStore{
+		Store:    store,
+		size:     size,
+		devAddrs: make(map[types.DevAddr]*list.Element),
+		lru:      list.New(),
+		index:    make(map[string]types.DevAddr),
+	}
+}
+
+func cacheKey(dev *Device) string {
+	return fmt.Sprintf("%s:%s", dev.AppEUI, dev.DevEUI)
+}
+
+func cacheCopy(dev *Device) *Device {
+	if dev == nil {
+		return nil
+	}
+	cpy := *dev
+	cpy.old = nil
+	return &cpy
+}
+
+// ListForAddress lists all devices for a specific DevAddr, from the cache if possible. Lookups without devices
+// are not cached, so that a device that is created later is found.
+func (s *CachedStore) ListForAddress(devAddr types.DevAddr) ([]*Device, error) {
+	s.mu.Lock()
+	var cached []*Device
+	element, ok := s.devAddrs[devAddr]
+	if ok {
+		s.lru.MoveToFront(element)
+		cached = element.Value.(*cacheEntry).devices
+	}
+	generation := s.generation
+	s.mu.Unlock()
+	if !ok {
+		devices, err := s.Store.ListForAddress(devAddr)
+		if err != nil {
+			return nil, err
+		}
+		cached = make([]*Device, 0, len(devices))
+		for _, dev := range devices {
+			if dev != nil {
+				cached = append(cached, cacheCopy(dev))
+			}
+		}
+		if len(cached) > 0 {
+			s.mu.Lock()
+			if s.generation == generation {
+				s.add(devAddr, cached)
+			}
+			s.mu.Unlock()
+		}
+	}
+	devices := make([]*Device, len(cached))
+	for i, dev := range cached {
+		devices[i] = cacheCopy(dev)
+	}
+	return devices, nil
+}
+
+// Set a new Device or update an existing one
+func (s *CachedStore) Set(new *Device, properties ...string) error {
+	if err := s.Store.Set(new, properties...); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	key := cacheKey(new)
+	removed := make([]types.DevAddr, 0, 2)
+	if devAddr, ok := s.remove(key); ok {
+		removed = append(removed, devAddr)
+	}
+	if new.old != nil && cacheKey(new.old) != key {
+		if devAddr, ok := s.remove(cacheKey(new.old)); ok {
+			removed = append(removed, devAddr)
+		}
+	}
+	defer func() {
+		for _, devAddr := range removed {
+			s.evictEmpty(devAddr)
+		}
+	}()
+	if new.DevAddr.IsEmpty() {
+		return nil
+	}
+	if len(properties) > 0 {
+		// Only some fields were written, so we can not be sure that new is what the database contains
+		s.evict(new.DevAddr)
+		return nil
+	}
+	if element, ok := s.devAddrs[new.DevAddr]; ok {
+		entry := element.Value.(*cacheEntry)
+		entry.devices = append(entry.devices, cacheCopy(new))
+		s.index[key] = new.DevAddr
+	}
+	return nil
+}
+
+// Delete a Device
+func (s *CachedStore) Delete(appEUI types.AppEUI, devEUI types.DevEUI) error {
+	if err := s.Store.Delete(appEUI, devEUI); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	if devAddr, ok := s.remove(fmt.Sprintf("%s:%s", appEUI, devEUI)); ok {
+		s.evictEmpty(devAddr)
+	}
+	return nil
+}
+
+// WithTransaction runs fn in a transaction of the underlying Store. As the devices that were written in the
+// transaction are not known, the cache is cleared after a commit.
+func (s *CachedStore) WithTransaction(fn func(tx Store) error) error {
+	if err := s.Store.WithTransaction(fn); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	s.devAddrs = make(map[types.DevAddr]*list.Element)
+	s.lru.Init()
+	s.index = make(map[string]types.DevAddr)
+	return nil
+}
+
+// add the devices with the DevAddr to the cache, and evict the least recently used DevAddrs if the cache is full;
+// the caller must hold the lock
+func (s *CachedStore) add(devAddr types.DevAddr, devices []*Device) {
+	s.evict(devAddr)
+	s.devAddrs[devAddr] = s.lru.PushFront(&cacheEntry{devAddr: devAddr, devices: devices})
+	for _, dev := range devices {
+		s.index[cacheKey(dev)] = devAddr
+	}
+	for s.lru.Len() > s.size {
+		s.evict(s.lru.Back().Value.(*cacheEntry).devAddr)
+	}
+}
+
+// evict the DevAddr and its devices from the cache; the caller must hold the lock
+func (s *CachedStore) evict(devAddr types.DevAddr) {
+	element, ok := s.devAddrs[devAddr]
+	if !ok {
+		return
+	}
+	for _, dev := range element.Value.(*cacheEntry).devices {
+		delete(s.index, cacheKey(dev))
+	}
+	s.lru.Remove(element)
+	delete(s.devAddrs, devAddr)
+}
+
+// evictEmpty evicts the DevAddr if it has no devices left in the cache; the caller must hold the lock
+func (s *CachedStore) evictEmpty(devAddr types.DevAddr) {
+	if element, ok := s.devAddrs[devAddr]; ok && len(element.Value.(*cacheEntry).devices) == 0 {
+		s.evict(devAddr)
+	}
+}
+
+// remove the device with the given key from the cache and return its DevAddr; the caller must hold the lock
+func (s *CachedStore) remove(key string) (types.DevAddr, bool) {
+	devAddr, ok := s.index[key]
+	if !ok {
+		return devAddr, false
+	}
+	delete(s.index, key)
+	element, ok := s.devAddrs[devAddr]
+	if !ok {
+		return devAddr, false
+	}
+	entry := element.Value.(*cacheEntry)
+	remaining := make([]*Device, 0, len(entry.devices))
+	for _, dev := range entry.devices {
+		if cacheKey(dev) != key {
+			remaining = append(remaining, dev)
+		}
+	}
+	entry.devices = remaining
+	return devAddr, true
+}
+
+// Len returns the number of devices in the cache
+func (s *CachedStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.index)
+}
+
+// WarmUp loads the DevAddrs of the count most recently seen devices into the cache, using the LastSeen index of
+// the Store. All devices that share such a DevAddr are loaded, as an incomplete DevAddr entry would hide devices
+// from ListForAddress.
+func (s *CachedStore) WarmUp(count int) error {
+	if count <= 0 {
+		return nil
+	}
+	devices, err := s.Store.ListRecentlySeen(count)
+	if err != nil {
+		return err
+	}
+	for _, dev := range devices {
+		if dev.DevAddr.IsEmpty() {
+			continue
+		}
+		if _, err := s.ListForAddress(dev.DevAddr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ByLastSeen sorts Devices by LastSeen, the most recently seen first
+type ByLastSeen []*Device
+
+func (a ByLastSeen) Len() int           { return len(a) }
+func (a ByLastSeen) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a ByLastSeen) Less(i, j int) bool { return a[i].LastSeen.After(a[j].LastSeen) }
@@ -0,0 +1,106 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package device
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestCachedStore(t *testing.T) {
+	a := New(t)
+
+	s := NewCachedStore(NewRedisDeviceStore(GetRedisClient(), "networkserver-test-cached-store"))
+
+	now := time.Now()
+	devices := []*Device{
+		{AppEUI: types.AppEUI{1}, DevEUI: types.DevEUI{1}, DevAddr: types.DevAddr{0, 0, 0, 1}, LastSeen: now.Add(-3 * time.Hour)},
+		{AppEUI: types.AppEUI{1}, DevEUI: types.DevEUI{2}, DevAddr: types.DevAddr{0, 0, 0, 2}, LastSeen: now.Add(-1 * time.Hour)},
+		{AppEUI: types.AppEUI{1}, DevEUI: types.DevEUI{3}, DevAddr: types.DevAddr{0, 0, 0, 3}, LastSeen: now.Add(-2 * time.Hour)},
+		{AppEUI: types.AppEUI{1}, DevEUI: types.DevEUI{4}, DevAddr: types.DevAddr{0, 0, 0, 3}},
+	}
+	for _, dev := range devices {
+		a.So(s.Store.Set(dev), ShouldBeNil)
+	}
+	defer func() {
+		for _, dev := range devices {
+			s.Delete(dev.AppEUI, dev.DevEUI)
+		}
+	}()
+
+	a.So(s.Len(), ShouldEqual, 0)
+
+	// The two most recently seen devices, and the device that shares a DevAddr with one of them
+	a.So(s.WarmUp(2), ShouldBeNil)
+	a.So(s.Len(), ShouldEqual, 3)
+	a.So(s.devAddrs, ShouldContainKey, types.DevAddr{0, 0, 0, 2})
+	a.So(s.devAddrs, ShouldContainKey, types.DevAddr{0, 0, 0, 3})
+	a.So(s.devAddrs, ShouldNotContainKey, types.DevAddr{0, 0, 0, 1})
+
+	// Updates through the store are visible in the cache
+	dev, err := s.Get(types.AppEUI{1}, types.DevEUI{2})
+	a.So(err, ShouldBeNil)
+	dev.StartUpdate()
+	dev.FCntUp = 42
+	a.So(s.Set(dev), ShouldBeNil)
+	res, err := s.ListForAddress(types.DevAddr{0, 0, 0, 2})
+	a.So(err, ShouldBeNil)
+	a.So(res, ShouldHaveLength, 1)
+	a.So(res[0].FCntUp, ShouldEqual, 42)
+
+	// Modifying a result does not modify the cache
+	res[0].FCntUp = 43
+	res, _ = s.ListForAddress(types.DevAddr{0, 0, 0, 2})
+	a.So(res[0].FCntUp, ShouldEqual, 42)
+
+	// Deleted devices are removed from the cache
+	a.So(s.Delete(types.AppEUI{1}, types.DevEUI{4}), ShouldBeNil)
+	res, _ = s.ListForAddress(types.DevAddr{0, 0, 0, 3})
+	a.So(res, ShouldHaveLength, 1)
+	a.So(s.Len(), ShouldEqual, 2)
+}
+
+func TestCachedStoreSize(t *testing.T) {
+	a := New(t)
+
+	s := NewCachedStoreWithSize(NewRedisDeviceStore(GetRedisClient(), "networkserver-test-cached-store-size"), 2)
+
+	devices := []*Device{
+		{AppEUI: types.AppEUI{1}, DevEUI: types.DevEUI{1}, DevAddr: types.DevAddr{0, 0, 0, 1}},
+		{AppEUI: types.AppEUI{1}, DevEUI: types.DevEUI{2}, DevAddr: types.DevAddr{0, 0, 0, 2}},
+		{AppEUI: types.AppEUI{1}, DevEUI: types.DevEUI{3}, DevAddr: types.DevAddr{0, 0, 0, 3}},
+	}
+	for _, dev := range devices {
+		a.So(s.Store.Set(dev), ShouldBeNil)
+	}
+	defer func() {
+		for _, dev := range devices {
+			s.Delete(dev.AppEUI, dev.DevEUI)
+		}
+	}()
+
+	// Lookups without devices are not cached
+	res, err := s.ListForAddress(types.DevAddr{0, 0, 0, 4})
+	a.So(err, ShouldBeNil)
+	a.So(res, ShouldBeEmpty)
+	a.So(s.devAddrs, ShouldNotContainKey, types.DevAddr{0, 0, 0, 4})
+
+	// The least recently used DevAddr is evicted
+	s.ListForAddress(types.DevAddr{0, 0, 0, 1})
+	s.ListForAddress(types.DevAddr{0, 0, 0, 2})
+	s.ListForAddress(types.DevAddr{0, 0, 0, 1})
+	s.ListForAddress(types.DevAddr{0, 0, 0, 3})
+	a.So(s.devAddrs, ShouldHaveLength, 2)
+	a.So(s.devAddrs, ShouldContainKey, types.DevAddr{0, 0, 0, 1})
+	a.So(s.devAddrs, ShouldContainKey, types.DevAddr{0, 0, 0, 3})
+	a.So(s.Len(), ShouldEqual, 2)
+
+	// A DevAddr without devices is evicted
+	a.So(s.Delete(types.AppEUI{1}, types.DevEUI{3}), ShouldBeNil)
+	a.So(s.devAddrs, ShouldNotContainKey, types.DevAddr{0, 0, 0, 3})
+}
@@ -0,0 +1,126 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package device
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/TheThingsNetwork/go-utils/encoding"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// Codec marshals Devices for storage
+type Codec interface {
+	Marshal(dev Device) ([]byte, error)
+	Unmarshal(data []byte) (Device, error)
+}
+
+// Codecs for the device store. Without a Codec, the store saves each field of a Device
+// in a separate field of the Redis hash, which allows updating only changed fields and
+// migrating records. The ProtobufCodec is defined in codec_protobuf.go.
+var (
+	// JSONCodec stores Devices as JSON, which makes records readable in Redis
+	JSONCodec Codec = jsonCodec{}
+	// GobCodec stores Devices in the gob format
+	GobCodec Codec = gobCodec{}
+)
+
+// ParseCodec returns the Codec with the given name (hash, json, gob or protobuf). The hash Codec is nil, as the
+// store then saves the fields of Devices separately. Records that were saved without Codec can be read with any
+// Codec, but records that were saved with a Codec can only be read with that Codec.
+func ParseCodec(name string) (Codec, error) {
+	switch name {
+	case "hash":
+		return nil, nil
+	case "json":
+		return JSONCodec, nil
+	case "gob":
+		return GobCodec, nil
+	case "protobuf":
+		return ProtobufCodec, nil
+	}
+	return nil, errors.NewErrInvalidArgument("Codec", fmt.Sprintf("%s is not hash, json, gob or protobuf", name))
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(dev Device) ([]byte, error) {
+	return json.Marshal(dev)
+}
+
+func (jsonCodec) Unmarshal(data []byte) (dev Device, err error) {
+	err = json.Unmarshal(data, &dev)
+	return
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(dev Device) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(dev); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte) (dev Device, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&dev)
+	return
+}
+
+// hashEncoder stores each field of a Device in a separate field of the Redis hash
+func hashEncoder(input interface{}, properties ...string) (map[string]string, error) {
+	return encoding.ToStringStringMap("redis", input, properties...)
+}
+
+// hashDecoder is the counterpart of hashEncoder
+func hashDecoder(input map[string]string) (output interface{}, err error) {
+	return encoding.FromStringStringMap("redis", Device{}, input)
+}
+
+// codecDataField is the field of the Redis hash that contains the marshaled Device
+const codecDataField = "data"
+
+// fCntUpField is the field of the Redis hash that contains the FCntUp, with and without codec
+const fCntUpField = "f_cnt_up"
+
+// codecEncoder returns an encoder for the RedisMapStore that stores the whole Device in one field.
+// The DevAddr and FCntUp are also stored in their own fields, as the store needs to get them without the rest of
+// the Device.
+func codecEncoder(codec Codec) func(input interface{}, properties ...string) (map[string]string, error) {
+	return func(input interface{}, properties ...string) (map[string]string, error) {
+		dev, ok := input.(Device)
+		if !ok {
+			return nil, errors.New("Codec can only encode Devices")
+		}
+		data, err := codec.Marshal(dev)
+		if err != nil {
+			return nil, err
+		}
+		devAddr, err := dev.DevAddr.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{
+			codecDataField: string(data),
+			"dev_addr":     string(devAddr),
+			fCntUpField:    strconv.FormatUint(uint64(dev.FCntUp), 10),
+		}, nil
+	}
+}
+
+// codecDecoder returns a decoder for the RedisMapStore that is the counterpart of codecEncoder
+func codecDecoder(codec Codec) func(input map[string]string) (output interface{}, err error) {
+	return func(input map[string]string) (output interface{}, err error) {
+		data, ok := input[codecDataField]
+		if !ok {
+			return encoding.FromStringStringMap("redis", Device{}, input)
+		}
+		return codec.Unmarshal([]byte(data))
+	}
+}
@@ -0,0 +1,436 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package device
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/gogo/protobuf/proto"
+)
+
+// ProtobufCodec stores Devices in the protobuf wire format, which gives the smallest records. The MACState of
+// Devices is not stored, as the NetworkServer only sets it when getting a single device.
+var ProtobufCodec Codec = protobufCodec{}
+
+type protobufCodec struct{}
+
+func (protobufCodec) Marshal(dev Device) ([]byte, error) {
+	return proto.Marshal(newDeviceMessage(dev))
+}
+
+func (protobufCodec) Unmarshal(data []byte) (Device, error) {
+	msg := new(deviceMessage)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return Device{}, err
+	}
+	return msg.device(), nil
+}
+
+// The messages below are the protobuf representation of a Device. Field numbers must never be changed or reused,
+// new fields get a new number.
+
+type deviceMessage struct {
+	DevEUI               []byte                `protobuf:"bytes,1,opt,name=dev_eui"`
+	AppEUI               []byte                `protobuf:"bytes,2,opt,name=app_eui"`
+	AppID                string                `protobuf:"bytes,3,opt,name=app_id"`
+	DevID                string                `protobuf:"bytes,4,opt,name=dev_id"`
+	DevAddr              []byte                `protobuf:"bytes,5,opt,name=dev_addr"`
+	NwkSKey              []byte                `protobuf:"bytes,6,opt,name=nwk_s_key"`
+	AppSKey              []byte                `protobuf:"bytes,7,opt,name=app_s_key"`
+	FCntUp               uint32                `protobuf:"varint,8,opt,name=f_cnt_up"`
+	FCntDown             uint32                `protobuf:"varint,9,opt,name=f_cnt_down"`
+	LastSeen             int64                 `protobuf:"varint,10,opt,name=last_seen"`
+	Options              *optionsMessage       `protobuf:"bytes,11,opt,name=options"`
+	Class                uint32                `protobuf:"varint,12,opt,name=class"`
+	RXDelay              uint32                `protobuf:"varint,13,opt,name=rx_delay"`
+	ADR                  *adrMessage           `protobuf:"bytes,14,opt,name=adr"`
+	TxParams             *txParamsMessage      `protobuf:"bytes,15,opt,name=tx_params"`
+	DevAddrPrefix        []byte                `protobuf:"bytes,16,opt,name=dev_addr_prefix"`
+	RX2Frequency         uint32                `protobuf:"varint,17,opt,name=rx2_frequency"`
+	RX2DataRate          string                `protobuf:"bytes,18,opt,name=rx2_data_rate"`
+	ConfirmedClass       uint32                `protobuf:"varint,19,opt,name=confirmed_class"`
+	Blocked              bool                  `protobuf:"varint,20,opt,name=blocked"`
+	Tags                 map[string]string     `protobuf:"bytes,21,rep,name=tags" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	SessionStartedAt     int64                 `protobuf:"varint,22,opt,name=session_started_at"`
+	SessionGraceDeadline int64                 `protobuf:"varint,23,opt,name=session_grace_deadline"`
+	LastDownlink         int64                 `protobuf:"varint,24,opt,name=last_downlink"`
+	LastDevNonce         []byte                `protobuf:"bytes,25,opt,name=last_dev_nonce"`
+	MinorVersion         uint32                `protobuf:"varint,26,opt,name=minor_version"`
+	RJCount0             uint32                `protobuf:"varint,27,opt,name=rj_count_0"`
+	Usage                *usageMessage         `protobuf:"bytes,28,opt,name=usage"`
+	MICFailures          *micFailuresMessage   `protobuf:"bytes,29,opt,name=mic_failures"`
+	MACCommands          []*macCommandMessage  `protobuf:"bytes,30,rep,name=mac_commands"`
+	Channels             []*channelMessage     `protobuf:"bytes,31,rep,name=channels"`
+	DataRates            []string              `protobuf:"bytes,32,rep,name=data_rates"`
+	UplinkChannel        *uplinkChannelMessage `protobuf:"bytes,33,opt,name=uplink_channel"`
+	ConfirmedMACCommands []*macCommandMessage  `protobuf:"bytes,34,rep,name=confirmed_mac_commands"`
+	CreatedAt            int64                 `protobuf:"varint,35,opt,name=created_at"`
+	UpdatedAt            int64                 `protobuf:"varint,36,opt,name=updated_at"`
+	SessionDevNonce      []byte                `protobuf:"bytes,37,opt,name=session_dev_nonce"`
+}
+
+func (m *deviceMessage) Reset()         { *m = deviceMessage{} }
+func (m *deviceMessage) String() string { return proto.CompactTextString(m) }
+func (*deviceMessage) ProtoMessage()    {}
+
+type optionsMessage struct {
+	ActivationConstraints string  `protobuf:"bytes,1,opt,name=activation_constraints"`
+	DisableFCntCheck      bool    `protobuf:"varint,2,opt,name=disable_fcnt_check"`
+	Uses32BitFCnt         bool    `protobuf:"varint,3,opt,name=uses_32_bit_fcnt"`
+	MinDataRate           int64   `protobuf:"varint,4,opt,name=min_data_rate"`
+	MaxDataRate           int64   `protobuf:"varint,5,opt,name=max_data_rate"`
+	DownlinkDisabled      bool    `protobuf:"varint,6,opt,name=downlink_disabled"`
+	FCntCheckMode         string  `protobuf:"bytes,7,opt,name=fcnt_check_mode"`
+	ADRAckLimit           uint32  `protobuf:"varint,8,opt,name=adr_ack_limit"`
+	ADRAckDelay           uint32  `protobuf:"varint,9,opt,name=adr_ack_delay"`
+	Multicast             bool    `protobuf:"varint,10,opt,name=multicast"`
+	MACOnlyDownlinkMode   string  `protobuf:"bytes,11,opt,name=mac_only_downlink_mode"`
+	AllowedDataRates      []int64 `protobuf:"varint,12,rep,packed,name=allowed_data_rates"`
+	GuaranteeAck          bool    `protobuf:"varint,13,opt,name=guarantee_ack"`
+}
+
+func (m *optionsMessage) Reset()         { *m = optionsMessage{} }
+func (m *optionsMessage) String() string { return proto.CompactTextString(m) }
+func (*optionsMessage) ProtoMessage()    {}
+
+type adrMessage struct {
+	Band     string `protobuf:"bytes,1,opt,name=band"`
+	Margin   int64  `protobuf:"varint,2,opt,name=margin"`
+	SendReq  bool   `protobuf:"varint,3,opt,name=send_req"`
+	Failed   int64  `protobuf:"varint,4,opt,name=failed"`
+	AckCnt   int64  `protobuf:"varint,5,opt,name=ack_cnt"`
+	DataRate string `protobuf:"bytes,6,opt,name=data_rate"`
+	TxPower  int64  `protobuf:"varint,7,opt,name=tx_power"`
+	NbTrans  int64  `protobuf:"varint,8,opt,name=nb_trans"`
+}
+
+func (m *adrMessage) Reset()         { *m = adrMessage{} }
+func (m *adrMessage) String() string { return proto.CompactTextString(m) }
+func (*adrMessage) ProtoMessage()    {}
+
+type txParamsMessage struct {
+	Set               bool  `protobuf:"varint,1,opt,name=set"`
+	UplinkDwellTime   bool  `protobuf:"varint,2,opt,name=uplink_dwell_time"`
+	DownlinkDwellTime bool  `protobuf:"varint,3,opt,name=downlink_dwell_time"`
+	MaxEIRP           int64 `protobuf:"varint,4,opt,name=max_eirp"`
+}
+
+func (m *txParamsMessage) Reset()         { *m = txParamsMessage{} }
+func (m *txParamsMessage) String() string { return proto.CompactTextString(m) }
+func (*txParamsMessage) ProtoMessage()    {}
+
+type usageMessage struct {
+	Since            int64  `protobuf:"varint,1,opt,name=since"`
+	UplinkMessages   uint64 `protobuf:"varint,2,opt,name=uplink_messages"`
+	UplinkBytes      uint64 `protobuf:"varint,3,opt,name=uplink_bytes"`
+	DownlinkMessages uint64 `protobuf:"varint,4,opt,name=downlink_messages"`
+	DownlinkBytes    uint64 `protobuf:"varint,5,opt,name=downlink_bytes"`
+}
+
+func (m *usageMessage) Reset()         { *m = usageMessage{} }
+func (m *usageMessage) String() string { return proto.CompactTextString(m) }
+func (*usageMessage) ProtoMessage()    {}
+
+type micFailuresMessage struct {
+	Total  uint64 `protobuf:"varint,1,opt,name=total"`
+	Since  int64  `protobuf:"varint,2,opt,name=since"`
+	Recent uint64 `protobuf:"varint,3,opt,name=recent"`
+	Last   int64  `protobuf:"varint,4,opt,name=last"`
+}
+
+func (m *micFailuresMessage) Reset()         { *m = micFailuresMessage{} }
+func (m *micFailuresMessage) String() string { return proto.CompactTextString(m) }
+func (*micFailuresMessage) ProtoMessage()    {}
+
+type macCommandMessage struct {
+	CID      uint32 `protobuf:"varint,1,opt,name=cid"`
+	Payload  []byte `protobuf:"bytes,2,opt,name=payload"`
+	Sticky   bool   `protobuf:"varint,3,opt,name=sticky"`
+	Sent     uint32 `protobuf:"varint,4,opt,name=sent"`
+	Priority int64  `protobuf:"varint,5,opt,name=priority"`
+}
+
+func (m *macCommandMessage) Reset()         { *m = macCommandMessage{} }
+func (m *macCommandMessage) String() string { return proto.CompactTextString(m) }
+func (*macCommandMessage) ProtoMessage()    {}
+
+type channelMessage struct {
+	Index     uint32 `protobuf:"varint,1,opt,name=index"`
+	Frequency uint32 `protobuf:"varint,2,opt,name=frequency"`
+	MinDR     uint32 `protobuf:"varint,3,opt,name=min_dr"`
+	MaxDR     uint32 `protobuf:"varint,4,opt,name=max_dr"`
+}
+
+func (m *channelMessage) Reset()         { *m = channelMessage{} }
+func (m *channelMessage) String() string { return proto.CompactTextString(m) }
+func (*channelMessage) ProtoMessage()    {}
+
+type uplinkChannelMessage struct {
+	Index     int64  `protobuf:"varint,1,opt,name=index"`
+	Frequency uint32 `protobuf:"varint,2,opt,name=frequency"`
+}
+
+func (m *uplinkChannelMessage) Reset()         { *m = uplinkChannelMessage{} }
+func (m *uplinkChannelMessage) String() string { return proto.CompactTextString(m) }
+func (*uplinkChannelMessage) ProtoMessage()    {}
+
+// unixNano returns the time in nanoseconds since the epoch, or 0 for the zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano is the counterpart of unixNano
+func fromUnixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns).UTC()
+}
+
+func newMACCommandMessages(cmds []MACCommand) []*macCommandMessage {
+	if len(cmds) == 0 {
+		return nil
+	}
+	msgs := make([]*macCommandMessage, len(cmds))
+	for i, cmd := range cmds {
+		msgs[i] = &macCommandMessage{
+			CID:      uint32(cmd.CID),
+			Payload:  cmd.Payload,
+			Sticky:   cmd.Sticky,
+			Sent:     cmd.Sent,
+			Priority: int64(cmd.Priority),
+		}
+	}
+	return msgs
+}
+
+func macCommands(msgs []*macCommandMessage) []MACCommand {
+	if len(msgs) == 0 {
+		return nil
+	}
+	cmds := make([]MACCommand, len(msgs))
+	for i, msg := range msgs {
+		cmds[i] = MACCommand{
+			CID:      uint8(msg.CID),
+			Payload:  msg.Payload,
+			Sticky:   msg.Sticky,
+			Sent:     msg.Sent,
+			Priority: int(msg.Priority),
+		}
+	}
+	return cmds
+}
+
+func newDeviceMessage(dev Device) *deviceMessage {
+	msg := &deviceMessage{
+		DevEUI:   dev.DevEUI[:],
+		AppEUI:   dev.AppEUI[:],
+		AppID:    dev.AppID,
+		DevID:    dev.DevID,
+		DevAddr:  dev.DevAddr[:],
+		NwkSKey:  dev.NwkSKey[:],
+		AppSKey:  dev.AppSKey[:],
+		FCntUp:   dev.FCntUp,
+		FCntDown: dev.FCntDown,
+		LastSeen: unixNano(dev.LastSeen),
+		Options: &optionsMessage{
+			ActivationConstraints: dev.Options.ActivationConstraints,
+			DisableFCntCheck:      dev.Options.DisableFCntCheck,
+			Uses32BitFCnt:         dev.Options.Uses32BitFCnt,
+			MinDataRate:           int64(dev.Options.MinDataRate),
+			MaxDataRate:           int64(dev.Options.MaxDataRate),
+			DownlinkDisabled:      dev.Options.DownlinkDisabled,
+			FCntCheckMode:         dev.Options.FCntCheckMode,
+			ADRAckLimit:           dev.Options.ADRAckLimit,
+			ADRAckDelay:           dev.Options.ADRAckDelay,
+			Multicast:             dev.Options.Multicast,
+			MACOnlyDownlinkMode:   dev.Options.MACOnlyDownlinkMode,
+			GuaranteeAck:          dev.Options.GuaranteeAck,
+		},
+		Class:   uint32(dev.Class),
+		RXDelay: uint32(dev.RXDelay),
+		ADR: &adrMessage{
+			Band:     dev.ADR.Band,
+			Margin:   int64(dev.ADR.Margin),
+			SendReq:  dev.ADR.SendReq,
+			Failed:   int64(dev.ADR.Failed),
+			AckCnt:   int64(dev.ADR.AckCnt),
+			DataRate: dev.ADR.DataRate,
+			TxPower:  int64(dev.ADR.TxPower),
+			NbTrans:  int64(dev.ADR.NbTrans),
+		},
+		TxParams: &txParamsMessage{
+			Set:               dev.TxParams.Set,
+			UplinkDwellTime:   dev.TxParams.UplinkDwellTime,
+			DownlinkDwellTime: dev.TxParams.DownlinkDwellTime,
+			MaxEIRP:           int64(dev.TxParams.MaxEIRP),
+		},
+		DevAddrPrefix:        dev.DevAddrPrefix.Bytes(),
+		RX2Frequency:         dev.RX2Frequency,
+		RX2DataRate:          dev.RX2DataRate,
+		ConfirmedClass:       uint32(dev.ConfirmedClass),
+		Blocked:              dev.Blocked,
+		Tags:                 dev.Tags,
+		SessionStartedAt:     unixNano(dev.SessionStartedAt),
+		SessionGraceDeadline: unixNano(dev.SessionGraceDeadline),
+		LastDownlink:         unixNano(dev.LastDownlink),
+		LastDevNonce:         dev.LastDevNonce[:],
+		SessionDevNonce:      dev.SessionDevNonce[:],
+		MinorVersion:         uint32(dev.MinorVersion),
+		RJCount0:             uint32(dev.RJCount0),
+		Usage: &usageMessage{
+			Since:            unixNano(dev.Usage.Since),
+			UplinkMessages:   dev.Usage.UplinkMessages,
+			UplinkBytes:      dev.Usage.UplinkBytes,
+			DownlinkMessages: dev.Usage.DownlinkMessages,
+			DownlinkBytes:    dev.Usage.DownlinkBytes,
+		},
+		MICFailures: &micFailuresMessage{
+			Total:  dev.MICFailures.Total,
+			Since:  unixNano(dev.MICFailures.Since),
+			Recent: dev.MICFailures.Recent,
+			Last:   unixNano(dev.MICFailures.Last),
+		},
+		MACCommands: newMACCommandMessages(dev.MACCommands),
+		DataRates:   dev.DataRates,
+		UplinkChannel: &uplinkChannelMessage{
+			Index:     int64(dev.UplinkChannel.Index),
+			Frequency: dev.UplinkChannel.Frequency,
+		},
+		ConfirmedMACCommands: newMACCommandMessages(dev.ConfirmedMACCommands),
+		CreatedAt:            unixNano(dev.CreatedAt),
+		UpdatedAt:            unixNano(dev.UpdatedAt),
+	}
+	for _, dr := range dev.Options.AllowedDataRates {
+		msg.Options.AllowedDataRates = append(msg.Options.AllowedDataRates, int64(dr))
+	}
+	for _, channel := range dev.Channels {
+		msg.Channels = append(msg.Channels, &channelMessage{
+			Index:     uint32(channel.Index),
+			Frequency: channel.Frequency,
+			MinDR:     uint32(channel.MinDR),
+			MaxDR:     uint32(channel.MaxDR),
+		})
+	}
+	return msg
+}
+
+func (m *deviceMessage) device() Device {
+	dev := Device{
+		AppID:                m.AppID,
+		DevID:                m.DevID,
+		FCntUp:               m.FCntUp,
+		FCntDown:             m.FCntDown,
+		LastSeen:             fromUnixNano(m.LastSeen),
+		Class:                Class(m.Class),
+		RXDelay:              uint8(m.RXDelay),
+		RX2Frequency:         m.RX2Frequency,
+		RX2DataRate:          m.RX2DataRate,
+		ConfirmedClass:       Class(m.ConfirmedClass),
+		Blocked:              m.Blocked,
+		SessionStartedAt:     fromUnixNano(m.SessionStartedAt),
+		SessionGraceDeadline: fromUnixNano(m.SessionGraceDeadline),
+		LastDownlink:         fromUnixNano(m.LastDownlink),
+		MinorVersion:         MinorVersion(m.MinorVersion),
+		RJCount0:             uint16(m.RJCount0),
+		MACCommands:          macCommands(m.MACCommands),
+		ConfirmedMACCommands: macCommands(m.ConfirmedMACCommands),
+		CreatedAt:            fromUnixNano(m.CreatedAt),
+		UpdatedAt:            fromUnixNano(m.UpdatedAt),
+	}
+	copy(dev.DevEUI[:], m.DevEUI)
+	copy(dev.AppEUI[:], m.AppEUI)
+	copy(dev.DevAddr[:], m.DevAddr)
+	copy(dev.NwkSKey[:], m.NwkSKey)
+	copy(dev.AppSKey[:], m.AppSKey)
+	copy(dev.LastDevNonce[:], m.LastDevNonce)
+	copy(dev.SessionDevNonce[:], m.SessionDevNonce)
+	if len(m.DevAddrPrefix) > 0 {
+		var prefix types.DevAddrPrefix
+		if err := prefix.UnmarshalBinary(m.DevAddrPrefix); err == nil {
+			dev.DevAddrPrefix = prefix
+		}
+	}
+	if len(m.Tags) > 0 {
+		dev.Tags = m.Tags
+	}
+	if len(m.DataRates) > 0 {
+		dev.DataRates = m.DataRates
+	}
+	if o := m.Options; o != nil {
+		dev.Options = Options{
+			ActivationConstraints: o.ActivationConstraints,
+			DisableFCntCheck:      o.DisableFCntCheck,
+			Uses32BitFCnt:         o.Uses32BitFCnt,
+			MinDataRate:           int(o.MinDataRate),
+			MaxDataRate:           int(o.MaxDataRate),
+			DownlinkDisabled:      o.DownlinkDisabled,
+			FCntCheckMode:         o.FCntCheckMode,
+			ADRAckLimit:           o.ADRAckLimit,
+			ADRAckDelay:           o.ADRAckDelay,
+			Multicast:             o.Multicast,
+			MACOnlyDownlinkMode:   o.MACOnlyDownlinkMode,
+			GuaranteeAck:          o.GuaranteeAck,
+		}
+		for _, dr := range o.AllowedDataRates {
+			dev.Options.AllowedDataRates = append(dev.Options.AllowedDataRates, int(dr))
+		}
+	}
+	if adr := m.ADR; adr != nil {
+		dev.ADR = ADRSettings{
+			Band:     adr.Band,
+			Margin:   int(adr.Margin),
+			SendReq:  adr.SendReq,
+			Failed:   int(adr.Failed),
+			AckCnt:   int(adr.AckCnt),
+			DataRate: adr.DataRate,
+			TxPower:  int(adr.TxPower),
+			NbTrans:  int(adr.NbTrans),
+		}
+	}
+	if tx := m.TxParams; tx != nil {
+		dev.TxParams = TxParams{
+			Set:               tx.Set,
+			UplinkDwellTime:   tx.UplinkDwellTime,
+			DownlinkDwellTime: tx.DownlinkDwellTime,
+			MaxEIRP:           int(tx.MaxEIRP),
+		}
+	}
+	if usage := m.Usage; usage != nil {
+		dev.Usage = Usage{
+			Since:            fromUnixNano(usage.Since),
+			UplinkMessages:   usage.UplinkMessages,
+			UplinkBytes:      usage.UplinkBytes,
+			DownlinkMessages: usage.DownlinkMessages,
+			DownlinkBytes:    usage.DownlinkBytes,
+		}
+	}
+	if failures := m.MICFailures; failures != nil {
+		dev.MICFailures = MICFailures{
+			Total:  failures.Total,
+			Since:  fromUnixNano(failures.Since),
+			Recent: failures.Recent,
+			Last:   fromUnixNano(failures.Last),
+		}
+	}
+	for _, channel := range m.Channels {
+		dev.Channels = append(dev.Channels, Channel{
+			Index:     uint8(channel.Index),
+			Frequency: channel.Frequency,
+			MinDR:     uint8(channel.MinDR),
+			MaxDR:     uint8(channel.MaxDR),
+		})
+	}
+	if uplinkChannel := m.UplinkChannel; uplinkChannel != nil {
+		dev.UplinkChannel = UplinkChannel{
+			Index:     int(uplinkChannel.Index),
+			Frequency: uplinkChannel.Frequency,
+		}
+	}
+	return dev
+}
@@ -4,20 +4,109 @@
 package device
 
 import (
+	"fmt"
 	"reflect"
 	"time"
 
 	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
 	"github.com/fatih/structs"
 )
 
-const currentDBVersion = "2.4.1"
+const currentDBVersion = "2.6.0"
 
 // Options for the specified device
 type Options struct {
 	ActivationConstraints string `json:"activation_constraints,omitempty"` // Activation Constraints (public/local/private)
 	DisableFCntCheck      bool   `json:"disable_fcnt_check,omitemtpy"`     // Disable Frame counter check (insecure)
 	Uses32BitFCnt         bool   `json:"uses_32_bit_fcnt,omitemtpy"`       // Use 32-bit Frame counters
+	MinDataRate           int    `json:"min_data_rate,omitempty"`          // Lowest data rate index for ADR (overrides the NetworkServer default)
+	MaxDataRate           int    `json:"max_data_rate,omitempty"`          // Highest data rate index for ADR (overrides the NetworkServer default)
+	DownlinkDisabled      bool   `json:"downlink_disabled,omitempty"`      // Do not send downlink to the device
+	FCntCheckMode         string `json:"fcnt_check_mode,omitempty"`        // Frame counter check mode (overrides the NetworkServer default)
+	ADRAckLimit           uint32 `json:"adr_ack_limit,omitempty"`          // ADR_ACK_LIMIT of the device (overrides the NetworkServer default)
+	ADRAckDelay           uint32 `json:"adr_ack_delay,omitempty"`          // ADR_ACK_DELAY of the device (overrides the NetworkServer default)
+	Multicast             bool   `json:"multicast,omitempty"`              // The session is shared by a multicast group, which can not acknowledge downlink
+	MACOnlyDownlinkMode   string `json:"mac_only_downlink_mode,omitempty"` // How downlinks with only MAC commands are sent (overrides the NetworkServer default)
+	AllowedDataRates      []int  `json:"allowed_data_rates,omitempty"`     // Data rate indices that the device may use (all data rates if empty)
+	GuaranteeAck          bool   `json:"guarantee_ack,omitempty"`          // Reject confirmed uplinks of which the ACK can not be sent
+}
+
+// maxDataRateIndex is the highest data rate index that can be set with LinkADRReq
+const maxDataRateIndex = 15
+
+// maxADRAckParam is the highest ADR_ACK_LIMIT and ADR_ACK_DELAY that can be set with ADRParamSetupReq
+const maxADRAckParam = 1 << 15
+
+// Validate the options
+func (o Options) Validate() error {
+	for name, value := range map[string]uint32{"ADR_ACK_LIMIT": o.ADRAckLimit, "ADR_ACK_DELAY": o.ADRAckDelay} {
+		if value == 0 {
+			continue
+		}
+		// ADRParamSetupReq sets the parameters as powers of 2
+		if value > maxADRAckParam || value&(value-1) != 0 {
+			return errors.NewErrInvalidArgument(name, fmt.Sprintf("%d is not a power of 2 up to %d", value, maxADRAckParam))
+		}
+	}
+	for _, dr := range o.AllowedDataRates {
+		if dr < 0 || dr > maxDataRateIndex {
+			return errors.NewErrInvalidArgument("Allowed data rates", fmt.Sprintf("%d is not a data rate index", dr))
+		}
+	}
+	return nil
+}
+
+// Class of a LoRaWAN device
+type Class uint8
+
+// LoRaWAN device classes, numbered as in the DeviceModeInd MAC command
+const (
+	ClassA Class = iota
+	ClassB
+	ClassC
+)
+
+func (c Class) String() string {
+	switch c {
+	case ClassA:
+		return "A"
+	case ClassB:
+		return "B"
+	case ClassC:
+		return "C"
+	}
+	return "RFU"
+}
+
+// MinorVersion of the LoRaWAN specification that the device implements
+type MinorVersion uint8
+
+// LoRaWAN minor versions
+const (
+	LoRaWAN1_0 MinorVersion = iota // LoRaWAN 1.0.x
+	LoRaWAN1_1                     // LoRaWAN 1.1
+)
+
+func (v MinorVersion) String() string {
+	switch v {
+	case LoRaWAN1_0:
+		return "1.0"
+	case LoRaWAN1_1:
+		return "1.1"
+	}
+	return "RFU"
+}
+
+// ParseMinorVersion returns the MinorVersion of a LoRaWAN version (1.0 or 1.1). An empty version is LoRaWAN 1.0.
+func ParseMinorVersion(version string) (MinorVersion, error) {
+	switch version {
+	case "", "1.0":
+		return LoRaWAN1_0, nil
+	case "1.1":
+		return LoRaWAN1_1, nil
+	}
+	return 0, errors.NewErrInvalidArgument("LoRaWAN version", fmt.Sprintf("%s is not 1.0 or 1.1", version))
 }
 
 // Device contains the state of a device
@@ -30,16 +119,105 @@ type Device struct {
 	DevID    string        `redis:"dev_id"`
 	DevAddr  types.DevAddr `redis:"dev_addr"`
 	NwkSKey  types.NwkSKey `redis:"nwk_s_key"`
+	AppSKey  types.AppSKey `redis:"app_s_key"` // Only stored when the network server is combined with the handler
 	FCntUp   uint32        `redis:"f_cnt_up"`
 	FCntDown uint32        `redis:"f_cnt_down"`
 	LastSeen time.Time     `redis:"last_seen"`
 	Options  Options       `redis:"options"`
+	Class    Class         `redis:"class"`
+	RXDelay  uint8         `redis:"rx_delay"`
 	ADR      ADRSettings   `redis:"adr,include"`
+	TxParams TxParams      `redis:"tx_params"`
+
+	DevAddrPrefix types.DevAddrPrefix `redis:"dev_addr_prefix"` // Prefix of the NetworkServer that the DevAddr of the last activation is in
+
+	RX2Frequency uint32 `redis:"rx2_frequency"` // RX2 frequency in Hz as set with RXParamSetupReq, 0 for the default of the band
+	RX2DataRate  string `redis:"rx2_data_rate"` // RX2 data rate as sent in the JoinAccept or set with RXParamSetupReq, empty for the default of the band
+
+	ConfirmedClass Class `redis:"confirmed_class"` // Class that the device switched to, as confirmed by an uplink after the DeviceModeConf
+
+	Blocked bool `redis:"blocked"` // Blocked devices can not activate or send uplink
+
+	Tags map[string]string `redis:"tags"` // Labels of the operator, such as location, owner or firmware version
+
+	SessionStartedAt time.Time `redis:"session_started_at"` // Time of the activation of the current session
+
+	SessionGraceDeadline time.Time `redis:"session_grace_deadline"` // Until when uplinks of the expired session are accepted
+
+	LastDownlink time.Time `redis:"last_downlink"` // Time of the last downlink, to send at most one downlink per uplink
+
+	LastDevNonce    types.DevNonce `redis:"last_dev_nonce"`    // DevNonce of the last JoinRequest
+	SessionDevNonce types.DevNonce `redis:"session_dev_nonce"` // DevNonce of the JoinRequest of the current session
+
+	MinorVersion MinorVersion `redis:"minor_version"`
+	RJCount0     uint16       `redis:"rj_count_0"` // Last RJcount0 (LoRaWAN 1.1 only)
+
+	Usage Usage `redis:"usage"`
+
+	MICFailures MICFailures `redis:"mic_failures"` // Uplinks with the DevAddr of the device that no device could validate
+
+	MACCommands []MACCommand `redis:"mac_commands"` // Queued downlink MAC commands
+	Channels    []Channel    `redis:"channels"`     // Channels that were added to the channel plan of the device
+	DataRates   []string     `redis:"data_rates"`   // Data rates of the last uplinks, the oldest first
+
+	UplinkChannel UplinkChannel `redis:"uplink_channel"` // Channel of the last uplink, to compute the RX1 frequency
+
+	ConfirmedMACCommands []MACCommand `redis:"confirmed_mac_commands"` // Last downlink MAC command of each CID that the device accepted
+
+	MACState []MACCommandState `redis:"-"` // Only set by the NetworkServer when getting a single device
 
 	CreatedAt time.Time `redis:"created_at"`
 	UpdatedAt time.Time `redis:"updated_at"`
 }
 
+// Usage of a device in the current accounting window
+type Usage struct {
+	Since            time.Time `json:"since"`
+	UplinkMessages   uint64    `json:"uplink_messages,omitempty"`
+	UplinkBytes      uint64    `json:"uplink_bytes,omitempty"`
+	DownlinkMessages uint64    `json:"downlink_messages,omitempty"`
+	DownlinkBytes    uint64    `json:"downlink_bytes,omitempty"`
+}
+
+// MICFailures of a device, counted over all time and in the current window
+type MICFailures struct {
+	Total  uint64    `json:"total,omitempty"`
+	Since  time.Time `json:"since"`            // Start of the current window
+	Recent uint64    `json:"recent,omitempty"` // Failures in the current window, the failure rate of the device
+	Last   time.Time `json:"last"`
+}
+
+// TxParams of a device, as set with the TxParamSetupReq MAC command
+type TxParams struct {
+	Set               bool `json:"set,omitempty"` // If not set, the defaults of the band apply
+	UplinkDwellTime   bool `json:"uplink_dwell_time,omitempty"`
+	DownlinkDwellTime bool `json:"downlink_dwell_time,omitempty"`
+	MaxEIRP           int  `json:"max_eirp,omitempty"` // Index of the MaxEIRP
+}
+
+// MACCommand is a downlink MAC command that is queued for a device
+type MACCommand struct {
+	CID      uint8  `json:"cid"`
+	Payload  []byte `json:"payload,omitempty"`
+	Sticky   bool   `json:"sticky,omitempty"`   // Sticky commands are re-sent until the device answers them
+	Sent     uint32 `json:"sent,omitempty"`     // Number of times the command was sent
+	Priority int    `json:"priority,omitempty"` // Commands with a higher priority are sent first
+}
+
+// UplinkChannel is the channel that a device used for an uplink
+type UplinkChannel struct {
+	Index     int    `json:"index"`               // Index in the channel plan of the device, -1 if the frequency is not in it
+	Frequency uint32 `json:"frequency,omitempty"` // Frequency in Hz, 0 if it is not known
+}
+
+// Channel in the channel plan of a device, as configured with the NewChannelReq MAC command
+type Channel struct {
+	Index     uint8  `json:"index"`
+	Frequency uint32 `json:"frequency"` // A frequency of 0 disables the channel
+	MinDR     uint8  `json:"min_dr,omitempty"`
+	MaxDR     uint8  `json:"max_dr,omitempty"`
+}
+
 // ADRSettings contains the (desired) settings for a device that uses ADR
 type ADRSettings struct {
 	Band   string `redis:"band"`
@@ -47,7 +225,8 @@ type ADRSettings struct {
 
 	// Indicates whether the NetworkServer should send a LinkADRReq when possible
 	SendReq bool `redis:"send_req,omitempty"`
-	Failed  int  `redis:"failed,omitempty"` // number of failed ADR attempts
+	Failed  int  `redis:"failed,omitempty"`  // number of failed ADR attempts
+	AckCnt  int  `redis:"ack_cnt,omitempty"` // number of uplinks since the last downlink
 
 	// Desired Settings:
 	DataRate string `redis:"data_rate,omitempty"`
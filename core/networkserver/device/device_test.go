@@ -29,3 +29,23 @@ func TestDeviceChangedFields(t *testing.T) {
 	a.So(device.ChangedFields(), ShouldHaveLength, 1)
 	a.So(device.ChangedFields(), ShouldContain, "DevID")
 }
+
+func TestOptionsValidate(t *testing.T) {
+	a := New(t)
+	a.So(Options{}.Validate(), ShouldBeNil)
+	a.So(Options{ADRAckLimit: 64, ADRAckDelay: 32}.Validate(), ShouldBeNil)
+	a.So(Options{ADRAckLimit: 1, ADRAckDelay: 32768}.Validate(), ShouldBeNil)
+	a.So(Options{ADRAckLimit: 63}.Validate(), ShouldNotBeNil)
+	a.So(Options{ADRAckDelay: 65536}.Validate(), ShouldNotBeNil)
+}
+
+func TestParseMinorVersion(t *testing.T) {
+	a := New(t)
+	for version, expected := range map[string]MinorVersion{"": LoRaWAN1_0, "1.0": LoRaWAN1_0, "1.1": LoRaWAN1_1} {
+		v, err := ParseMinorVersion(version)
+		a.So(err, ShouldBeNil)
+		a.So(v, ShouldEqual, expected)
+	}
+	_, err := ParseMinorVersion("1.2")
+	a.So(err, ShouldNotBeNil)
+}
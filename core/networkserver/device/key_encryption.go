@@ -0,0 +1,99 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package device
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// encryptedFields are the fields of the Redis hash that contain session keys. When a Codec is used, the
+// marshaled Device contains the keys, so the whole data field is encrypted.
+var encryptedFields = []string{"nwk_s_key", "app_s_key", codecDataField}
+
+// encryptedPrefix marks encrypted values, so that records that were written before encryption was enabled
+// can still be read
+const encryptedPrefix = "enc:"
+
+// NewKeyEncryption returns the AEAD for encrypting session keys with the given master key, which must be
+// 16, 24 or 32 bytes long
+func NewKeyEncryption(masterKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, errors.NewErrInvalidArgument("Master key", err.Error())
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptKeys makes the store encrypt the session keys of Devices with the master key before writing them,
+// and decrypt them when reading. Other fields and the DevAddr index are not encrypted, so that they can
+// still be used for lookups.
+func (s *RedisDeviceStore) EncryptKeys(masterKey []byte) error {
+	keys, err := NewKeyEncryption(masterKey)
+	if err != nil {
+		return err
+	}
+	setDeviceEncoding(s.store, s.codec, keys)
+	if s.replicaStore != nil {
+		setDeviceEncoding(s.replicaStore, s.codec, keys)
+	}
+	return nil
+}
+
+func encryptingEncoder(encoder func(input interface{}, properties ...string) (map[string]string, error), keys cipher.AEAD) func(input interface{}, properties ...string) (map[string]string, error) {
+	return func(input interface{}, properties ...string) (map[string]string, error) {
+		vmap, err := encoder(input, properties...)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range encryptedFields {
+			value, ok := vmap[field]
+			if !ok || value == "" {
+				continue
+			}
+			nonce := make([]byte, keys.NonceSize())
+			if _, err := rand.Read(nonce); err != nil {
+				return nil, err
+			}
+			// The field name is authenticated, so that encrypted values can not be moved to other fields
+			sealed := keys.Seal(nonce, nonce, []byte(value), []byte(field))
+			vmap[field] = encryptedPrefix + base64.StdEncoding.EncodeToString(sealed)
+		}
+		return vmap, nil
+	}
+}
+
+func decryptingDecoder(decoder func(input map[string]string) (interface{}, error), keys cipher.AEAD) func(input map[string]string) (interface{}, error) {
+	return func(input map[string]string) (interface{}, error) {
+		decrypted := make(map[string]string, len(input))
+		for field, value := range input {
+			decrypted[field] = value
+		}
+		for _, field := range encryptedFields {
+			value, ok := input[field]
+			if !ok || !strings.HasPrefix(value, encryptedPrefix) {
+				continue
+			}
+			sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+			if err != nil {
+				return nil, err
+			}
+			if len(sealed) < keys.NonceSize() {
+				return nil, errors.NewErrInvalidArgument(field, "encrypted value too short")
+			}
+			nonce, ciphertext := sealed[:keys.NonceSize()], sealed[keys.NonceSize():]
+			plaintext, err := keys.Open(nil, nonce, ciphertext, []byte(field))
+			if err != nil {
+				return nil, errors.NewErrPermissionDenied("could not decrypt " + field)
+			}
+			decrypted[field] = string(plaintext)
+		}
+		return decoder(decrypted)
+	}
+}
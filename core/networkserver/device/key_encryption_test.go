@@ -0,0 +1,81 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package device
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestDeviceStoreKeyEncryption(t *testing.T) {
+	masterKey := []byte{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+
+	for name, codec := range map[string]Codec{"hash": nil, "json": JSONCodec} {
+		a := New(t)
+
+		prefix := "networkserver-test-key-encryption-" + name
+		s := NewRedisDeviceStoreWithCodec(GetRedisClient(), prefix, codec).(*RedisDeviceStore)
+		a.So(s.EncryptKeys([]byte{1, 2, 3}), ShouldNotBeNil)
+		a.So(s.EncryptKeys(masterKey), ShouldBeNil)
+
+		dev := &Device{
+			DevEUI:  types.DevEUI{0, 0, 0, 0, 0, 0, 0, 1},
+			AppEUI:  types.AppEUI{0, 0, 0, 0, 0, 0, 0, 1},
+			DevAddr: types.DevAddr{0, 0, 0, 1},
+			NwkSKey: types.NwkSKey{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 5, 1},
+			FCntUp:  42,
+		}
+		a.So(s.Set(dev), ShouldBeNil)
+		defer s.Delete(dev.AppEUI, dev.DevEUI)
+
+		// The backing map contains ciphertext
+		raw, err := GetRedisClient().HGetAll(prefix + ":device:" + "0000000000000001:0000000000000001").Result()
+		a.So(err, ShouldBeNil)
+		for field, value := range raw {
+			a.So(value, ShouldNotContainSubstring, dev.NwkSKey.String())
+			if field == "nwk_s_key" || field == codecDataField {
+				a.So(strings.HasPrefix(value, encryptedPrefix), ShouldBeTrue)
+			}
+		}
+
+		// The DevAddr is not encrypted
+		a.So(raw["dev_addr"], ShouldEqual, dev.DevAddr.String())
+		if codec == nil {
+			a.So(raw["f_cnt_up"], ShouldEqual, "42")
+		}
+		found, err := s.ListForAddress(dev.DevAddr)
+		a.So(err, ShouldBeNil)
+		a.So(found, ShouldHaveLength, 1)
+		a.So(found[0].NwkSKey, ShouldEqual, dev.NwkSKey)
+
+		// Round-trip
+		res, err := s.Get(dev.AppEUI, dev.DevEUI)
+		a.So(err, ShouldBeNil)
+		a.So(res.NwkSKey, ShouldEqual, dev.NwkSKey)
+
+		// Without the master key, the keys can not be read
+		plain := NewRedisDeviceStoreWithCodec(GetRedisClient(), prefix, codec)
+		res, err = plain.Get(dev.AppEUI, dev.DevEUI)
+		if err == nil {
+			a.So(res.NwkSKey, ShouldNotEqual, dev.NwkSKey)
+		}
+
+		// With the wrong master key, decryption fails
+		wrong := NewRedisDeviceStoreWithCodec(GetRedisClient(), prefix, codec).(*RedisDeviceStore)
+		wrong.EncryptKeys([]byte{8, 7, 6, 5, 4, 3, 2, 1, 8, 7, 6, 5, 4, 3, 2, 1})
+		_, err = wrong.Get(dev.AppEUI, dev.DevEUI)
+		a.So(err, ShouldNotBeNil)
+
+		// Records that were written before encryption was enabled can still be read
+		a.So(plain.Delete(dev.AppEUI, dev.DevEUI), ShouldBeNil)
+		a.So(plain.Set(&Device{AppEUI: dev.AppEUI, DevEUI: dev.DevEUI, DevAddr: dev.DevAddr, NwkSKey: dev.NwkSKey}), ShouldBeNil)
+		res, err = s.Get(dev.AppEUI, dev.DevEUI)
+		a.So(err, ShouldBeNil)
+		a.So(res.NwkSKey, ShouldEqual, dev.NwkSKey)
+	}
+}
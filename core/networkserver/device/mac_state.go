@@ -0,0 +1,42 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package device
+
+// MACCommandStatus is the status of a downlink MAC command
+type MACCommandStatus string
+
+// MAC command statuses
+const (
+	// MACCommandQueued commands are not sent yet
+	MACCommandQueued MACCommandStatus = "queued"
+	// MACCommandPending commands are sent, but not answered by the device
+	MACCommandPending MACCommandStatus = "pending"
+	// MACCommandConfirmed commands are accepted by the device
+	MACCommandConfirmed MACCommandStatus = "confirmed"
+)
+
+// MACCommandState is the state of a downlink MAC command of a device
+type MACCommandState struct {
+	CID     uint8            `json:"cid"`
+	Payload []byte           `json:"payload,omitempty"`
+	Status  MACCommandStatus `json:"status"`
+	Sent    uint32           `json:"sent,omitempty"`
+}
+
+// GetMACState returns the state of the downlink MAC commands of the device: the queued commands, followed by
+// the last confirmed command of each CID
+func (d *Device) GetMACState() []MACCommandState {
+	state := make([]MACCommandState, 0, len(d.MACCommands)+len(d.ConfirmedMACCommands))
+	for _, cmd := range d.MACCommands {
+		status := MACCommandQueued
+		if cmd.Sent > 0 {
+			status = MACCommandPending
+		}
+		state = append(state, MACCommandState{CID: cmd.CID, Payload: cmd.Payload, Status: status, Sent: cmd.Sent})
+	}
+	for _, cmd := range d.ConfirmedMACCommands {
+		state = append(state, MACCommandState{CID: cmd.CID, Payload: cmd.Payload, Status: MACCommandConfirmed, Sent: cmd.Sent})
+	}
+	return state
+}
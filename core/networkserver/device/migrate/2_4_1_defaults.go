@@ -0,0 +1,45 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package migrate
+
+import (
+	"github.com/TheThingsNetwork/ttn/core/band"
+	"github.com/TheThingsNetwork/ttn/core/storage"
+	redis "gopkg.in/redis.v5"
+)
+
+// Defaults migration from 2.4.1 to 2.5.0 sets the defaults for fields that
+// did not exist in older device records, and of which the zero value is not
+// the default:
+// - The RX2 data rate is the one of the band, which the Router sent in the JoinAccept
+func Defaults(prefix string) storage.MigrateFunction {
+	return func(client *redis.Client, key string, obj map[string]string) (string, map[string]string, error) {
+		if marshaled(obj) {
+			return "2.5.0", obj, nil
+		}
+		if _, ok := obj["rx2_data_rate"]; !ok {
+			if dataRate := rx2DataRate(obj["adr_band"]); dataRate != "" {
+				obj["rx2_data_rate"] = dataRate
+			}
+		}
+		return "2.5.0", obj, nil
+	}
+}
+
+// rx2DataRate returns the RX2 data rate of the band, or an empty string if the band is not known
+func rx2DataRate(region string) string {
+	fp, err := band.Get(region)
+	if err != nil {
+		return ""
+	}
+	dataRate, err := fp.GetDataRateStringForIndex(fp.RX2DataRate)
+	if err != nil {
+		return ""
+	}
+	return dataRate
+}
+
+func init() {
+	deviceMigrations["2.4.1"] = Defaults
+}
@@ -0,0 +1,30 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package migrate
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/storage"
+	redis "gopkg.in/redis.v5"
+)
+
+// SessionStartedAt migration from 2.5.0 to 2.6.0 starts the session of devices
+// that were activated before the start of sessions was stored. Without it, the
+// session of these devices would never expire.
+func SessionStartedAt(prefix string) storage.MigrateFunction {
+	return func(client *redis.Client, key string, obj map[string]string) (string, map[string]string, error) {
+		if marshaled(obj) {
+			return "2.6.0", obj, nil
+		}
+		if obj["nwk_s_key"] != "" && obj["session_started_at"] == "" {
+			obj["session_started_at"] = time.Now().UTC().Format(time.RFC3339Nano)
+		}
+		return "2.6.0", obj, nil
+	}
+}
+
+func init() {
+	deviceMigrations["2.5.0"] = SessionStartedAt
+}
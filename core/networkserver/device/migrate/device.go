@@ -17,3 +17,10 @@ func DeviceMigrations(prefix string) map[string]storage.MigrateFunction {
 	}
 	return funcs
 }
+
+// marshaled returns whether the device record is stored by a codec, in which case the fields of the device are not
+// fields of the record
+func marshaled(obj map[string]string) bool {
+	_, ok := obj["data"]
+	return ok
+}
@@ -4,7 +4,10 @@
 package device
 
 import (
+	"crypto/cipher"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/TheThingsNetwork/ttn/core/networkserver/device/migrate"
@@ -18,25 +21,40 @@ import (
 type Store interface {
 	List(opts *storage.ListOptions) ([]*Device, error)
 	ListForAddress(devAddr types.DevAddr) ([]*Device, error)
+	ListForDevEUI(devEUI types.DevEUI) ([]*Device, error)
+	ListForAppEUI(appEUI types.AppEUI) ([]*Device, error)
+	ListDevAddrs() ([]types.DevAddr, error)
+	ListByLastSeen(before, after time.Time) ([]*Device, error)
+	ListRecentlySeen(count int) ([]*Device, error)
 	Get(appEUI types.AppEUI, devEUI types.DevEUI) (*Device, error)
 	Set(new *Device, properties ...string) (err error)
 	Delete(appEUI types.AppEUI, devEUI types.DevEUI) error
 	Frames(appEUI types.AppEUI, devEUI types.DevEUI) (FrameHistory, error)
+	ScanAndRepairIndex() (*IndexRepair, error)
+	WithTransaction(fn func(tx Store) error) error
+	Ping() error
 }
 
 const defaultRedisPrefix = "ns"
 
 const redisDevicePrefix = "device"
 const redisDevAddrPrefix = "dev_addr"
+const redisDevEUIPrefix = "dev_eui"
 const redisFramesPrefix = "frames"
+const redisLastSeenPrefix = "last_seen"
 
 // NewRedisDeviceStore creates a new Redis-based status store
 func NewRedisDeviceStore(client *redis.Client, prefix string) Store {
+	return NewRedisDeviceStoreWithCodec(client, prefix, nil)
+}
+
+// NewRedisDeviceStoreWithCodec creates a new Redis-based status store that marshals Devices with the given Codec.
+// If the codec is nil, the fields of Devices are stored separately.
+func NewRedisDeviceStoreWithCodec(client *redis.Client, prefix string, codec Codec) Store {
 	if prefix == "" {
 		prefix = defaultRedisPrefix
 	}
-	store := storage.NewRedisMapStore(client, prefix+":"+redisDevicePrefix)
-	store.SetBase(Device{}, "")
+	store := newDeviceMapStore(client, prefix, codec)
 	for v, f := range migrate.DeviceMigrations(prefix) {
 		store.AddMigration(v, f)
 	}
@@ -44,21 +62,64 @@ func NewRedisDeviceStore(client *redis.Client, prefix string) Store {
 	return &RedisDeviceStore{
 		client:       client,
 		prefix:       prefix,
+		codec:        codec,
 		store:        store,
 		frameStore:   frameStore,
 		devAddrIndex: storage.NewRedisSetStore(client, prefix+":"+redisDevAddrPrefix),
+		devEUIIndex:  storage.NewRedisSetStore(client, prefix+":"+redisDevEUIPrefix),
+	}
+}
+
+// NewRedisDeviceStoreWithReplica creates a new Redis-based status store that serves ListForAddress from a
+// read-only replica, while all other reads and all writes go to the primary. As the replica may be slightly stale,
+// the FCntUp of the devices that are read from the replica is read from the primary, so that a stale FCntUp does not
+// let replayed uplinks through. Devices that still need a migration are read from the replica as they are.
+func NewRedisDeviceStoreWithReplica(primary, replica *redis.Client, prefix string, codec Codec) Store {
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+	s := NewRedisDeviceStoreWithCodec(primary, prefix, codec).(*RedisDeviceStore)
+	if replica != nil {
+		s.replicaStore = newDeviceMapStore(replica, prefix, codec)
+		s.replicaDevAddrIndex = storage.NewRedisSetStore(replica, prefix+":"+redisDevAddrPrefix)
+	}
+	return s
+}
+
+func newDeviceMapStore(client *redis.Client, prefix string, codec Codec) *storage.RedisMapStore {
+	store := storage.NewRedisMapStore(client, prefix+":"+redisDevicePrefix)
+	setDeviceEncoding(store, codec, nil)
+	return store
+}
+
+func setDeviceEncoding(store *storage.RedisMapStore, codec Codec, keys cipher.AEAD) {
+	encoder, decoder := hashEncoder, hashDecoder
+	if codec != nil {
+		encoder, decoder = codecEncoder(codec), codecDecoder(codec)
+	}
+	if keys != nil {
+		encoder, decoder = encryptingEncoder(encoder, keys), decryptingDecoder(decoder, keys)
 	}
+	store.SetEncoder(encoder)
+	store.SetDecoder(decoder)
 }
 
 // RedisDeviceStore stores Devices in Redis.
 // - Devices are stored as a Hash
 // - DevAddr mappings are indexed in a Set
+// - DevEUI mappings are indexed in a Set
+// - LastSeen times are indexed in a Sorted Set
 type RedisDeviceStore struct {
 	client       *redis.Client
 	prefix       string
+	codec        Codec
 	store        *storage.RedisMapStore
 	frameStore   *storage.RedisQueueStore
 	devAddrIndex *storage.RedisSetStore
+	devEUIIndex  *storage.RedisSetStore
+
+	replicaStore        *storage.RedisMapStore
+	replicaDevAddrIndex *storage.RedisSetStore
 }
 
 // List all Devices
@@ -76,16 +137,21 @@ func (s *RedisDeviceStore) List(opts *storage.ListOptions) ([]*Device, error) {
 	return devices, nil
 }
 
-// ListForAddress lists all devices for a specific DevAddr
+// ListForAddress lists all devices for a specific DevAddr. Each device is read with a single command, so that its
+// keys and frame counters are always from the same write.
 func (s *RedisDeviceStore) ListForAddress(devAddr types.DevAddr) ([]*Device, error) {
-	deviceKeys, err := s.devAddrIndex.Get(devAddr.String())
+	store, devAddrIndex := s.store, s.devAddrIndex
+	if s.replicaStore != nil {
+		store, devAddrIndex = s.replicaStore, s.replicaDevAddrIndex
+	}
+	deviceKeys, err := devAddrIndex.Get(devAddr.String())
 	if errors.GetErrType(err) == errors.NotFound {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	devicesI, err := s.store.GetAll(deviceKeys, nil)
+	devicesI, err := store.GetAll(deviceKeys, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -95,9 +161,231 @@ func (s *RedisDeviceStore) ListForAddress(devAddr types.DevAddr) ([]*Device, err
 			devices[i] = &device
 		}
 	}
+	if s.replicaStore != nil {
+		if err := s.readFCntUp(devices); err != nil {
+			return nil, err
+		}
+	}
+	return devices, nil
+}
+
+// readFCntUp sets the FCntUp of the devices to the one on the primary. Devices that are no longer on the primary
+// are removed from the list.
+func (s *RedisDeviceStore) readFCntUp(devices []*Device) error {
+	pipe := s.client.Pipeline()
+	defer pipe.Close()
+	exists := make([]*redis.BoolCmd, len(devices))
+	fCntUp := make([]*redis.StringCmd, len(devices))
+	var queued bool
+	for i, dev := range devices {
+		if dev == nil {
+			continue
+		}
+		key := fmt.Sprintf("%s:%s:%s:%s", s.prefix, redisDevicePrefix, dev.AppEUI, dev.DevEUI)
+		exists[i] = pipe.Exists(key)
+		fCntUp[i] = pipe.HGet(key, fCntUpField)
+		queued = true
+	}
+	if !queued {
+		return nil
+	}
+	if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+		return err
+	}
+	for i := range devices {
+		if exists[i] == nil {
+			continue
+		}
+		if !exists[i].Val() {
+			devices[i] = nil
+			continue
+		}
+		fCnt, err := fCntUp[i].Uint64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		devices[i].FCntUp = uint32(fCnt)
+	}
+	return nil
+}
+
+// ListForDevEUI lists the devices with a specific DevEUI, under any AppEUI, according to the DevEUI index. Devices
+// that were stored before the DevEUI index existed are not in it, so if the index has no devices for the DevEUI,
+// the devices are scanned for it, and the devices that are found are added to the index.
+func (s *RedisDeviceStore) ListForDevEUI(devEUI types.DevEUI) ([]*Device, error) {
+	deviceKeys, err := s.devEUIIndex.Get(devEUI.String())
+	if errors.GetErrType(err) == errors.NotFound {
+		return s.scanForDevEUI(devEUI)
+	}
+	if err != nil {
+		return nil, err
+	}
+	devicesI, err := s.store.GetAll(deviceKeys, nil)
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]*Device, 0, len(devicesI))
+	for _, deviceI := range devicesI {
+		if device, ok := deviceI.(Device); ok {
+			devices = append(devices, &device)
+		}
+	}
+	return devices, nil
+}
+
+// scanForDevEUI lists the devices with a specific DevEUI by scanning the device keys, and adds them to the DevEUI
+// index
+func (s *RedisDeviceStore) scanForDevEUI(devEUI types.DevEUI) ([]*Device, error) {
+	devicesI, err := s.store.List(fmt.Sprintf("*:%s", devEUI), nil)
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]*Device, 0, len(devicesI))
+	for _, deviceI := range devicesI {
+		device, ok := deviceI.(Device)
+		if !ok || device.DevEUI != devEUI {
+			continue
+		}
+		if err := s.devEUIIndex.Add(devEUI.String(), fmt.Sprintf("%s:%s", device.AppEUI, device.DevEUI)); err != nil {
+			return nil, err
+		}
+		devices = append(devices, &device)
+	}
+	return devices, nil
+}
+
+// ListForAppEUI lists the devices with a specific AppEUI
+func (s *RedisDeviceStore) ListForAppEUI(appEUI types.AppEUI) ([]*Device, error) {
+	devicesI, err := s.store.List(fmt.Sprintf("%s:*", appEUI), nil)
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]*Device, 0, len(devicesI))
+	for _, deviceI := range devicesI {
+		if device, ok := deviceI.(Device); ok {
+			devices = append(devices, &device)
+		}
+	}
+	return devices, nil
+}
+
+// ListDevAddrs lists the DevAddrs that are used by at least one device, according to the DevAddr index
+func (s *RedisDeviceStore) ListDevAddrs() ([]types.DevAddr, error) {
+	keys, err := s.devAddrIndex.Keys("")
+	if err != nil {
+		return nil, err
+	}
+	prefix := s.devAddrIndex.Key("")
+	devAddrs := make([]types.DevAddr, 0, len(keys))
+	for _, key := range keys {
+		devAddr, err := types.ParseDevAddr(strings.TrimPrefix(key, prefix))
+		if err != nil {
+			continue
+		}
+		devAddrs = append(devAddrs, devAddr)
+	}
+	return devAddrs, nil
+}
+
+func (s *RedisDeviceStore) lastSeenKey() string {
+	return s.prefix + ":" + redisLastSeenPrefix
+}
+
+// lastSeenScore is the score of a LastSeen time in the index, in milliseconds, as scores are float64
+func lastSeenScore(t time.Time) float64 {
+	return float64(t.UnixNano() / int64(time.Millisecond))
+}
+
+// lastSeenChanged returns true if the LastSeen time in the index has to be updated when setting the device
+func lastSeenChanged(new *Device, properties []string) bool {
+	if new.LastSeen.IsZero() {
+		return false
+	}
+	if len(properties) > 0 {
+		var set bool
+		for _, property := range properties {
+			if property == "last_seen" {
+				set = true
+			}
+		}
+		if !set {
+			return false
+		}
+	}
+	return new.old == nil || !new.LastSeen.Equal(new.old.LastSeen)
+}
+
+// ListByLastSeen lists the devices that were last seen before the given time and at or after the given time,
+// according to the LastSeen index. A zero time leaves that side of the range open. Devices are only in the index
+// once they are seen after the index was introduced.
+func (s *RedisDeviceStore) ListByLastSeen(before, after time.Time) ([]*Device, error) {
+	opt := redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if !after.IsZero() {
+		opt.Min = fmt.Sprintf("%.0f", lastSeenScore(after))
+	}
+	if !before.IsZero() {
+		opt.Max = fmt.Sprintf("(%.0f", lastSeenScore(before))
+	}
+	keys, err := s.client.ZRangeByScore(s.lastSeenKey(), opt).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	devicesI, err := s.store.GetAll(keys, nil)
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]*Device, 0, len(devicesI))
+	for _, deviceI := range devicesI {
+		device, ok := deviceI.(Device)
+		if !ok || device.LastSeen.IsZero() {
+			continue
+		}
+		// The index could be behind if the device was set without its LastSeen time
+		if (!before.IsZero() && !device.LastSeen.Before(before)) || device.LastSeen.Before(after) {
+			continue
+		}
+		devices = append(devices, &device)
+	}
 	return devices, nil
 }
 
+// ListRecentlySeen lists the count most recently seen devices according to the LastSeen index, the most recently
+// seen first
+func (s *RedisDeviceStore) ListRecentlySeen(count int) ([]*Device, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+	keys, err := s.client.ZRevRange(s.lastSeenKey(), 0, int64(count-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	devicesI, err := s.store.GetAll(keys, nil)
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]*Device, 0, len(devicesI))
+	for _, deviceI := range devicesI {
+		device, ok := deviceI.(Device)
+		if !ok || device.LastSeen.IsZero() {
+			continue
+		}
+		devices = append(devices, &device)
+	}
+	sort.Sort(ByLastSeen(devices))
+	return devices, nil
+}
+
+// Ping checks that the database can be reached
+func (s *RedisDeviceStore) Ping() error {
+	return s.client.Ping().Err()
+}
+
 // Get a specific Device
 func (s *RedisDeviceStore) Get(appEUI types.AppEUI, devEUI types.DevEUI) (*Device, error) {
 	deviceI, err := s.store.Get(fmt.Sprintf("%s:%s", appEUI, devEUI))
@@ -112,16 +400,26 @@ func (s *RedisDeviceStore) Get(appEUI types.AppEUI, devEUI types.DevEUI) (*Devic
 
 // Set a new Device or update an existing one
 func (s *RedisDeviceStore) Set(new *Device, properties ...string) (err error) {
+	if err := new.Options.Validate(); err != nil {
+		return err
+	}
+
 	// If this is an update, check if AppEUI, DevEUI and DevAddr are still the same
 	old := new.old
-	var addrChanged bool
+	var addrChanged, euiChanged bool
 	if old != nil {
-		addrChanged = new.DevAddr != old.DevAddr || new.DevEUI != old.DevEUI || new.AppEUI != old.AppEUI
+		euiChanged = new.DevEUI != old.DevEUI || new.AppEUI != old.AppEUI
+		addrChanged = new.DevAddr != old.DevAddr || euiChanged
 		if addrChanged {
 			if err := s.devAddrIndex.Remove(old.DevAddr.String(), fmt.Sprintf("%s:%s", old.AppEUI, old.DevEUI)); err != nil {
 				return err
 			}
 		}
+		if euiChanged {
+			if err := s.devEUIIndex.Remove(old.DevEUI.String(), fmt.Sprintf("%s:%s", old.AppEUI, old.DevEUI)); err != nil {
+				return err
+			}
+		}
 	}
 
 	now := time.Now()
@@ -141,6 +439,18 @@ func (s *RedisDeviceStore) Set(new *Device, properties ...string) (err error) {
 		}
 	}
 
+	if new.old == nil || euiChanged {
+		if err := s.devEUIIndex.Add(new.DevEUI.String(), key); err != nil {
+			return err
+		}
+	}
+
+	if lastSeenChanged(new, properties) {
+		if err := s.client.ZAdd(s.lastSeenKey(), redis.Z{Score: lastSeenScore(new.LastSeen), Member: key}).Err(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -164,6 +474,14 @@ func (s *RedisDeviceStore) Delete(appEUI types.AppEUI, devEUI types.DevEUI) erro
 		}
 	}
 
+	if err := s.devEUIIndex.Remove(devEUI.String(), key); err != nil {
+		return err
+	}
+
+	if err := s.client.ZRem(s.lastSeenKey(), key).Err(); err != nil {
+		return err
+	}
+
 	return s.store.Delete(key)
 }
 
@@ -175,3 +493,85 @@ func (s *RedisDeviceStore) Frames(appEUI types.AppEUI, devEUI types.DevEUI) (Fra
 		store:  s.frameStore,
 	}, nil
 }
+
+// IndexRepair contains the number of DevAddr and DevEUI index entries that were repaired
+type IndexRepair struct {
+	Removed int // Entries for devices that do not exist or have a different DevAddr or DevEUI
+	Added   int // Entries that were missing for existing devices
+}
+
+// ScanAndRepairIndex walks all devices and the DevAddr and DevEUI indexes, removes index
+// entries that do not point to a device with that DevAddr or DevEUI and adds missing ones
+func (s *RedisDeviceStore) ScanAndRepairIndex() (*IndexRepair, error) {
+	devices, err := s.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	repair := new(IndexRepair)
+	err = s.repairIndex(repair, s.devAddrIndex, "dev_addr", devices, func(device *Device) string {
+		if device.DevAddr.IsEmpty() {
+			return ""
+		}
+		return device.DevAddr.String()
+	})
+	if err != nil {
+		return repair, err
+	}
+	err = s.repairIndex(repair, s.devEUIIndex, "dev_eui", devices, func(device *Device) string {
+		return device.DevEUI.String()
+	})
+	return repair, err
+}
+
+// repairIndex repairs the index of the devices by the value of a field. Devices with an empty value are not indexed.
+func (s *RedisDeviceStore) repairIndex(repair *IndexRepair, index *storage.RedisSetStore, field string, devices []*Device, value func(*Device) string) error {
+	expected := make(map[string]map[string]bool)
+	for _, device := range devices {
+		if device == nil || value(device) == "" {
+			continue
+		}
+		indexed := value(device)
+		if expected[indexed] == nil {
+			expected[indexed] = make(map[string]bool)
+		}
+		expected[indexed][fmt.Sprintf("%s:%s", device.AppEUI, device.DevEUI)] = true
+	}
+
+	entries, err := index.List("", nil)
+	if err != nil {
+		return err
+	}
+
+	for indexed, keys := range entries {
+		for _, key := range keys {
+			if expected[indexed][key] {
+				delete(expected[indexed], key)
+				continue
+			}
+			// Check again, the device could have been set after we listed all devices
+			deviceI, err := s.store.GetFields(key, field)
+			if err == nil {
+				if device, ok := deviceI.(Device); ok && value(&device) == indexed {
+					continue
+				}
+			} else if errors.GetErrType(err) != errors.NotFound {
+				return err
+			}
+			if err := index.Remove(indexed, key); err != nil {
+				return err
+			}
+			repair.Removed++
+		}
+	}
+
+	for indexed, keys := range expected {
+		for key := range keys {
+			if err := index.Add(indexed, key); err != nil {
+				return err
+			}
+			repair.Added++
+		}
+	}
+
+	return nil
+}
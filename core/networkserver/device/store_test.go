@@ -4,19 +4,97 @@
 package device
 
 import (
+	"fmt"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/TheThingsNetwork/ttn/core/types"
 	. "github.com/TheThingsNetwork/ttn/utils/testing"
 	. "github.com/smartystreets/assertions"
+	"gopkg.in/redis.v5"
 )
 
 func TestDeviceStore(t *testing.T) {
+	NewRedisDeviceStore(GetRedisClient(), "")
+
+	testDeviceStore(t, NewRedisDeviceStore(GetRedisClient(), "networkserver-test-device-store"))
+}
+
+func TestDeviceStoreCodecs(t *testing.T) {
+	for name, codec := range map[string]Codec{"json": JSONCodec, "gob": GobCodec, "protobuf": ProtobufCodec} {
+		t.Logf("Testing the %s codec", name)
+		testDeviceStore(t, NewRedisDeviceStoreWithCodec(GetRedisClient(), "networkserver-test-device-store-"+name, codec))
+	}
+}
+
+func TestParseCodec(t *testing.T) {
 	a := New(t)
+	for name, expected := range map[string]Codec{"hash": nil, "json": JSONCodec, "gob": GobCodec, "protobuf": ProtobufCodec} {
+		codec, err := ParseCodec(name)
+		a.So(err, ShouldBeNil)
+		a.So(codec, ShouldEqual, expected)
+	}
+	_, err := ParseCodec("xml")
+	a.So(err, ShouldNotBeNil)
+}
 
-	NewRedisDeviceStore(GetRedisClient(), "")
+func TestDeviceStoreRoundTrip(t *testing.T) {
+	for name, codec := range map[string]Codec{"hash": nil, "json": JSONCodec, "gob": GobCodec, "protobuf": ProtobufCodec} {
+		a := New(t)
+
+		s := NewRedisDeviceStoreWithCodec(GetRedisClient(), "networkserver-test-device-store-round-trip-"+name, codec)
+
+		since := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		dev := &Device{
+			DevEUI:   types.DevEUI{0, 0, 0, 0, 0, 0, 0, 1},
+			AppEUI:   types.AppEUI{0, 0, 0, 0, 0, 0, 0, 1},
+			AppID:    "app",
+			DevID:    "dev",
+			DevAddr:  types.DevAddr{0, 0, 0, 1},
+			NwkSKey:  types.NwkSKey{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 5, 1},
+			FCntUp:   42,
+			FCntDown: 24,
+			LastSeen: since,
+			Options: Options{
+				ActivationConstraints: "local",
+				Uses32BitFCnt:         true,
+				MaxDataRate:           5,
+				FCntCheckMode:         "strict",
+			},
+			Class:    ClassC,
+			RXDelay:  2,
+			ADR:      ADRSettings{Band: "EU_863_870", Margin: 10, SendReq: true, DataRate: "SF7BW125", TxPower: 14, NbTrans: 2},
+			TxParams: TxParams{Set: true, DownlinkDwellTime: true},
+			Blocked:  true,
 
-	s := NewRedisDeviceStore(GetRedisClient(), "networkserver-test-device-store")
+			LastDevNonce:    types.DevNonce{1, 2},
+			SessionDevNonce: types.DevNonce{1, 2},
+			MinorVersion:    LoRaWAN1_1,
+			RJCount0:        3,
+			Usage:           Usage{Since: since, UplinkMessages: 1, UplinkBytes: 20},
+			MACCommands:     []MACCommand{{CID: 3, Payload: []byte{1, 2, 3, 4}, Sticky: true}},
+		}
+		a.So(s.Set(dev), ShouldBeNil)
+
+		stored, err := s.Get(dev.AppEUI, dev.DevEUI)
+		a.So(err, ShouldBeNil)
+		if stored != nil {
+			a.So(stored.CreatedAt.IsZero(), ShouldBeFalse)
+			stored.CreatedAt, stored.UpdatedAt = dev.CreatedAt, dev.UpdatedAt
+			a.So(*stored, ShouldResemble, *dev)
+		}
+
+		a.So(s.Delete(dev.AppEUI, dev.DevEUI), ShouldBeNil)
+
+		if a.Failed() {
+			t.Errorf("Round trip failed for the %s codec", name)
+		}
+	}
+}
+
+func testDeviceStore(t *testing.T, s Store) {
+	a := New(t)
 
 	// Non-existing App
 	err := s.Set(&Device{
@@ -119,3 +197,249 @@ func TestDeviceStore(t *testing.T) {
 	a.So(err, ShouldBeNil)
 	a.So(res, ShouldHaveLength, 1)
 }
+
+// getReplicaClient returns a client for another database on the test Redis, which stands in for a replica
+func getReplicaClient() *redis.Client {
+	host := os.Getenv("REDIS_HOST")
+	if host == "" {
+		host = "localhost"
+	}
+	return redis.NewClient(&redis.Options{
+		Addr: fmt.Sprintf("%s:6379", host),
+		DB:   2,
+	})
+}
+
+func TestDeviceStoreWithReplica(t *testing.T) {
+	for name, codec := range map[string]Codec{"hash": nil, "json": JSONCodec} {
+		a := New(t)
+
+		prefix := "networkserver-test-device-store-replica-" + name
+		s := NewRedisDeviceStoreWithReplica(GetRedisClient(), getReplicaClient(), prefix, codec)
+		replica := NewRedisDeviceStoreWithCodec(getReplicaClient(), prefix, codec)
+
+		devAddr := types.DevAddr{0, 0, 0, 1}
+		appEUI := types.AppEUI{0, 0, 0, 0, 0, 0, 0, 1}
+		devEUI := types.DevEUI{0, 0, 0, 0, 0, 0, 0, 1}
+
+		// Writes go to the primary
+		a.So(s.Set(&Device{DevAddr: devAddr, AppEUI: appEUI, DevEUI: devEUI, FCntUp: 42}), ShouldBeNil)
+
+		dev, err := s.Get(appEUI, devEUI)
+		a.So(err, ShouldBeNil)
+		a.So(dev.DevAddr, ShouldEqual, devAddr)
+
+		_, err = replica.Get(appEUI, devEUI)
+		a.So(err, ShouldNotBeNil)
+
+		// ListForAddress reads from the replica, which has not caught up yet
+		devices, err := s.ListForAddress(devAddr)
+		a.So(err, ShouldBeNil)
+		a.So(devices, ShouldBeEmpty)
+
+		// Once the replica has the device, ListForAddress returns it, with the FCntUp of the primary
+		a.So(replica.Set(&Device{DevAddr: devAddr, AppEUI: appEUI, DevEUI: devEUI, FCntUp: 10}), ShouldBeNil)
+
+		devices, err = s.ListForAddress(devAddr)
+		a.So(err, ShouldBeNil)
+		if a.So(devices, ShouldHaveLength, 1) {
+			a.So(devices[0].FCntUp, ShouldEqual, 42)
+		}
+
+		// A device that is deleted from the primary is not returned
+		a.So(s.Delete(appEUI, devEUI), ShouldBeNil)
+		devices, err = s.ListForAddress(devAddr)
+		a.So(err, ShouldBeNil)
+		a.So(devices, ShouldHaveLength, 1)
+		a.So(devices[0], ShouldBeNil)
+
+		a.So(replica.Delete(appEUI, devEUI), ShouldBeNil)
+	}
+}
+
+func TestDeviceStoreMigrate(t *testing.T) {
+	a := New(t)
+
+	s := NewRedisDeviceStore(GetRedisClient(), "networkserver-test-device-store-migrate")
+
+	appEUI := types.AppEUI{0, 0, 0, 0, 0, 0, 0, 1}
+	devEUI := types.DevEUI{0, 0, 0, 0, 0, 0, 0, 1}
+	key := "networkserver-test-device-store-migrate:device:" + appEUI.String() + ":" + devEUI.String()
+
+	// A record as it was stored by an older version
+	err := GetRedisClient().HMSet(key, map[string]string{
+		"_version":  "2.4.1",
+		"app_eui":   appEUI.String(),
+		"dev_eui":   devEUI.String(),
+		"dev_addr":  types.DevAddr{0, 0, 0, 1}.String(),
+		"nwk_s_key": types.NwkSKey{1}.String(),
+		"adr_band":  "US_902_928",
+	}).Err()
+	a.So(err, ShouldBeNil)
+
+	defer func() {
+		s.Delete(appEUI, devEUI)
+	}()
+
+	dev, err := s.Get(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(dev.DevAddr, ShouldEqual, types.DevAddr{0, 0, 0, 1})
+	a.So(dev.ADR.Band, ShouldEqual, "US_902_928")
+	a.So(dev.RX2DataRate, ShouldEqual, "SF12BW500")
+	a.So(dev.SessionStartedAt.IsZero(), ShouldBeFalse)
+
+	stored, err := GetRedisClient().HGetAll(key).Result()
+	a.So(err, ShouldBeNil)
+	a.So(stored["_version"], ShouldEqual, currentDBVersion)
+	a.So(stored["rx2_data_rate"], ShouldEqual, "SF12BW500")
+}
+
+func TestDeviceStoreScanAndRepairIndex(t *testing.T) {
+	a := New(t)
+
+	prefix := "networkserver-test-device-store-repair-index"
+	s := NewRedisDeviceStore(GetRedisClient(), prefix)
+
+	devAddr := types.DevAddr{0, 0, 0, 1}
+	appEUI := types.AppEUI{0, 0, 0, 0, 0, 0, 0, 1}
+
+	// A consistent device
+	a.So(s.Set(&Device{DevAddr: devAddr, AppEUI: appEUI, DevEUI: types.DevEUI{0, 0, 0, 0, 0, 0, 0, 1}}), ShouldBeNil)
+	defer s.Delete(appEUI, types.DevEUI{0, 0, 0, 0, 0, 0, 0, 1})
+
+	// A device that is missing from the index
+	a.So(s.Set(&Device{DevAddr: devAddr, AppEUI: appEUI, DevEUI: types.DevEUI{0, 0, 0, 0, 0, 0, 0, 2}}), ShouldBeNil)
+	defer s.Delete(appEUI, types.DevEUI{0, 0, 0, 0, 0, 0, 0, 2})
+	GetRedisClient().SRem(prefix+":dev_addr:"+devAddr.String(), appEUI.String()+":"+types.DevEUI{0, 0, 0, 0, 0, 0, 0, 2}.String())
+
+	// A dangling index entry for a device that does not exist
+	GetRedisClient().SAdd(prefix+":dev_addr:"+devAddr.String(), appEUI.String()+":"+types.DevEUI{0, 0, 0, 0, 0, 0, 0, 3}.String())
+
+	repair, err := s.ScanAndRepairIndex()
+	a.So(err, ShouldBeNil)
+	a.So(repair.Removed, ShouldEqual, 1)
+	a.So(repair.Added, ShouldEqual, 1)
+
+	res, err := s.ListForAddress(devAddr)
+	a.So(err, ShouldBeNil)
+	a.So(res, ShouldHaveLength, 2)
+	a.So(res[0].DevEUI, ShouldEqual, types.DevEUI{0, 0, 0, 0, 0, 0, 0, 1})
+	a.So(res[1].DevEUI, ShouldEqual, types.DevEUI{0, 0, 0, 0, 0, 0, 0, 2})
+
+	// Nothing left to repair
+	repair, err = s.ScanAndRepairIndex()
+	a.So(err, ShouldBeNil)
+	a.So(repair.Removed, ShouldEqual, 0)
+	a.So(repair.Added, ShouldEqual, 0)
+}
+
+func TestDeviceStoreListForDevEUI(t *testing.T) {
+	a := New(t)
+
+	prefix := "networkserver-test-device-store-list-for-dev-eui"
+	s := NewRedisDeviceStore(GetRedisClient(), prefix)
+
+	devEUI := types.DevEUI{0, 0, 0, 0, 0, 0, 0, 1}
+	appEUI1 := types.AppEUI{0, 0, 0, 0, 0, 0, 0, 1}
+	appEUI2 := types.AppEUI{0, 0, 0, 0, 0, 0, 0, 2}
+	appEUI3 := types.AppEUI{0, 0, 0, 0, 0, 0, 0, 3}
+	defer func() {
+		s.Delete(appEUI1, devEUI)
+		s.Delete(appEUI2, devEUI)
+		s.Delete(appEUI3, devEUI)
+	}()
+
+	res, err := s.ListForDevEUI(devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(res, ShouldBeEmpty)
+
+	a.So(s.Set(&Device{AppEUI: appEUI1, DevEUI: devEUI}), ShouldBeNil)
+	a.So(s.Set(&Device{AppEUI: appEUI2, DevEUI: devEUI}), ShouldBeNil)
+	res, err = s.ListForDevEUI(devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(res, ShouldHaveLength, 2)
+
+	// A device that moves to another AppEUI is indexed under its new key
+	dev, _ := s.Get(appEUI2, devEUI)
+	dev.StartUpdate()
+	dev.AppEUI = appEUI3
+	a.So(s.Set(dev), ShouldBeNil)
+	s.Delete(appEUI2, devEUI)
+	a.So(s.Delete(appEUI1, devEUI), ShouldBeNil)
+	res, err = s.ListForDevEUI(devEUI)
+	a.So(err, ShouldBeNil)
+	if a.So(res, ShouldHaveLength, 1) {
+		a.So(res[0].AppEUI, ShouldEqual, appEUI3)
+	}
+
+	// A device that was stored before the index is found by a scan, which adds it to the index
+	GetRedisClient().SRem(prefix+":dev_eui:"+devEUI.String(), appEUI3.String()+":"+devEUI.String())
+	res, err = s.ListForDevEUI(devEUI)
+	a.So(err, ShouldBeNil)
+	if a.So(res, ShouldHaveLength, 1) {
+		a.So(res[0].AppEUI, ShouldEqual, appEUI3)
+	}
+	members, _ := GetRedisClient().SMembers(prefix + ":dev_eui:" + devEUI.String()).Result()
+	a.So(members, ShouldContain, appEUI3.String()+":"+devEUI.String())
+	repair, err := s.ScanAndRepairIndex()
+	a.So(err, ShouldBeNil)
+	a.So(repair.Added, ShouldEqual, 0)
+}
+
+func TestDeviceStoreListByLastSeen(t *testing.T) {
+	a := New(t)
+
+	s := NewRedisDeviceStore(GetRedisClient(), "networkserver-test-device-store-last-seen")
+
+	appEUI := types.AppEUI{0, 0, 0, 0, 0, 0, 0, 1}
+	since := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	a.So(s.Set(&Device{AppEUI: appEUI, DevEUI: types.DevEUI{0, 0, 0, 0, 0, 0, 0, 1}, LastSeen: since}), ShouldBeNil)
+	defer s.Delete(appEUI, types.DevEUI{0, 0, 0, 0, 0, 0, 0, 1})
+
+	// Devices that are set in a transaction are indexed when it is committed
+	a.So(s.WithTransaction(func(tx Store) error {
+		return tx.Set(&Device{AppEUI: appEUI, DevEUI: types.DevEUI{0, 0, 0, 0, 0, 0, 0, 2}, LastSeen: since.Add(time.Minute)})
+	}), ShouldBeNil)
+	defer s.Delete(appEUI, types.DevEUI{0, 0, 0, 0, 0, 0, 0, 2})
+
+	// Devices that were never seen are not indexed
+	a.So(s.Set(&Device{AppEUI: appEUI, DevEUI: types.DevEUI{0, 0, 0, 0, 0, 0, 0, 3}}), ShouldBeNil)
+	defer s.Delete(appEUI, types.DevEUI{0, 0, 0, 0, 0, 0, 0, 3})
+
+	res, err := s.ListByLastSeen(time.Time{}, time.Time{})
+	a.So(err, ShouldBeNil)
+	a.So(res, ShouldHaveLength, 2)
+
+	res, err = s.ListByLastSeen(since.Add(time.Minute), time.Time{})
+	a.So(err, ShouldBeNil)
+	a.So(res, ShouldHaveLength, 1)
+	a.So(res[0].DevEUI, ShouldEqual, types.DevEUI{0, 0, 0, 0, 0, 0, 0, 1})
+
+	res, err = s.ListByLastSeen(time.Time{}, since.Add(time.Minute))
+	a.So(err, ShouldBeNil)
+	a.So(res, ShouldHaveLength, 1)
+	a.So(res[0].DevEUI, ShouldEqual, types.DevEUI{0, 0, 0, 0, 0, 0, 0, 2})
+
+	// Updating the LastSeen time moves the device in the index
+	dev, err := s.Get(appEUI, types.DevEUI{0, 0, 0, 0, 0, 0, 0, 1})
+	a.So(err, ShouldBeNil)
+	dev.StartUpdate()
+	dev.LastSeen = since.Add(time.Hour)
+	a.So(s.Set(dev), ShouldBeNil)
+
+	res, err = s.ListByLastSeen(since.Add(time.Minute), time.Time{})
+	a.So(err, ShouldBeNil)
+	a.So(res, ShouldBeEmpty)
+
+	// The most recently seen devices come first
+	res, err = s.ListRecentlySeen(1)
+	a.So(err, ShouldBeNil)
+	a.So(res, ShouldHaveLength, 1)
+	a.So(res[0].DevEUI, ShouldEqual, types.DevEUI{0, 0, 0, 0, 0, 0, 0, 1})
+
+	res, err = s.ListRecentlySeen(5)
+	a.So(err, ShouldBeNil)
+	a.So(res, ShouldHaveLength, 2)
+	a.So(res[1].DevEUI, ShouldEqual, types.DevEUI{0, 0, 0, 0, 0, 0, 0, 2})
+}
@@ -0,0 +1,241 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package device
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/storage"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+	"gopkg.in/redis.v5"
+)
+
+// WithTransaction runs fn with a Store that buffers its writes. When fn returns without error, the writes are
+// committed atomically in a Redis MULTI/EXEC; when fn returns an error, they are discarded. The commit fails if
+// a device that was read or written in fn was changed by someone else in the meantime.
+//
+// Get and ListForAddress in the transaction see the writes that were done in it, List, ListDevAddrs and
+// ListByLastSeen do not.
+// Frames are not part of the transaction.
+func (s *RedisDeviceStore) WithTransaction(fn func(tx Store) error) error {
+	return s.client.Watch(func(tx *redis.Tx) error {
+		t := &redisTransaction{
+			store:   s,
+			tx:      tx,
+			pending: make(map[string]*Device),
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+		return t.commit()
+	})
+}
+
+// transactionOp is a buffered write in a transaction
+type transactionOp struct {
+	key     string
+	set     *Device // nil for a delete
+	props   []string
+	devAddr types.DevAddr // DevAddr of the deleted device
+	devEUI  types.DevEUI  // DevEUI of the deleted device
+}
+
+// redisTransaction is the Store that is passed to the function of WithTransaction
+type redisTransaction struct {
+	store   *RedisDeviceStore
+	tx      *redis.Tx
+	ops     []transactionOp
+	pending map[string]*Device // nil for deleted devices
+}
+
+func deviceKey(appEUI types.AppEUI, devEUI types.DevEUI) string {
+	return fmt.Sprintf("%s:%s", appEUI, devEUI)
+}
+
+// watch makes the commit fail if the device is changed by someone else
+func (t *redisTransaction) watch(key string) error {
+	return t.tx.Watch(t.store.store.Key(key)).Err()
+}
+
+func (t *redisTransaction) List(opts *storage.ListOptions) ([]*Device, error) {
+	return t.store.List(opts)
+}
+
+func (t *redisTransaction) ListForAddress(devAddr types.DevAddr) ([]*Device, error) {
+	devices, err := t.store.ListForAddress(devAddr)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Device, 0, len(devices))
+	for _, dev := range devices {
+		if dev == nil {
+			continue
+		}
+		if _, ok := t.pending[deviceKey(dev.AppEUI, dev.DevEUI)]; !ok {
+			res = append(res, dev)
+		}
+	}
+	for _, dev := range t.pending {
+		if dev != nil && dev.DevAddr == devAddr {
+			res = append(res, cacheCopy(dev))
+		}
+	}
+	return res, nil
+}
+
+func (t *redisTransaction) ListForDevEUI(devEUI types.DevEUI) ([]*Device, error) {
+	devices, err := t.store.ListForDevEUI(devEUI)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Device, 0, len(devices))
+	for _, dev := range devices {
+		if _, ok := t.pending[deviceKey(dev.AppEUI, dev.DevEUI)]; !ok {
+			res = append(res, dev)
+		}
+	}
+	for _, dev := range t.pending {
+		if dev != nil && dev.DevEUI == devEUI {
+			res = append(res, cacheCopy(dev))
+		}
+	}
+	return res, nil
+}
+
+func (t *redisTransaction) ListForAppEUI(appEUI types.AppEUI) ([]*Device, error) {
+	devices, err := t.store.ListForAppEUI(appEUI)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Device, 0, len(devices))
+	for _, dev := range devices {
+		if _, ok := t.pending[deviceKey(dev.AppEUI, dev.DevEUI)]; !ok {
+			res = append(res, dev)
+		}
+	}
+	for _, dev := range t.pending {
+		if dev != nil && dev.AppEUI == appEUI {
+			res = append(res, cacheCopy(dev))
+		}
+	}
+	return res, nil
+}
+
+func (t *redisTransaction) ListDevAddrs() ([]types.DevAddr, error) {
+	return t.store.ListDevAddrs()
+}
+
+func (t *redisTransaction) ListByLastSeen(before, after time.Time) ([]*Device, error) {
+	return t.store.ListByLastSeen(before, after)
+}
+
+func (t *redisTransaction) ListRecentlySeen(count int) ([]*Device, error) {
+	return t.store.ListRecentlySeen(count)
+}
+
+func (t *redisTransaction) Ping() error {
+	return t.store.Ping()
+}
+
+func (t *redisTransaction) Get(appEUI types.AppEUI, devEUI types.DevEUI) (*Device, error) {
+	key := deviceKey(appEUI, devEUI)
+	if dev, ok := t.pending[key]; ok {
+		if dev == nil {
+			return nil, errors.NewErrNotFound(t.store.store.Key(key))
+		}
+		return cacheCopy(dev), nil
+	}
+	if err := t.watch(key); err != nil {
+		return nil, err
+	}
+	return t.store.Get(appEUI, devEUI)
+}
+
+func (t *redisTransaction) Set(new *Device, properties ...string) error {
+	if err := new.Options.Validate(); err != nil {
+		return err
+	}
+	key := deviceKey(new.AppEUI, new.DevEUI)
+	if err := t.watch(key); err != nil {
+		return err
+	}
+	now := time.Now()
+	new.UpdatedAt = now
+	if new.old == nil {
+		new.CreatedAt = now
+	}
+	dev := *new
+	t.ops = append(t.ops, transactionOp{key: key, set: &dev, props: properties})
+	t.pending[key] = cacheCopy(new)
+	return nil
+}
+
+func (t *redisTransaction) Delete(appEUI types.AppEUI, devEUI types.DevEUI) error {
+	dev, err := t.Get(appEUI, devEUI)
+	if err != nil {
+		return err
+	}
+	key := deviceKey(appEUI, devEUI)
+	t.ops = append(t.ops, transactionOp{key: key, devAddr: dev.DevAddr, devEUI: devEUI})
+	t.pending[key] = nil
+	return nil
+}
+
+func (t *redisTransaction) Frames(appEUI types.AppEUI, devEUI types.DevEUI) (FrameHistory, error) {
+	return t.store.Frames(appEUI, devEUI)
+}
+
+func (t *redisTransaction) ScanAndRepairIndex() (*IndexRepair, error) {
+	return nil, errors.NewErrInternal("The device indexes can not be repaired in a transaction")
+}
+
+// WithTransaction runs fn in the same transaction
+func (t *redisTransaction) WithTransaction(fn func(tx Store) error) error {
+	return fn(t)
+}
+
+// commit writes the buffered operations in a MULTI/EXEC, in the same way as Set and Delete of RedisDeviceStore
+func (t *redisTransaction) commit() error {
+	if len(t.ops) == 0 {
+		return nil
+	}
+	_, err := t.tx.Pipelined(func(pipe *redis.Pipeline) error {
+		for _, op := range t.ops {
+			if op.set == nil {
+				if !op.devAddr.IsEmpty() {
+					t.store.devAddrIndex.RemovePipelined(pipe, op.devAddr.String(), op.key)
+				}
+				t.store.devEUIIndex.RemovePipelined(pipe, op.devEUI.String(), op.key)
+				pipe.ZRem(t.store.lastSeenKey(), op.key)
+				t.store.store.DeletePipelined(pipe, op.key)
+				continue
+			}
+			new, old := op.set, op.set.old
+			euiChanged := old != nil && (new.DevEUI != old.DevEUI || new.AppEUI != old.AppEUI)
+			addrChanged := old != nil && (new.DevAddr != old.DevAddr || euiChanged)
+			if addrChanged {
+				t.store.devAddrIndex.RemovePipelined(pipe, old.DevAddr.String(), deviceKey(old.AppEUI, old.DevEUI))
+			}
+			if euiChanged {
+				t.store.devEUIIndex.RemovePipelined(pipe, old.DevEUI.String(), deviceKey(old.AppEUI, old.DevEUI))
+			}
+			if err := t.store.store.SetPipelined(pipe, op.key, *new, op.props...); err != nil {
+				return err
+			}
+			if (old == nil || addrChanged) && !new.DevAddr.IsEmpty() {
+				t.store.devAddrIndex.AddPipelined(pipe, new.DevAddr.String(), op.key)
+			}
+			if old == nil || euiChanged {
+				t.store.devEUIIndex.AddPipelined(pipe, new.DevEUI.String(), op.key)
+			}
+			if lastSeenChanged(new, op.props) {
+				pipe.ZAdd(t.store.lastSeenKey(), redis.Z{Score: lastSeenScore(new.LastSeen), Member: op.key})
+			}
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,86 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package device
+
+import (
+	"testing"
+
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestDeviceStoreTransaction(t *testing.T) {
+	a := New(t)
+
+	s := NewRedisDeviceStore(GetRedisClient(), "networkserver-test-device-store-transaction")
+
+	devAddr := types.DevAddr{0, 0, 0, 1}
+	old := &Device{
+		AppEUI:  types.AppEUI{0, 0, 0, 0, 0, 0, 0, 1},
+		DevEUI:  types.DevEUI{0, 0, 0, 0, 0, 0, 0, 1},
+		DevAddr: devAddr,
+	}
+	new := &Device{
+		AppEUI:  types.AppEUI{0, 0, 0, 0, 0, 0, 0, 1},
+		DevEUI:  types.DevEUI{0, 0, 0, 0, 0, 0, 0, 2},
+		DevAddr: devAddr,
+	}
+	a.So(s.Set(old), ShouldBeNil)
+	defer func() {
+		s.Delete(old.AppEUI, old.DevEUI)
+		s.Delete(new.AppEUI, new.DevEUI)
+	}()
+
+	reprovision := func(tx Store) error {
+		if err := tx.Delete(old.AppEUI, old.DevEUI); err != nil {
+			return err
+		}
+		if err := tx.Set(&Device{AppEUI: new.AppEUI, DevEUI: new.DevEUI, DevAddr: new.DevAddr}); err != nil {
+			return err
+		}
+
+		// The transaction sees its own writes
+		_, err := tx.Get(old.AppEUI, old.DevEUI)
+		a.So(errors.GetErrType(err), ShouldEqual, errors.NotFound)
+		devices, err := tx.ListForAddress(devAddr)
+		a.So(err, ShouldBeNil)
+		a.So(devices, ShouldHaveLength, 1)
+		a.So(devices[0].DevEUI, ShouldEqual, new.DevEUI)
+		return nil
+	}
+
+	// A failure inside the transaction leaves the store unchanged
+	errFailed := errors.New("failed")
+	err := s.WithTransaction(func(tx Store) error {
+		if err := reprovision(tx); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	a.So(err, ShouldEqual, errFailed)
+
+	_, err = s.Get(old.AppEUI, old.DevEUI)
+	a.So(err, ShouldBeNil)
+	_, err = s.Get(new.AppEUI, new.DevEUI)
+	a.So(errors.GetErrType(err), ShouldEqual, errors.NotFound)
+	devices, err := s.ListForAddress(devAddr)
+	a.So(err, ShouldBeNil)
+	a.So(devices, ShouldHaveLength, 1)
+	a.So(devices[0].DevEUI, ShouldEqual, old.DevEUI)
+
+	// A successful transaction commits all writes
+	err = s.WithTransaction(reprovision)
+	a.So(err, ShouldBeNil)
+
+	_, err = s.Get(old.AppEUI, old.DevEUI)
+	a.So(errors.GetErrType(err), ShouldEqual, errors.NotFound)
+	_, err = s.Get(new.AppEUI, new.DevEUI)
+	a.So(err, ShouldBeNil)
+	devices, err = s.ListForAddress(devAddr)
+	a.So(err, ShouldBeNil)
+	a.So(devices, ShouldHaveLength, 1)
+	a.So(devices[0].DevEUI, ShouldEqual, new.DevEUI)
+}
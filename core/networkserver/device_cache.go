@@ -0,0 +1,45 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/go-utils/log"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+)
+
+// DeviceCache enables the in-memory DevAddr cache of the device store. Only enable it if this is the only
+// NetworkServer that writes to the database.
+var DeviceCache bool
+
+// DeviceCacheSize is the maximum number of DevAddrs in the device cache, the least recently used are evicted
+var DeviceCacheSize = device.DefaultCacheSize
+
+// DeviceCacheWarmUp is the number of most recently seen devices whose DevAddr is loaded into the cache on Init
+// (0 means no warm-up)
+var DeviceCacheWarmUp int
+
+func withDeviceCache(store device.Store) device.Store {
+	if DeviceCache {
+		return device.NewCachedStoreWithSize(store, DeviceCacheSize)
+	}
+	return store
+}
+
+func (n *networkServer) warmUpDeviceCache() error {
+	cache, ok := n.devices.(*device.CachedStore)
+	if !ok || DeviceCacheWarmUp <= 0 {
+		return nil
+	}
+	start := time.Now()
+	if err := cache.WarmUp(DeviceCacheWarmUp); err != nil {
+		return err
+	}
+	n.Ctx.WithFields(log.Fields{
+		"Devices":  cache.Len(),
+		"Duration": time.Now().Sub(start),
+	}).Info("Warmed up device cache")
+	return nil
+}
@@ -4,14 +4,97 @@
 package networkserver
 
 import (
+	"fmt"
+
 	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
 	"github.com/TheThingsNetwork/ttn/api/trace"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
 	"github.com/TheThingsNetwork/ttn/utils/errors"
 	"github.com/brocaar/lorawan"
 )
 
-func (n *networkServer) HandleDownlink(message *pb_broker.DownlinkMessage) (*pb_broker.DownlinkMessage, error) {
-	err := message.UnmarshalPayload()
+// maxFPort is the highest FPort that can be used; FPort 224 is the test port and higher ports are RFU
+const maxFPort = 224
+
+// validateDownlinkFPort checks that the FPort of a downlink is consistent with its payload. The Handler
+// encrypts the FRMPayload with the AppSKey, which is only correct for FPort > 0. On FPort 0, the
+// FRMPayload contains MAC commands that must be encrypted with the NwkSKey.
+func validateDownlinkFPort(mac *pb_lorawan.MACPayload) error {
+	switch {
+	case mac.FPort < 0 || mac.FPort > maxFPort:
+		return errors.NewErrInvalidArgument("Downlink", fmt.Sprintf("FPort %d is RFU", mac.FPort))
+	case mac.FPort == 0 && len(mac.FrmPayload) > 0:
+		return errors.NewErrInvalidArgument("Downlink", "FRMPayload on FPort 0 is not encrypted with the NwkSKey")
+	}
+	return nil
+}
+
+// validateDownlinkMType checks that a downlink is a data downlink. Confirmed downlinks are only allowed for
+// devices that can acknowledge them, which excludes multicast groups.
+func validateDownlinkMType(msg *pb_lorawan.Message, dev *device.Device) error {
+	switch msg.MType {
+	case pb_lorawan.MType_UNCONFIRMED_DOWN:
+	case pb_lorawan.MType_CONFIRMED_DOWN:
+		if dev.Options.Multicast {
+			return errors.NewErrInvalidArgument("Downlink", "confirmed downlink can not be sent to a multicast group")
+		}
+	default:
+		return errors.NewErrInvalidArgument("Downlink", fmt.Sprintf("MType %s is not a data downlink", msg.MType))
+	}
+	return nil
+}
+
+// ErrDownlinkAlreadySent is returned when a Class A device already got a downlink after its last uplink. The
+// device only opens its RX windows once per uplink, so only one frame can be sent.
+var ErrDownlinkAlreadySent = errors.NewErrAlreadyExists("Downlink for the last uplink")
+
+// downlinkOpportunity returns whether a downlink can be sent to the device. The opportunity is only tracked for
+// Class A devices that sent an uplink; Class C devices can receive downlink at any time.
+func downlinkOpportunity(dev *device.Device) bool {
+	if downlinkClass(dev) != device.ClassA || dev.LastSeen.IsZero() {
+		return true
+	}
+	return dev.LastDownlink.Before(dev.LastSeen)
+}
+
+// ErrDownlinkFCntReused is returned for a downlink with a frame counter that is lower than the FCntDown of the
+// device, for example a stale downlink that was prepared before the session was reset
+var ErrDownlinkFCntReused = errors.NewErrInvalidArgument("Downlink", "FCnt is lower than the FCntDown of the device")
+
+// validateDownlinkFCnt checks that the frame counter of a downlink does not go back. A frame counter of 0 was not
+// derived from an uplink, the FCntDown of the device is used for it.
+func validateDownlinkFCnt(mac *pb_lorawan.MACPayload, dev *device.Device) error {
+	if mac.FCnt != 0 && mac.FCnt < dev.FCntDown {
+		return ErrDownlinkFCntReused
+	}
+	return nil
+}
+
+func (n *networkServer) HandleDownlink(message *pb_broker.DownlinkMessage) (res *pb_broker.DownlinkMessage, err error) {
+	if err := validateEUIs(message.AppEui, message.DevEui); err != nil {
+		return nil, err
+	}
+	if message.GetMessage() == nil && len(message.Payload) == 0 {
+		return nil, errors.NewErrInvalidArgument("Downlink", "empty payload")
+	}
+	if DownlinkDeduplicationWindow > 0 {
+		key, err := downlinkDedupKey(message)
+		if err != nil {
+			return nil, err
+		}
+		if handled, ok := n.reserveDownlink(key); ok {
+			return handled, nil
+		}
+		defer func() {
+			if err != nil {
+				n.finishDownlink(key, nil)
+				return
+			}
+			n.finishDownlink(key, res)
+		}()
+	}
+	err = message.UnmarshalPayload()
 	if err != nil {
 		return nil, err
 	}
@@ -36,6 +119,10 @@ func (n *networkServer) HandleDownlink(message *pb_broker.DownlinkMessage) (*pb_
 
 	dev.StartUpdate()
 	defer func() {
+		// A downlink that is not sent must not consume the FCntDown or the queued MAC commands of the device
+		if err != nil {
+			return
+		}
 		setErr := n.devices.Set(dev)
 		if setErr != nil {
 			n.Ctx.WithError(setErr).Error("Could not update device state")
@@ -49,13 +136,44 @@ func (n *networkServer) HandleDownlink(message *pb_broker.DownlinkMessage) (*pb_
 		return nil, errors.NewErrInvalidArgument("Downlink", "DevAddr does not match device")
 	}
 
+	if err = validateDownlinkFPort(lorawanDownlinkMac); err != nil {
+		return nil, err
+	}
+
+	if err = validateDownlinkMType(message.Message.GetLorawan(), dev); err != nil {
+		return nil, err
+	}
+
+	if !downlinkOpportunity(dev) {
+		message.Trace = message.Trace.WithEvent(trace.DropEvent, "reason", "downlink already sent")
+		return nil, ErrDownlinkAlreadySent
+	}
+
+	if err = validateDownlinkFCnt(lorawanDownlinkMac, dev); err != nil {
+		message.Trace = message.Trace.WithEvent(trace.DropEvent, "reason", "FCnt reused")
+		return nil, err
+	}
+
 	err = n.handleDownlinkMAC(message, dev)
 	if err != nil {
 		return nil, err
 	}
+	zeroDownlinkRFUBits(lorawanDownlinkMac)
+
+	err = n.padDownlink(message, dev)
+	if err != nil {
+		return nil, err
+	}
 
 	lorawanDownlinkMac.FCnt = dev.FCntDown // Use full 32-bit FCnt for setting MIC
 	dev.FCntDown++                         // TODO: For confirmed downlink, FCntDown should be incremented AFTER ACK
+	if n.checkFCntCeiling(dev, FCntDirectionDown, lorawanDownlinkMac.FCnt, dev.FCntDown) {
+		message.Trace = message.Trace.WithEvent(fCntCeilingEvent, "direction", FCntDirectionDown, "fcnt", dev.FCntDown)
+	}
+
+	if err = setMACOnlyDownlinkFPort(lorawanDownlinkMac, dev); err != nil {
+		return nil, err
+	}
 
 	phyPayload := message.Message.GetLorawan().PHYPayload()
 	phyPayload.SetMIC(lorawan.AES128Key(dev.NwkSKey))
@@ -63,7 +181,13 @@ func (n *networkServer) HandleDownlink(message *pb_broker.DownlinkMessage) (*pb_
 	if err != nil {
 		return nil, err
 	}
+	if err = validateDownlinkPayloadSize(message, dev, len(bytes)); err != nil {
+		return nil, err
+	}
 	message.Payload = bytes
+	n.accountDownlink(dev, len(bytes))
+	dev.LastDownlink = n.now()
+	dev.ADR.AckCnt = 0
 
 	return message, nil
 }
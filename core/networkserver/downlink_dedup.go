@@ -0,0 +1,95 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+)
+
+// DownlinkDeduplicationWindow is how long the NetworkServer remembers downlinks it handled. A downlink that is
+// handled again within this window, for example because the caller retried after a timeout, gets the frame that
+// was built the first time, instead of a new frame with the next FCntDown. Deduplication is disabled if 0.
+var DownlinkDeduplicationWindow time.Duration
+
+// handledDownlink is a downlink that is handled (in flight) until done is closed, and remembered until it expires
+type handledDownlink struct {
+	message *pb_broker.DownlinkMessage
+	expires time.Time
+	done    chan struct{}
+}
+
+type downlinkDedupCache struct {
+	sync.Mutex
+	downlinks map[string]handledDownlink
+}
+
+// downlinkDedupKey derives the idempotency key of a downlink from the device, the downlink option and the payload
+// as it was received, so before it is processed.
+func downlinkDedupKey(message *pb_broker.DownlinkMessage) (string, error) {
+	payload := message.Payload
+	if len(payload) == 0 && message.Message != nil {
+		var err error
+		payload, err = message.Message.Marshal()
+		if err != nil {
+			return "", err
+		}
+	}
+	hash := sha256.New()
+	hash.Write(message.AppEui.Bytes())
+	hash.Write(message.DevEui.Bytes())
+	hash.Write([]byte(message.GetDownlinkOption().GetIdentifier()))
+	hash.Write([]byte{0})
+	hash.Write(payload)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// reserveDownlink returns the downlink that was built for the key within the deduplication window. If there is
+// none, it reserves the key and returns false; the caller must then call finishDownlink. Retries that arrive while
+// the downlink is still handled wait for it, instead of building another frame with the next FCntDown.
+func (n *networkServer) reserveDownlink(key string) (*pb_broker.DownlinkMessage, bool) {
+	for {
+		n.downlinks.Lock()
+		now := n.now()
+		if n.downlinks.downlinks == nil {
+			n.downlinks.downlinks = make(map[string]handledDownlink)
+		}
+		handled, ok := n.downlinks.downlinks[key]
+		if ok && handled.message == nil {
+			n.downlinks.Unlock()
+			<-handled.done
+			continue
+		}
+		if ok && now.Before(handled.expires) {
+			n.downlinks.Unlock()
+			return handled.message, true
+		}
+		for k, handled := range n.downlinks.downlinks {
+			if handled.message != nil && !now.Before(handled.expires) {
+				delete(n.downlinks.downlinks, k)
+			}
+		}
+		n.downlinks.downlinks[key] = handledDownlink{done: make(chan struct{})}
+		n.downlinks.Unlock()
+		return nil, false
+	}
+}
+
+// finishDownlink stores the downlink that was built for the reserved key. If message is nil, the downlink was not
+// built, and the key is released, so that a retry handles the downlink again.
+func (n *networkServer) finishDownlink(key string, message *pb_broker.DownlinkMessage) {
+	n.downlinks.Lock()
+	defer n.downlinks.Unlock()
+	handled := n.downlinks.downlinks[key]
+	if message == nil {
+		delete(n.downlinks.downlinks, key)
+	} else {
+		n.downlinks.downlinks[key] = handledDownlink{message: message, expires: n.now().Add(DownlinkDeduplicationWindow)}
+	}
+	close(handled.done)
+}
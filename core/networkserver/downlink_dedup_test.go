@@ -0,0 +1,114 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestHandleDownlinkDeduplication(t *testing.T) {
+	a := New(t)
+	now := time.Now()
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-downlink-dedup"),
+		clock:   func() time.Time { return now },
+	}
+	ns.InitStatus()
+
+	defer func(window time.Duration) { DownlinkDeduplicationWindow = window }(DownlinkDeduplicationWindow)
+	DownlinkDeduplicationWindow = time.Minute
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+
+	ns.devices.Set(&device.Device{
+		DevAddr: devAddr,
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	downlinkMessage := func(identifier string, payload []byte) *pb_broker.DownlinkMessage {
+		message := &pb_broker.DownlinkMessage{
+			AppEui:         &appEUI,
+			DevEui:         &devEUI,
+			Message:        new(pb_protocol.Message),
+			DownlinkOption: &pb_broker.DownlinkOption{Identifier: identifier},
+		}
+		mac := message.Message.InitLoRaWAN().InitDownlink()
+		mac.DevAddr = devAddr
+		mac.FPort = 1
+		mac.FrmPayload = payload
+		return message
+	}
+
+	downlink := func(identifier string, payload []byte) *pb_broker.DownlinkMessage {
+		res, err := ns.HandleDownlink(downlinkMessage(identifier, payload))
+		a.So(err, ShouldBeNil)
+		return res
+	}
+
+	fCntDown := func() uint32 {
+		dev, err := ns.devices.Get(appEUI, devEUI)
+		a.So(err, ShouldBeNil)
+		return dev.FCntDown
+	}
+
+	// The retry gets the same frame, FCntDown is only incremented once
+	first := downlink("option-1", []byte{1, 2, 3})
+	retry := downlink("option-1", []byte{1, 2, 3})
+	a.So(retry.Payload, ShouldResemble, first.Payload)
+	a.So(fCntDown(), ShouldEqual, 1)
+
+	// Another downlink option is a new downlink
+	downlink("option-2", []byte{1, 2, 3})
+	a.So(fCntDown(), ShouldEqual, 2)
+
+	// Another payload is a new downlink
+	downlink("option-2", []byte{4, 5, 6})
+	a.So(fCntDown(), ShouldEqual, 3)
+
+	// After the window, the same downlink is handled again
+	now = now.Add(2 * time.Minute)
+	downlink("option-1", []byte{1, 2, 3})
+	a.So(fCntDown(), ShouldEqual, 4)
+
+	// Concurrent retries wait for the downlink that is in flight, instead of using another FCntDown
+	var wg sync.WaitGroup
+	results := make(chan []byte, 10)
+	for i := 0; i < 10; i++ {
+		message := downlinkMessage("option-3", []byte{1, 2, 3})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := ns.HandleDownlink(message)
+			if err == nil {
+				results <- res.Payload
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+	var payloads [][]byte
+	for payload := range results {
+		payloads = append(payloads, payload)
+	}
+	a.So(payloads, ShouldHaveLength, 10)
+	for _, payload := range payloads {
+		a.So(payload, ShouldResemble, payloads[0])
+	}
+	a.So(fCntDown(), ShouldEqual, 5)
+}
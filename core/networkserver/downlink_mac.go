@@ -5,12 +5,54 @@ package networkserver
 
 import (
 	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
 	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
 )
 
+// DownlinkPriorityPolicy determines what is sent when the queued MAC commands and the application payload of a
+// downlink do not fit in one frame
+type DownlinkPriorityPolicy string
+
+// Downlink priority policies
+const (
+	// MACFirst rejects the downlink with ErrPayloadDeferred, so that the MAC commands are sent in a frame without
+	// application payload
+	MACFirst DownlinkPriorityPolicy = "mac"
+	// PayloadFirst sends the application payload, the MAC commands that do not fit stay queued for a next frame
+	PayloadFirst DownlinkPriorityPolicy = "payload"
+)
+
+// DownlinkPriority is the policy for downlinks where the MAC commands and the application payload do not fit
+// together. The default is MACFirst, as MAC commands keep the link working.
+var DownlinkPriority = MACFirst
+
+// ErrPayloadDeferred is returned for downlinks of which the application payload does not fit with the queued MAC
+// commands, if the DownlinkPriority is MACFirst. The application payload is not sent, so it should stay queued.
+var ErrPayloadDeferred = errors.NewErrInvalidArgument("Downlink", "application payload does not fit with the queued MAC commands")
+
+// macPayloadSize returns the size of the MACPayload: FHDR (7 + FOpts) | FPort (1) | FRMPayload
+func macPayloadSize(mac *pb_lorawan.MACPayload) int {
+	return 7 + fOptsLength(mac.FOpts) + 1 + len(mac.FrmPayload)
+}
+
 func (n *networkServer) handleDownlinkMAC(message *pb_broker.DownlinkMessage, dev *device.Device) error {
 	if err := n.handleDownlinkADR(message, dev); err != nil {
 		return err
 	}
+	lorawanDownlinkMac := message.GetMessage().GetLorawan().GetMacPayload()
+	maxSize, limited := downlinkPayloadLimit(message, dev)
+	switch {
+	case limited && DownlinkPriority == PayloadFirst:
+		lorawanDownlinkMac.FOpts = drainMACCommandsWithin(dev, lorawanDownlinkMac.FOpts, maxSize-macPayloadSize(lorawanDownlinkMac))
+	default:
+		lorawanDownlinkMac.FOpts = drainMACCommands(dev, lorawanDownlinkMac.FOpts)
+		if limited && len(lorawanDownlinkMac.FrmPayload) > 0 && macPayloadSize(lorawanDownlinkMac) > maxSize {
+			return ErrPayloadDeferred
+		}
+	}
+	if macCommandsDeferred(dev, lorawanDownlinkMac.FOpts) {
+		lorawanDownlinkMac.FPending = true
+	}
 	return nil
 }
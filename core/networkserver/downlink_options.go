@@ -0,0 +1,88 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"sort"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+)
+
+// copyDownlinkOption returns a copy of the option that can be changed without changing the original
+func copyDownlinkOption(template *pb_broker.DownlinkOption) *pb_broker.DownlinkOption {
+	option := *template
+	if template.GatewayConfig != nil {
+		gatewayConfig := *template.GatewayConfig
+		option.GatewayConfig = &gatewayConfig
+	}
+	if lorawan := template.GetProtocolConfig().GetLorawan(); lorawan != nil {
+		lorawanConfig := *lorawan
+		option.ProtocolConfig = &pb_protocol.TxConfiguration{Protocol: &pb_protocol.TxConfiguration_Lorawan{
+			Lorawan: &lorawanConfig,
+		}}
+	}
+	return &option
+}
+
+// gatewayDownlinkOption returns a copy of the template option for the gateway. The Identifier of the template
+// belongs to the schedule of the gateway of the Router that issued it, so the options for other gateways have none.
+func gatewayDownlinkOption(template *pb_broker.DownlinkOption, gateway *pb_gateway.RxMetadata) *pb_broker.DownlinkOption {
+	option := copyDownlinkOption(template)
+	if option.GatewayId != gateway.GatewayId {
+		option.GatewayId = gateway.GatewayId
+		option.Identifier = ""
+	}
+	return option
+}
+
+// rankedDownlinkOptions returns the RX1 and RX2 downlink options of the gateways that received the uplink and have
+// duty-cycle budget, based on the option that the Router issued. The options are ranked by preference: RX1 before
+// RX2, and within a window the gateways with the best signal first. The Score of each option is its rank (lower is
+// better). If the Router issued an RX2 option, or the RX1 frequency is not known, there are only RX2 options.
+func (n *networkServer) rankedDownlinkOptions(template *pb_broker.DownlinkOption, metadata []*pb_gateway.RxMetadata, dev *device.Device) []*pb_broker.DownlinkOption {
+	if template == nil || template.GatewayConfig == nil {
+		return nil
+	}
+	rx1 := !isRX2Option(template, metadata)
+
+	candidates := make([]*pb_gateway.RxMetadata, 0, len(metadata))
+	for _, gateway := range metadata {
+		if gateway == nil || gateway.GatewayId == "" {
+			continue
+		}
+		if n.gatewayUtilization != nil && !n.gatewayUtilization.HasBudget(gateway.GatewayId) {
+			continue
+		}
+		candidates = append(candidates, gateway)
+	}
+	sort.Stable(bySignal(candidates))
+
+	rx1Options := make([]*pb_broker.DownlinkOption, 0, len(candidates))
+	rx2Options := make([]*pb_broker.DownlinkOption, 0, len(candidates))
+	for _, gateway := range candidates {
+		rx1Timestamp, rx2Timestamp := downlinkTimestamps(gateway.Timestamp, dev.RXDelay)
+		if rx1 {
+			option := gatewayDownlinkOption(template, gateway)
+			option.GatewayConfig.Timestamp = rx1Timestamp
+			if setRX1Frequency(option, dev) {
+				setDownlinkPower(option, gateway, dev)
+				rx1Options = append(rx1Options, option)
+			}
+		}
+		option := gatewayDownlinkOption(template, gateway)
+		option.GatewayConfig.Timestamp = rx2Timestamp
+		setRX2Parameters(option, dev)
+		setDownlinkPower(option, gateway, dev)
+		rx2Options = append(rx2Options, option)
+	}
+
+	options := append(rx1Options, rx2Options...)
+	for i, option := range options {
+		option.Score = uint32(i)
+	}
+	return options
+}
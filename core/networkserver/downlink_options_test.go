@@ -0,0 +1,142 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestRankedDownlinkOptions(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{}
+
+	dev := &device.Device{ADR: device.ADRSettings{Band: pb_lorawan.FrequencyPlan_EU_863_870.String()}}
+	template := &pb_broker.DownlinkOption{
+		Identifier:    "router-option",
+		GatewayId:     "weak",
+		GatewayConfig: &pb_gateway.TxConfiguration{Timestamp: 1002000, Frequency: 868100000},
+		ProtocolConfig: &pb_protocol.TxConfiguration{Protocol: &pb_protocol.TxConfiguration_Lorawan{
+			Lorawan: &pb_lorawan.TxConfiguration{DataRate: "SF7BW125"},
+		}},
+	}
+	metadata := []*pb_gateway.RxMetadata{
+		&pb_gateway.RxMetadata{GatewayId: "weak", Timestamp: 2000, Snr: 1},
+		&pb_gateway.RxMetadata{GatewayId: "strong", Timestamp: 1000, Snr: 5},
+	}
+
+	options := ns.rankedDownlinkOptions(template, metadata, dev)
+	a.So(options, ShouldHaveLength, 4)
+
+	// RX1 options come first, the gateway with the best signal first
+	a.So(options[0].GatewayId, ShouldEqual, "strong")
+	a.So(options[0].GatewayConfig.Timestamp, ShouldEqual, 1000+1000000)
+	a.So(options[0].GatewayConfig.Frequency, ShouldEqual, 868100000)
+	a.So(options[0].GetProtocolConfig().GetLorawan().DataRate, ShouldEqual, "SF7BW125")
+	a.So(options[1].GatewayId, ShouldEqual, "weak")
+	a.So(options[1].GatewayConfig.Timestamp, ShouldEqual, 2000+1000000)
+
+	// Then the RX2 options, with the RX2 parameters of the band
+	a.So(options[2].GatewayId, ShouldEqual, "strong")
+	a.So(options[2].GatewayConfig.Timestamp, ShouldEqual, 1000+2000000)
+	a.So(options[2].GatewayConfig.Frequency, ShouldEqual, 869525000)
+	a.So(options[2].GetProtocolConfig().GetLorawan().DataRate, ShouldEqual, "SF9BW125")
+	a.So(options[3].GatewayId, ShouldEqual, "weak")
+	a.So(options[3].GatewayConfig.Timestamp, ShouldEqual, 2000+2000000)
+
+	for i, option := range options {
+		a.So(option.Score, ShouldEqual, uint32(i))
+	}
+
+	// Only the options for the gateway of the Router keep its Identifier
+	a.So(options[0].Identifier, ShouldBeEmpty)
+	a.So(options[1].Identifier, ShouldEqual, "router-option")
+	a.So(options[2].Identifier, ShouldBeEmpty)
+	a.So(options[3].Identifier, ShouldEqual, "router-option")
+
+	// The template is not changed
+	a.So(template.GatewayConfig.Timestamp, ShouldEqual, 1002000)
+	a.So(template.GetProtocolConfig().GetLorawan().DataRate, ShouldEqual, "SF7BW125")
+
+	// An RX2 option of the Router only results in RX2 options
+	rx2Template := copyDownlinkOption(template)
+	rx2Template.GatewayConfig.Timestamp = 2002000
+	options = ns.rankedDownlinkOptions(rx2Template, metadata, dev)
+	a.So(options, ShouldHaveLength, 2)
+	a.So(options[0].GatewayId, ShouldEqual, "strong")
+	a.So(options[0].GatewayConfig.Timestamp, ShouldEqual, 1000+2000000)
+	a.So(options[1].GatewayId, ShouldEqual, "weak")
+	a.So(options[1].GatewayConfig.Timestamp, ShouldEqual, 2000+2000000)
+
+	// Gateways without budget are left out
+	ns.SetGatewayUtilization(testGatewayUtilization{"strong": true})
+	options = ns.rankedDownlinkOptions(template, metadata, dev)
+	a.So(options, ShouldHaveLength, 2)
+	a.So(options[0].GatewayId, ShouldEqual, "weak")
+	a.So(options[1].GatewayId, ShouldEqual, "weak")
+}
+
+func TestHandleUplinkDownlinkOptions(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkDownlinkOptions"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-downlink-options"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		ADR:     device.ADRSettings{Band: pb_lorawan.FrequencyPlan_EU_863_870.String()},
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	message := uplinkMACInitMessage(appEUI, devEUI)
+	message.GatewayMetadata = []*pb_gateway.RxMetadata{
+		&pb_gateway.RxMetadata{GatewayId: "gateway", Timestamp: 1000, Snr: 1},
+		&pb_gateway.RxMetadata{GatewayId: "other", Timestamp: 5000, Snr: 5},
+	}
+	message.ResponseTemplate.DownlinkOption = &pb_broker.DownlinkOption{
+		Identifier:    "router-option",
+		GatewayId:     "gateway",
+		GatewayConfig: &pb_gateway.TxConfiguration{Timestamp: 1001000, Frequency: 868100000},
+	}
+
+	res, err := ns.HandleUplink(message)
+	a.So(err, ShouldBeNil)
+
+	// The Router issued the option for its own gateway, which is selected
+	a.So(res.ResponseTemplate.DownlinkOption.GatewayId, ShouldEqual, "gateway")
+
+	// The RX1 and RX2 options of all gateways are ranked in the response template
+	options := res.ResponseTemplate.DownlinkOptions
+	if a.So(options, ShouldHaveLength, 4) {
+		a.So(options[0].GatewayId, ShouldEqual, "other")
+		a.So(options[0].GatewayConfig.Timestamp, ShouldEqual, 5000+1000000)
+		a.So(options[1].GatewayId, ShouldEqual, "gateway")
+		a.So(options[1].GatewayConfig.Timestamp, ShouldEqual, 1000+1000000)
+		a.So(options[2].GatewayId, ShouldEqual, "other")
+		a.So(options[2].GatewayConfig.Timestamp, ShouldEqual, 5000+2000000)
+		a.So(options[2].GatewayConfig.Frequency, ShouldEqual, 869525000)
+		a.So(options[3].GatewayId, ShouldEqual, "gateway")
+		a.So(options[3].GatewayConfig.Timestamp, ShouldEqual, 1000+2000000)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+)
+
+// DownlinkPadding is the minimum length of the FRMPayload of downlinks with an application payload. Downlinks
+// without FRMPayload, such as downlinks that only carry MAC commands, are not padded. Shorter payloads are padded with zero bytes before encryption; the application on the device is expected to use a
+// payload format that ignores trailing zeros. Padding requires the AppSKey of the device, so it is only applied
+// when the network server is combined with the handler (see ExposeAppSKey). The default of 0 disables padding.
+var DownlinkPadding = 0
+
+// paddedEvent is the trace event for downlinks of which the FRMPayload is padded
+const paddedEvent = "padded"
+
+// padDownlink pads the FRMPayload of the downlink to DownlinkPadding bytes, within the payload size limit of the
+// downlink. The FRMPayload is decrypted, padded and encrypted again with the AppSKey of the device.
+func (n *networkServer) padDownlink(message *pb_broker.DownlinkMessage, dev *device.Device) error {
+	lorawanDownlinkMac := message.GetMessage().GetLorawan().GetMacPayload()
+	if DownlinkPadding <= 0 || lorawanDownlinkMac.FPort == 0 || len(lorawanDownlinkMac.FrmPayload) == 0 {
+		return nil
+	}
+	if len(lorawanDownlinkMac.FrmPayload) >= DownlinkPadding {
+		return nil
+	}
+	if dev.AppSKey.IsEmpty() {
+		return nil
+	}
+	padding := DownlinkPadding - len(lorawanDownlinkMac.FrmPayload)
+	if maxSize, limited := downlinkPayloadLimit(message, dev); limited {
+		if available := maxSize - macPayloadSize(lorawanDownlinkMac); available < padding {
+			padding = available
+		}
+	}
+	if padding <= 0 {
+		return nil
+	}
+
+	// Crypt a copy, as that replaces the MACPayload of the message
+	msg := *message.Message.GetLorawan()
+	if err := msg.DecryptFRMPayload(dev.AppSKey); err != nil {
+		return err
+	}
+	mac := msg.GetMacPayload()
+	mac.FrmPayload = append(mac.FrmPayload, make([]byte, padding)...)
+	if err := msg.EncryptFRMPayload(dev.AppSKey); err != nil {
+		return err
+	}
+	lorawanDownlinkMac.FrmPayload = msg.GetMacPayload().FrmPayload
+	message.Trace = message.Trace.WithEvent(paddedEvent, "padding", padding)
+	return nil
+}
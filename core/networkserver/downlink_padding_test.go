@@ -0,0 +1,118 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestHandleDownlinkPadding(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleDownlinkPadding"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-downlink-padding"),
+	}
+	ns.InitStatus()
+
+	defer func(padding int) {
+		DownlinkPadding = padding
+	}(DownlinkPadding)
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+	nwkSKey := types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+	appSKey := types.AppSKey{8, 7, 6, 5, 4, 3, 2, 1, 8, 7, 6, 5, 4, 3, 2, 1}
+
+	setup := func(appSKey types.AppSKey) {
+		ns.devices.Set(&device.Device{
+			DevAddr: devAddr,
+			AppEUI:  appEUI,
+			DevEUI:  devEUI,
+			NwkSKey: nwkSKey,
+			AppSKey: appSKey,
+		})
+	}
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// downlink sends the payload, encrypted like the handler does, and returns the decrypted FRMPayload
+	// of the resulting frame after checking its MIC
+	downlink := func(payload []byte) []byte {
+		message := &pb_broker.DownlinkMessage{
+			AppEui:  &appEUI,
+			DevEui:  &devEUI,
+			Message: new(pb_protocol.Message),
+		}
+		msg := message.Message.InitLoRaWAN()
+		mac := msg.InitDownlink()
+		mac.DevAddr = devAddr
+		mac.FPort = 1
+		mac.FrmPayload = payload
+		a.So(msg.EncryptFRMPayload(appSKey), ShouldBeNil)
+
+		res, err := ns.HandleDownlink(message)
+		a.So(err, ShouldBeNil)
+		if res == nil {
+			return nil
+		}
+
+		var phy lorawan.PHYPayload
+		a.So(phy.UnmarshalBinary(res.Payload), ShouldBeNil)
+		ok, err := phy.ValidateMIC(lorawan.AES128Key(nwkSKey))
+		a.So(err, ShouldBeNil)
+		a.So(ok, ShouldBeTrue)
+
+		sent := pb_lorawan.MessageFromPHYPayload(phy)
+		a.So(sent.DecryptFRMPayload(appSKey), ShouldBeNil)
+		return sent.GetMacPayload().FrmPayload
+	}
+
+	// Padding is disabled by default
+	setup(appSKey)
+	a.So(downlink([]byte{1, 2, 3}), ShouldResemble, []byte{1, 2, 3})
+
+	// Short payloads are padded with zeros
+	DownlinkPadding = 8
+	setup(appSKey)
+	a.So(downlink([]byte{1, 2, 3}), ShouldResemble, []byte{1, 2, 3, 0, 0, 0, 0, 0})
+
+	// Longer payloads are not changed
+	setup(appSKey)
+	a.So(downlink([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9}), ShouldResemble, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9})
+
+	// Without the AppSKey, the payload can not be padded
+	setup(types.AppSKey{})
+	a.So(downlink([]byte{1, 2, 3}), ShouldResemble, []byte{1, 2, 3})
+
+	// The response to an uplink that only carries MAC commands is not padded, so it is still sent without FPort
+	setup(appSKey)
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	dev.StartUpdate()
+	queueMACCommand(dev, lorawan.DevStatusReq, nil, false)
+	a.So(ns.devices.Set(dev), ShouldBeNil)
+	uplink, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldBeNil)
+	res, err := ns.HandleDownlink(uplink.ResponseTemplate)
+	a.So(err, ShouldBeNil)
+	var phy lorawan.PHYPayload
+	a.So(phy.UnmarshalBinary(res.Payload), ShouldBeNil)
+	sent := phy.MACPayload.(*lorawan.MACPayload)
+	a.So(sent.FPort, ShouldBeNil)
+	a.So(sent.FRMPayload, ShouldBeEmpty)
+	a.So(sent.FHDR.FOpts, ShouldHaveLength, 1)
+}
@@ -0,0 +1,90 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"math"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+	"github.com/TheThingsNetwork/ttn/core/band"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+)
+
+// DownlinkPowerPolicy determines the transmit power of the gateway for downlinks
+type DownlinkPowerPolicy string
+
+// Downlink power policies
+const (
+	// MaxDownlinkPower keeps the power of the downlink option, which is the maximum of the frequency plan
+	MaxDownlinkPower DownlinkPowerPolicy = "max"
+	// PathLossDownlinkPower uses the power that makes the downlink arrive at the device with the
+	// DownlinkTargetRSSI, based on the path loss of the uplink
+	PathLossDownlinkPower DownlinkPowerPolicy = "path-loss"
+)
+
+// DownlinkPower is the policy for the transmit power of downlinks
+var DownlinkPower = MaxDownlinkPower
+
+// DownlinkTargetRSSI is the RSSI (in dBm) at the device that the PathLossDownlinkPower policy aims for
+var DownlinkTargetRSSI = -100
+
+// MinDownlinkPower is the lowest transmit power (in dBm) that the PathLossDownlinkPower policy uses
+var MinDownlinkPower = 2
+
+// downlinkPowerEvent is the trace event for downlinks of which the power was set by the PathLossDownlinkPower policy
+const downlinkPowerEvent = "set downlink power"
+
+// uplinkTXPower returns the transmit power (in dBm) of the uplinks of the device, which is set by ADR
+func uplinkTXPower(dev *device.Device, frequency uint64) (int, bool) {
+	if dev.ADR.TxPower != 0 {
+		return dev.ADR.TxPower, true
+	}
+	fp, err := band.Get(deviceBand(dev, frequency))
+	if err != nil {
+		return 0, false
+	}
+	return fp.DefaultTXPower, true
+}
+
+// pathLossPower returns the transmit power (in dBm) for a downlink to a device that transmitted with txPower and
+// was received with rssi, clamped to the range of MinDownlinkPower and maxPower
+func pathLossPower(txPower int, rssi float32, maxPower int32) int32 {
+	pathLoss := float64(txPower) - float64(rssi)
+	power := int32(math.Ceil(pathLoss + float64(DownlinkTargetRSSI)))
+	if power < int32(MinDownlinkPower) {
+		power = int32(MinDownlinkPower)
+	}
+	if power > maxPower {
+		power = maxPower
+	}
+	return power
+}
+
+// setDownlinkPower sets the transmit power of the downlink option for the gateway according to the DownlinkPower
+// policy. The power of the option is the maximum of the frequency plan for the window, so it is never raised. It
+// returns whether the power was changed.
+func setDownlinkPower(option *pb_broker.DownlinkOption, gateway *pb_gateway.RxMetadata, dev *device.Device) bool {
+	if DownlinkPower != PathLossDownlinkPower || option.GatewayConfig == nil || gateway.Rssi == 0 {
+		return false
+	}
+	maxPower := option.GatewayConfig.Power
+	if maxPower == 0 {
+		fp, err := band.Get(deviceBand(dev, gateway.Frequency))
+		if err != nil {
+			return false
+		}
+		maxPower = int32(fp.DefaultTXPower)
+	}
+	txPower, ok := uplinkTXPower(dev, gateway.Frequency)
+	if !ok {
+		return false
+	}
+	power := pathLossPower(txPower, gateway.Rssi, maxPower)
+	if power == option.GatewayConfig.Power {
+		return false
+	}
+	option.GatewayConfig.Power = power
+	return true
+}
@@ -0,0 +1,53 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestSetDownlinkPower(t *testing.T) {
+	a := New(t)
+
+	defer func(policy DownlinkPowerPolicy) { DownlinkPower = policy }(DownlinkPower)
+
+	dev := &device.Device{ADR: device.ADRSettings{Band: "EU_863_870"}}
+	power := func(rssi float32, maxPower int32) (int32, bool) {
+		option := &pb_broker.DownlinkOption{GatewayConfig: &pb_gateway.TxConfiguration{Power: maxPower}}
+		changed := setDownlinkPower(option, &pb_gateway.RxMetadata{GatewayId: "gateway", Rssi: rssi, Frequency: 868100000}, dev)
+		return option.GatewayConfig.Power, changed
+	}
+
+	// The power of the option is kept by default
+	DownlinkPower = MaxDownlinkPower
+	p, changed := power(-40, 14)
+	a.So(changed, ShouldBeFalse)
+	a.So(p, ShouldEqual, 14)
+
+	DownlinkPower = PathLossDownlinkPower
+
+	// A strong signal gets a lower power than a weak signal
+	strong, changed := power(-60, 27)
+	a.So(changed, ShouldBeTrue)
+	weak, _ := power(-105, 27)
+	a.So(strong, ShouldBeLessThan, weak)
+	a.So(weak, ShouldEqual, 14-(-105)+DownlinkTargetRSSI)
+
+	// The power is clamped to the minimum and the power of the option
+	p, _ = power(-20, 27)
+	a.So(p, ShouldEqual, MinDownlinkPower)
+	p, changed = power(-130, 14)
+	a.So(changed, ShouldBeFalse)
+	a.So(p, ShouldEqual, 14)
+
+	// The known uplink power of the device is used
+	dev.ADR.TxPower = 8
+	p, _ = power(-105, 27)
+	a.So(p, ShouldEqual, 8-(-105)+DownlinkTargetRSSI)
+}
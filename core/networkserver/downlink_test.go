@@ -9,8 +9,10 @@ import (
 	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
 	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
 	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
 	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
 	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
 	. "github.com/TheThingsNetwork/ttn/utils/testing"
 	"github.com/brocaar/lorawan"
 	. "github.com/smartystreets/assertions"
@@ -101,3 +103,362 @@ func TestHandleDownlink(t *testing.T) {
 	a.So(dev.FCntDown, ShouldEqual, 1)
 
 }
+
+func TestValidateDownlinkFPort(t *testing.T) {
+	a := New(t)
+	a.So(validateDownlinkFPort(&pb_lorawan.MACPayload{FPort: 1, FrmPayload: []byte{1, 2, 3}}), ShouldBeNil)
+	a.So(validateDownlinkFPort(&pb_lorawan.MACPayload{FPort: 224, FrmPayload: []byte{1, 2, 3}}), ShouldBeNil)
+	a.So(validateDownlinkFPort(&pb_lorawan.MACPayload{FPort: 0}), ShouldBeNil) // Only FOpts
+	a.So(validateDownlinkFPort(&pb_lorawan.MACPayload{FPort: 0, FrmPayload: []byte{1, 2, 3}}), ShouldNotBeNil)
+	a.So(validateDownlinkFPort(&pb_lorawan.MACPayload{FPort: 225, FrmPayload: []byte{1, 2, 3}}), ShouldNotBeNil)
+}
+
+func TestHandleDownlinkFPort(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-downlink-fport"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+
+	ns.devices.Set(&device.Device{
+		DevAddr: devAddr,
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	downlink := func(fPort uint8) error {
+		phy := lorawan.PHYPayload{
+			MHDR: lorawan.MHDR{MType: lorawan.UnconfirmedDataDown, Major: lorawan.LoRaWANR1},
+			MACPayload: &lorawan.MACPayload{
+				FPort:      &fPort,
+				FHDR:       lorawan.FHDR{DevAddr: lorawan.DevAddr(devAddr)},
+				FRMPayload: []lorawan.Payload{&lorawan.DataPayload{Bytes: []byte{1, 2, 3, 4}}},
+			},
+		}
+		bytes, _ := phy.MarshalBinary()
+		_, err := ns.HandleDownlink(&pb_broker.DownlinkMessage{
+			AppEui:  &appEUI,
+			DevEui:  &devEUI,
+			Payload: bytes,
+			DownlinkOption: &pb_broker.DownlinkOption{
+				ProtocolConfig: &pb_protocol.TxConfiguration{Protocol: &pb_protocol.TxConfiguration_Lorawan{
+					Lorawan: &pb_lorawan.TxConfiguration{},
+				}},
+			},
+		})
+		return err
+	}
+
+	// Application payload encrypted with the AppSKey
+	a.So(downlink(1), ShouldBeNil)
+
+	// Application payload on the port for MAC commands
+	a.So(downlink(0), ShouldNotBeNil)
+
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	a.So(dev.FCntDown, ShouldEqual, 1)
+}
+
+func TestHandleDownlinkEmptyPayload(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-downlink-empty-payload"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	for _, payload := range [][]byte{nil, []byte{}} {
+		_, err := ns.HandleDownlink(&pb_broker.DownlinkMessage{
+			AppEui:  &appEUI,
+			DevEui:  &devEUI,
+			Payload: payload,
+			DownlinkOption: &pb_broker.DownlinkOption{
+				ProtocolConfig: &pb_protocol.TxConfiguration{Protocol: &pb_protocol.TxConfiguration_Lorawan{
+					Lorawan: &pb_lorawan.TxConfiguration{},
+				}},
+			},
+		})
+		a.So(err, ShouldNotBeNil)
+		a.So(errors.GetErrType(err), ShouldEqual, errors.InvalidArgument)
+	}
+}
+
+func TestHandleDownlinkConfirmed(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-downlink-confirmed"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+
+	dev := &device.Device{
+		DevAddr: devAddr,
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	}
+	ns.devices.Set(dev)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	downlink := func(mType lorawan.MType) (*pb_broker.DownlinkMessage, error) {
+		fPort := uint8(1)
+		phy := lorawan.PHYPayload{
+			MHDR: lorawan.MHDR{MType: mType, Major: lorawan.LoRaWANR1},
+			MACPayload: &lorawan.MACPayload{
+				FPort:      &fPort,
+				FHDR:       lorawan.FHDR{DevAddr: lorawan.DevAddr(devAddr)},
+				FRMPayload: []lorawan.Payload{&lorawan.DataPayload{Bytes: []byte{1, 2, 3, 4}}},
+			},
+		}
+		bytes, _ := phy.MarshalBinary()
+		return ns.HandleDownlink(&pb_broker.DownlinkMessage{
+			AppEui:  &appEUI,
+			DevEui:  &devEUI,
+			Payload: bytes,
+			DownlinkOption: &pb_broker.DownlinkOption{
+				ProtocolConfig: &pb_protocol.TxConfiguration{Protocol: &pb_protocol.TxConfiguration_Lorawan{
+					Lorawan: &pb_lorawan.TxConfiguration{},
+				}},
+			},
+		})
+	}
+
+	res, err := downlink(lorawan.ConfirmedDataDown)
+	a.So(err, ShouldBeNil)
+	var phyPayload lorawan.PHYPayload
+	phyPayload.UnmarshalBinary(res.Payload)
+	a.So(phyPayload.MHDR.MType, ShouldEqual, lorawan.ConfirmedDataDown)
+	a.So(res.Message.GetLorawan().IsConfirmed(), ShouldBeTrue)
+
+	// Only data downlinks
+	_, err = downlink(lorawan.UnconfirmedDataUp)
+	a.So(err, ShouldNotBeNil)
+
+	// Multicast groups can not acknowledge
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	dev.StartUpdate()
+	dev.Options.Multicast = true
+	ns.devices.Set(dev)
+
+	_, err = downlink(lorawan.ConfirmedDataDown)
+	a.So(err, ShouldNotBeNil)
+	a.So(errors.GetErrType(err), ShouldEqual, errors.InvalidArgument)
+
+	_, err = downlink(lorawan.UnconfirmedDataDown)
+	a.So(err, ShouldBeNil)
+}
+
+func TestHandleDownlinkOnePerUplink(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleDownlinkOnePerUplink"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-downlink-one-per-uplink"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	dev := &device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	}
+	// 6 + 5 + 2 bytes; with the LinkCheckAns, the RXTimingSetupReq does not fit in the FOpts
+	queueMACCommand(dev, lorawan.NewChannelReq, []byte{3, 1, 2, 3, 0x50}, false)
+	queueMACCommand(dev, lorawan.RXParamSetupReq, []byte{1, 2, 3, 4}, false)
+	queueMACCommand(dev, lorawan.RXTimingSetupReq, []byte{1}, false)
+	ns.devices.Set(dev)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	uplink := func() *pb_broker.DownlinkMessage {
+		res, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, pb_lorawan.MACCommand{Cid: uint32(lorawan.LinkCheckReq)}))
+		a.So(err, ShouldBeNil)
+		template := res.ResponseTemplate
+		template.AppEui, template.DevEui = &appEUI, &devEUI
+		template.Message.GetLorawan().GetMacPayload().FrmPayload = []byte{1, 2, 3, 4}
+		return template
+	}
+
+	// The MAC answer and the application payload are sent in one frame
+	template := uplink()
+	res, err := ns.HandleDownlink(template)
+	a.So(err, ShouldBeNil)
+	mac := res.Message.GetLorawan().GetMacPayload()
+	a.So(mac.FOpts, ShouldHaveLength, 3)
+	a.So(mac.FOpts[0].Cid, ShouldEqual, uint32(lorawan.LinkCheckAns))
+	a.So(mac.FrmPayload, ShouldNotBeEmpty)
+	a.So(mac.FPending, ShouldBeTrue)
+
+	// A second frame for the same uplink is not sent
+	_, err = ns.HandleDownlink(template)
+	a.So(err, ShouldEqual, ErrDownlinkAlreadySent)
+
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.FCntDown, ShouldEqual, 1)
+	a.So(dev.MACCommands, ShouldHaveLength, 1)
+
+	// The next uplink opens a new opportunity, where the deferred command is sent
+	res, err = ns.HandleDownlink(uplink())
+	a.So(err, ShouldBeNil)
+	mac = res.Message.GetLorawan().GetMacPayload()
+	a.So(mac.FOpts, ShouldHaveLength, 2)
+	a.So(mac.FOpts[1].Cid, ShouldEqual, uint32(lorawan.RXTimingSetupReq))
+	a.So(mac.FPending, ShouldBeFalse)
+}
+
+func TestHandleDownlinkFCntMonotonic(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-downlink-fcnt-monotonic"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+
+	ns.devices.Set(&device.Device{
+		DevAddr:  devAddr,
+		AppEUI:   appEUI,
+		DevEUI:   devEUI,
+		FCntDown: 5,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	downlink := func(fCnt uint32) (*pb_broker.DownlinkMessage, error) {
+		fPort := uint8(1)
+		phy := lorawan.PHYPayload{
+			MHDR: lorawan.MHDR{MType: lorawan.UnconfirmedDataDown, Major: lorawan.LoRaWANR1},
+			MACPayload: &lorawan.MACPayload{
+				FPort: &fPort,
+				FHDR:  lorawan.FHDR{DevAddr: lorawan.DevAddr(devAddr), FCnt: fCnt},
+			},
+		}
+		bytes, _ := phy.MarshalBinary()
+		return ns.HandleDownlink(&pb_broker.DownlinkMessage{
+			AppEui:  &appEUI,
+			DevEui:  &devEUI,
+			Payload: bytes,
+			DownlinkOption: &pb_broker.DownlinkOption{
+				ProtocolConfig: &pb_protocol.TxConfiguration{Protocol: &pb_protocol.TxConfiguration_Lorawan{
+					Lorawan: &pb_lorawan.TxConfiguration{},
+				}},
+			},
+		})
+	}
+
+	// A downlink that would decrease the FCntDown is rejected
+	_, err := downlink(3)
+	a.So(err, ShouldEqual, ErrDownlinkFCntReused)
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	a.So(dev.FCntDown, ShouldEqual, 5)
+
+	res, err := downlink(5)
+	a.So(err, ShouldBeNil)
+	a.So(res.Message.GetLorawan().GetMacPayload().FCnt, ShouldEqual, 5)
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.FCntDown, ShouldEqual, 6)
+}
+
+func TestHandleDownlinkPriority(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-downlink-priority"),
+	}
+	ns.InitStatus()
+
+	defer func(priority DownlinkPriorityPolicy) {
+		DownlinkPriority = priority
+	}(DownlinkPriority)
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+
+	// 6 + 5 bytes of MAC commands and 50 bytes of payload do not fit in the 59 bytes at SF12
+	setup := func() {
+		dev := &device.Device{
+			DevAddr: devAddr,
+			AppEUI:  appEUI,
+			DevEUI:  devEUI,
+			ADR:     device.ADRSettings{Band: "EU_863_870"},
+		}
+		queueMACCommand(dev, lorawan.NewChannelReq, []byte{3, 1, 2, 3, 0x50}, false)
+		queueMACCommand(dev, lorawan.RXParamSetupReq, []byte{1, 2, 3, 4}, false)
+		ns.devices.Set(dev)
+	}
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	downlink := func(payload []byte) (*pb_lorawan.MACPayload, error) {
+		message := &pb_broker.DownlinkMessage{
+			AppEui:  &appEUI,
+			DevEui:  &devEUI,
+			Message: new(pb_protocol.Message),
+			DownlinkOption: &pb_broker.DownlinkOption{
+				ProtocolConfig: &pb_protocol.TxConfiguration{Protocol: &pb_protocol.TxConfiguration_Lorawan{
+					Lorawan: &pb_lorawan.TxConfiguration{DataRate: "SF12BW125"},
+				}},
+			},
+		}
+		mac := message.Message.InitLoRaWAN().InitDownlink()
+		mac.DevAddr = devAddr
+		mac.FPort = 1
+		mac.FrmPayload = payload
+		res, err := ns.HandleDownlink(message)
+		if err != nil {
+			return nil, err
+		}
+		return res.Message.GetLorawan().GetMacPayload(), nil
+	}
+
+	// MAC first: the payload is rejected, so that it stays queued, and the MAC commands are sent without payload
+	DownlinkPriority = MACFirst
+	setup()
+	_, err := downlink(make([]byte, 50))
+	a.So(err, ShouldEqual, ErrPayloadDeferred)
+
+	mac, err := downlink(nil)
+	a.So(err, ShouldBeNil)
+	a.So(mac.FOpts, ShouldHaveLength, 2)
+
+	mac, err = downlink(make([]byte, 50))
+	a.So(err, ShouldBeNil)
+	a.So(mac.FOpts, ShouldBeEmpty)
+	a.So(mac.FrmPayload, ShouldHaveLength, 50)
+
+	// Payload first: the payload is sent, the MAC commands stay queued
+	DownlinkPriority = PayloadFirst
+	setup()
+	mac, err = downlink(make([]byte, 50))
+	a.So(err, ShouldBeNil)
+	a.So(mac.FOpts, ShouldBeEmpty)
+	a.So(mac.FrmPayload, ShouldHaveLength, 50)
+	a.So(mac.FPending, ShouldBeTrue)
+
+	mac, err = downlink(nil)
+	a.So(err, ShouldBeNil)
+	a.So(mac.FOpts, ShouldHaveLength, 2)
+	a.So(mac.FPending, ShouldBeFalse)
+}
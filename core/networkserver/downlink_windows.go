@@ -0,0 +1,40 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import "github.com/rcrowley/go-metrics"
+
+// downlinkWindows are the receive windows that are counted
+var downlinkWindows = []int{1, 2}
+
+func newDownlinkWindowCounters() map[int]metrics.Counter {
+	counters := make(map[int]metrics.Counter, len(downlinkWindows))
+	for _, window := range downlinkWindows {
+		counters[window] = metrics.NewCounter()
+	}
+	return counters
+}
+
+// countDownlinkWindow counts a downlink that is scheduled in the receive window (1 or 2)
+func (n *networkServer) countDownlinkWindow(window int) {
+	if n.status == nil {
+		return
+	}
+	if counter, ok := n.status.downlinkWindows[window]; ok {
+		counter.Inc(1)
+	}
+}
+
+// GetDownlinkWindows returns the number of downlinks that were scheduled in RX1 and RX2, by window. Downlinks of
+// uplinks without server time are not counted, as their window is not checked.
+func (n *networkServer) GetDownlinkWindows() map[int]int64 {
+	windows := make(map[int]int64, len(downlinkWindows))
+	if n.status == nil {
+		return windows
+	}
+	for window, counter := range n.status.downlinkWindows {
+		windows[window] = counter.Count()
+	}
+	return windows
+}
@@ -0,0 +1,89 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestHandleUplinkDownlinkWindows(t *testing.T) {
+	a := New(t)
+
+	uplinkTime := time.Unix(1500000000, 0)
+	now := uplinkTime
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkDownlinkWindows"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-downlink-windows"),
+		clock:   func() time.Time { return now },
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	uplink := func() *pb_broker.DeduplicatedUplinkMessage {
+		message := uplinkMACInitMessage(appEUI, devEUI)
+		message.ServerTime = uplinkTime.UnixNano()
+		message.GatewayMetadata = []*pb_gateway.RxMetadata{
+			&pb_gateway.RxMetadata{GatewayId: "gateway", Timestamp: 1000},
+		}
+		message.ResponseTemplate.DownlinkOption = &pb_broker.DownlinkOption{
+			GatewayId:     "gateway",
+			GatewayConfig: &pb_gateway.TxConfiguration{Timestamp: 1001000},
+		}
+		return message
+	}
+
+	a.So(ns.GetDownlinkWindows(), ShouldResemble, map[int]int64{1: 0, 2: 0})
+
+	// RX1 is feasible
+	now = uplinkTime.Add(500 * time.Millisecond)
+	_, err := ns.HandleUplink(uplink())
+	a.So(err, ShouldBeNil)
+	a.So(ns.GetDownlinkWindows(), ShouldResemble, map[int]int64{1: 1, 2: 0})
+
+	// RX1 has passed, so RX2 is used
+	now = uplinkTime.Add(1500 * time.Millisecond)
+	_, err = ns.HandleUplink(uplink())
+	a.So(err, ShouldBeNil)
+	a.So(ns.GetDownlinkWindows(), ShouldResemble, map[int]int64{1: 1, 2: 1})
+
+	// Both windows have passed, the dropped downlink is not counted and its MAC commands stay queued
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	dev.StartUpdate()
+	queueMACCommand(dev, lorawan.DevStatusReq, nil, false)
+	ns.devices.Set(dev)
+
+	now = uplinkTime.Add(3 * time.Second)
+	res, err := ns.HandleUplink(uplink())
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate, ShouldBeNil)
+	a.So(ns.GetDownlinkWindows(), ShouldResemble, map[int]int64{1: 1, 2: 1})
+
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	if a.So(dev.MACCommands, ShouldHaveLength, 1) {
+		a.So(dev.MACCommands[0].Sent, ShouldEqual, 0)
+	}
+}
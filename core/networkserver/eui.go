@@ -0,0 +1,32 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// Errors for requests without a valid AppEUI or DevEUI
+var (
+	ErrMissingAppEUI = errors.NewErrInvalidArgument("AppEUI", "missing")
+	ErrMissingDevEUI = errors.NewErrInvalidArgument("DevEUI", "missing")
+	ErrZeroAppEUI    = errors.NewErrInvalidArgument("AppEUI", "can not be zero")
+	ErrZeroDevEUI    = errors.NewErrInvalidArgument("DevEUI", "can not be zero")
+)
+
+// validateEUIs checks that the AppEUI and DevEUI of a request are set and not zero
+func validateEUIs(appEUI *types.AppEUI, devEUI *types.DevEUI) error {
+	switch {
+	case appEUI == nil:
+		return ErrMissingAppEUI
+	case devEUI == nil:
+		return ErrMissingDevEUI
+	case appEUI.IsEmpty():
+		return ErrZeroAppEUI
+	case devEUI.IsEmpty():
+		return ErrZeroDevEUI
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_handler "github.com/TheThingsNetwork/ttn/api/handler"
+	pb "github.com/TheThingsNetwork/ttn/api/networkserver"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestValidateEUIs(t *testing.T) {
+	a := New(t)
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	var zeroAppEUI types.AppEUI
+	var zeroDevEUI types.DevEUI
+
+	a.So(validateEUIs(&appEUI, &devEUI), ShouldBeNil)
+	a.So(validateEUIs(nil, &devEUI), ShouldEqual, ErrMissingAppEUI)
+	a.So(validateEUIs(&appEUI, nil), ShouldEqual, ErrMissingDevEUI)
+	a.So(validateEUIs(&zeroAppEUI, &devEUI), ShouldEqual, ErrZeroAppEUI)
+	a.So(validateEUIs(&appEUI, &zeroDevEUI), ShouldEqual, ErrZeroDevEUI)
+}
+
+func TestHandlersRejectInvalidEUIs(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandlersRejectInvalidEUIs"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-invalid-euis"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	var zeroAppEUI types.AppEUI
+	var zeroDevEUI types.DevEUI
+
+	cases := []struct {
+		appEUI *types.AppEUI
+		devEUI *types.DevEUI
+	}{
+		{nil, &devEUI},
+		{&appEUI, nil},
+		{&zeroAppEUI, &devEUI},
+		{&appEUI, &zeroDevEUI},
+	}
+
+	for _, c := range cases {
+		shouldBeInvalid := func(err error) {
+			a.So(err, ShouldNotBeNil)
+			a.So(errors.GetErrType(err), ShouldEqual, errors.InvalidArgument)
+		}
+
+		_, err := ns.HandleUplink(&pb_broker.DeduplicatedUplinkMessage{AppEui: c.appEUI, DevEui: c.devEUI})
+		shouldBeInvalid(err)
+
+		_, err = ns.InjectUplink(&pb_broker.DeduplicatedUplinkMessage{AppEui: c.appEUI, DevEui: c.devEUI})
+		shouldBeInvalid(err)
+
+		_, err = ns.HandleDownlink(&pb_broker.DownlinkMessage{AppEui: c.appEUI, DevEui: c.devEUI, Payload: []byte{1}})
+		shouldBeInvalid(err)
+
+		// Activations without EUIs keep failing with missing metadata
+		if c.appEUI == nil || c.devEUI == nil {
+			continue
+		}
+
+		_, err = ns.HandlePrepareActivation(&pb_broker.DeduplicatedDeviceActivationRequest{
+			AppEui: c.appEUI,
+			DevEui: c.devEUI,
+		})
+		shouldBeInvalid(err)
+		a.So(JoinFailureCause(err), ShouldEqual, "zero EUI")
+
+		devAddr := getDevAddr(1, 2, 3, 4)
+		var nwkSKey types.NwkSKey
+		_, err = ns.HandleActivate(&pb_handler.DeviceActivationResponse{
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: &pb_lorawan.ActivationMetadata{
+					AppEui:  c.appEUI,
+					DevEui:  c.devEUI,
+					DevAddr: &devAddr,
+					NwkSKey: &nwkSKey,
+				},
+			}},
+		})
+		shouldBeInvalid(err)
+
+		_, err = ns.HandleGetDevice(*c.appEUI, *c.devEUI)
+		shouldBeInvalid(err)
+
+		shouldBeInvalid(ns.BlockDevice(*c.appEUI, *c.devEUI))
+		shouldBeInvalid(ns.UnblockDevice(*c.appEUI, *c.devEUI))
+	}
+
+	_, err := ns.HandleGetDevices(&pb.DevicesRequest{}, nil)
+	a.So(errors.GetErrType(err), ShouldEqual, errors.InvalidArgument)
+}
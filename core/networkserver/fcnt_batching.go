@@ -0,0 +1,98 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+)
+
+// FCntPersistMessages and FCntPersistInterval enable batching of the writes of uplink frame counters. When
+// enabled, the uplink frame counter is written to the database once every FCntPersistMessages uplinks, or
+// on the first uplink after FCntPersistInterval has passed since the last write. In between, the frame
+// counter is kept in memory. Batching is disabled if both are 0.
+//
+// As the stored frame counter can be up to FCntPersistMessages behind, the NetworkServer resumes from the
+// stored frame counter after a restart. Frame counters in that window are accepted again, which is the
+// price for the reduced writes. The first uplink after a restart is always written.
+var (
+	FCntPersistMessages uint32
+	FCntPersistInterval time.Duration
+)
+
+func fCntBatching() bool {
+	return FCntPersistMessages > 0 || FCntPersistInterval > 0
+}
+
+type fCntState struct {
+	nwkSKey   types.NwkSKey // The session of the frame counter
+	fCntUp    uint32        // The frame counter in memory
+	persisted uint32        // The frame counter in the database
+	at        time.Time     // The time of the last write
+}
+
+type fCntCache struct {
+	sync.Mutex
+	devices map[string]*fCntState
+}
+
+func fCntKey(dev *device.Device) string {
+	return fmt.Sprintf("%s:%s", dev.AppEUI, dev.DevEUI)
+}
+
+// restoreFCnt sets the uplink frame counter of the device to the one in memory. If the stored session or frame
+// counter is not the one that was last written by this NetworkServer, for example because the device re-activated,
+// the frame counter in memory is discarded, so that the frame counter always belongs to the NwkSKey of the device.
+func (n *networkServer) restoreFCnt(dev *device.Device) {
+	if !fCntBatching() {
+		return
+	}
+	n.fCnts.Lock()
+	defer n.fCnts.Unlock()
+	state, ok := n.fCnts.devices[fCntKey(dev)]
+	if !ok {
+		return
+	}
+	if state.nwkSKey != dev.NwkSKey || state.persisted != dev.FCntUp {
+		delete(n.fCnts.devices, fCntKey(dev))
+		return
+	}
+	dev.FCntUp = state.fCntUp
+}
+
+// forgetFCnt discards the uplink frame counter of the device in memory, for example after it was reset. This only
+// affects this NetworkServer: other NetworkServers on the same database keep their batched frame counter of the
+// device, and may write it to the database later.
+func (n *networkServer) forgetFCnt(dev *device.Device) {
+	n.fCnts.Lock()
+	defer n.fCnts.Unlock()
+	delete(n.fCnts.devices, fCntKey(dev))
+}
+
+// batchFCnt is called after an uplink updated the frame counter of the device. If the frame counter does not
+// have to be written yet, it is kept in memory and the stored frame counter is put back in the device.
+func (n *networkServer) batchFCnt(dev *device.Device) {
+	if !fCntBatching() {
+		return
+	}
+	n.fCnts.Lock()
+	defer n.fCnts.Unlock()
+	if n.fCnts.devices == nil {
+		n.fCnts.devices = make(map[string]*fCntState)
+	}
+	now := n.now()
+	state, ok := n.fCnts.devices[fCntKey(dev)]
+	if !ok ||
+		(FCntPersistMessages > 0 && dev.FCntUp-state.persisted >= FCntPersistMessages) ||
+		(FCntPersistInterval > 0 && now.Sub(state.at) >= FCntPersistInterval) {
+		n.fCnts.devices[fCntKey(dev)] = &fCntState{nwkSKey: dev.NwkSKey, fCntUp: dev.FCntUp, persisted: dev.FCntUp, at: now}
+		return
+	}
+	state.fCntUp = dev.FCntUp
+	dev.FCntUp = state.persisted
+}
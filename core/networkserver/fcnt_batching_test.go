@@ -0,0 +1,135 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/TheThingsNetwork/ttn/api/networkserver"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestFCntBatching(t *testing.T) {
+	a := New(t)
+
+	defer func(messages uint32, interval time.Duration, mode FCntCheckMode) {
+		FCntPersistMessages, FCntPersistInterval, FCntCheck = messages, interval, mode
+	}(FCntPersistMessages, FCntPersistInterval, FCntCheck)
+	FCntPersistMessages = 3
+	FCntCheck = FCntCheckStrict
+
+	store := device.NewRedisDeviceStore(GetRedisClient(), "ns-test-fcnt-batching")
+	newNetworkServer := func() *networkServer {
+		ns := &networkServer{
+			Component: &component.Component{
+				Ctx: GetLogger(t, "TestFCntBatching"),
+			},
+			devices: store,
+		}
+		ns.InitStatus()
+		return ns
+	}
+	ns := newNetworkServer()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+
+	store.Set(&device.Device{
+		DevAddr: devAddr,
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		NwkSKey: types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8},
+	})
+	defer func() {
+		store.Delete(appEUI, devEUI)
+	}()
+
+	uplink := func(ns *networkServer, fCnt uint32) {
+		message := uplinkMACInitMessage(appEUI, devEUI)
+		message.Message.GetLorawan().GetMacPayload().FCnt = fCnt
+		_, err := ns.HandleUplink(message)
+		a.So(err, ShouldBeNil)
+	}
+	stored := func() uint32 {
+		dev, _ := store.Get(appEUI, devEUI)
+		return dev.FCntUp
+	}
+	candidates := func(ns *networkServer, fCnt uint32) int {
+		res, err := ns.HandleGetDevices(&pb.DevicesRequest{DevAddr: &devAddr, FCnt: fCnt}, nil)
+		a.So(err, ShouldBeNil)
+		return len(res.Results)
+	}
+
+	// The first uplink is written
+	uplink(ns, 1)
+	a.So(stored(), ShouldEqual, 1)
+
+	// The next ones are kept in memory
+	uplink(ns, 2)
+	uplink(ns, 3)
+	a.So(stored(), ShouldEqual, 1)
+	dev, _ := ns.HandleGetDevice(appEUI, devEUI)
+	a.So(dev.FCntUp, ShouldEqual, 3)
+	a.So(candidates(ns, 3), ShouldEqual, 0)
+	a.So(candidates(ns, 4), ShouldEqual, 1)
+
+	// Until the batch is full
+	uplink(ns, 4)
+	a.So(stored(), ShouldEqual, 4)
+	uplink(ns, 5)
+	a.So(stored(), ShouldEqual, 4)
+
+	// After a restart, the NetworkServer resumes from the stored frame counter, so the counters
+	// in the batch window are accepted again
+	ns = newNetworkServer()
+	a.So(candidates(ns, 5), ShouldEqual, 1)
+
+	// The first uplink after the restart is written
+	uplink(ns, 6)
+	a.So(stored(), ShouldEqual, 6)
+
+	// A re-activation discards the frame counter in memory
+	uplink(ns, 7)
+	dev, _ = store.Get(appEUI, devEUI)
+	dev.StartUpdate()
+	dev.FCntUp = 0
+	store.Set(dev)
+	dev, _ = ns.HandleGetDevice(appEUI, devEUI)
+	a.So(dev.FCntUp, ShouldEqual, 0)
+}
+
+func TestFCntBatchingInterval(t *testing.T) {
+	a := New(t)
+
+	defer func(messages uint32, interval time.Duration) {
+		FCntPersistMessages, FCntPersistInterval = messages, interval
+	}(FCntPersistMessages, FCntPersistInterval)
+	FCntPersistMessages = 0
+	FCntPersistInterval = time.Minute
+
+	now := time.Now()
+	ns := &networkServer{clock: func() time.Time { return now }}
+
+	dev := &device.Device{FCntUp: 1}
+	ns.batchFCnt(dev)
+	a.So(dev.FCntUp, ShouldEqual, 1)
+
+	dev = &device.Device{FCntUp: 2}
+	ns.batchFCnt(dev)
+	a.So(dev.FCntUp, ShouldEqual, 1)
+
+	now = now.Add(time.Minute)
+	dev = &device.Device{FCntUp: 1}
+	ns.restoreFCnt(dev)
+	a.So(dev.FCntUp, ShouldEqual, 2)
+	dev.FCntUp = 3
+	ns.batchFCnt(dev)
+	a.So(dev.FCntUp, ShouldEqual, 3)
+}
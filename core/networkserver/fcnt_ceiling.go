@@ -0,0 +1,57 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"math"
+
+	"github.com/TheThingsNetwork/go-utils/log"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+)
+
+// FCntCeilingThreshold is the fraction of the 32-bit frame counter space at which an alert is emitted for a
+// device, so that it can be re-keyed before its frame counters wrap (0 means never)
+var FCntCeilingThreshold = 0.9
+
+// Directions of frame counters in FCnt ceiling alerts
+const (
+	FCntDirectionUp   = "up"
+	FCntDirectionDown = "down"
+)
+
+const fCntCeilingEvent = "fcnt ceiling"
+
+// FCntCeilingAlert is called when a frame counter of a device crosses the FCntCeilingThreshold
+type FCntCeilingAlert func(dev *device.Device, direction string, fCnt uint32)
+
+// SetFCntCeilingAlert sets the function that is called when a frame counter of a device crosses the
+// FCntCeilingThreshold. The alert is emitted once, when the counter crosses the threshold.
+func (n *networkServer) SetFCntCeilingAlert(alert FCntCeilingAlert) {
+	n.fCntCeilingAlert = alert
+}
+
+func fCntCeiling() (ceiling uint32, ok bool) {
+	if FCntCeilingThreshold <= 0 || FCntCeilingThreshold >= 1 {
+		return 0, false
+	}
+	return uint32(FCntCeilingThreshold * math.MaxUint32), true
+}
+
+// checkFCntCeiling emits an alert if the frame counter crossed the ceiling, and returns whether it did
+func (n *networkServer) checkFCntCeiling(dev *device.Device, direction string, old, new uint32) bool {
+	ceiling, ok := fCntCeiling()
+	if !ok || old >= ceiling || new < ceiling {
+		return false
+	}
+	n.Ctx.WithFields(log.Fields{
+		"AppEUI":    dev.AppEUI,
+		"DevEUI":    dev.DevEUI,
+		"Direction": direction,
+		"FCnt":      new,
+	}).Warn("Frame counter is approaching its maximum, the device should be re-keyed")
+	if n.fCntCeilingAlert != nil {
+		n.fCntCeilingAlert(dev, direction, new)
+	}
+	return true
+}
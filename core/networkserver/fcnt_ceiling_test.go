@@ -0,0 +1,106 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestFCntCeilingAlert(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestFCntCeilingAlert"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-fcnt-ceiling-alert"),
+	}
+	ns.InitStatus()
+
+	type alert struct {
+		direction string
+		fCnt      uint32
+	}
+	var alerts []alert
+	ns.SetFCntCeilingAlert(func(dev *device.Device, direction string, fCnt uint32) {
+		alerts = append(alerts, alert{direction, fCnt})
+	})
+
+	ceiling, ok := fCntCeiling()
+	a.So(ok, ShouldBeTrue)
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+	ns.devices.Set(&device.Device{
+		DevAddr:  devAddr,
+		AppEUI:   appEUI,
+		DevEUI:   devEUI,
+		FCntUp:   ceiling - 3,
+		FCntDown: ceiling - 1,
+		Options:  device.Options{Uses32BitFCnt: true},
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	uplink := func(fCnt uint32) {
+		message := uplinkMACInitMessage(appEUI, devEUI)
+		message.Message.GetLorawan().GetMacPayload().FCnt = fCnt & 0xffff
+		_, err := ns.HandleUplink(message)
+		a.So(err, ShouldBeNil)
+	}
+
+	uplink(ceiling - 2)
+	a.So(alerts, ShouldBeEmpty)
+
+	// The alert fires when the counter crosses the ceiling
+	uplink(ceiling)
+	a.So(alerts, ShouldResemble, []alert{{FCntDirectionUp, ceiling}})
+
+	// And not again after that
+	uplink(ceiling + 1)
+	a.So(alerts, ShouldHaveLength, 1)
+
+	// Downlink counters are checked as well
+	downlink := func() {
+		fPort := uint8(1)
+		phy := lorawan.PHYPayload{
+			MHDR: lorawan.MHDR{MType: lorawan.UnconfirmedDataDown, Major: lorawan.LoRaWANR1},
+			MACPayload: &lorawan.MACPayload{
+				FPort: &fPort,
+				FHDR:  lorawan.FHDR{DevAddr: lorawan.DevAddr(devAddr)},
+			},
+		}
+		bytes, _ := phy.MarshalBinary()
+		_, err := ns.HandleDownlink(&pb_broker.DownlinkMessage{
+			AppEui:  &appEUI,
+			DevEui:  &devEUI,
+			Payload: bytes,
+			DownlinkOption: &pb_broker.DownlinkOption{
+				ProtocolConfig: &pb_protocol.TxConfiguration{Protocol: &pb_protocol.TxConfiguration_Lorawan{
+					Lorawan: &pb_lorawan.TxConfiguration{},
+				}},
+			},
+		})
+		a.So(err, ShouldBeNil)
+	}
+
+	downlink()
+	a.So(alerts, ShouldHaveLength, 2)
+	a.So(alerts[1], ShouldResemble, alert{FCntDirectionDown, ceiling})
+
+	uplink(ceiling + 2)
+	downlink()
+	a.So(alerts, ShouldHaveLength, 2)
+}
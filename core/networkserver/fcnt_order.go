@@ -0,0 +1,35 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/utils/fcnt"
+)
+
+// AllowFCntUpRewind makes the NetworkServer store the frame counter of an uplink that arrives after an uplink
+// with a higher frame counter. By default, the stored frame counter never decreases, so that out-of-order
+// delivery of deduplicated uplinks can not rewind it and open it up for replays.
+var AllowFCntUpRewind = false
+
+const outOfOrderEvent = "out of order"
+
+// keepFCntUp restores the stored uplink frame counter if the frame counter of the uplink is lower, and returns
+// whether it did. Devices with the frame counter check disabled may reset their frame counter, so it is not kept.
+func keepFCntUp(dev *device.Device, stored uint32) bool {
+	if AllowFCntUpRewind || dev.Options.DisableFCntCheck || dev.FCntUp >= stored {
+		return false
+	}
+	dev.FCntUp = stored
+	return true
+}
+
+// uplinkFCnt returns the full frame counter of an uplink. 16-bit devices only have the 16 bits that are sent over
+// the air, for 32-bit devices the full counter is reconstructed from the stored one.
+func uplinkFCnt(dev *device.Device, fCnt uint32) uint32 {
+	if dev.Options.Uses32BitFCnt {
+		return fcnt.GetFull(dev.FCntUp, uint16(fCnt))
+	}
+	return fCnt & 0xffff
+}
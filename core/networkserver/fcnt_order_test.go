@@ -0,0 +1,78 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestHandleUplinkOutOfOrder(t *testing.T) {
+	a := New(t)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkOutOfOrder"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-out-of-order"),
+		clock:   func() time.Time { return now },
+	}
+	ns.InitStatus()
+
+	defer func(allow bool) {
+		AllowFCntUpRewind = allow
+	}(AllowFCntUpRewind)
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	uplink := func(fCnt uint32) *device.Device {
+		now = now.Add(time.Second)
+		message := uplinkMACInitMessage(appEUI, devEUI)
+		message.Message.GetLorawan().GetMacPayload().FCnt = fCnt
+		_, err := ns.HandleUplink(message)
+		a.So(err, ShouldBeNil)
+		dev, err := ns.devices.Get(appEUI, devEUI)
+		a.So(err, ShouldBeNil)
+		return dev
+	}
+
+	dev := uplink(5)
+	a.So(dev.FCntUp, ShouldEqual, 5)
+
+	// An uplink that arrives late does not rewind the frame counter, but the device was still seen
+	dev = uplink(3)
+	a.So(dev.FCntUp, ShouldEqual, 5)
+	a.So(dev.LastSeen.Equal(now), ShouldBeTrue)
+
+	dev = uplink(6)
+	a.So(dev.FCntUp, ShouldEqual, 6)
+
+	// The frame counter may be rewound if allowed
+	AllowFCntUpRewind = true
+	dev = uplink(4)
+	a.So(dev.FCntUp, ShouldEqual, 4)
+	AllowFCntUpRewind = false
+
+	// Devices with the frame counter check disabled may reset their frame counter
+	dev.Options.DisableFCntCheck = true
+	ns.devices.Set(dev, "options")
+	dev = uplink(1)
+	a.So(dev.FCntUp, ShouldEqual, 1)
+}
@@ -0,0 +1,104 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+	"gopkg.in/redis.v5"
+)
+
+// FrameCounterFilter selects the devices of which ResetFrameCounters resets the frame counters. A device matches
+// the filter if it matches all fields that are set.
+type FrameCounterFilter struct {
+	AppEUI         *types.AppEUI        // Only devices of this application
+	Prefix         *types.DevAddrPrefix // Only devices with a DevAddr in this prefix
+	LastSeenBefore time.Time            // Only devices that were not seen since this time
+}
+
+func (f FrameCounterFilter) matches(dev *device.Device) bool {
+	if f.AppEUI != nil && dev.AppEUI != *f.AppEUI {
+		return false
+	}
+	if f.Prefix != nil && !dev.DevAddr.HasPrefix(*f.Prefix) {
+		return false
+	}
+	if !f.LastSeenBefore.IsZero() && !dev.LastSeen.Before(f.LastSeenBefore) {
+		return false
+	}
+	return true
+}
+
+// fCntResetAttempts is the number of times that the reset of a device is attempted if the device is changed
+// during the reset
+const fCntResetAttempts = 5
+
+// ResetFrameCounters resets the frame counters of all devices that match the filter, and clears their queued MAC
+// commands and the time of their last downlink. Each device is reset in its own transaction, which is retried if
+// the device is changed during the reset, so that a busy device does not make the whole reset fail. If an error is
+// returned, the devices that were reset before the error stay reset. It returns the number of devices that were
+// reset.
+//
+// The frame counters that other NetworkServers on the same database keep in memory are not discarded, see forgetFCnt.
+func (n *networkServer) ResetFrameCounters(filter FrameCounterFilter) (int, error) {
+	devices, err := n.devices.List(nil)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for _, listed := range devices {
+		if listed == nil || !filter.matches(listed) {
+			continue
+		}
+		dev, err := n.resetFrameCounters(filter, listed.AppEUI, listed.DevEUI)
+		if err != nil {
+			return count, err
+		}
+		if dev != nil {
+			n.forgetFCnt(dev)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// resetFrameCounters resets the frame counters of the device if it still matches the filter. It returns the device
+// if it was reset.
+func (n *networkServer) resetFrameCounters(filter FrameCounterFilter, appEUI types.AppEUI, devEUI types.DevEUI) (reset *device.Device, err error) {
+	for attempt := 0; attempt < fCntResetAttempts; attempt++ {
+		reset = nil
+		err = n.devices.WithTransaction(func(tx device.Store) error {
+			dev, err := tx.Get(appEUI, devEUI)
+			if errors.GetErrType(err) == errors.NotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if !filter.matches(dev) {
+				return nil
+			}
+			dev.StartUpdate()
+			dev.FCntUp = 0
+			dev.FCntDown = 0
+			dev.LastDownlink = time.Time{}
+			dev.MACCommands = nil
+			if err := tx.Set(dev); err != nil {
+				return err
+			}
+			reset = dev
+			return nil
+		})
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reset, nil
+}
@@ -0,0 +1,128 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+	"gopkg.in/redis.v5"
+)
+
+func TestResetFrameCounters(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-reset-frame-counters"),
+	}
+	ns.InitStatus()
+
+	app1 := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 1))
+	app2 := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 2))
+	prefix := types.DevAddrPrefix{DevAddr: getDevAddr(0x26, 0, 0, 0), Length: 8}
+	now := time.Now()
+
+	devices := map[string]*device.Device{
+		"app1-in-prefix":  {AppEUI: app1, DevEUI: types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 0, 1)), DevAddr: getDevAddr(0x26, 0, 0, 1)},
+		"app1-in-prefix2": {AppEUI: app1, DevEUI: types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 0, 2)), DevAddr: getDevAddr(0x26, 0, 0, 2), LastSeen: now.Add(-time.Hour)},
+		"app1-recent":     {AppEUI: app1, DevEUI: types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 0, 3)), DevAddr: getDevAddr(0x26, 0, 0, 3), LastSeen: now},
+		"app1-outside":    {AppEUI: app1, DevEUI: types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 0, 4)), DevAddr: getDevAddr(0x27, 0, 0, 4)},
+		"app2-in-prefix":  {AppEUI: app2, DevEUI: types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 0, 5)), DevAddr: getDevAddr(0x26, 0, 0, 5)},
+	}
+	for _, dev := range devices {
+		dev.FCntUp = 42
+		dev.FCntDown = 24
+		dev.LastDownlink = now
+		queueMACCommand(dev, lorawan.DevStatusReq, nil, true)
+		a.So(ns.devices.Set(dev), ShouldBeNil)
+	}
+	defer func() {
+		for _, dev := range devices {
+			ns.devices.Delete(dev.AppEUI, dev.DevEUI)
+		}
+	}()
+
+	count, err := ns.ResetFrameCounters(FrameCounterFilter{
+		AppEUI:         &app1,
+		Prefix:         &prefix,
+		LastSeenBefore: now.Add(-time.Minute),
+	})
+	a.So(err, ShouldBeNil)
+	a.So(count, ShouldEqual, 2)
+
+	for name, dev := range devices {
+		stored, err := ns.devices.Get(dev.AppEUI, dev.DevEUI)
+		a.So(err, ShouldBeNil)
+		switch name {
+		case "app1-in-prefix", "app1-in-prefix2":
+			a.So(stored.FCntUp, ShouldEqual, 0)
+			a.So(stored.FCntDown, ShouldEqual, 0)
+			a.So(stored.LastDownlink.IsZero(), ShouldBeTrue)
+			a.So(stored.MACCommands, ShouldBeEmpty)
+		default:
+			a.So(stored.FCntUp, ShouldEqual, 42)
+			a.So(stored.FCntDown, ShouldEqual, 24)
+			a.So(stored.LastDownlink.IsZero(), ShouldBeFalse)
+			a.So(stored.MACCommands, ShouldHaveLength, 1)
+		}
+	}
+
+	// Without filter, all devices are reset
+	count, err = ns.ResetFrameCounters(FrameCounterFilter{})
+	a.So(err, ShouldBeNil)
+	a.So(count, ShouldEqual, len(devices))
+}
+
+// conflictingStore fails the first transactions as if the devices were changed during the transaction
+type conflictingStore struct {
+	device.Store
+	conflicts int
+}
+
+func (s *conflictingStore) WithTransaction(fn func(tx device.Store) error) error {
+	if s.conflicts > 0 {
+		s.conflicts--
+		return redis.TxFailedErr
+	}
+	return s.Store.WithTransaction(fn)
+}
+
+func TestResetFrameCountersConflict(t *testing.T) {
+	a := New(t)
+	store := &conflictingStore{Store: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-reset-frame-counters-conflict")}
+	ns := &networkServer{devices: store}
+	ns.InitStatus()
+
+	dev := &device.Device{
+		AppEUI:   types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 1)),
+		DevEUI:   types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 0, 1)),
+		DevAddr:  getDevAddr(0x26, 0, 0, 1),
+		FCntUp:   42,
+		FCntDown: 24,
+	}
+	a.So(ns.devices.Set(dev), ShouldBeNil)
+	defer ns.devices.Delete(dev.AppEUI, dev.DevEUI)
+
+	// The reset of the device is retried
+	store.conflicts = fCntResetAttempts - 1
+	count, err := ns.ResetFrameCounters(FrameCounterFilter{})
+	a.So(err, ShouldBeNil)
+	a.So(count, ShouldEqual, 1)
+	stored, _ := ns.devices.Get(dev.AppEUI, dev.DevEUI)
+	a.So(stored.FCntUp, ShouldEqual, 0)
+
+	// Until it keeps conflicting
+	stored.StartUpdate()
+	stored.FCntUp = 42
+	a.So(ns.devices.Set(stored), ShouldBeNil)
+	store.conflicts = fCntResetAttempts
+	_, err = ns.ResetFrameCounters(FrameCounterFilter{})
+	a.So(err, ShouldEqual, redis.TxFailedErr)
+	stored, _ = ns.devices.Get(dev.AppEUI, dev.DevEUI)
+	a.So(stored.FCntUp, ShouldEqual, 42)
+}
@@ -0,0 +1,52 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+
+	"github.com/TheThingsNetwork/ttn/core/types"
+)
+
+// Directions of the encryption blocks of the FRMPayload
+const (
+	uplinkDir   byte = 0
+	downlinkDir byte = 1
+)
+
+// cryptFRMPayload encrypts or decrypts (which is the same operation) the FRMPayload of a data frame as
+// specified in section 4.3.3 of the LoRaWAN specification. The fCnt must be the full 32-bit frame counter.
+func cryptFRMPayload(key [16]byte, dir byte, devAddr types.DevAddr, fCnt uint32, payload []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	var a, s [aes.BlockSize]byte
+	a[0] = 0x01
+	a[5] = dir
+	// DevAddr and FCnt are little-endian in the block
+	a[6], a[7], a[8], a[9] = devAddr[3], devAddr[2], devAddr[1], devAddr[0]
+	binary.LittleEndian.PutUint32(a[10:14], fCnt)
+
+	out := make([]byte, len(payload))
+	for i := 0; i < len(payload); i += aes.BlockSize {
+		a[15] = byte(i/aes.BlockSize + 1)
+		block.Encrypt(s[:], a[:])
+		for j := i; j < len(payload) && j < i+aes.BlockSize; j++ {
+			out[j] = payload[j] ^ s[j-i]
+		}
+	}
+	return out, nil
+}
+
+// decryptUplinkFPort0 decrypts the FRMPayload of an uplink on FPort 0, which contains MAC commands
+func decryptUplinkFPort0(nwkSKey types.NwkSKey, devAddr types.DevAddr, fCnt uint32, frmPayload []byte) ([]byte, error) {
+	return cryptFRMPayload(nwkSKey, uplinkDir, devAddr, fCnt, frmPayload)
+}
+
+// encryptDownlinkFPort0 encrypts MAC commands for the FRMPayload of a downlink on FPort 0
+func encryptDownlinkFPort0(nwkSKey types.NwkSKey, devAddr types.DevAddr, fCnt uint32, macCommands []byte) ([]byte, error) {
+	return cryptFRMPayload(nwkSKey, downlinkDir, devAddr, fCnt, macCommands)
+}
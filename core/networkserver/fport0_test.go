@@ -0,0 +1,106 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestFPort0RoundTrip(t *testing.T) {
+	a := New(t)
+
+	nwkSKey := types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+	devAddr := types.DevAddr{1, 2, 3, 4}
+	fCnt := uint32(0x00010002)
+
+	// LinkCheckReq + DevStatusAns + LinkADRAns, longer than one AES block
+	cmds := []byte{0x02, 0x06, 0xff, 0x05, 0x03, 0x07, 0x06, 0xff, 0x05, 0x06, 0xff, 0x05, 0x06, 0xff, 0x05, 0x06, 0xff, 0x05}
+
+	for _, dir := range []struct {
+		mType lorawan.MType
+		dir   byte
+	}{
+		{lorawan.UnconfirmedDataUp, uplinkDir},
+		{lorawan.UnconfirmedDataDown, downlinkDir},
+	} {
+		encrypted, err := cryptFRMPayload(nwkSKey, dir.dir, devAddr, fCnt, cmds)
+		a.So(err, ShouldBeNil)
+		a.So(encrypted, ShouldNotResemble, cmds)
+
+		// Same result as the reference implementation
+		fPort := uint8(0)
+		phy := lorawan.PHYPayload{
+			MHDR: lorawan.MHDR{MType: dir.mType, Major: lorawan.LoRaWANR1},
+			MACPayload: &lorawan.MACPayload{
+				FHDR:       lorawan.FHDR{DevAddr: lorawan.DevAddr(devAddr), FCnt: fCnt},
+				FPort:      &fPort,
+				FRMPayload: []lorawan.Payload{&lorawan.DataPayload{Bytes: cmds}},
+			},
+		}
+		a.So(phy.EncryptFRMPayload(lorawan.AES128Key(nwkSKey)), ShouldBeNil)
+		a.So(phy.MACPayload.(*lorawan.MACPayload).FRMPayload[0].(*lorawan.DataPayload).Bytes, ShouldResemble, encrypted)
+
+		decrypted, err := cryptFRMPayload(nwkSKey, dir.dir, devAddr, fCnt, encrypted)
+		a.So(err, ShouldBeNil)
+		a.So(decrypted, ShouldResemble, cmds)
+	}
+
+	// Downlink encryption is decrypted by the device with the downlink direction only
+	encrypted, _ := encryptDownlinkFPort0(nwkSKey, devAddr, fCnt, cmds)
+	decrypted, _ := decryptUplinkFPort0(nwkSKey, devAddr, fCnt, encrypted)
+	a.So(decrypted, ShouldNotResemble, cmds)
+
+	// The upper 16 bits of the frame counter are used
+	truncated, _ := encryptDownlinkFPort0(nwkSKey, devAddr, fCnt&0xffff, cmds)
+	a.So(truncated, ShouldNotResemble, encrypted)
+}
+
+func TestHandleUplinkFPort0OutOfOrder(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkFPort0OutOfOrder"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-fport0-out-of-order"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	nwkSKey := types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		NwkSKey: nwkSKey,
+		FCntUp:  10,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// The uplink arrives after an uplink with a higher frame counter, its LinkCheckReq is encrypted with its own
+	message := uplinkMACInitMessage(appEUI, devEUI)
+	mac := message.Message.GetLorawan().GetMacPayload()
+	mac.FCnt = 5
+	mac.FrmPayload, _ = cryptFRMPayload(nwkSKey, uplinkDir, getDevAddr(1, 2, 3, 4), 5, []byte{byte(lorawan.LinkCheckReq)})
+
+	res, err := ns.HandleUplink(message)
+	a.So(err, ShouldBeNil)
+	fOpts := res.ResponseTemplate.Message.GetLorawan().GetMacPayload().FOpts
+	if a.So(fOpts, ShouldHaveLength, 1) {
+		a.So(fOpts[0].Cid, ShouldEqual, uint32(lorawan.LinkCheckAns))
+	}
+
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	a.So(dev.FCntUp, ShouldEqual, 10)
+}
@@ -0,0 +1,178 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"sort"
+	"time"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+)
+
+// GatewayUtilization is used to check whether a gateway has duty-cycle budget left for a downlink
+type GatewayUtilization interface {
+	HasBudget(gatewayID string) bool
+}
+
+func (n *networkServer) SetGatewayUtilization(utilization GatewayUtilization) {
+	n.gatewayUtilization = utilization
+}
+
+type bySignal []*pb_gateway.RxMetadata
+
+func (a bySignal) Len() int      { return len(a) }
+func (a bySignal) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a bySignal) Less(i, j int) bool {
+	if a[i].Snr != a[j].Snr {
+		return a[i].Snr > a[j].Snr
+	}
+	return a[i].Rssi > a[j].Rssi
+}
+
+// dedupeGatewayMetadata removes the duplicate metadata of gateways that reported the uplink more than once,
+// keeping the report with the best signal at the position of the first one. Metadata without gateway ID is kept.
+func dedupeGatewayMetadata(metadata []*pb_gateway.RxMetadata) []*pb_gateway.RxMetadata {
+	deduped := make([]*pb_gateway.RxMetadata, 0, len(metadata))
+	index := make(map[string]int, len(metadata))
+	for _, gateway := range metadata {
+		if gateway == nil {
+			continue
+		}
+		if gateway.GatewayId == "" {
+			deduped = append(deduped, gateway)
+			continue
+		}
+		if i, ok := index[gateway.GatewayId]; ok {
+			if bySignal([]*pb_gateway.RxMetadata{gateway, deduped[i]}).Less(0, 1) {
+				deduped[i] = gateway
+			}
+			continue
+		}
+		index[gateway.GatewayId] = len(deduped)
+		deduped = append(deduped, gateway)
+	}
+	return deduped
+}
+
+// issuedGateways returns the metadata of the gateways for which a Router issued the downlink option. Only these
+// gateways can be selected for the downlink, as the Router schedules it by the Identifier of the option, which
+// belongs to the schedule of its gateway.
+func issuedGateways(option *pb_broker.DownlinkOption, metadata []*pb_gateway.RxMetadata) []*pb_gateway.RxMetadata {
+	var issued []*pb_gateway.RxMetadata
+	for _, gateway := range metadata {
+		if gateway != nil && gateway.GatewayId != "" && gateway.GatewayId == option.GatewayId {
+			issued = append(issued, gateway)
+		}
+	}
+	return issued
+}
+
+// selectDownlinkGateway returns the gateway with the best signal that still has duty-cycle budget, or nil. Gateways
+// with an equal signal are selected according to the GatewayTieBreak policy.
+func (n *networkServer) selectDownlinkGateway(metadata []*pb_gateway.RxMetadata) *pb_gateway.RxMetadata {
+	candidates := make([]*pb_gateway.RxMetadata, 0, len(metadata))
+	for _, gateway := range metadata {
+		if gateway != nil && gateway.GatewayId != "" {
+			candidates = append(candidates, gateway)
+		}
+	}
+	sort.Stable(bySignal(candidates))
+	var best []*pb_gateway.RxMetadata
+	for _, gateway := range candidates {
+		if len(best) > 0 && bySignal([]*pb_gateway.RxMetadata{best[0], gateway}).Less(0, 1) {
+			break
+		}
+		if n.gatewayUtilization == nil || n.gatewayUtilization.HasBudget(gateway.GatewayId) {
+			best = append(best, gateway)
+		}
+	}
+	if len(best) == 0 {
+		return nil
+	}
+	return n.breakGatewayTie(best)
+}
+
+// defaultRXDelay is the RX delay that the Router uses when it builds downlink options
+const defaultRXDelay = time.Second
+
+// downlinkTimestamps returns the timestamps for RX1 and RX2 of an uplink that a gateway received at
+// uplinkTimestamp. Gateway timestamps are the microsecond counter of the gateway, so the result is
+// in the time base of that gateway and wraps around with its counter.
+func downlinkTimestamps(uplinkTimestamp uint32, rxDelay uint8) (rx1 uint32, rx2 uint32) {
+	if rxDelay == 0 {
+		rxDelay = 1
+	}
+	rx1 = uplinkTimestamp + uint32(time.Duration(rxDelay)*time.Second/time.Microsecond)
+	rx2 = rx1 + uint32(time.Second/time.Microsecond)
+	return
+}
+
+// isRX2Option returns whether the Router built the option for RX2. The Router built the option for the timestamp of
+// its own gateway, the offset tells us the RX window.
+func isRX2Option(option *pb_broker.DownlinkOption, metadata []*pb_gateway.RxMetadata) bool {
+	if option.GatewayConfig == nil {
+		return false
+	}
+	for _, md := range metadata {
+		if md != nil && md.GatewayId == option.GatewayId {
+			return option.GatewayConfig.Timestamp-md.Timestamp > uint32(defaultRXDelay/time.Microsecond)
+		}
+	}
+	return false
+}
+
+// setDownlinkTimestamp sets the timestamp of the downlink option for the given gateway and RX delay
+func setDownlinkTimestamp(option *pb_broker.DownlinkOption, metadata []*pb_gateway.RxMetadata, gateway *pb_gateway.RxMetadata, rxDelay uint8) {
+	if option.GatewayConfig == nil {
+		return
+	}
+
+	rx1Timestamp, rx2Timestamp := downlinkTimestamps(gateway.Timestamp, rxDelay)
+	if isRX2Option(option, metadata) {
+		option.GatewayConfig.Timestamp = rx2Timestamp
+	} else {
+		option.GatewayConfig.Timestamp = rx1Timestamp
+	}
+}
+
+// DownlinkSkewTolerance is how long a receive window may have passed according to the clock of the NetworkServer
+// before a downlink is no longer scheduled in it. This tolerates skew between the clock of the server that
+// received the uplink and the clock of the NetworkServer.
+var DownlinkSkewTolerance time.Duration
+
+// downlinkWindowEvent is the trace event that records the receive window of the downlink
+const downlinkWindowEvent = "downlink window"
+
+// scheduleDownlinkWindow checks that the receive window of the downlink option has not passed yet, using the
+// server time of the uplink as the time that the gateway received it. If RX1 has passed, the option is moved
+// to RX2 with the RX2 parameters of the band of the device. It returns the window (1 or 2) of the option, or
+// false if RX2 has passed as well. If the server time of the uplink is unknown, the option is not checked and
+// the window is 0.
+func (n *networkServer) scheduleDownlinkWindow(message *pb_broker.DeduplicatedUplinkMessage, option *pb_broker.DownlinkOption, gateway *pb_gateway.RxMetadata, dev *device.Device) (window int, ok bool) {
+	if option.GatewayConfig == nil || message.ServerTime == 0 {
+		return 0, true
+	}
+	rxDelay := dev.RXDelay
+	if rxDelay == 0 {
+		rxDelay = 1
+	}
+	rx1Timestamp, rx2Timestamp := downlinkTimestamps(gateway.Timestamp, rxDelay)
+	rx1 := time.Unix(0, message.ServerTime).Add(time.Duration(rxDelay) * time.Second)
+	rx2 := rx1.Add(time.Second)
+	deadline := n.now().Add(-DownlinkSkewTolerance)
+
+	if option.GatewayConfig.Timestamp == rx1Timestamp {
+		if !rx1.Before(deadline) {
+			return 1, true
+		}
+		option.GatewayConfig.Timestamp = rx2Timestamp
+		setRX2Parameters(option, dev)
+	}
+	if !rx2.Before(deadline) {
+		return 2, true
+	}
+	return 0, false
+}
@@ -0,0 +1,381 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+type testGatewayUtilization map[string]bool
+
+func (u testGatewayUtilization) HasBudget(gatewayID string) bool {
+	return !u[gatewayID]
+}
+
+func TestSelectDownlinkGateway(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{}
+
+	metadata := []*pb_gateway.RxMetadata{
+		&pb_gateway.RxMetadata{GatewayId: "weak", Snr: -5, Rssi: -110},
+		&pb_gateway.RxMetadata{GatewayId: "best", Snr: 8, Rssi: -60},
+		&pb_gateway.RxMetadata{GatewayId: "good-rssi", Snr: 5, Rssi: -50},
+		&pb_gateway.RxMetadata{GatewayId: "good", Snr: 5, Rssi: -80},
+	}
+
+	a.So(ns.selectDownlinkGateway(nil), ShouldBeNil)
+	a.So(ns.selectDownlinkGateway(metadata).GatewayId, ShouldEqual, "best")
+
+	// The input order is not changed
+	a.So(metadata[0].GatewayId, ShouldEqual, "weak")
+
+	// Fall back to the next-best gateway with budget
+	utilization := testGatewayUtilization{"best": true}
+	ns.SetGatewayUtilization(utilization)
+	a.So(ns.selectDownlinkGateway(metadata).GatewayId, ShouldEqual, "good-rssi")
+
+	utilization["good-rssi"] = true
+	a.So(ns.selectDownlinkGateway(metadata).GatewayId, ShouldEqual, "good")
+
+	utilization["good"] = true
+	utilization["weak"] = true
+	a.So(ns.selectDownlinkGateway(metadata), ShouldBeNil)
+}
+
+func TestHandleUplinkIssuedGateway(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkIssuedGateway"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-issued-gateway"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	uplink := func() *pb_broker.DeduplicatedUplinkMessage {
+		message := uplinkMACInitMessage(appEUI, devEUI)
+		message.GatewayMetadata = []*pb_gateway.RxMetadata{
+			&pb_gateway.RxMetadata{GatewayId: "best", Timestamp: 500000, Snr: 8},
+			&pb_gateway.RxMetadata{GatewayId: "issued", Timestamp: 1000, Snr: -5},
+		}
+		message.ResponseTemplate.DownlinkOption = &pb_broker.DownlinkOption{
+			Identifier:    "router:issued-slot",
+			GatewayId:     "issued",
+			GatewayConfig: &pb_gateway.TxConfiguration{Timestamp: 1001000},
+		}
+		return message
+	}
+
+	// The option stays with the gateway for which the Router issued it
+	res, err := ns.HandleUplink(uplink())
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate.DownlinkOption.GatewayId, ShouldEqual, "issued")
+	a.So(res.ResponseTemplate.DownlinkOption.Identifier, ShouldEqual, "router:issued-slot")
+	a.So(res.ResponseTemplate.DownlinkOption.GatewayConfig.Timestamp, ShouldEqual, 1001000)
+
+	// Without budget on that gateway, the downlink is dropped
+	ns.SetGatewayUtilization(testGatewayUtilization{"issued": true})
+	res, err = ns.HandleUplink(uplink())
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate, ShouldBeNil)
+}
+
+type testGatewayUtilizationReporter map[string]float64
+
+func (u testGatewayUtilizationReporter) HasBudget(gatewayID string) bool {
+	return u[gatewayID] < 1
+}
+
+func (u testGatewayUtilizationReporter) Utilization(gatewayID string) float64 {
+	return u[gatewayID]
+}
+
+func TestSelectDownlinkGatewayTieBreak(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{}
+
+	defer func(policy GatewayTieBreakPolicy) {
+		GatewayTieBreak = policy
+	}(GatewayTieBreak)
+
+	metadata := []*pb_gateway.RxMetadata{
+		&pb_gateway.RxMetadata{GatewayId: "weak", Snr: -5, Rssi: -110},
+		&pb_gateway.RxMetadata{GatewayId: "first", Snr: 5, Rssi: -80},
+		&pb_gateway.RxMetadata{GatewayId: "second", Snr: 5, Rssi: -80},
+	}
+
+	// selectGateway selects a gateway and records that it was used
+	selectGateway := func() string {
+		gateway := ns.selectDownlinkGateway(metadata)
+		ns.useDownlinkGateway(gateway.GatewayId)
+		return gateway.GatewayId
+	}
+
+	a.So(selectGateway(), ShouldEqual, "first")
+	a.So(selectGateway(), ShouldEqual, "first")
+
+	// The least recently used gateway alternates
+	GatewayTieBreak = LeastRecentlyUsedGateway
+	a.So(selectGateway(), ShouldEqual, "second")
+	a.So(selectGateway(), ShouldEqual, "first")
+	a.So(selectGateway(), ShouldEqual, "second")
+
+	// The least utilized gateway
+	GatewayTieBreak = LeastUtilizedGateway
+	a.So(selectGateway(), ShouldEqual, "first")
+	ns.SetGatewayUtilization(testGatewayUtilizationReporter{"first": 0.5, "second": 0.2})
+	a.So(selectGateway(), ShouldEqual, "second")
+	a.So(selectGateway(), ShouldEqual, "second")
+
+	// Gateways without budget are not considered
+	ns.SetGatewayUtilization(testGatewayUtilizationReporter{"first": 0.5, "second": 1})
+	a.So(selectGateway(), ShouldEqual, "first")
+}
+
+func TestDownlinkTimestamps(t *testing.T) {
+	a := New(t)
+
+	rx1, rx2 := downlinkTimestamps(1000, 0)
+	a.So(rx1, ShouldEqual, 1001000)
+	a.So(rx2, ShouldEqual, 2001000)
+
+	rx1, rx2 = downlinkTimestamps(1000, 5)
+	a.So(rx1, ShouldEqual, 5001000)
+	a.So(rx2, ShouldEqual, 6001000)
+
+	// The gateway counter rolls over
+	rx1, rx2 = downlinkTimestamps(4294967000, 1)
+	a.So(rx1, ShouldEqual, 999704)
+	a.So(rx2, ShouldEqual, 1999704)
+}
+
+func TestSetDownlinkTimestamp(t *testing.T) {
+	a := New(t)
+
+	metadata := []*pb_gateway.RxMetadata{
+		&pb_gateway.RxMetadata{GatewayId: "router", Timestamp: 1000},
+		&pb_gateway.RxMetadata{GatewayId: "best", Timestamp: 500000},
+	}
+
+	// RX1 option of the Router, moved to another gateway with a different time base
+	option := &pb_broker.DownlinkOption{GatewayId: "router", GatewayConfig: &pb_gateway.TxConfiguration{Timestamp: 1001000}}
+	setDownlinkTimestamp(option, metadata, metadata[1], 5)
+	a.So(option.GatewayConfig.Timestamp, ShouldEqual, 5500000)
+
+	// RX2 option of the Router
+	option = &pb_broker.DownlinkOption{GatewayId: "router", GatewayConfig: &pb_gateway.TxConfiguration{Timestamp: 2001000}}
+	setDownlinkTimestamp(option, metadata, metadata[1], 5)
+	a.So(option.GatewayConfig.Timestamp, ShouldEqual, 6500000)
+
+	// No gateway configuration
+	option = &pb_broker.DownlinkOption{GatewayId: "router"}
+	setDownlinkTimestamp(option, metadata, metadata[1], 5)
+	a.So(option.GatewayConfig, ShouldBeNil)
+}
+
+func TestScheduleDownlinkWindow(t *testing.T) {
+	a := New(t)
+
+	defer func(tolerance time.Duration) {
+		DownlinkSkewTolerance = tolerance
+	}(DownlinkSkewTolerance)
+
+	uplinkTime := time.Unix(1500000000, 0)
+	var now time.Time
+	ns := &networkServer{clock: func() time.Time { return now }}
+
+	dev := &device.Device{ADR: device.ADRSettings{Band: pb_lorawan.FrequencyPlan_EU_863_870.String()}}
+	gateway := &pb_gateway.RxMetadata{GatewayId: "gateway", Timestamp: 1000}
+	message := &pb_broker.DeduplicatedUplinkMessage{ServerTime: uplinkTime.UnixNano()}
+	rx1Option := func() *pb_broker.DownlinkOption {
+		return &pb_broker.DownlinkOption{
+			GatewayId:     "gateway",
+			GatewayConfig: &pb_gateway.TxConfiguration{Timestamp: 1001000, Frequency: 868100000},
+			ProtocolConfig: &pb_protocol.TxConfiguration{Protocol: &pb_protocol.TxConfiguration_Lorawan{
+				Lorawan: &pb_lorawan.TxConfiguration{DataRate: "SF7BW125"},
+			}},
+		}
+	}
+
+	// RX1 is still ahead
+	now = uplinkTime.Add(500 * time.Millisecond)
+	option := rx1Option()
+	window, ok := ns.scheduleDownlinkWindow(message, option, gateway, dev)
+	a.So(ok, ShouldBeTrue)
+	a.So(window, ShouldEqual, 1)
+	a.So(option.GatewayConfig.Timestamp, ShouldEqual, 1001000)
+
+	// RX1 has passed, RX2 is chosen
+	now = uplinkTime.Add(1500 * time.Millisecond)
+	option = rx1Option()
+	window, ok = ns.scheduleDownlinkWindow(message, option, gateway, dev)
+	a.So(ok, ShouldBeTrue)
+	a.So(window, ShouldEqual, 2)
+	a.So(option.GatewayConfig.Timestamp, ShouldEqual, 2001000)
+	a.So(option.GatewayConfig.Frequency, ShouldEqual, 869525000)
+	a.So(option.GetProtocolConfig().GetLorawan().DataRate, ShouldEqual, "SF9BW125")
+
+	// Unless RX1 passed within the tolerance
+	DownlinkSkewTolerance = time.Second
+	option = rx1Option()
+	window, ok = ns.scheduleDownlinkWindow(message, option, gateway, dev)
+	a.So(ok, ShouldBeTrue)
+	a.So(window, ShouldEqual, 1)
+	DownlinkSkewTolerance = 0
+
+	// Both windows have passed
+	now = uplinkTime.Add(2500 * time.Millisecond)
+	_, ok = ns.scheduleDownlinkWindow(message, rx1Option(), gateway, dev)
+	a.So(ok, ShouldBeFalse)
+
+	// Without the server time, nothing is checked
+	window, ok = ns.scheduleDownlinkWindow(&pb_broker.DeduplicatedUplinkMessage{}, rx1Option(), gateway, dev)
+	a.So(ok, ShouldBeTrue)
+	a.So(window, ShouldEqual, 0)
+}
+
+func TestHandleUplinkClockSkew(t *testing.T) {
+	a := New(t)
+
+	uplinkTime := time.Unix(1500000000, 0)
+	now := uplinkTime.Add(1500 * time.Millisecond)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkClockSkew"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-clock-skew"),
+		clock:   func() time.Time { return now },
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	uplink := func() *pb_broker.DeduplicatedUplinkMessage {
+		message := uplinkMACInitMessage(appEUI, devEUI)
+		message.ServerTime = uplinkTime.UnixNano()
+		message.GatewayMetadata = []*pb_gateway.RxMetadata{
+			&pb_gateway.RxMetadata{GatewayId: "gateway", Timestamp: 1000},
+		}
+		message.ResponseTemplate.DownlinkOption = &pb_broker.DownlinkOption{
+			GatewayId:     "gateway",
+			GatewayConfig: &pb_gateway.TxConfiguration{Timestamp: 1001000},
+		}
+		return message
+	}
+
+	// RX1 is infeasible, so RX2 is used
+	res, err := ns.HandleUplink(uplink())
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate, ShouldNotBeNil)
+	a.So(res.ResponseTemplate.DownlinkOption.GatewayConfig.Timestamp, ShouldEqual, 2001000)
+	var window string
+	for _, trace := range res.Trace.Flatten() {
+		if trace.Event == downlinkWindowEvent {
+			window = trace.Metadata["window"]
+		}
+	}
+	a.So(window, ShouldEqual, "2")
+
+	// Both windows are infeasible, the downlink is dropped
+	now = uplinkTime.Add(3 * time.Second)
+	res, err = ns.HandleUplink(uplink())
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate, ShouldBeNil)
+}
+
+func TestDedupeGatewayMetadata(t *testing.T) {
+	a := New(t)
+
+	a.So(dedupeGatewayMetadata(nil), ShouldBeEmpty)
+
+	deduped := dedupeGatewayMetadata([]*pb_gateway.RxMetadata{
+		&pb_gateway.RxMetadata{GatewayId: "a", Snr: 1},
+		&pb_gateway.RxMetadata{GatewayId: "b", Snr: 2},
+		&pb_gateway.RxMetadata{GatewayId: "a", Snr: 5},
+		&pb_gateway.RxMetadata{GatewayId: "b", Snr: 0},
+		&pb_gateway.RxMetadata{},
+		&pb_gateway.RxMetadata{},
+	})
+	a.So(deduped, ShouldHaveLength, 4)
+	a.So(deduped[0].GatewayId, ShouldEqual, "a")
+	a.So(deduped[0].Snr, ShouldEqual, 5)
+	a.So(deduped[1].GatewayId, ShouldEqual, "b")
+	a.So(deduped[1].Snr, ShouldEqual, 2)
+}
+
+func TestHandleUplinkGatewayCount(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkGatewayCount"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-gateway-count"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	message := uplinkMACInitMessage(appEUI, devEUI, pb_lorawan.MACCommand{Cid: uint32(lorawan.LinkCheckReq)})
+	message.GatewayMetadata = []*pb_gateway.RxMetadata{
+		&pb_gateway.RxMetadata{GatewayId: "gw-1", Snr: 5},
+		&pb_gateway.RxMetadata{GatewayId: "gw-2", Snr: 3},
+		&pb_gateway.RxMetadata{GatewayId: "gw-1", Snr: 5},
+		&pb_gateway.RxMetadata{GatewayId: "gw-3", Snr: 1},
+	}
+	res, err := ns.HandleUplink(message)
+	a.So(err, ShouldBeNil)
+
+	// All distinct gateways are forwarded
+	a.So(res.GatewayMetadata, ShouldHaveLength, 3)
+
+	// And counted in the LinkCheckAns
+	fOpts := res.ResponseTemplate.Message.GetLorawan().GetMacPayload().FOpts
+	a.So(fOpts, ShouldHaveLength, 1)
+	var answer lorawan.LinkCheckAnsPayload
+	a.So(answer.UnmarshalBinary(fOpts[0].Payload), ShouldBeNil)
+	a.So(answer.GwCnt, ShouldEqual, 3)
+}
@@ -0,0 +1,79 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"sync"
+
+	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+)
+
+// GatewayTieBreakPolicy determines which gateway is selected for a downlink if multiple gateways received the
+// uplink with an equal signal
+type GatewayTieBreakPolicy string
+
+// Gateway tie-break policies
+const (
+	// FirstGateway selects the gateway that comes first in the metadata of the uplink
+	FirstGateway GatewayTieBreakPolicy = "first"
+	// LeastRecentlyUsedGateway selects the gateway that was selected the longest ago, which spreads the load
+	LeastRecentlyUsedGateway GatewayTieBreakPolicy = "lru"
+	// LeastUtilizedGateway selects the gateway with the lowest duty-cycle utilization, if the GatewayUtilization
+	// is a GatewayUtilizationReporter
+	LeastUtilizedGateway GatewayTieBreakPolicy = "utilization"
+)
+
+// GatewayTieBreak is the policy for gateways with an equal signal
+var GatewayTieBreak = FirstGateway
+
+// GatewayUtilizationReporter is a GatewayUtilization that also reports the duty-cycle utilization of a gateway,
+// as a fraction of its budget
+type GatewayUtilizationReporter interface {
+	GatewayUtilization
+	Utilization(gatewayID string) float64
+}
+
+type gatewayUsageCache struct {
+	sync.Mutex
+	sequence uint64
+	lastUsed map[string]uint64
+}
+
+// useDownlinkGateway records that the gateway was selected for a downlink
+func (n *networkServer) useDownlinkGateway(gatewayID string) {
+	n.gatewayUsage.Lock()
+	defer n.gatewayUsage.Unlock()
+	if n.gatewayUsage.lastUsed == nil {
+		n.gatewayUsage.lastUsed = make(map[string]uint64)
+	}
+	n.gatewayUsage.sequence++
+	n.gatewayUsage.lastUsed[gatewayID] = n.gatewayUsage.sequence
+}
+
+// breakGatewayTie selects one of the gateways with an equal signal according to the GatewayTieBreak policy.
+// Gateways that are equal according to the policy are selected in the order of the metadata.
+func (n *networkServer) breakGatewayTie(gateways []*pb_gateway.RxMetadata) *pb_gateway.RxMetadata {
+	selected := gateways[0]
+	switch GatewayTieBreak {
+	case LeastRecentlyUsedGateway:
+		n.gatewayUsage.Lock()
+		defer n.gatewayUsage.Unlock()
+		for _, gateway := range gateways[1:] {
+			if n.gatewayUsage.lastUsed[gateway.GatewayId] < n.gatewayUsage.lastUsed[selected.GatewayId] {
+				selected = gateway
+			}
+		}
+	case LeastUtilizedGateway:
+		reporter, ok := n.gatewayUtilization.(GatewayUtilizationReporter)
+		if !ok {
+			break
+		}
+		for _, gateway := range gateways[1:] {
+			if reporter.Utilization(gateway.GatewayId) < reporter.Utilization(selected.GatewayId) {
+				selected = gateway
+			}
+		}
+	}
+	return selected
+}
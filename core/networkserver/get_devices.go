@@ -4,16 +4,177 @@
 package networkserver
 
 import (
+	"fmt"
+	"sort"
+
 	pb "github.com/TheThingsNetwork/ttn/api/networkserver"
 	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
 	"github.com/TheThingsNetwork/ttn/utils/fcnt"
+	"github.com/brocaar/lorawan"
+)
+
+// FCntCheckMode determines which uplink frame counters are valid
+type FCntCheckMode string
+
+// Frame counter check modes
+const (
+	// FCntCheckWindow accepts frame counters that are equal to or higher than the stored one, up to MaxFCntGap higher
+	// if MaxFCntGap is set
+	FCntCheckWindow FCntCheckMode = "window"
+	// FCntCheckStrict only accepts frame counters that are higher than the stored one
+	FCntCheckStrict FCntCheckMode = "strict"
+	// FCntCheckRelaxed accepts frame counters that are equal to (retransmissions) or higher than the stored one
+	FCntCheckRelaxed FCntCheckMode = "relaxed"
+)
+
+// FCntCheck is the default frame counter check mode, devices can override it in their options
+var FCntCheck = FCntCheckWindow
+
+// ParseFCntCheckMode parses a frame counter check mode (strict, relaxed or window)
+func ParseFCntCheckMode(modeString string) (FCntCheckMode, error) {
+	switch mode := FCntCheckMode(modeString); mode {
+	case FCntCheckWindow, FCntCheckStrict, FCntCheckRelaxed:
+		return mode, nil
+	}
+	return "", errors.NewErrInvalidArgument("FCnt check mode", fmt.Sprintf("%s is not strict, relaxed or window", modeString))
+}
+
+// MaxFCntGap is the maximum gap between the stored and the uplink frame counter in the window mode (0 means no limit)
+var MaxFCntGap uint32
+
+func fCntCheckMode(dev *device.Device) FCntCheckMode {
+	if dev.Options.FCntCheckMode != "" {
+		return FCntCheckMode(dev.Options.FCntCheckMode)
+	}
+	return FCntCheck
+}
+
+// validFCnt returns whether the uplink frame counter is valid for the stored frame counter. As the stored
+// frame counter is 0 after activation, a frame counter of 0 is then also accepted in strict mode.
+func validFCnt(mode FCntCheckMode, stored uint32, fCnt uint32) bool {
+	switch mode {
+	case FCntCheckStrict:
+		return fCnt > stored || (stored == 0 && fCnt == 0)
+	case FCntCheckRelaxed:
+		return fCnt >= stored
+	default:
+		return fCnt >= stored && (MaxFCntGap == 0 || fCnt-stored <= MaxFCntGap)
+	}
+}
+
+func (n *networkServer) HandleGetDevice(appEUI types.AppEUI, devEUI types.DevEUI) (*device.Device, error) {
+	if err := validateEUIs(&appEUI, &devEUI); err != nil {
+		return nil, err
+	}
+	dev, err := n.devices.Get(appEUI, devEUI)
+	if err != nil {
+		return nil, err
+	}
+	dev.Usage = currentUsage(dev.Usage, n.now())
+	dev.MACState = dev.GetMACState()
+	n.restoreFCnt(dev)
+	return dev, nil
+}
+
+// MaxGetDevicesCandidates is the maximum number of devices with the same DevAddr that HandleGetDevices considers.
+// When there are more, the most recently seen devices are considered, as a silent device is the least likely to
+// be the sender of an uplink (0 means no limit).
+var MaxGetDevicesCandidates int
+
+// limitCandidates returns the most recently seen MaxGetDevicesCandidates devices
+func limitCandidates(devices []*device.Device) []*device.Device {
+	candidates := make([]*device.Device, 0, len(devices))
+	for _, dev := range devices {
+		if dev != nil {
+			candidates = append(candidates, dev)
+		}
+	}
+	if MaxGetDevicesCandidates <= 0 || len(candidates) <= MaxGetDevicesCandidates {
+		return candidates
+	}
+	sort.Stable(device.ByLastSeen(candidates))
+	return candidates[:MaxGetDevicesCandidates]
+}
+
+// ExposeAppSKey makes the network server store the AppSKey that is set through the device manager, and return it
+// in the results of HandleGetDevices, so that a combined handler does not need a second lookup. This must only be
+// enabled when the network server and handler are operated together, as the AppSKey is otherwise not for the
+// network server to know.
+var ExposeAppSKey bool
+
+// GetDevicesOptions are options for HandleGetDevices
+type GetDevicesOptions struct {
+	// IncludeInactive includes devices without an active session. These can not validate a MIC, so they
+	// are only useful for diagnostics.
+	IncludeInactive bool
+}
+
+// UnknownDevAddrPolicy determines what HandleGetDevices returns for a DevAddr that no device has
+type UnknownDevAddrPolicy string
+
+// Unknown DevAddr policies
+const (
+	// EmptyUnknownDevAddr returns an empty result, as for a DevAddr of which all devices are filtered out
+	EmptyUnknownDevAddr UnknownDevAddrPolicy = "empty"
+	// NotFoundUnknownDevAddr returns ErrUnknownDevAddr, so that the broker can tell an unknown DevAddr from a known
+	// DevAddr without a device that accepts the frame counter
+	NotFoundUnknownDevAddr UnknownDevAddrPolicy = "not-found"
 )
 
-func (n *networkServer) HandleGetDevices(req *pb.DevicesRequest) (*pb.DevicesResponse, error) {
+// UnknownDevAddr is the policy for DevAddrs that no device has
+var UnknownDevAddr = EmptyUnknownDevAddr
+
+// ErrUnknownDevAddr is returned by HandleGetDevices for a DevAddr that no device has, if UnknownDevAddr is
+// NotFoundUnknownDevAddr
+var ErrUnknownDevAddr = errors.NewErrNotFound("DevAddr")
+
+// activeSession returns whether the device has an active session
+func activeSession(dev *device.Device) bool {
+	return !dev.DevAddr.IsEmpty() && !dev.NwkSKey.IsEmpty()
+}
+
+// anyDevice returns whether the list contains a device, as ListForAddress returns nil for devices that are gone
+func anyDevice(devices []*device.Device) bool {
+	for _, dev := range devices {
+		if dev != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// activeDevices returns the devices with an active session
+func activeDevices(devices []*device.Device) []*device.Device {
+	active := make([]*device.Device, 0, len(devices))
+	for _, dev := range devices {
+		if dev != nil && activeSession(dev) {
+			active = append(active, dev)
+		}
+	}
+	return active
+}
+
+func (n *networkServer) HandleGetDevices(req *pb.DevicesRequest, options *GetDevicesOptions) (*pb.DevicesResponse, error) {
+	if req.DevAddr == nil {
+		return nil, errors.NewErrInvalidArgument("DevAddr", "missing")
+	}
 	devices, err := n.devices.ListForAddress(*req.DevAddr)
 	if err != nil {
 		return nil, err
 	}
+	if UnknownDevAddr == NotFoundUnknownDevAddr && !anyDevice(devices) {
+		return nil, ErrUnknownDevAddr
+	}
+
+	// Devices without an active session are filtered out before the candidates are limited, so that they do not
+	// take the place of devices that can be the sender of the uplink
+	if options == nil || !options.IncludeInactive {
+		devices = activeDevices(devices)
+	}
+	devices = limitCandidates(devices)
 
 	// Return all devices with DevAddr with FCnt <= fCnt or Security off
 
@@ -22,9 +183,7 @@ func (n *networkServer) HandleGetDevices(req *pb.DevicesRequest) (*pb.DevicesRes
 	}
 
 	for _, device := range devices {
-		if device == nil {
-			continue
-		}
+		n.restoreFCnt(device)
 		fullFCnt := fcnt.GetFull(device.FCntUp, uint16(req.FCnt))
 		dev := &pb_lorawan.Device{
 			AppEui:           &device.AppEUI,
@@ -36,14 +195,19 @@ func (n *networkServer) HandleGetDevices(req *pb.DevicesRequest) (*pb.DevicesRes
 			Uses32BitFCnt:    device.Options.Uses32BitFCnt,
 			DisableFCntCheck: device.Options.DisableFCntCheck,
 		}
+		if ExposeAppSKey && !device.AppSKey.IsEmpty() {
+			dev.AppSKey = &device.AppSKey
+		}
+		dev.SecurityPosture = dev.ComputeSecurityPosture()
 		if device.Options.DisableFCntCheck {
 			res.Results = append(res.Results, dev)
 			continue
 		}
-		if device.FCntUp <= req.FCnt {
+		mode := fCntCheckMode(device)
+		if validFCnt(mode, device.FCntUp, req.FCnt) {
 			res.Results = append(res.Results, dev)
 			continue
-		} else if device.Options.Uses32BitFCnt && device.FCntUp <= fullFCnt {
+		} else if device.Options.Uses32BitFCnt && validFCnt(mode, device.FCntUp, fullFCnt) {
 			res.Results = append(res.Results, dev)
 			continue
 		}
@@ -51,3 +215,63 @@ func (n *networkServer) HandleGetDevices(req *pb.DevicesRequest) (*pb.DevicesRes
 
 	return res, nil
 }
+
+// validMIC checks the MIC of an uplink with the NwkSKey of the device, first
+// with the 16-bit frame counter, then with the full 32-bit counter if the
+// device uses it
+func validMIC(phy *lorawan.PHYPayload, dev *device.Device) (bool, error) {
+	macPayload, ok := phy.MACPayload.(*lorawan.MACPayload)
+	if !ok {
+		return false, errors.NewErrInvalidArgument("Uplink", "does not contain a MAC payload")
+	}
+	nwkSKey := lorawan.AES128Key(dev.NwkSKey)
+
+	ok, err := phy.ValidateMIC(nwkSKey)
+	if err != nil || ok || !dev.Options.Uses32BitFCnt {
+		return ok, err
+	}
+
+	originalFCnt := macPayload.FHDR.FCnt
+	defer func() {
+		macPayload.FHDR.FCnt = originalFCnt
+	}()
+	macPayload.FHDR.FCnt = fcnt.GetFull(dev.FCntUp, uint16(originalFCnt))
+	if macPayload.FHDR.FCnt == originalFCnt {
+		return false, nil
+	}
+	return phy.ValidateMIC(nwkSKey)
+}
+
+func (n *networkServer) HandleGetDeviceForMIC(payload []byte) (*device.Device, error) {
+	var phy lorawan.PHYPayload
+	if err := phy.UnmarshalBinary(payload); err != nil {
+		return nil, errors.NewErrInvalidArgument("Uplink", err.Error())
+	}
+	macPayload, ok := phy.MACPayload.(*lorawan.MACPayload)
+	if !ok {
+		return nil, errors.NewErrInvalidArgument("Uplink", "does not contain a MAC payload")
+	}
+
+	devAddr := types.DevAddr(macPayload.FHDR.DevAddr)
+	devices, err := n.devices.ListForAddress(devAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dev := range devices {
+		if dev == nil {
+			continue
+		}
+		ok, err := validMIC(&phy, dev)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return dev, nil
+		}
+	}
+
+	n.countMICFailures(devices)
+
+	return nil, errors.NewErrNotFound(fmt.Sprintf("Device with DevAddr %s that validates MIC", devAddr))
+}
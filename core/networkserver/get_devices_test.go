@@ -5,11 +5,15 @@ package networkserver
 
 import (
 	"testing"
+	"time"
 
 	pb "github.com/TheThingsNetwork/ttn/api/networkserver"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
 	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
 	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
 	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
 	. "github.com/smartystreets/assertions"
 )
 
@@ -27,7 +31,7 @@ func TestHandleGetDevices(t *testing.T) {
 	res, err := ns.HandleGetDevices(&pb.DevicesRequest{
 		DevAddr: &devAddr1,
 		FCnt:    5,
-	})
+	}, nil)
 	a.So(err, ShouldBeNil)
 	a.So(res.Results, ShouldBeEmpty)
 
@@ -46,7 +50,7 @@ func TestHandleGetDevices(t *testing.T) {
 	res, err = ns.HandleGetDevices(&pb.DevicesRequest{
 		DevAddr: &devAddr1,
 		FCnt:    5,
-	})
+	}, nil)
 	a.So(err, ShouldBeNil)
 	a.So(res.Results, ShouldHaveLength, 1)
 
@@ -55,7 +59,7 @@ func TestHandleGetDevices(t *testing.T) {
 	res, err = ns.HandleGetDevices(&pb.DevicesRequest{
 		DevAddr: &devAddr2,
 		FCnt:    5,
-	})
+	}, nil)
 	a.So(err, ShouldBeNil)
 	a.So(res.Results, ShouldHaveLength, 0)
 
@@ -63,7 +67,7 @@ func TestHandleGetDevices(t *testing.T) {
 	res, err = ns.HandleGetDevices(&pb.DevicesRequest{
 		DevAddr: &devAddr1,
 		FCnt:    4,
-	})
+	}, nil)
 	a.So(err, ShouldBeNil)
 	a.So(res.Results, ShouldHaveLength, 0)
 
@@ -84,7 +88,7 @@ func TestHandleGetDevices(t *testing.T) {
 	res, err = ns.HandleGetDevices(&pb.DevicesRequest{
 		DevAddr: &devAddr2,
 		FCnt:    4,
-	})
+	}, nil)
 	a.So(err, ShouldBeNil)
 	a.So(res.Results, ShouldHaveLength, 1)
 
@@ -106,7 +110,7 @@ func TestHandleGetDevices(t *testing.T) {
 	res, err = ns.HandleGetDevices(&pb.DevicesRequest{
 		DevAddr: &devAddr3,
 		FCnt:    5,
-	})
+	}, nil)
 	a.So(err, ShouldBeNil)
 	a.So(res.Results, ShouldHaveLength, 1)
 
@@ -128,8 +132,471 @@ func TestHandleGetDevices(t *testing.T) {
 	res, err = ns.HandleGetDevices(&pb.DevicesRequest{
 		DevAddr: &devAddr4,
 		FCnt:    5,
-	})
+	}, nil)
+	a.So(err, ShouldBeNil)
+	a.So(res.Results, ShouldHaveLength, 1)
+
+}
+
+func TestHandleGetDeviceForMIC(t *testing.T) {
+	a := New(t)
+
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-get-device-for-mic"),
+	}
+
+	uplink := func(nwkSKey types.NwkSKey, fCnt uint32) []byte {
+		phy := lorawan.PHYPayload{
+			MHDR: lorawan.MHDR{
+				MType: lorawan.UnconfirmedDataUp,
+				Major: lorawan.LoRaWANR1,
+			},
+			MACPayload: &lorawan.MACPayload{
+				FHDR: lorawan.FHDR{
+					DevAddr: lorawan.DevAddr([4]byte{1, 2, 3, 4}),
+					FCnt:    fCnt,
+				},
+			},
+		}
+		phy.SetMIC(lorawan.AES128Key(nwkSKey))
+		bytes, _ := phy.MarshalBinary()
+		return bytes
+	}
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	for i := byte(1); i <= 3; i++ {
+		dev := &device.Device{
+			DevAddr: getDevAddr(1, 2, 3, 4),
+			AppEUI:  appEUI,
+			DevEUI:  types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, i)),
+			NwkSKey: types.NwkSKey{i, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8},
+		}
+		if i == 3 {
+			dev.FCntUp = 0x1fff0
+			dev.Options.Uses32BitFCnt = true
+		}
+		ns.devices.Set(dev)
+		defer func(devEUI types.DevEUI) {
+			ns.devices.Delete(appEUI, devEUI)
+		}(dev.DevEUI)
+	}
+
+	// Invalid payload
+	_, err := ns.HandleGetDeviceForMIC([]byte{})
+	a.So(err, ShouldNotBeNil)
+
+	// No device validates the MIC
+	_, err = ns.HandleGetDeviceForMIC(uplink(types.NwkSKey{9}, 1))
+	a.So(err, ShouldNotBeNil)
+
+	// One device validates the MIC
+	dev, err := ns.HandleGetDeviceForMIC(uplink(types.NwkSKey{2, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}, 1))
+	a.So(err, ShouldBeNil)
+	a.So(dev.DevEUI, ShouldEqual, types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 2)))
+
+	// 32-bit FCnt
+	dev, err = ns.HandleGetDeviceForMIC(uplink(types.NwkSKey{3, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}, 0x20005))
+	a.So(err, ShouldBeNil)
+	a.So(dev.DevEUI, ShouldEqual, types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 3)))
+}
+
+func TestValidFCnt(t *testing.T) {
+	a := New(t)
+
+	defer func(gap uint32) {
+		MaxFCntGap = gap
+	}(MaxFCntGap)
+	MaxFCntGap = 10
+
+	a.So(validFCnt(FCntCheckStrict, 5, 4), ShouldBeFalse)
+	a.So(validFCnt(FCntCheckStrict, 5, 5), ShouldBeFalse) // retransmission
+	a.So(validFCnt(FCntCheckStrict, 5, 6), ShouldBeTrue)
+	a.So(validFCnt(FCntCheckStrict, 0, 0), ShouldBeTrue) // after activation
+
+	a.So(validFCnt(FCntCheckRelaxed, 5, 4), ShouldBeFalse)
+	a.So(validFCnt(FCntCheckRelaxed, 5, 5), ShouldBeTrue) // retransmission
+	a.So(validFCnt(FCntCheckRelaxed, 5, 100), ShouldBeTrue)
+
+	a.So(validFCnt(FCntCheckWindow, 5, 4), ShouldBeFalse)
+	a.So(validFCnt(FCntCheckWindow, 5, 5), ShouldBeTrue) // retransmission
+	a.So(validFCnt(FCntCheckWindow, 5, 15), ShouldBeTrue)
+	a.So(validFCnt(FCntCheckWindow, 5, 16), ShouldBeFalse)
+
+	// Without MaxFCntGap, the window has no upper limit
+	MaxFCntGap = 0
+	a.So(validFCnt(FCntCheckWindow, 5, 4), ShouldBeFalse)
+	a.So(validFCnt(FCntCheckWindow, 5, 100000), ShouldBeTrue)
+}
+
+func TestParseFCntCheckMode(t *testing.T) {
+	a := New(t)
+
+	for _, mode := range []FCntCheckMode{FCntCheckWindow, FCntCheckStrict, FCntCheckRelaxed} {
+		parsed, err := ParseFCntCheckMode(string(mode))
+		a.So(err, ShouldBeNil)
+		a.So(parsed, ShouldEqual, mode)
+	}
+
+	_, err := ParseFCntCheckMode("strcit")
+	a.So(err, ShouldNotBeNil)
+	_, err = ParseFCntCheckMode("")
+	a.So(err, ShouldNotBeNil)
+}
+
+func TestHandleGetDevicesFCntCheckMode(t *testing.T) {
+	a := New(t)
+
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-get-devices-fcnt-check-mode"),
+	}
+
+	defer func(mode FCntCheckMode) {
+		FCntCheck = mode
+	}(FCntCheck)
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+	dev := &device.Device{
+		DevAddr: devAddr,
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		NwkSKey: types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8},
+		FCntUp:  5,
+	}
+	ns.devices.Set(dev)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// A retransmission of the last uplink
+	retransmission := func() []*pb_lorawan.Device {
+		res, err := ns.HandleGetDevices(&pb.DevicesRequest{
+			DevAddr: &devAddr,
+			FCnt:    5,
+		}, nil)
+		a.So(err, ShouldBeNil)
+		return res.Results
+	}
+
+	FCntCheck = FCntCheckWindow
+	a.So(retransmission(), ShouldHaveLength, 1)
+
+	FCntCheck = FCntCheckRelaxed
+	a.So(retransmission(), ShouldHaveLength, 1)
+
+	FCntCheck = FCntCheckStrict
+	a.So(retransmission(), ShouldHaveLength, 0)
+
+	// The device overrides the mode of the NetworkServer
+	dev.StartUpdate()
+	dev.Options.FCntCheckMode = string(FCntCheckRelaxed)
+	ns.devices.Set(dev)
+	a.So(retransmission(), ShouldHaveLength, 1)
+}
+
+func TestHandleGetDevicesInactive(t *testing.T) {
+	a := New(t)
+
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-get-devices-inactive"),
+	}
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+
+	active := &device.Device{
+		DevAddr: devAddr,
+		AppEUI:  appEUI,
+		DevEUI:  types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 1)),
+		NwkSKey: types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8},
+	}
+	inactive := &device.Device{
+		DevAddr: devAddr,
+		AppEUI:  appEUI,
+		DevEUI:  types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 2)),
+	}
+	for _, dev := range []*device.Device{active, inactive} {
+		ns.devices.Set(dev)
+		defer ns.devices.Delete(dev.AppEUI, dev.DevEUI)
+	}
+
+	req := &pb.DevicesRequest{DevAddr: &devAddr, FCnt: 1}
+
+	// Inactive devices are excluded by default
+	res, err := ns.HandleGetDevices(req, nil)
+	a.So(err, ShouldBeNil)
+	a.So(res.Results, ShouldHaveLength, 1)
+	a.So(*res.Results[0].DevEui, ShouldEqual, active.DevEUI)
+
+	res, err = ns.HandleGetDevices(req, &GetDevicesOptions{})
+	a.So(err, ShouldBeNil)
+	a.So(res.Results, ShouldHaveLength, 1)
+
+	// And included with the option
+	res, err = ns.HandleGetDevices(req, &GetDevicesOptions{IncludeInactive: true})
+	a.So(err, ShouldBeNil)
+	a.So(res.Results, ShouldHaveLength, 2)
+
+	// An inactive device that was seen more recently does not take the place of the active device
+	defer func(limit int) {
+		MaxGetDevicesCandidates = limit
+	}(MaxGetDevicesCandidates)
+	MaxGetDevicesCandidates = 1
+	inactive.StartUpdate()
+	inactive.LastSeen = time.Now()
+	ns.devices.Set(inactive)
+	res, err = ns.HandleGetDevices(req, nil)
+	a.So(err, ShouldBeNil)
+	a.So(res.Results, ShouldHaveLength, 1)
+	a.So(*res.Results[0].DevEui, ShouldEqual, active.DevEUI)
+}
+
+func TestHandleGetDevicesSecurityPosture(t *testing.T) {
+	a := New(t)
+
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-get-devices-security-posture"),
+	}
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+	nwkSKey := types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+
+	expected := map[types.DevEUI]string{}
+	for i, dev := range []*device.Device{
+		{NwkSKey: nwkSKey},
+		{NwkSKey: nwkSKey, Options: device.Options{DisableFCntCheck: true}},
+		{},
+	} {
+		dev.DevAddr = devAddr
+		dev.AppEUI = appEUI
+		dev.DevEUI = types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, byte(i)))
+		ns.devices.Set(dev)
+		defer ns.devices.Delete(dev.AppEUI, dev.DevEUI)
+		expected[dev.DevEUI] = []string{pb_lorawan.PostureSecure, pb_lorawan.PostureFCntCheckDisabled, pb_lorawan.PostureNoSession}[i]
+	}
+
+	res, err := ns.HandleGetDevices(&pb.DevicesRequest{DevAddr: &devAddr, FCnt: 1}, &GetDevicesOptions{IncludeInactive: true})
+	a.So(err, ShouldBeNil)
+	a.So(res.Results, ShouldHaveLength, 3)
+	for _, result := range res.Results {
+		a.So(result.SecurityPosture, ShouldEqual, expected[*result.DevEui])
+	}
+
+	// The posture is sent in the response
+	data, err := res.Marshal()
+	a.So(err, ShouldBeNil)
+	var received pb.DevicesResponse
+	a.So(received.Unmarshal(data), ShouldBeNil)
+	a.So(received.Results, ShouldHaveLength, 3)
+	for _, result := range received.Results {
+		a.So(result.SecurityPosture, ShouldEqual, expected[*result.DevEui])
+	}
+}
+
+func TestHandleGetDevicesCandidateLimit(t *testing.T) {
+	a := New(t)
+
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-get-devices-candidate-limit"),
+	}
+
+	defer func(limit int) {
+		MaxGetDevicesCandidates = limit
+	}(MaxGetDevicesCandidates)
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+	now := time.Now()
+
+	// Device i was last seen i hours ago
+	for i := byte(1); i <= 5; i++ {
+		dev := &device.Device{
+			DevAddr:  devAddr,
+			AppEUI:   appEUI,
+			DevEUI:   types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, i)),
+			NwkSKey:  types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8},
+			LastSeen: now.Add(-1 * time.Duration(i) * time.Hour),
+		}
+		ns.devices.Set(dev)
+		defer ns.devices.Delete(dev.AppEUI, dev.DevEUI)
+	}
+
+	req := &pb.DevicesRequest{DevAddr: &devAddr, FCnt: 1}
+
+	res, err := ns.HandleGetDevices(req, nil)
+	a.So(err, ShouldBeNil)
+	a.So(res.Results, ShouldHaveLength, 5)
+
+	// The most recently seen devices are returned
+	MaxGetDevicesCandidates = 2
+	res, err = ns.HandleGetDevices(req, nil)
+	a.So(err, ShouldBeNil)
+	a.So(res.Results, ShouldHaveLength, 2)
+	var devEUIs []types.DevEUI
+	for _, dev := range res.Results {
+		devEUIs = append(devEUIs, *dev.DevEui)
+	}
+	a.So(devEUIs, ShouldContain, types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 1)))
+	a.So(devEUIs, ShouldContain, types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 2)))
+}
+
+func TestHandleGetDevicesUnknownDevAddr(t *testing.T) {
+	a := New(t)
+
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-get-devices-unknown-devaddr"),
+	}
+
+	defer func(policy UnknownDevAddrPolicy) {
+		UnknownDevAddr = policy
+	}(UnknownDevAddr)
+
+	knownDevAddr := getDevAddr(1, 2, 3, 4)
+	unknownDevAddr := getDevAddr(5, 6, 7, 8)
+	dev := &device.Device{
+		DevAddr: knownDevAddr,
+		AppEUI:  types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8)),
+		DevEUI:  types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8)),
+		NwkSKey: types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8},
+		FCntUp:  5,
+	}
+	ns.devices.Set(dev)
+	defer ns.devices.Delete(dev.AppEUI, dev.DevEUI)
+
+	// By default, both are empty
+	res, err := ns.HandleGetDevices(&pb.DevicesRequest{DevAddr: &unknownDevAddr, FCnt: 5}, nil)
+	a.So(err, ShouldBeNil)
+	a.So(res.Results, ShouldBeEmpty)
+	res, err = ns.HandleGetDevices(&pb.DevicesRequest{DevAddr: &knownDevAddr, FCnt: 4}, nil)
+	a.So(err, ShouldBeNil)
+	a.So(res.Results, ShouldBeEmpty)
+
+	UnknownDevAddr = NotFoundUnknownDevAddr
+
+	// Unknown DevAddr
+	_, err = ns.HandleGetDevices(&pb.DevicesRequest{DevAddr: &unknownDevAddr, FCnt: 5}, nil)
+	a.So(err, ShouldEqual, ErrUnknownDevAddr)
+	a.So(errors.GetErrType(err), ShouldEqual, errors.NotFound)
+
+	// Known DevAddr, all devices filtered out by FCnt
+	res, err = ns.HandleGetDevices(&pb.DevicesRequest{DevAddr: &knownDevAddr, FCnt: 4}, nil)
+	a.So(err, ShouldBeNil)
+	a.So(res.Results, ShouldBeEmpty)
+}
+
+func TestHandleGetDevicesAppSKey(t *testing.T) {
+	a := New(t)
+
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-get-devices-app-s-key"),
+	}
+
+	defer func(expose bool) {
+		ExposeAppSKey = expose
+	}(ExposeAppSKey)
+
+	appSKey := types.AppSKey{8, 7, 6, 5, 4, 3, 2, 1, 8, 7, 6, 5, 4, 3, 2, 1}
+	dev := &device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8)),
+		DevEUI:  types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8)),
+		NwkSKey: types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8},
+		AppSKey: appSKey,
+	}
+	ns.devices.Set(dev)
+	defer ns.devices.Delete(dev.AppEUI, dev.DevEUI)
+
+	req := &pb.DevicesRequest{DevAddr: &dev.DevAddr, FCnt: 1}
+
+	// The AppSKey is not exposed by default
+	res, err := ns.HandleGetDevices(req, nil)
 	a.So(err, ShouldBeNil)
 	a.So(res.Results, ShouldHaveLength, 1)
+	a.So(res.Results[0].AppSKey, ShouldBeNil)
 
+	ExposeAppSKey = true
+	res, err = ns.HandleGetDevices(req, nil)
+	a.So(err, ShouldBeNil)
+	a.So(res.Results, ShouldHaveLength, 1)
+	a.So(res.Results[0].AppSKey, ShouldNotBeNil)
+	a.So(*res.Results[0].AppSKey, ShouldEqual, appSKey)
+}
+
+func TestHandleGetDevicesSessionSnapshot(t *testing.T) {
+	a := New(t)
+
+	ns := &networkServer{
+		devices: device.NewCachedStore(device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-get-devices-session-snapshot")),
+	}
+
+	defer func(messages uint32) {
+		FCntPersistMessages = messages
+	}(FCntPersistMessages)
+	FCntPersistMessages = 10
+
+	devAddr := getDevAddr(0, 0, 0, 9)
+	appEUI := types.AppEUI(getEUI(0, 0, 0, 0, 0, 0, 0, 9))
+	devEUI := types.DevEUI(getEUI(0, 0, 0, 0, 0, 0, 0, 9))
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// session sets a session with the key as the last byte of the NwkSKey
+	session := func(key byte, fCnt uint32) *device.Device {
+		dev, err := ns.devices.Get(appEUI, devEUI)
+		if err != nil {
+			dev = &device.Device{AppEUI: appEUI, DevEUI: devEUI, DevAddr: devAddr}
+		} else {
+			dev.StartUpdate()
+		}
+		dev.NwkSKey = types.NwkSKey{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, key}
+		dev.FCntUp = fCnt
+		dev.Options.DisableFCntCheck = true
+		a.So(ns.devices.Set(dev), ShouldBeNil)
+		return dev
+	}
+
+	getDevices := func() []*pb_lorawan.Device {
+		res, err := ns.HandleGetDevices(&pb.DevicesRequest{DevAddr: &devAddr}, nil)
+		a.So(err, ShouldBeNil)
+		return res.Results
+	}
+
+	// The frame counter of the first session is kept in memory
+	dev := session(1, 0)
+	ns.batchFCnt(dev)
+	dev.FCntUp = 5
+	ns.batchFCnt(dev)
+	results := getDevices()
+	a.So(results, ShouldHaveLength, 1)
+	a.So(results[0].FCntUp, ShouldEqual, 5)
+
+	// After a re-key with the same stored frame counter, the frame counter in memory does not belong to the key
+	session(2, 0)
+	results = getDevices()
+	a.So(results, ShouldHaveLength, 1)
+	a.So(results[0].NwkSKey[15], ShouldEqual, 2)
+	a.So(results[0].FCntUp, ShouldEqual, 0)
+
+	// Concurrent re-keys never result in a key with the frame counter of another session; in these sessions the
+	// frame counter is equal to the key
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for key := byte(3); key < 100; key++ {
+			session(key, uint32(key))
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		for _, result := range getDevices() {
+			a.So(result.FCntUp, ShouldEqual, uint32(result.NwkSKey[15]))
+		}
+	}
 }
@@ -0,0 +1,44 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/go-utils/log"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+)
+
+// IndexRepairInterval is the interval at which the DevAddr and DevEUI indexes are checked and repaired (0 means never)
+var IndexRepairInterval time.Duration
+
+func (n *networkServer) ScanAndRepairIndex() (*device.IndexRepair, error) {
+	repair, err := n.devices.ScanAndRepairIndex()
+	if err != nil {
+		return repair, err
+	}
+	if repair.Removed > 0 || repair.Added > 0 {
+		n.Ctx.WithFields(log.Fields{
+			"Removed": repair.Removed,
+			"Added":   repair.Added,
+		}).Warn("Repaired device indexes")
+	}
+	return repair, nil
+}
+
+// repairIndexEvery repairs the device indexes at the interval until stop is closed
+func (n *networkServer) repairIndexEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := n.ScanAndRepairIndex(); err != nil {
+				n.Ctx.WithError(err).Warn("Could not repair device indexes")
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestRepairIndexEvery(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{Ctx: GetLogger(t, "TestRepairIndexEvery")},
+		devices:   device.NewRedisDeviceStore(GetRedisClient(), "ns-test-repair-index-every"),
+		stop:      make(chan struct{}),
+	}
+
+	stop := ns.stop
+	done := make(chan struct{})
+	go func() {
+		ns.repairIndexEvery(time.Millisecond, stop)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ns.Shutdown()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("repairIndexEvery did not return after Shutdown")
+	}
+	a.So(ns.stop, ShouldBeNil)
+}
@@ -0,0 +1,17 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+)
+
+// ListDevicesByLastSeen lists the devices that were last seen before the given time and at or after the given
+// time. A zero time leaves that side of the range open, so ListDevicesByLastSeen(t, time.Time{}) returns the
+// devices that were not seen since t.
+func (n *networkServer) ListDevicesByLastSeen(before, after time.Time) ([]*device.Device, error) {
+	return n.devices.ListByLastSeen(before, after)
+}
@@ -0,0 +1,83 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestListDevicesByLastSeen(t *testing.T) {
+	a := New(t)
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestListDevicesByLastSeen"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-list-devices-by-last-seen"),
+		clock:   func() time.Time { return now },
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUIs := []types.DevEUI{
+		types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 1)),
+		types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 2)),
+		types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 3)),
+	}
+	for _, devEUI := range devEUIs {
+		ns.devices.Set(&device.Device{
+			DevAddr: getDevAddr(1, 2, 3, 4),
+			AppEUI:  appEUI,
+			DevEUI:  devEUI,
+		})
+		defer ns.devices.Delete(appEUI, devEUI)
+	}
+
+	touch := func(devEUI types.DevEUI) {
+		_, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+		a.So(err, ShouldBeNil)
+	}
+
+	list := func(before, after time.Time) []types.DevEUI {
+		devices, err := ns.ListDevicesByLastSeen(before, after)
+		a.So(err, ShouldBeNil)
+		res := make([]types.DevEUI, 0, len(devices))
+		for _, dev := range devices {
+			res = append(res, dev.DevEUI)
+		}
+		return res
+	}
+
+	// Devices that were never seen are not listed
+	a.So(list(time.Time{}, time.Time{}), ShouldBeEmpty)
+
+	start := now
+	touch(devEUIs[0])
+	now = now.Add(time.Hour)
+	touch(devEUIs[1])
+	now = now.Add(time.Hour)
+	touch(devEUIs[2])
+
+	a.So(list(time.Time{}, time.Time{}), ShouldHaveLength, 3)
+	a.So(list(start.Add(time.Hour), time.Time{}), ShouldResemble, []types.DevEUI{devEUIs[0]})
+	a.So(list(time.Time{}, start.Add(time.Hour)), ShouldHaveLength, 2)
+	a.So(list(start.Add(2*time.Hour), start.Add(time.Hour)), ShouldResemble, []types.DevEUI{devEUIs[1]})
+
+	// Touching a device moves it in the index
+	now = now.Add(time.Hour)
+	touch(devEUIs[0])
+	a.So(list(start.Add(time.Hour), time.Time{}), ShouldBeEmpty)
+	a.So(list(time.Time{}, start.Add(3*time.Hour)), ShouldResemble, []types.DevEUI{devEUIs[0]})
+
+	// Deleted devices are removed from the index
+	ns.devices.Delete(appEUI, devEUIs[0])
+	a.So(list(time.Time{}, start.Add(3*time.Hour)), ShouldBeEmpty)
+}
@@ -4,13 +4,79 @@
 package networkserver
 
 import (
+	"fmt"
 	"sort"
 
 	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+	"github.com/brocaar/lorawan"
 )
 
 const macCMD = "cmd" // For Tracing
 
+// LoRaWAN 1.1 MAC commands that are not defined in github.com/brocaar/lorawan
+const (
+	deviceModeInd  lorawan.CID = 0x20
+	deviceModeConf lorawan.CID = 0x20
+)
+
+// LoRaWAN 1.0.2 MAC commands that are not defined in github.com/brocaar/lorawan
+const (
+	txParamSetupReq lorawan.CID = 0x09
+	txParamSetupAns lorawan.CID = 0x09
+)
+
+// uplinkMACCommandLength contains the payload length of the uplink MAC commands that the NetworkServer knows
+var uplinkMACCommandLength = map[lorawan.CID]int{
+	lorawan.LinkCheckReq:     0,
+	lorawan.LinkADRAns:       1,
+	lorawan.DutyCycleAns:     0,
+	lorawan.RXParamSetupAns:  1,
+	lorawan.DevStatusAns:     2,
+	lorawan.NewChannelAns:    1,
+	lorawan.RXTimingSetupAns: 0,
+	txParamSetupAns:          0,
+	deviceModeInd:            1,
+}
+
+// uplinkFOpts returns the (unencrypted) FOpts bytes of an uplink PHYPayload
+func uplinkFOpts(phyPayload []byte) []byte {
+	// MHDR (1) | DevAddr (4) | FCtrl (1) | FCnt (2) | FOpts (0..15) | ... | MIC (4)
+	if len(phyPayload) < 12 {
+		return nil
+	}
+	fOptsLen := int(phyPayload[5] & 0x0f)
+	if len(phyPayload) < 12+fOptsLen {
+		return nil
+	}
+	return phyPayload[8 : 8+fOptsLen]
+}
+
+// parseUplinkFOpts splits the FOpts of an uplink into MAC commands. As the length of
+// unknown commands is not known, an unknown command gets the rest of the FOpts as
+// payload. If the FOpts end with a truncated command, the commands before it are
+// returned with an error.
+func parseUplinkFOpts(fOpts []byte) (cmds []pb_lorawan.MACCommand, err error) {
+	for len(fOpts) > 0 {
+		cid := lorawan.CID(fOpts[0])
+		length, ok := uplinkMACCommandLength[cid]
+		if !ok {
+			return append(cmds, pb_lorawan.MACCommand{Cid: uint32(cid), Payload: fOpts[1:]}), nil
+		}
+		if len(fOpts) < 1+length {
+			return cmds, errors.NewErrInvalidArgument("FOpts", fmt.Sprintf("truncated MAC command 0x%02x", byte(cid)))
+		}
+		cmd := pb_lorawan.MACCommand{Cid: uint32(cid)}
+		if length > 0 {
+			cmd.Payload = fOpts[1 : 1+length]
+		}
+		cmds = append(cmds, cmd)
+		fOpts = fOpts[1+length:]
+	}
+	return cmds, nil
+}
+
 type bySNR []*pb_gateway.RxMetadata
 
 func (a bySNR) Len() int           { return len(a) }
@@ -0,0 +1,61 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+)
+
+// MACOnlyDownlinkMode determines how a downlink that only carries MAC commands, and no application payload, is sent
+type MACOnlyDownlinkMode string
+
+// MAC-only downlink modes
+const (
+	// MACInFOpts sends the MAC commands in the FOpts of a frame without FPort and FRMPayload
+	MACInFOpts MACOnlyDownlinkMode = "fopts"
+	// MACInFRMPayload sends the MAC commands in the FRMPayload on FPort 0, encrypted with the NwkSKey
+	MACInFRMPayload MACOnlyDownlinkMode = "fport0"
+)
+
+// MACOnlyDownlinks is the default mode for downlinks that only carry MAC commands, devices can override it in
+// their options
+var MACOnlyDownlinks = MACInFOpts
+
+// noFPort is the FPort of a MACPayload without FPort and FRMPayload
+const noFPort = -1
+
+func macOnlyDownlinkMode(dev *device.Device) MACOnlyDownlinkMode {
+	if dev.Options.MACOnlyDownlinkMode != "" {
+		return MACOnlyDownlinkMode(dev.Options.MACOnlyDownlinkMode)
+	}
+	return MACOnlyDownlinks
+}
+
+// setMACOnlyDownlinkFPort sets the FPort of a downlink without application payload: an empty frame with MAC
+// commands in the FOpts has no FPort, MAC commands in the FRMPayload are sent on FPort 0. The FCnt of the
+// downlink must already be set, as it is used to encrypt the FRMPayload.
+func setMACOnlyDownlinkFPort(mac *pb_lorawan.MACPayload, dev *device.Device) error {
+	if len(mac.FrmPayload) != 0 || len(mac.FOpts) == 0 {
+		return nil
+	}
+	switch macOnlyDownlinkMode(dev) {
+	case MACInFRMPayload:
+		raw := make([]byte, 0, fOptsLength(mac.FOpts))
+		for _, cmd := range mac.FOpts {
+			raw = append(raw, byte(cmd.Cid))
+			raw = append(raw, cmd.Payload...)
+		}
+		frmPayload, err := encryptDownlinkFPort0(dev.NwkSKey, dev.DevAddr, mac.FCnt, raw)
+		if err != nil {
+			return err
+		}
+		mac.FPort = 0
+		mac.FOpts = nil
+		mac.FrmPayload = frmPayload
+	default:
+		mac.FPort = noFPort
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestHandleDownlinkMACOnly(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleDownlinkMACOnly"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "test-handle-downlink-mac-only"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+	nwkSKey := types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+	devStatusReq := pb_lorawan.MACCommand{Cid: uint32(lorawan.DevStatusReq)}
+
+	setup := func(options device.Options) {
+		dev := &device.Device{
+			DevAddr: devAddr,
+			AppEUI:  appEUI,
+			DevEUI:  devEUI,
+			NwkSKey: nwkSKey,
+			Options: options,
+		}
+		queueMACCommand(dev, lorawan.DevStatusReq, nil, false)
+		ns.devices.Set(dev)
+	}
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// downlink sends a downlink with the payload, which gets the queued DevStatusReq, and returns the resulting frame
+	downlink := func(payload []byte) *lorawan.MACPayload {
+		message := &pb_broker.DownlinkMessage{
+			AppEui:  &appEUI,
+			DevEui:  &devEUI,
+			Message: new(pb_protocol.Message),
+		}
+		mac := message.Message.InitLoRaWAN().InitDownlink()
+		mac.DevAddr = devAddr
+		mac.FPort = 1
+		mac.FrmPayload = payload
+		res, err := ns.HandleDownlink(message)
+		a.So(err, ShouldBeNil)
+		if res == nil {
+			return nil
+		}
+		var phy lorawan.PHYPayload
+		a.So(phy.UnmarshalBinary(res.Payload), ShouldBeNil)
+		return phy.MACPayload.(*lorawan.MACPayload)
+	}
+
+	// With an application payload, the FPort of the application is used
+	setup(device.Options{})
+	mac := downlink([]byte{1, 2, 3})
+	a.So(mac.FPort, ShouldNotBeNil)
+	a.So(*mac.FPort, ShouldEqual, 1)
+	a.So(mac.FHDR.FOpts, ShouldHaveLength, 1)
+
+	// macOnlyDownlink sends the response to an uplink with only MAC commands, which has the queued DevStatusReq
+	// and no application payload, and returns the resulting frame
+	macOnlyDownlink := func() *lorawan.MACPayload {
+		uplink, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+		a.So(err, ShouldBeNil)
+		template := uplink.ResponseTemplate
+		a.So(template.Message.GetLorawan().GetMacPayload().FOpts, ShouldResemble, []pb_lorawan.MACCommand{devStatusReq})
+		res, err := ns.HandleDownlink(template)
+		a.So(err, ShouldBeNil)
+		if res == nil {
+			return nil
+		}
+		var phy lorawan.PHYPayload
+		a.So(phy.UnmarshalBinary(res.Payload), ShouldBeNil)
+		return phy.MACPayload.(*lorawan.MACPayload)
+	}
+
+	// MAC commands in the FOpts of an empty frame are sent without FPort
+	setup(device.Options{})
+	mac = macOnlyDownlink()
+	a.So(mac.FPort, ShouldBeNil)
+	a.So(mac.FRMPayload, ShouldBeEmpty)
+	a.So(mac.FHDR.FOpts, ShouldHaveLength, 1)
+
+	// MAC commands in the FRMPayload are sent on FPort 0, encrypted with the NwkSKey
+	setup(device.Options{MACOnlyDownlinkMode: string(MACInFRMPayload)})
+	mac = macOnlyDownlink()
+	a.So(mac.FPort, ShouldNotBeNil)
+	a.So(*mac.FPort, ShouldEqual, 0)
+	a.So(mac.FHDR.FOpts, ShouldBeEmpty)
+	a.So(mac.FRMPayload, ShouldHaveLength, 1)
+	encrypted := mac.FRMPayload[0].(*lorawan.DataPayload).Bytes
+	raw, _ := encryptDownlinkFPort0(nwkSKey, devAddr, mac.FHDR.FCnt, encrypted)
+	a.So(raw, ShouldResemble, []byte{byte(lorawan.DevStatusReq)})
+
+	// The server default can also be changed
+	defer func(mode MACOnlyDownlinkMode) {
+		MACOnlyDownlinks = mode
+	}(MACOnlyDownlinks)
+	MACOnlyDownlinks = MACInFRMPayload
+	setup(device.Options{})
+	mac = macOnlyDownlink()
+	a.So(mac.FPort, ShouldNotBeNil)
+	a.So(*mac.FPort, ShouldEqual, 0)
+}
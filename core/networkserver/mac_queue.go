@@ -0,0 +1,171 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+	"github.com/brocaar/lorawan"
+)
+
+// maxFOptsLength is the maximum length of the FOpts field in bytes
+const maxFOptsLength = 15
+
+func fOptsLength(fOpts []pb_lorawan.MACCommand) (length int) {
+	for _, cmd := range fOpts {
+		length += 1 + len(cmd.Payload)
+	}
+	return
+}
+
+// MACCommandPriorities contains the priorities of downlink MAC commands by CID; commands without a priority have
+// priority 0. When not all queued commands fit in a downlink, the commands with the highest priority are sent
+// first, and commands with the same priority in the order in which they were queued.
+var MACCommandPriorities = map[lorawan.CID]int{}
+
+// ParseMACCommandPriority parses a MAC command priority in the cid=priority notation (0x03=1)
+func ParseMACCommandPriority(priorityString string) (cid lorawan.CID, priority int, err error) {
+	parts := strings.Split(priorityString, "=")
+	if len(parts) != 2 {
+		return cid, priority, errors.NewErrInvalidArgument("MAC command priority", "should be in cid=priority notation")
+	}
+	parsed, err := strconv.ParseUint(parts[0], 0, 8)
+	if err != nil {
+		return cid, priority, errors.NewErrInvalidArgument("MAC command priority", "CID should be a byte")
+	}
+	priority, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return cid, priority, errors.NewErrInvalidArgument("MAC command priority", "priority should be a number")
+	}
+	return lorawan.CID(parsed), priority, nil
+}
+
+// byPriority orders the indexes of a MAC command queue, the highest priority first
+type byPriority struct {
+	queue   []device.MACCommand
+	indexes []int
+}
+
+func (a byPriority) Len() int      { return len(a.indexes) }
+func (a byPriority) Swap(i, j int) { a.indexes[i], a.indexes[j] = a.indexes[j], a.indexes[i] }
+func (a byPriority) Less(i, j int) bool {
+	return a.queue[a.indexes[i]].Priority > a.queue[a.indexes[j]].Priority
+}
+
+// queueMACCommand adds a MAC command to the queue of the device, replacing a queued command with the same CID. The
+// command gets the priority that is configured for its CID in MACCommandPriorities.
+func queueMACCommand(dev *device.Device, cid lorawan.CID, payload []byte, sticky bool) {
+	cmd := device.MACCommand{CID: uint8(cid), Payload: payload, Sticky: sticky, Priority: MACCommandPriorities[cid]}
+	for i, queued := range dev.MACCommands {
+		if queued.CID == cmd.CID {
+			queue := make([]device.MACCommand, len(dev.MACCommands))
+			copy(queue, dev.MACCommands)
+			queue[i] = cmd
+			dev.MACCommands = queue
+			return
+		}
+	}
+	dev.MACCommands = append(dev.MACCommands[:len(dev.MACCommands):len(dev.MACCommands)], cmd)
+}
+
+// answerMACCommand removes the queued command that is answered by the device. In LoRaWAN, the
+// answer to a command has the same CID as the request.
+func answerMACCommand(dev *device.Device, cid lorawan.CID) {
+	var queue []device.MACCommand
+	for _, queued := range dev.MACCommands {
+		if queued.CID != uint8(cid) {
+			queue = append(queue, queued)
+		}
+	}
+	if len(queue) != len(dev.MACCommands) {
+		dev.MACCommands = queue
+	}
+}
+
+// confirmMACCommand removes the queued command that is accepted by the device, and keeps it as the last
+// confirmed command with its CID
+func confirmMACCommand(dev *device.Device, cid lorawan.CID) {
+	for _, queued := range dev.MACCommands {
+		if queued.CID != uint8(cid) {
+			continue
+		}
+		confirmed := make([]device.MACCommand, 0, len(dev.ConfirmedMACCommands)+1)
+		for _, cmd := range dev.ConfirmedMACCommands {
+			if cmd.CID != queued.CID {
+				confirmed = append(confirmed, cmd)
+			}
+		}
+		dev.ConfirmedMACCommands = append(confirmed, queued)
+	}
+	answerMACCommand(dev, cid)
+}
+
+// drainMACCommands appends the queued MAC commands of the device that fit in the FOpts, the highest priority first.
+// Commands that are already in the FOpts are skipped. Non-sticky commands are removed from the queue once they are
+// sent, sticky commands stay in the queue until they are answered.
+func drainMACCommands(dev *device.Device, fOpts []pb_lorawan.MACCommand) []pb_lorawan.MACCommand {
+	return drainMACCommandsWithin(dev, fOpts, maxFOptsLength)
+}
+
+// drainMACCommandsWithin is drainMACCommands with a lower maximum length of the FOpts
+func drainMACCommandsWithin(dev *device.Device, fOpts []pb_lorawan.MACCommand, maxLength int) []pb_lorawan.MACCommand {
+	if maxLength > maxFOptsLength {
+		maxLength = maxFOptsLength
+	}
+	if len(dev.MACCommands) == 0 {
+		return fOpts
+	}
+	length := fOptsLength(fOpts)
+	queue := make([]device.MACCommand, len(dev.MACCommands))
+	copy(queue, dev.MACCommands)
+	order := byPriority{queue: queue, indexes: make([]int, len(queue))}
+	for i := range order.indexes {
+		order.indexes[i] = i
+	}
+	sort.Stable(order)
+	drained := make([]bool, len(queue))
+	for _, i := range order.indexes {
+		queued := &queue[i]
+		var present bool
+		for _, cmd := range fOpts {
+			if cmd.Cid == uint32(queued.CID) {
+				present = true
+				break
+			}
+		}
+		if !present && length+1+len(queued.Payload) <= maxLength {
+			fOpts = append(fOpts, pb_lorawan.MACCommand{Cid: uint32(queued.CID), Payload: queued.Payload})
+			length += 1 + len(queued.Payload)
+			queued.Sent++
+			drained[i] = !queued.Sticky
+		}
+	}
+	var remaining []device.MACCommand
+	for i, queued := range queue {
+		if !drained[i] {
+			remaining = append(remaining, queued)
+		}
+	}
+	dev.MACCommands = remaining
+	return fOpts
+}
+
+// macCommandsDeferred returns whether the device has queued MAC commands that are not in the FOpts
+func macCommandsDeferred(dev *device.Device, fOpts []pb_lorawan.MACCommand) bool {
+queued:
+	for _, queued := range dev.MACCommands {
+		for _, cmd := range fOpts {
+			if cmd.Cid == uint32(queued.CID) {
+				continue queued
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,266 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestDrainMACCommands(t *testing.T) {
+	a := New(t)
+
+	dev := &device.Device{}
+	queueMACCommand(dev, lorawan.LinkADRReq, []byte{1, 2, 3, 4}, true)
+	queueMACCommand(dev, lorawan.DevStatusReq, nil, false)
+	queueMACCommand(dev, lorawan.NewChannelReq, []byte{1, 2, 3, 4, 5}, false)
+	queueMACCommand(dev, lorawan.RXTimingSetupReq, []byte{1}, false)
+	a.So(dev.MACCommands, ShouldHaveLength, 4)
+
+	// Queueing a command with the same CID replaces it
+	queueMACCommand(dev, lorawan.LinkADRReq, []byte{5, 6, 7, 8}, true)
+	a.So(dev.MACCommands, ShouldHaveLength, 4)
+	a.So(dev.MACCommands[0].Payload, ShouldResemble, []byte{5, 6, 7, 8})
+
+	// 2 + 5 + 1 + 6 bytes; the RXTimingSetupReq does not fit anymore
+	fOpts := drainMACCommands(dev, []pb_lorawan.MACCommand{{Cid: uint32(lorawan.LinkCheckAns), Payload: []byte{1}}})
+	a.So(fOpts, ShouldHaveLength, 4)
+	a.So(fOptsLength(fOpts), ShouldEqual, 14)
+
+	// The sticky command and the command that did not fit stay in the queue
+	a.So(dev.MACCommands, ShouldHaveLength, 2)
+	a.So(dev.MACCommands[0].CID, ShouldEqual, lorawan.LinkADRReq)
+	a.So(dev.MACCommands[1].CID, ShouldEqual, lorawan.RXTimingSetupReq)
+
+	// Commands that are already in the FOpts are not added again
+	fOpts = drainMACCommands(dev, []pb_lorawan.MACCommand{{Cid: uint32(lorawan.LinkADRReq), Payload: []byte{5, 6, 7, 8}}})
+	a.So(fOpts, ShouldHaveLength, 2)
+	a.So(dev.MACCommands, ShouldHaveLength, 1)
+
+	answerMACCommand(dev, lorawan.LinkADRReq)
+	a.So(dev.MACCommands, ShouldBeEmpty)
+}
+
+func TestDrainMACCommandsPriority(t *testing.T) {
+	a := New(t)
+
+	defer func(priorities map[lorawan.CID]int) {
+		MACCommandPriorities = priorities
+	}(MACCommandPriorities)
+	MACCommandPriorities = map[lorawan.CID]int{lorawan.DutyCycleReq: 2}
+
+	dev := &device.Device{}
+	queueMACCommand(dev, lorawan.NewChannelReq, []byte{1, 2, 3, 4, 5}, false)
+	queueMACCommand(dev, lorawan.LinkADRReq, []byte{1, 2, 3, 4}, true)
+	queueMACCommand(dev, lorawan.DutyCycleReq, []byte{1}, false)
+	a.So(dev.MACCommands[2].Priority, ShouldEqual, 2)
+
+	// 2 + 6 bytes; the LinkADRReq does not fit anymore
+	fOpts := drainMACCommandsWithin(dev, nil, 10)
+	a.So(fOpts, ShouldHaveLength, 2)
+	a.So(fOpts[0].Cid, ShouldEqual, uint32(lorawan.DutyCycleReq))
+	a.So(fOpts[1].Cid, ShouldEqual, uint32(lorawan.NewChannelReq))
+	a.So(dev.MACCommands, ShouldHaveLength, 1)
+	a.So(dev.MACCommands[0].CID, ShouldEqual, lorawan.LinkADRReq)
+
+	cid, priority, err := ParseMACCommandPriority("0x03=1")
+	a.So(err, ShouldBeNil)
+	a.So(cid, ShouldEqual, lorawan.LinkADRReq)
+	a.So(priority, ShouldEqual, 1)
+	_, _, err = ParseMACCommandPriority("0x100=1")
+	a.So(err, ShouldNotBeNil)
+	_, _, err = ParseMACCommandPriority("3")
+	a.So(err, ShouldNotBeNil)
+}
+
+func TestHandleUplinkMACCommandPriority(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkMACCommandPriority"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-mac-command-priority"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	// 6 + 5 + 5 bytes do not fit in the FOpts; the urgent RXParamSetupReq was queued last
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		MACCommands: []device.MACCommand{
+			{CID: uint8(lorawan.NewChannelReq), Payload: []byte{1, 2, 3, 4, 5}},
+			{CID: uint8(lorawan.LinkADRReq), Payload: []byte{1, 2, 3, 4}},
+			{CID: uint8(lorawan.RXParamSetupReq), Payload: []byte{1, 2, 3, 4}, Priority: 1},
+		},
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	res, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldBeNil)
+	mac := res.ResponseTemplate.Message.GetLorawan().GetMacPayload()
+	a.So(mac.FOpts, ShouldHaveLength, 2)
+	a.So(mac.FOpts[0].Cid, ShouldEqual, uint32(lorawan.RXParamSetupReq))
+	a.So(mac.FOpts[1].Cid, ShouldEqual, uint32(lorawan.NewChannelReq))
+	a.So(mac.FPending, ShouldBeTrue)
+
+	dev, err := ns.devices.Get(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(dev.MACCommands, ShouldHaveLength, 1)
+	a.So(dev.MACCommands[0].CID, ShouldEqual, lorawan.LinkADRReq)
+}
+
+func TestMACCommandQueue(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestMACCommandQueue"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-mac-command-queue"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+
+	dev := &device.Device{
+		DevAddr: devAddr,
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	}
+	queueMACCommand(dev, lorawan.LinkADRReq, []byte{0x51, 0xff, 0x00, 0x01}, true)
+	ns.devices.Set(dev)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	downlink := func() []pb_lorawan.MACCommand {
+		fPort := uint8(1)
+		phy := lorawan.PHYPayload{
+			MHDR: lorawan.MHDR{MType: lorawan.UnconfirmedDataDown, Major: lorawan.LoRaWANR1},
+			MACPayload: &lorawan.MACPayload{
+				FPort: &fPort,
+				FHDR:  lorawan.FHDR{DevAddr: lorawan.DevAddr(devAddr)},
+			},
+		}
+		bytes, _ := phy.MarshalBinary()
+		res, err := ns.HandleDownlink(&pb_broker.DownlinkMessage{
+			AppEui:  &appEUI,
+			DevEui:  &devEUI,
+			Payload: bytes,
+			DownlinkOption: &pb_broker.DownlinkOption{
+				ProtocolConfig: &pb_protocol.TxConfiguration{Protocol: &pb_protocol.TxConfiguration_Lorawan{
+					Lorawan: &pb_lorawan.TxConfiguration{},
+				}},
+			},
+		})
+		a.So(err, ShouldBeNil)
+		return res.Message.GetLorawan().GetMacPayload().FOpts
+	}
+
+	// The LinkADRReq is sent
+	fOpts := downlink()
+	a.So(fOpts, ShouldHaveLength, 1)
+	a.So(fOpts[0].Cid, ShouldEqual, uint32(lorawan.LinkADRReq))
+
+	// The device did not answer, so the LinkADRReq is sent again
+	fOpts = downlink()
+	a.So(fOpts, ShouldHaveLength, 1)
+	a.So(fOpts[0].Cid, ShouldEqual, uint32(lorawan.LinkADRReq))
+
+	stored, _ := ns.devices.Get(appEUI, devEUI)
+	a.So(stored.MACCommands, ShouldHaveLength, 1)
+
+	// The device acknowledges the LinkADRReq
+	_, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, pb_lorawan.MACCommand{
+		Cid:     uint32(lorawan.LinkADRAns),
+		Payload: []byte{0x07},
+	}))
+	a.So(err, ShouldBeNil)
+
+	stored, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(stored.MACCommands, ShouldBeEmpty)
+
+	a.So(downlink(), ShouldBeEmpty)
+}
+
+func TestHandleGetDeviceMACState(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleGetDeviceMACState"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-mac-state"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+	linkADRReq := []byte{0x51, 0xff, 0x00, 0x01}
+
+	dev := &device.Device{
+		DevAddr: devAddr,
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	}
+	queueMACCommand(dev, lorawan.LinkADRReq, linkADRReq, true)
+	ns.devices.Set(dev)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// The LinkADRReq is not sent yet
+	dev, err := ns.HandleGetDevice(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(dev.MACState, ShouldResemble, []device.MACCommandState{
+		{CID: uint8(lorawan.LinkADRReq), Payload: linkADRReq, Status: device.MACCommandQueued},
+	})
+
+	// The LinkADRReq is sent, but the device did not answer
+	message := &pb_broker.DownlinkMessage{
+		AppEui:  &appEUI,
+		DevEui:  &devEUI,
+		Message: new(pb_protocol.Message),
+	}
+	mac := message.Message.InitLoRaWAN().InitDownlink()
+	mac.DevAddr = devAddr
+	mac.FPort = 1
+	_, err = ns.HandleDownlink(message)
+	a.So(err, ShouldBeNil)
+
+	dev, err = ns.HandleGetDevice(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(dev.MACState, ShouldResemble, []device.MACCommandState{
+		{CID: uint8(lorawan.LinkADRReq), Payload: linkADRReq, Status: device.MACCommandPending, Sent: 1},
+	})
+
+	// The device accepts the LinkADRReq
+	_, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, pb_lorawan.MACCommand{
+		Cid:     uint32(lorawan.LinkADRAns),
+		Payload: []byte{0x07},
+	}))
+	a.So(err, ShouldBeNil)
+
+	dev, err = ns.HandleGetDevice(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(dev.MACState, ShouldResemble, []device.MACCommandState{
+		{CID: uint8(lorawan.LinkADRReq), Payload: linkADRReq, Status: device.MACCommandConfirmed, Sent: 1},
+	})
+}
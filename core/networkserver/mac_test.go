@@ -7,6 +7,8 @@ import (
 	"testing"
 
 	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/brocaar/lorawan"
 	. "github.com/smartystreets/assertions"
 )
 
@@ -26,3 +28,39 @@ func TestLinkMargin(t *testing.T) {
 	a := New(t)
 	a.So(linkMargin("SF7BW125", 4.3), ShouldEqual, 11.8)
 }
+
+func TestUplinkFOpts(t *testing.T) {
+	a := New(t)
+	a.So(uplinkFOpts(nil), ShouldBeNil)
+	a.So(uplinkFOpts([]byte{0x40, 4, 3, 2, 1, 0x00, 1, 0, 1, 2, 3, 4}), ShouldBeEmpty)
+	a.So(uplinkFOpts([]byte{0x40, 4, 3, 2, 1, 0x02, 1, 0, 0x03, 0x07, 1, 2, 3, 4}), ShouldResemble, []byte{0x03, 0x07})
+	a.So(uplinkFOpts([]byte{0x40, 4, 3, 2, 1, 0x0f, 1, 0, 1, 2, 3, 4}), ShouldBeNil) // FOptsLen longer than payload
+}
+
+func TestParseUplinkFOpts(t *testing.T) {
+	a := New(t)
+
+	// LinkCheckReq + DevStatusAns + LinkADRAns
+	cmds, err := parseUplinkFOpts([]byte{0x02, 0x06, 0xff, 0x05, 0x03, 0x07})
+	a.So(err, ShouldBeNil)
+	a.So(cmds, ShouldResemble, []pb_lorawan.MACCommand{
+		{Cid: uint32(lorawan.LinkCheckReq)},
+		{Cid: uint32(lorawan.DevStatusAns), Payload: []byte{0xff, 0x05}},
+		{Cid: uint32(lorawan.LinkADRAns), Payload: []byte{0x07}},
+	})
+
+	// Unknown command gets the rest of the FOpts
+	cmds, err = parseUplinkFOpts([]byte{0x02, 0x7f, 0x01, 0x02, 0x03, 0x07})
+	a.So(err, ShouldBeNil)
+	a.So(cmds, ShouldResemble, []pb_lorawan.MACCommand{
+		{Cid: uint32(lorawan.LinkCheckReq)},
+		{Cid: 0x7f, Payload: []byte{0x01, 0x02, 0x03, 0x07}},
+	})
+
+	// Truncated command
+	cmds, err = parseUplinkFOpts([]byte{0x02, 0x06, 0xff})
+	a.So(err, ShouldNotBeNil)
+	a.So(cmds, ShouldResemble, []pb_lorawan.MACCommand{
+		{Cid: uint32(lorawan.LinkCheckReq)},
+	})
+}
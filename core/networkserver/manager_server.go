@@ -34,6 +34,9 @@ func checkAppRights(claims *claims.Claims, appID string, right types.Right) erro
 }
 
 func (n *networkServerManager) getDevice(ctx context.Context, in *pb_lorawan.DeviceIdentifier) (*device.Device, error) {
+	if err := validateEUIs(in.AppEui, in.DevEui); err != nil {
+		return nil, err
+	}
 	if err := in.Validate(); err != nil {
 		return nil, errors.Wrap(err, "Invalid Device Identifier")
 	}
@@ -78,6 +81,7 @@ func (n *networkServerManager) GetDevice(ctx context.Context, in *pb_lorawan.Dev
 		DisableFCntCheck: dev.Options.DisableFCntCheck,
 		Uses32BitFCnt:    dev.Options.Uses32BitFCnt,
 		LastSeen:         lastSeen.UnixNano(),
+		LorawanVersion:   dev.MinorVersion.String(),
 	}, nil
 }
 
@@ -85,6 +89,10 @@ func (n *networkServerManager) SetDevice(ctx context.Context, in *pb_lorawan.Dev
 	if err := in.Validate(); err != nil {
 		return nil, errors.Wrap(err, "Invalid Device")
 	}
+	minorVersion, err := device.ParseMinorVersion(in.LorawanVersion)
+	if err != nil {
+		return nil, err
+	}
 
 	claims, err := n.networkServer.Component.ValidateTTNAuthContext(ctx)
 	if err != nil {
@@ -113,6 +121,7 @@ func (n *networkServerManager) SetDevice(ctx context.Context, in *pb_lorawan.Dev
 	dev.FCntUp = in.FCntUp
 	dev.FCntDown = in.FCntDown
 	dev.ADR = device.ADRSettings{Band: dev.ADR.Band, Margin: dev.ADR.Margin}
+	dev.MinorVersion = minorVersion
 
 	dev.Options = device.Options{
 		DisableFCntCheck:      in.DisableFCntCheck,
@@ -121,8 +130,16 @@ func (n *networkServerManager) SetDevice(ctx context.Context, in *pb_lorawan.Dev
 	}
 
 	if in.NwkSKey != nil && in.DevAddr != nil {
+		if dev.DevAddr != *in.DevAddr || dev.NwkSKey != *in.NwkSKey {
+			dev.SessionStartedAt = n.networkServer.now()
+			dev.SessionGraceDeadline = time.Time{}
+		}
 		dev.DevAddr = *in.DevAddr
 		dev.NwkSKey = *in.NwkSKey
+		dev.AppSKey = types.AppSKey{}
+		if ExposeAppSKey && in.AppSKey != nil {
+			dev.AppSKey = *in.AppSKey
+		}
 	}
 
 	err = n.networkServer.devices.Set(dev)
@@ -156,12 +173,14 @@ func (n *networkServerManager) DeleteDevice(ctx context.Context, in *pb_lorawan.
 
 func (n *networkServerManager) GetPrefixes(ctx context.Context, in *pb_lorawan.PrefixesRequest) (*pb_lorawan.PrefixesResponse, error) {
 	var mapping []*pb_lorawan.PrefixesResponse_PrefixMapping
+	n.networkServer.prefixesMu.RLock()
 	for prefix, usage := range n.networkServer.prefixes {
 		mapping = append(mapping, &pb_lorawan.PrefixesResponse_PrefixMapping{
 			Prefix: prefix.String(),
 			Usage:  usage,
 		})
 	}
+	n.networkServer.prefixesMu.RUnlock()
 	return &pb_lorawan.PrefixesResponse{
 		Prefixes: mapping,
 	}, nil
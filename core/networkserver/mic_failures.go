@@ -0,0 +1,68 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/go-utils/log"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+)
+
+// MICFailureWindow is the period over which the recent MIC failures of a device are counted
+var MICFailureWindow = time.Hour
+
+// MICFailureThreshold is the number of MIC failures in the MICFailureWindow at which an alert is emitted for a
+// device, as it may be cloned or its session keys may be out of sync (0 means never)
+var MICFailureThreshold uint64 = 10
+
+// MICFailureAlert is called when the MIC failures of a device in the MICFailureWindow reach the MICFailureThreshold
+type MICFailureAlert func(dev *device.Device, failures uint64)
+
+// SetMICFailureAlert sets the function that is called when the MIC failures of a device reach the
+// MICFailureThreshold. The alert is emitted once per window.
+func (n *networkServer) SetMICFailureAlert(alert MICFailureAlert) {
+	n.micFailureAlert = alert
+}
+
+// currentMICFailures returns the MIC failures of the device with the failures of the current window
+func currentMICFailures(failures device.MICFailures, now time.Time) device.MICFailures {
+	if failures.Since.IsZero() || !now.Before(failures.Since.Add(MICFailureWindow)) {
+		failures.Since = now
+		failures.Recent = 0
+	}
+	return failures
+}
+
+// countMICFailures counts a MIC failure for the devices with the DevAddr of an uplink that none of them could
+// validate. As it is not known which of the devices sent the uplink, it is counted for all devices with a session.
+func (n *networkServer) countMICFailures(devices []*device.Device) {
+	now := n.now()
+	for _, dev := range devices {
+		if dev == nil || dev.NwkSKey.IsEmpty() {
+			continue
+		}
+		dev.StartUpdate()
+		dev.MICFailures = currentMICFailures(dev.MICFailures, now)
+		dev.MICFailures.Total++
+		dev.MICFailures.Recent++
+		dev.MICFailures.Last = now
+		if err := n.devices.Set(dev, "mic_failures"); err != nil {
+			n.Ctx.WithError(err).Warn("Could not count MIC failure")
+			continue
+		}
+		if MICFailureThreshold == 0 || dev.MICFailures.Recent != MICFailureThreshold {
+			continue
+		}
+		n.Ctx.WithFields(log.Fields{
+			"AppEUI":   dev.AppEUI,
+			"DevEUI":   dev.DevEUI,
+			"Failures": dev.MICFailures.Recent,
+			"Window":   MICFailureWindow,
+		}).Warn("Device has many MIC failures, it may be cloned or its session keys may be out of sync")
+		if n.micFailureAlert != nil {
+			n.micFailureAlert(dev, dev.MICFailures.Recent)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestMICFailures(t *testing.T) {
+	a := New(t)
+	now := time.Now()
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestMICFailures"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-mic-failures"),
+		clock:   func() time.Time { return now },
+	}
+	ns.InitStatus()
+
+	defer func(threshold uint64, window time.Duration) {
+		MICFailureThreshold, MICFailureWindow = threshold, window
+	}(MICFailureThreshold, MICFailureWindow)
+	MICFailureThreshold, MICFailureWindow = 3, time.Hour
+
+	var alerts []uint64
+	ns.SetMICFailureAlert(func(dev *device.Device, failures uint64) {
+		alerts = append(alerts, failures)
+	})
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	nwkSKey := types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		NwkSKey: nwkSKey,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	uplink := func(nwkSKey types.NwkSKey) error {
+		phy := lorawan.PHYPayload{
+			MHDR: lorawan.MHDR{MType: lorawan.UnconfirmedDataUp, Major: lorawan.LoRaWANR1},
+			MACPayload: &lorawan.MACPayload{
+				FHDR: lorawan.FHDR{DevAddr: lorawan.DevAddr([4]byte{1, 2, 3, 4}), FCnt: 1},
+			},
+		}
+		phy.SetMIC(lorawan.AES128Key(nwkSKey))
+		bytes, _ := phy.MarshalBinary()
+		_, err := ns.HandleGetDeviceForMIC(bytes)
+		return err
+	}
+
+	failures := func() device.MICFailures {
+		dev, err := ns.HandleGetDevice(appEUI, devEUI)
+		a.So(err, ShouldBeNil)
+		return dev.MICFailures
+	}
+
+	// Valid uplinks are not counted
+	a.So(uplink(nwkSKey), ShouldBeNil)
+	a.So(failures().Total, ShouldEqual, 0)
+
+	// The alert is emitted when the failures reach the threshold
+	a.So(uplink(types.NwkSKey{9}), ShouldNotBeNil)
+	a.So(uplink(types.NwkSKey{9}), ShouldNotBeNil)
+	a.So(alerts, ShouldBeEmpty)
+	a.So(uplink(types.NwkSKey{9}), ShouldNotBeNil)
+	a.So(alerts, ShouldResemble, []uint64{3})
+	a.So(failures().Total, ShouldEqual, 3)
+	a.So(failures().Recent, ShouldEqual, 3)
+	a.So(failures().Last, ShouldHappenWithin, time.Millisecond, now)
+
+	// and only once per window
+	a.So(uplink(types.NwkSKey{9}), ShouldNotBeNil)
+	a.So(alerts, ShouldHaveLength, 1)
+
+	// In the next window, the recent failures start from 0
+	now = now.Add(time.Hour)
+	a.So(uplink(types.NwkSKey{9}), ShouldNotBeNil)
+	a.So(failures().Total, ShouldEqual, 5)
+	a.So(failures().Recent, ShouldEqual, 1)
+}
@@ -4,6 +4,10 @@
 package networkserver
 
 import (
+	"fmt"
+	"sync"
+	"time"
+
 	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
 	pb_handler "github.com/TheThingsNetwork/ttn/api/handler"
 	pb "github.com/TheThingsNetwork/ttn/api/networkserver"
@@ -11,6 +15,8 @@ import (
 	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
 	"github.com/TheThingsNetwork/ttn/core/types"
 	"github.com/TheThingsNetwork/ttn/utils/errors"
+	"github.com/rcrowley/go-metrics"
+	"golang.org/x/net/context" // See https://github.com/grpc/grpc-go/issues/711"
 	"gopkg.in/redis.v5"
 )
 
@@ -21,44 +27,259 @@ type NetworkServer interface {
 
 	UsePrefix(prefix types.DevAddrPrefix, usage []string) error
 	GetPrefixesFor(requiredUsages ...string) []types.DevAddrPrefix
+	GetPrefixUsage() ([]PrefixUsage, error)
+	GetPrefixConfig() ([]PrefixConfig, error)
+	GetActivationLatency() map[ActivationPhase]metrics.Histogram
+	GetDownlinkWindows() map[int]int64
+	SetPrefixDownlinkSettings(prefix types.DevAddrPrefix, settings DownlinkSettings) error
+
+	SetMACCommandHandler(handler MACCommandHandler)
+	SetGatewayUtilization(utilization GatewayUtilization)
+	SetQuotaPolicy(policy QuotaPolicy)
+	UseUplinkMiddleware(middleware ...UplinkMiddleware)
+	SetJoinAcceptKey(key JoinAcceptKeyFunc)
+	SetActivationAuditSink(sink ActivationAuditSink)
+	SetDevAddrCoordinator(coordinator DevAddrCoordinator)
+	SetFCntCeilingAlert(alert FCntCeilingAlert)
+	SetMICFailureAlert(alert MICFailureAlert)
+	SetConcurrencyLimit(limit int, policy ConcurrencyPolicy)
+	EncryptSessionKeys(masterKey []byte) error
+
+	ScanAndRepairIndex() (*device.IndexRepair, error)
+	BlockDevice(appEUI types.AppEUI, devEUI types.DevEUI) error
+	WithDeviceTransaction(fn func(devices device.Store) error) error
+	ResetFrameCounters(filter FrameCounterFilter) (int, error)
+	ListDevicesByLastSeen(before, after time.Time) ([]*device.Device, error)
+	ListDevicesByAppEUI(appEUI types.AppEUI, tags map[string]string) ([]*device.Device, error)
+	UpdateTags(appEUI types.AppEUI, devEUI types.DevEUI, tags map[string]string) error
+	Ready(ctx context.Context) error
+	UnblockDevice(appEUI types.AppEUI, devEUI types.DevEUI) error
 
-	HandleGetDevices(*pb.DevicesRequest) (*pb.DevicesResponse, error)
+	HandleGetDevice(appEUI types.AppEUI, devEUI types.DevEUI) (*device.Device, error)
+	GetDeviceSnapshot(appEUI types.AppEUI, devEUI types.DevEUI) (*DeviceSnapshot, error)
+	HandleGetDevices(*pb.DevicesRequest, *GetDevicesOptions) (*pb.DevicesResponse, error)
+	HandleGetDeviceForMIC(payload []byte) (*device.Device, error)
 	HandlePrepareActivation(*pb_broker.DeduplicatedDeviceActivationRequest) (*pb_broker.DeduplicatedDeviceActivationRequest, error)
 	HandleActivate(*pb_handler.DeviceActivationResponse) (*pb_handler.DeviceActivationResponse, error)
 	HandleUplink(*pb_broker.DeduplicatedUplinkMessage) (*pb_broker.DeduplicatedUplinkMessage, error)
+	InjectUplink(*pb_broker.DeduplicatedUplinkMessage) (*pb_broker.DeduplicatedUplinkMessage, error)
 	HandleDownlink(*pb_broker.DownlinkMessage) (*pb_broker.DownlinkMessage, error)
 }
 
+// DeviceCodec is the Codec with which the device store saves devices (nil to save the fields of devices separately)
+var DeviceCodec device.Codec
+
 // NewRedisNetworkServer creates a new Redis-backed NetworkServer
 func NewRedisNetworkServer(client *redis.Client, netID int) NetworkServer {
 	ns := &networkServer{
-		devices:  device.NewRedisDeviceStore(client, "ns"),
+		devices:  withDeviceCache(device.NewRedisDeviceStoreWithCodec(client, "ns", DeviceCodec)),
 		prefixes: map[types.DevAddrPrefix][]string{},
 	}
 	ns.netID = [3]byte{byte(netID >> 16), byte(netID >> 8), byte(netID)}
 	return ns
 }
 
+// NewRedisNetworkServerWithReplica creates a new Redis-backed NetworkServer that serves HandleGetDevices from a
+// read-only replica of the Redis database
+func NewRedisNetworkServerWithReplica(client, replica *redis.Client, netID int) NetworkServer {
+	ns := NewRedisNetworkServer(client, netID).(*networkServer)
+	ns.devices = withDeviceCache(device.NewRedisDeviceStoreWithReplica(client, replica, "ns", DeviceCodec))
+	return ns
+}
+
+// EncryptSessionKeys makes the NetworkServer encrypt the session keys of devices in the database with the
+// given master key
+func (n *networkServer) EncryptSessionKeys(masterKey []byte) error {
+	store := n.devices
+	if cache, ok := store.(*device.CachedStore); ok {
+		store = cache.Store
+	}
+	redisStore, ok := store.(*device.RedisDeviceStore)
+	if !ok {
+		return errors.NewErrInternal("Device store does not support encryption")
+	}
+	return redisStore.EncryptKeys(masterKey)
+}
+
+// WithDeviceTransaction runs fn with a device Store of which the writes are committed atomically when fn returns
+// without error, for example to re-provision a device by deleting it and creating a new one on the same DevAddr
+func (n *networkServer) WithDeviceTransaction(fn func(devices device.Store) error) error {
+	return n.devices.WithTransaction(fn)
+}
+
+// Ready checks that the device store can be reached right now, so that traffic is only sent to the network
+// server when it can handle it. Unlike the component status, this actively checks the database.
+func (n *networkServer) Ready(ctx context.Context) error {
+	res := make(chan error, 1)
+	go func() {
+		res <- n.devices.Ping()
+	}()
+	select {
+	case err := <-res:
+		if err != nil {
+			return errors.Wrap(err, "Device store is not reachable")
+		}
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "Device store is not reachable")
+	}
+}
+
 type networkServer struct {
 	*component.Component
 	devices  device.Store
 	netID    [3]byte
 	prefixes map[types.DevAddrPrefix][]string
 	status   *status
+
+	prefixDownlinkSettings map[types.DevAddrPrefix]DownlinkSettings
+	prefixesMu             sync.RWMutex // protects prefixes and prefixDownlinkSettings
+
+	macCommandHandler  MACCommandHandler
+	gatewayUtilization GatewayUtilization
+	quotaPolicy        QuotaPolicy
+	joinAcceptKey      JoinAcceptKeyFunc
+
+	activationAuditSink ActivationAuditSink
+	devAddrCoordinator  DevAddrCoordinator
+	fCntCeilingAlert    FCntCeilingAlert
+	micFailureAlert     MICFailureAlert
+
+	uplinkMiddleware []UplinkMiddleware
+
+	operations        chan struct{}
+	concurrencyPolicy ConcurrencyPolicy
+
+	fCnts        fCntCache
+	prefixUsage  prefixUsageCache
+	downlinks    downlinkDedupCache
+	gatewayUsage gatewayUsageCache
+
+	activationStarts activationStartCache
+
+	clock  func() time.Time
+	random randomSource
+
+	stop chan struct{} // Closed on Shutdown
+}
+
+// now returns the current time of the clock of the NetworkServer
+func (n *networkServer) now() time.Time {
+	if n.clock != nil {
+		return n.clock()
+	}
+	return time.Now()
+}
+
+// NetIDType is the type of the NetID of the network. If it is set, the NetID must be of this type and must not
+// have RFU bits set. If it is -1, the type is derived from the NetID, which is not validated.
+var NetIDType = -1
+
+// validateNetID checks that the NetID is of the configured NetIDType
+func (n *networkServer) validateNetID() error {
+	if NetIDType < 0 {
+		return nil
+	}
+	if NetIDType > 7 {
+		return errors.NewErrInvalidArgument("NetID type", fmt.Sprintf("%d is not in 0-7", NetIDType))
+	}
+	netID := types.NetID(n.netID)
+	if netID.Type() != NetIDType {
+		return errors.NewErrInvalidArgument("NetID", fmt.Sprintf("%s is of type %d instead of %d", netID, netID.Type(), NetIDType))
+	}
+	if err := netID.Validate(); err != nil {
+		return errors.NewErrInvalidArgument("NetID", err.Error())
+	}
+	return nil
+}
+
+// CheckJoinAcceptNetID makes HandlePrepareActivation check that the DevAddr of the JoinAccept has the type prefix
+// and NwkID of the NetID of the JoinAccept, as the device derives its network from the NetID
+var CheckJoinAcceptNetID = true
+
+// checkDevAddrNetID returns ErrJoinNetIDMismatch if the DevAddr is not of the NetID type and NwkID of the NetID
+func (n *networkServer) checkDevAddrNetID(devAddr types.DevAddr) error {
+	netID := types.NetID(n.netID)
+	if devAddr.NetIDType() != netID.Type() || devAddr.NwkID() != netID.NwkID() {
+		return ErrJoinNetIDMismatch
+	}
+	return nil
 }
 
+// UsePrefix registers a prefix for DevAddrs. The prefix has to be in the DevAddr prefix of the NetID, which
+// contains the type prefix and the NwkID of the NetID.
 func (n *networkServer) UsePrefix(prefix types.DevAddrPrefix, usage []string) error {
-	if prefix.Length < 7 {
+	if err := n.validateNetID(); err != nil {
+		return err
+	}
+	netIDPrefix := types.NetID(n.netID).DevAddrPrefix()
+	if prefix.Length < netIDPrefix.Length {
 		return errors.NewErrInvalidArgument("Prefix", "invalid length")
 	}
-	if prefix.DevAddr[0]>>1 != n.netID[2] {
+	if !prefix.DevAddr.HasPrefix(netIDPrefix) {
 		return errors.NewErrInvalidArgument("Prefix", "invalid netID")
 	}
+	n.prefixesMu.Lock()
 	n.prefixes[prefix] = usage
+	n.prefixesMu.Unlock()
+
+	// Make GetPrefixUsage include the new prefix
+	n.prefixUsage.Lock()
+	n.prefixUsage.usage = nil
+	n.prefixUsage.Unlock()
 	return nil
 }
 
+// DownlinkSettings are the default downlink settings for devices that are
+// activated with a DevAddr in a prefix
+type DownlinkSettings struct {
+	Rx1DrOffset uint32
+	Rx2Dr       uint32
+	RxDelay     uint32
+}
+
+func (n *networkServer) SetPrefixDownlinkSettings(prefix types.DevAddrPrefix, settings DownlinkSettings) error {
+	n.prefixesMu.Lock()
+	defer n.prefixesMu.Unlock()
+	if _, ok := n.prefixes[prefix]; !ok {
+		return errors.NewErrNotFound(fmt.Sprintf("Prefix %s", prefix))
+	}
+	if n.prefixDownlinkSettings == nil {
+		n.prefixDownlinkSettings = make(map[types.DevAddrPrefix]DownlinkSettings)
+	}
+	n.prefixDownlinkSettings[prefix] = settings
+	return nil
+}
+
+// getDownlinkSettings returns the downlink settings of the longest prefix of
+// the DevAddr that has them
+func (n *networkServer) getDownlinkSettings(devAddr types.DevAddr) (settings DownlinkSettings, ok bool) {
+	n.prefixesMu.RLock()
+	defer n.prefixesMu.RUnlock()
+	var length int
+	for prefix, prefixSettings := range n.prefixDownlinkSettings {
+		if devAddr.HasPrefix(prefix) && (!ok || prefix.Length > length) {
+			settings, length, ok = prefixSettings, prefix.Length, true
+		}
+	}
+	return
+}
+
+// getPrefix returns the longest registered prefix that contains the DevAddr
+func (n *networkServer) getPrefix(devAddr types.DevAddr) (prefix types.DevAddrPrefix, ok bool) {
+	n.prefixesMu.RLock()
+	defer n.prefixesMu.RUnlock()
+	for registered := range n.prefixes {
+		if devAddr.HasPrefix(registered) && (!ok || registered.Length > prefix.Length) {
+			prefix, ok = registered, true
+		}
+	}
+	return
+}
+
 func (n *networkServer) GetPrefixesFor(requiredUsages ...string) []types.DevAddrPrefix {
+	n.prefixesMu.RLock()
+	defer n.prefixesMu.RUnlock()
 	var suitablePrefixes []types.DevAddrPrefix
 	for prefix, offeredUsages := range n.prefixes {
 		matches := 0
@@ -79,12 +300,29 @@ func (n *networkServer) GetPrefixesFor(requiredUsages ...string) []types.DevAddr
 func (n *networkServer) Init(c *component.Component) error {
 	n.Component = c
 	n.InitStatus()
+	if err := n.validateNetID(); err != nil {
+		return err
+	}
 	err := n.Component.UpdateTokenKey()
 	if err != nil {
 		return err
 	}
+	if IndexRepairInterval > 0 {
+		n.stop = make(chan struct{})
+		go n.repairIndexEvery(IndexRepairInterval, n.stop)
+	}
+	if err := n.warmUpDeviceCache(); err != nil {
+		n.Ctx.WithError(err).Warn("Could not warm up device cache")
+	}
+	n.Component.SetReadinessCheck(n.Ready)
 	n.Component.SetStatus(component.StatusHealthy)
 	return nil
 }
 
-func (n *networkServer) Shutdown() {}
+// Shutdown stops the background work of the NetworkServer
+func (n *networkServer) Shutdown() {
+	if n.stop != nil {
+		close(n.stop)
+		n.stop = nil
+	}
+}
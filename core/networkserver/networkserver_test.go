@@ -5,9 +5,14 @@ package networkserver
 
 import (
 	"testing"
+	"time"
 
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
 	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
 	. "github.com/smartystreets/assertions"
+	"golang.org/x/net/context"
 	"gopkg.in/redis.v5"
 )
 
@@ -46,3 +51,111 @@ func TestUsePrefix(t *testing.T) {
 	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0x26, 0, 0, 0}), Length: 7}, []string{"otaa"}), ShouldBeNil)
 	a.So(ns.(*networkServer).prefixes, ShouldHaveLength, 1)
 }
+
+func TestUsePrefixNetIDTypes(t *testing.T) {
+	a := New(t)
+	var client redis.Client
+
+	// Type 3 NetID 60002D has NwkID 0x2D in 11 bits after the type prefix 1110
+	ns := NewRedisNetworkServer(&client, 0x60002d)
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0xe0, 0x5a, 0, 0}), Length: 15}, []string{"otaa"}), ShouldBeNil)
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0xe0, 0x5a, 0x80, 0}), Length: 17}, []string{"otaa"}), ShouldBeNil)
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0xe0, 0x5a, 0, 0}), Length: 14}, []string{"otaa"}), ShouldNotBeNil)
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0xe0, 0x5c, 0, 0}), Length: 15}, []string{"otaa"}), ShouldNotBeNil)
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0x5a, 0, 0, 0}), Length: 15}, []string{"otaa"}), ShouldNotBeNil)
+
+	// Allocated DevAddrs have the NwkID of the NetID
+	devAddr, err := ns.(*networkServer).getDevAddr("otaa")
+	a.So(err, ShouldBeNil)
+	a.So(devAddr.NetIDType(), ShouldEqual, 3)
+	a.So(devAddr.NwkID(), ShouldEqual, 0x2d)
+
+	// Type 6 NetID C00050 has NwkID 0x50 in 15 bits after the type prefix 1111110
+	ns = NewRedisNetworkServer(&client, 0xc00050)
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0xfc, 0x01, 0x40, 0}), Length: 22}, []string{"otaa"}), ShouldBeNil)
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0xfc, 0x01, 0x80, 0}), Length: 22}, []string{"otaa"}), ShouldNotBeNil)
+	devAddr, err = ns.(*networkServer).getDevAddr("otaa")
+	a.So(err, ShouldBeNil)
+	a.So(devAddr.NetIDType(), ShouldEqual, 6)
+	a.So(devAddr.NwkID(), ShouldEqual, 0x50)
+}
+
+func TestUsePrefixNetIDType(t *testing.T) {
+	a := New(t)
+	var client redis.Client
+
+	defer func(netIDType int) {
+		NetIDType = netIDType
+	}(NetIDType)
+
+	// Without NetID type, the NetID is not validated
+	ns := NewRedisNetworkServer(&client, 0x010213)
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0x26, 0, 0, 0}), Length: 7}, []string{"otaa"}), ShouldBeNil)
+
+	// Type 0 NetIDs only have a 6-bit NwkID, the other bits are RFU
+	NetIDType = 0
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0x26, 0, 0, 0}), Length: 7}, []string{"otaa"}), ShouldNotBeNil)
+	ns = NewRedisNetworkServer(&client, 0x000013)
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0x26, 0, 0, 0}), Length: 7}, []string{"otaa"}), ShouldBeNil)
+	devAddr, err := ns.(*networkServer).getDevAddr("otaa")
+	a.So(err, ShouldBeNil)
+	a.So(devAddr.NetIDType(), ShouldEqual, 0)
+	a.So(devAddr.NwkID(), ShouldEqual, 0x13)
+
+	// The NetID must be of the configured type
+	NetIDType = 1
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0x26, 0, 0, 0}), Length: 7}, []string{"otaa"}), ShouldNotBeNil)
+
+	// Type 1 NetID 20003F has NwkID 0x3F in 6 bits after the type prefix 10
+	ns = NewRedisNetworkServer(&client, 0x20003f)
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0xbf, 0, 0, 0}), Length: 8}, []string{"otaa"}), ShouldBeNil)
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0x26, 0, 0, 0}), Length: 7}, []string{"otaa"}), ShouldNotBeNil)
+	devAddr, err = ns.(*networkServer).getDevAddr("otaa")
+	a.So(err, ShouldBeNil)
+	a.So(devAddr.NetIDType(), ShouldEqual, 1)
+	a.So(devAddr.NwkID(), ShouldEqual, 0x3f)
+
+	// Type 3 NetIDs use all 21 bits of their ID
+	NetIDType = 3
+	ns = NewRedisNetworkServer(&client, 0x7f002d)
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0xe0, 0x5a, 0, 0}), Length: 15}, []string{"otaa"}), ShouldBeNil)
+	devAddr, err = ns.(*networkServer).getDevAddr("otaa")
+	a.So(err, ShouldBeNil)
+	a.So(devAddr.NetIDType(), ShouldEqual, 3)
+	a.So(devAddr.NwkID(), ShouldEqual, 0x2d)
+
+	NetIDType = 8
+	a.So(ns.UsePrefix(types.DevAddrPrefix{DevAddr: types.DevAddr([4]byte{0xe0, 0x5a, 0, 0}), Length: 15}, []string{"otaa"}), ShouldNotBeNil)
+}
+
+type unreachableStore struct {
+	device.Store
+	block chan struct{}
+}
+
+func (s *unreachableStore) Ping() error {
+	if s.block != nil {
+		<-s.block
+	}
+	return errors.New("connection refused")
+}
+
+func TestReady(t *testing.T) {
+	a := New(t)
+
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-ready"),
+	}
+	a.So(ns.Ready(context.Background()), ShouldBeNil)
+
+	ns.devices = &unreachableStore{}
+	a.So(ns.Ready(context.Background()), ShouldNotBeNil)
+
+	// A store that does not respond is not ready either
+	block := make(chan struct{})
+	defer close(block)
+	ns.devices = &unreachableStore{block: block}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	a.So(ns.Ready(ctx), ShouldNotBeNil)
+}
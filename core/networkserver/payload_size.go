@@ -0,0 +1,78 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"fmt"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	"github.com/TheThingsNetwork/ttn/core/band"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// txParams decodes the payload of a TxParamSetupReq
+func txParams(payload byte) device.TxParams {
+	return device.TxParams{
+		Set:               true,
+		DownlinkDwellTime: payload&(1<<5) != 0,
+		UplinkDwellTime:   payload&(1<<4) != 0,
+		MaxEIRP:           int(payload & 0x0f),
+	}
+}
+
+// downlinkDwellTime returns whether the downlink dwell time limit applies to the device. Until the device
+// accepted a TxParamSetupReq, the band defaults apply, which have the dwell time limit for AS923.
+func downlinkDwellTime(dev *device.Device) bool {
+	if !dev.TxParams.Set {
+		return true
+	}
+	return dev.TxParams.DownlinkDwellTime
+}
+
+// maxDownlinkPayloadSize returns the maximum MACPayload size for a downlink to the device at the given data rate
+func maxDownlinkPayloadSize(dev *device.Device, dataRate string) (int, error) {
+	fp, err := band.Get(dev.ADR.Band)
+	if err != nil {
+		return 0, err
+	}
+	drIdx, err := fp.GetDataRateIndexFor(dataRate)
+	if err != nil {
+		return 0, err
+	}
+	size, err := fp.GetMaxPayloadSizeFor(drIdx, downlinkDwellTime(dev))
+	if err != nil {
+		return 0, err
+	}
+	return size.M, nil
+}
+
+// downlinkPayloadLimit returns the maximum MACPayload size for the downlink. If the band of the device or the data
+// rate is not known, there is no limit.
+func downlinkPayloadLimit(message *pb_broker.DownlinkMessage, dev *device.Device) (maxSize int, ok bool) {
+	dataRate := message.GetDownlinkOption().GetProtocolConfig().GetLorawan().GetDataRate()
+	if dev.ADR.Band == "" || dataRate == "" {
+		return 0, false
+	}
+	maxSize, err := maxDownlinkPayloadSize(dev, dataRate)
+	if err != nil {
+		return 0, false
+	}
+	return maxSize, true
+}
+
+// validateDownlinkPayloadSize checks that the device can receive the downlink at the data rate of the downlink option.
+// If the band of the device or the data rate is not known, the payload size is not validated.
+func validateDownlinkPayloadSize(message *pb_broker.DownlinkMessage, dev *device.Device, phyPayloadSize int) error {
+	maxSize, ok := downlinkPayloadLimit(message, dev)
+	if !ok {
+		return nil
+	}
+	// MHDR (1) | MACPayload | MIC (4)
+	if size := phyPayloadSize - 5; size > maxSize {
+		dataRate := message.GetDownlinkOption().GetProtocolConfig().GetLorawan().GetDataRate()
+		return errors.NewErrInvalidArgument("Downlink", fmt.Sprintf("MACPayload of %d bytes exceeds the maximum of %d bytes at %s", size, maxSize, dataRate))
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestMaxDownlinkPayloadSize(t *testing.T) {
+	a := New(t)
+
+	dev := &device.Device{ADR: device.ADRSettings{Band: "AS_923"}}
+
+	// The band defaults apply: dwell time is limited
+	dwellTime, err := maxDownlinkPayloadSize(dev, "SF10BW125")
+	a.So(err, ShouldBeNil)
+
+	dev.TxParams = txParams(0x01) // No dwell time limits
+	noDwellTime, err := maxDownlinkPayloadSize(dev, "SF10BW125")
+	a.So(err, ShouldBeNil)
+	a.So(dwellTime, ShouldBeLessThan, noDwellTime)
+
+	dev.TxParams = txParams(0x21) // Downlink dwell time limit
+	a.So(dev.TxParams.DownlinkDwellTime, ShouldBeTrue)
+	a.So(dev.TxParams.UplinkDwellTime, ShouldBeFalse)
+	size, _ := maxDownlinkPayloadSize(dev, "SF10BW125")
+	a.So(size, ShouldEqual, dwellTime)
+
+	// Without dwell time limits in the band, the setting has no effect
+	dev.ADR.Band = "EU_863_870"
+	dev.TxParams = device.TxParams{}
+	dwellTime, _ = maxDownlinkPayloadSize(dev, "SF10BW125")
+	dev.TxParams = txParams(0x01)
+	noDwellTime, _ = maxDownlinkPayloadSize(dev, "SF10BW125")
+	a.So(dwellTime, ShouldEqual, noDwellTime)
+
+	// The downlink is validated against the limit
+	message := &pb_broker.DownlinkMessage{DownlinkOption: &pb_broker.DownlinkOption{
+		ProtocolConfig: &pb_protocol.TxConfiguration{Protocol: &pb_protocol.TxConfiguration_Lorawan{
+			Lorawan: &pb_lorawan.TxConfiguration{DataRate: "SF10BW125"},
+		}},
+	}}
+	dev.ADR.Band = "AS_923"
+	dev.TxParams = device.TxParams{}
+	a.So(validateDownlinkPayloadSize(message, dev, dwellTime+5), ShouldBeNil)
+	a.So(validateDownlinkPayloadSize(message, dev, dwellTime+6), ShouldNotBeNil)
+	dev.TxParams = txParams(0x01)
+	a.So(validateDownlinkPayloadSize(message, dev, dwellTime+6), ShouldBeNil)
+
+	// Unknown band
+	dev.ADR.Band = ""
+	a.So(validateDownlinkPayloadSize(message, dev, 1000), ShouldBeNil)
+}
+
+func TestHandleDownlinkPayloadSizeExceeded(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleDownlinkPayloadSizeExceeded"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-downlink-payload-size-exceeded"),
+	}
+	ns.InitStatus()
+
+	defer func(policy DownlinkPriorityPolicy) {
+		DownlinkPriority = policy
+	}(DownlinkPriority)
+	DownlinkPriority = PayloadFirst
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+
+	dev := &device.Device{
+		DevAddr:  devAddr,
+		AppEUI:   appEUI,
+		DevEUI:   devEUI,
+		FCntDown: 5,
+		ADR:      device.ADRSettings{Band: "AS_923"},
+	}
+	queueMACCommand(dev, lorawan.DevStatusReq, nil, false)
+	ns.devices.Set(dev)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	fPort := uint8(1)
+	phy := lorawan.PHYPayload{
+		MHDR: lorawan.MHDR{MType: lorawan.UnconfirmedDataDown, Major: lorawan.LoRaWANR1},
+		MACPayload: &lorawan.MACPayload{
+			FPort:      &fPort,
+			FHDR:       lorawan.FHDR{DevAddr: lorawan.DevAddr(devAddr)},
+			FRMPayload: []lorawan.Payload{&lorawan.DataPayload{Bytes: make([]byte, 200)}},
+		},
+	}
+	bytes, _ := phy.MarshalBinary()
+	_, err := ns.HandleDownlink(&pb_broker.DownlinkMessage{
+		AppEui:  &appEUI,
+		DevEui:  &devEUI,
+		Payload: bytes,
+		DownlinkOption: &pb_broker.DownlinkOption{
+			ProtocolConfig: &pb_protocol.TxConfiguration{Protocol: &pb_protocol.TxConfiguration_Lorawan{
+				Lorawan: &pb_lorawan.TxConfiguration{DataRate: "SF10BW125"},
+			}},
+		},
+	})
+	a.So(err, ShouldNotBeNil)
+
+	// The downlink that is not sent does not change the state of the device
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.FCntDown, ShouldEqual, 5)
+	a.So(dev.LastDownlink.IsZero(), ShouldBeTrue)
+	a.So(dev.MACCommands, ShouldHaveLength, 1)
+	a.So(dev.MACCommands[0].Sent, ShouldEqual, 0)
+}
+
+func TestHandleUplinkTxParamSetupAns(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkTxParamSetupAns"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-tx-param-setup-ans"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	dev := &device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	}
+	queueMACCommand(dev, txParamSetupReq, []byte{0x01}, true)
+	ns.devices.Set(dev)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	_, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, pb_lorawan.MACCommand{Cid: uint32(txParamSetupAns)}))
+	a.So(err, ShouldBeNil)
+
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.TxParams.Set, ShouldBeTrue)
+	a.So(dev.TxParams.DownlinkDwellTime, ShouldBeFalse)
+	a.So(dev.MACCommands, ShouldBeEmpty)
+}
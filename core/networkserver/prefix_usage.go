@@ -0,0 +1,94 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/types"
+)
+
+// PrefixUsage is the number of DevAddrs that are allocated in a prefix
+type PrefixUsage struct {
+	Prefix    types.DevAddrPrefix
+	Allocated int    // DevAddrs that are used by at least one device
+	Capacity  uint64 // DevAddrs in the prefix
+}
+
+// PrefixUsageCacheTime is how long the result of GetPrefixUsage is cached, as counting scans the DevAddr index
+var PrefixUsageCacheTime = time.Minute
+
+type prefixUsageCache struct {
+	sync.Mutex
+	usage   []PrefixUsage
+	updated time.Time
+}
+
+// GetPrefixUsage returns the number of allocated DevAddrs and the capacity of each prefix that is used
+func (n *networkServer) GetPrefixUsage() ([]PrefixUsage, error) {
+	n.prefixUsage.Lock()
+	defer n.prefixUsage.Unlock()
+
+	if n.prefixUsage.usage == nil || n.now().Sub(n.prefixUsage.updated) >= PrefixUsageCacheTime {
+		devAddrs, err := n.devices.ListDevAddrs()
+		if err != nil {
+			return nil, err
+		}
+		n.prefixesMu.RLock()
+		prefixes := make(byDevAddrPrefix, 0, len(n.prefixes))
+		for prefix := range n.prefixes {
+			prefixes = append(prefixes, prefix)
+		}
+		n.prefixesMu.RUnlock()
+		sort.Sort(prefixes)
+		usage := make([]PrefixUsage, len(prefixes))
+		for i, prefix := range prefixes {
+			usage[i] = PrefixUsage{Prefix: prefix, Capacity: 1 << uint(32-prefix.Length)}
+			for _, devAddr := range devAddrs {
+				if devAddr.HasPrefix(prefix) {
+					usage[i].Allocated++
+				}
+			}
+		}
+		n.prefixUsage.usage, n.prefixUsage.updated = usage, n.now()
+	}
+
+	usage := make([]PrefixUsage, len(n.prefixUsage.usage))
+	copy(usage, n.prefixUsage.usage)
+	return usage, nil
+}
+
+// PrefixConfig is the configuration of a prefix that is used, with its usage tags and utilization
+type PrefixConfig struct {
+	PrefixUsage
+	Usage            []string
+	DownlinkSettings *DownlinkSettings // Default downlink settings of the prefix, if any
+}
+
+// GetPrefixConfig returns the configuration of the prefixes that are used, sorted by prefix, so that operators
+// can verify their allocation setup at runtime
+func (n *networkServer) GetPrefixConfig() ([]PrefixConfig, error) {
+	usage, err := n.GetPrefixUsage()
+	if err != nil {
+		return nil, err
+	}
+
+	n.prefixesMu.RLock()
+	defer n.prefixesMu.RUnlock()
+	config := make([]PrefixConfig, 0, len(usage))
+	for _, prefixUsage := range usage {
+		tags, ok := n.prefixes[prefixUsage.Prefix]
+		if !ok {
+			continue
+		}
+		prefixConfig := PrefixConfig{PrefixUsage: prefixUsage, Usage: append([]string{}, tags...)}
+		if settings, ok := n.prefixDownlinkSettings[prefixUsage.Prefix]; ok {
+			prefixConfig.DownlinkSettings = &settings
+		}
+		config = append(config, prefixConfig)
+	}
+	return config, nil
+}
@@ -0,0 +1,102 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestGetPrefixUsage(t *testing.T) {
+	a := New(t)
+
+	now := time.Now()
+	ns := &networkServer{
+		netID: [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 8}:  []string{"otaa"},
+			types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x01, 0x00, 0x00}, Length: 16}: []string{"abp"},
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-get-prefix-usage"),
+		clock:   func() time.Time { return now },
+	}
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	for i, devAddr := range []types.DevAddr{
+		getDevAddr(0x26, 0x01, 0x00, 0x01),
+		getDevAddr(0x26, 0x01, 0x00, 0x01), // Same DevAddr as the first device
+		getDevAddr(0x26, 0x02, 0x00, 0x01),
+		getDevAddr(0x14, 0x00, 0x00, 0x01), // Outside the prefixes
+	} {
+		dev := &device.Device{AppEUI: appEUI, DevEUI: types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, byte(i))), DevAddr: devAddr}
+		a.So(ns.devices.Set(dev), ShouldBeNil)
+		defer ns.devices.Delete(dev.AppEUI, dev.DevEUI)
+	}
+
+	usage, err := ns.GetPrefixUsage()
+	a.So(err, ShouldBeNil)
+	a.So(usage, ShouldHaveLength, 2)
+	a.So(usage[0].Prefix.Length, ShouldEqual, 8)
+	a.So(usage[0].Allocated, ShouldEqual, 2)
+	a.So(usage[0].Capacity, ShouldEqual, 1<<24)
+	a.So(usage[1].Prefix.Length, ShouldEqual, 16)
+	a.So(usage[1].Allocated, ShouldEqual, 1)
+	a.So(usage[1].Capacity, ShouldEqual, 1<<16)
+
+	// The result is cached
+	dev := &device.Device{AppEUI: appEUI, DevEUI: types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 9)), DevAddr: getDevAddr(0x26, 0x01, 0x00, 0x02)}
+	a.So(ns.devices.Set(dev), ShouldBeNil)
+	defer ns.devices.Delete(dev.AppEUI, dev.DevEUI)
+
+	usage, _ = ns.GetPrefixUsage()
+	a.So(usage[1].Allocated, ShouldEqual, 1)
+
+	now = now.Add(PrefixUsageCacheTime)
+	usage, _ = ns.GetPrefixUsage()
+	a.So(usage[0].Allocated, ShouldEqual, 3)
+	a.So(usage[1].Allocated, ShouldEqual, 2)
+}
+
+func TestGetPrefixConfig(t *testing.T) {
+	a := New(t)
+
+	ns := &networkServer{
+		netID:    [3]byte{0x00, 0x00, 0x13},
+		prefixes: map[types.DevAddrPrefix][]string{},
+		devices:  device.NewRedisDeviceStore(GetRedisClient(), "ns-test-get-prefix-config"),
+	}
+
+	config, err := ns.GetPrefixConfig()
+	a.So(err, ShouldBeNil)
+	a.So(config, ShouldBeEmpty)
+
+	otaa := types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x00, 0x00, 0x00}, Length: 8}
+	abp := types.DevAddrPrefix{DevAddr: [4]byte{0x26, 0x01, 0x00, 0x00}, Length: 16}
+	a.So(ns.UsePrefix(otaa, []string{"otaa", "local"}), ShouldBeNil)
+	a.So(ns.UsePrefix(abp, []string{"abp"}), ShouldBeNil)
+	a.So(ns.SetPrefixDownlinkSettings(abp, DownlinkSettings{RxDelay: 5}), ShouldBeNil)
+
+	dev := &device.Device{AppEUI: types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 8, 1)), DevEUI: types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 8, 1)), DevAddr: getDevAddr(0x26, 0x01, 0x00, 0x01)}
+	a.So(ns.devices.Set(dev), ShouldBeNil)
+	defer ns.devices.Delete(dev.AppEUI, dev.DevEUI)
+
+	// Registering a prefix clears the cached usage
+	config, err = ns.GetPrefixConfig()
+	a.So(err, ShouldBeNil)
+	a.So(config, ShouldHaveLength, 2)
+	a.So(config[0].Prefix, ShouldResemble, otaa)
+	a.So(config[0].Usage, ShouldResemble, []string{"otaa", "local"})
+	a.So(config[0].DownlinkSettings, ShouldBeNil)
+	a.So(config[0].Allocated, ShouldEqual, 1)
+	a.So(config[1].Prefix, ShouldResemble, abp)
+	a.So(config[1].Usage, ShouldResemble, []string{"abp"})
+	a.So(config[1].DownlinkSettings, ShouldResemble, &DownlinkSettings{RxDelay: 5})
+	a.So(config[1].Allocated, ShouldEqual, 1)
+	a.So(config[1].Capacity, ShouldEqual, 1<<16)
+}
@@ -0,0 +1,66 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// MissingResponseTemplatePolicy determines what the NetworkServer does with uplinks that have no response template
+// while there are MAC commands to send to the device. The NetworkServer can not build a downlink option itself, as
+// only a Router can schedule a downlink on its gateway.
+type MissingResponseTemplatePolicy string
+
+// Missing response template policies
+const (
+	// DeferMissingResponseTemplate keeps the queued MAC commands for the next uplink with a response template
+	DeferMissingResponseTemplate MissingResponseTemplatePolicy = "defer"
+	// RejectMissingResponseTemplate rejects the uplink, which surfaces misconfigured Brokers and Routers
+	RejectMissingResponseTemplate MissingResponseTemplatePolicy = "strict"
+)
+
+// MissingResponseTemplate is the policy for uplinks without response template
+var MissingResponseTemplate = DeferMissingResponseTemplate
+
+// ErrMissingResponseTemplate is returned for uplinks without response template while there are MAC commands to
+// send, if the MissingResponseTemplate policy is strict
+var ErrMissingResponseTemplate = errors.NewErrInvalidArgument("Uplink", "no response template for pending MAC commands")
+
+// GuaranteeAcks makes the NetworkServer reject confirmed uplinks without response template with ErrAckUndeliverable,
+// instead of accepting uplinks of which the device never gets the ACK. Devices can also enable this in their options.
+var GuaranteeAcks bool
+
+// ErrAckUndeliverable is returned for confirmed uplinks without response template if the ACK is guaranteed
+var ErrAckUndeliverable = errors.NewErrInvalidArgument("Uplink", "no response template for the ACK of a confirmed uplink")
+
+// guaranteeAck returns whether the ACK of a confirmed uplink of the device must be sent without response template
+func guaranteeAck(dev *device.Device) bool {
+	return GuaranteeAcks || dev.Options.GuaranteeAck
+}
+
+// deferMACEvent is the trace event of MAC commands that are kept for a later downlink
+const deferMACEvent = "defer mac commands"
+
+// handleMissingResponseTemplate applies the MissingResponseTemplate policy to an uplink that came without response
+// template, if there are MAC commands to send to the device. The caller keeps the queued MAC commands. Confirmed
+// uplinks of which the ACK is guaranteed are rejected.
+func (n *networkServer) handleMissingResponseTemplate(message *pb_broker.DeduplicatedUplinkMessage, dev *device.Device) error {
+	mac := message.ResponseTemplate.GetMessage().GetLorawan().GetMacPayload()
+	if dev.Options.DownlinkDisabled || mac == nil {
+		return nil
+	}
+	if mac.Ack && message.GetMessage().GetLorawan().IsConfirmed() && guaranteeAck(dev) {
+		return ErrAckUndeliverable
+	}
+	if len(mac.FOpts) == 0 {
+		return nil
+	}
+	if MissingResponseTemplate == RejectMissingResponseTemplate {
+		return ErrMissingResponseTemplate
+	}
+	message.Trace = message.Trace.WithEvent(deferMACEvent, "reason", "missing response template")
+	return nil
+}
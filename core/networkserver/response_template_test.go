@@ -0,0 +1,177 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestHandleUplinkMissingResponseTemplate(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkMissingResponseTemplate"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-missing-response-template"),
+	}
+	ns.InitStatus()
+
+	defer func(policy MissingResponseTemplatePolicy) {
+		MissingResponseTemplate = policy
+	}(MissingResponseTemplate)
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		MACCommands: []device.MACCommand{
+			{CID: uint8(lorawan.DevStatusReq)},
+		},
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// uplink sends a LinkCheckReq without response template
+	uplink := func() (*pb_broker.DeduplicatedUplinkMessage, error) {
+		message := uplinkMACInitMessage(appEUI, devEUI, pb_lorawan.MACCommand{Cid: uint32(lorawan.LinkCheckReq)})
+		message.ResponseTemplate = nil
+		message.GatewayMetadata = []*pb_gateway.RxMetadata{
+			&pb_gateway.RxMetadata{GatewayId: "gateway", Timestamp: 1000, Frequency: 868100000},
+		}
+		return ns.HandleUplink(message)
+	}
+
+	// Strict: the uplink is rejected and the queued command is kept
+	MissingResponseTemplate = RejectMissingResponseTemplate
+	_, err := uplink()
+	a.So(err, ShouldEqual, ErrMissingResponseTemplate)
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	a.So(dev.MACCommands, ShouldHaveLength, 1)
+
+	// Defer: the uplink is accepted without response and the queued command is kept
+	MissingResponseTemplate = DeferMissingResponseTemplate
+	res, err := uplink()
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate, ShouldBeNil)
+	var deferred bool
+	for _, trace := range res.Trace.Flatten() {
+		if trace.Event == deferMACEvent {
+			deferred = true
+		}
+	}
+	a.So(deferred, ShouldBeTrue)
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.MACCommands, ShouldHaveLength, 1)
+	a.So(dev.MACCommands[0].CID, ShouldEqual, uint8(lorawan.DevStatusReq))
+	a.So(dev.MACCommands[0].Sent, ShouldEqual, 0)
+
+	// Strict: nothing to send, so the uplink is accepted without response
+	MissingResponseTemplate = RejectMissingResponseTemplate
+	dev.StartUpdate()
+	dev.MACCommands = nil
+	ns.devices.Set(dev)
+	message := uplinkMACInitMessage(appEUI, devEUI)
+	message.ResponseTemplate = nil
+	res, err = ns.HandleUplink(message)
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate, ShouldBeNil)
+}
+
+func TestHandleUplinkGuaranteeAck(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkGuaranteeAck"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-guarantee-ack"),
+	}
+	ns.InitStatus()
+
+	defer func(guarantee bool, policy MissingResponseTemplatePolicy) {
+		GuaranteeAcks, MissingResponseTemplate = guarantee, policy
+	}(GuaranteeAcks, MissingResponseTemplate)
+	MissingResponseTemplate = RejectMissingResponseTemplate
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	dev := &device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	}
+	ns.devices.Set(dev)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// uplink sends a confirmed uplink without response template
+	uplink := func() (*pb_broker.DeduplicatedUplinkMessage, error) {
+		message := uplinkMACInitMessage(appEUI, devEUI)
+		message.Message.GetLorawan().MType = pb_lorawan.MType_CONFIRMED_UP
+		message.ResponseTemplate = nil
+		message.GatewayMetadata = []*pb_gateway.RxMetadata{
+			&pb_gateway.RxMetadata{GatewayId: "gateway", Timestamp: 1000, Frequency: 868100000},
+		}
+		return ns.HandleUplink(message)
+	}
+
+	// Without guarantee, the ACK is lost
+	res, err := uplink()
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate, ShouldBeNil)
+
+	// The device guarantees the ACK: the uplink is rejected, as the ACK can not be sent
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	dev.StartUpdate()
+	dev.Options.GuaranteeAck = true
+	ns.devices.Set(dev)
+	_, err = uplink()
+	a.So(err, ShouldEqual, ErrAckUndeliverable)
+
+	// The NetworkServer guarantees the ACK for all devices
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	dev.StartUpdate()
+	dev.Options.GuaranteeAck = false
+	ns.devices.Set(dev)
+	GuaranteeAcks = true
+	_, err = uplink()
+	a.So(err, ShouldEqual, ErrAckUndeliverable)
+
+	// With a response template, the ACK is sent
+	message := uplinkMACInitMessage(appEUI, devEUI)
+	message.Message.GetLorawan().MType = pb_lorawan.MType_CONFIRMED_UP
+	message.GatewayMetadata = []*pb_gateway.RxMetadata{
+		&pb_gateway.RxMetadata{GatewayId: "gateway", Timestamp: 1000, Frequency: 868100000},
+	}
+	message.ResponseTemplate.DownlinkOption = &pb_broker.DownlinkOption{
+		GatewayId:     "gateway",
+		GatewayConfig: &pb_gateway.TxConfiguration{Timestamp: 1001000},
+	}
+	res, err = ns.HandleUplink(message)
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate, ShouldNotBeNil)
+	a.So(res.ResponseTemplate.Message.GetLorawan().GetMacPayload().Ack, ShouldBeTrue)
+
+	// Unconfirmed uplinks do not need an ACK
+	message = uplinkMACInitMessage(appEUI, devEUI)
+	message.ResponseTemplate = nil
+	res, err = ns.HandleUplink(message)
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate, ShouldBeNil)
+}
@@ -0,0 +1,77 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+	"github.com/brocaar/lorawan"
+)
+
+// RFUBitsPolicy determines how the NetworkServer treats uplinks that have reserved for future use (RFU) bits set.
+// The RFU bits of downlinks are always zero.
+type RFUBitsPolicy string
+
+// RFU bits policies
+const (
+	// IgnoreRFUBits masks the RFU bits of uplinks
+	IgnoreRFUBits RFUBitsPolicy = "ignore"
+	// RejectRFUBits rejects uplinks that have RFU bits set
+	RejectRFUBits RFUBitsPolicy = "reject"
+)
+
+// RFUBits is the policy for uplinks that have RFU bits set
+var RFUBits = IgnoreRFUBits
+
+// mhdrRFU are the RFU bits of the MHDR: MType (3) | RFU (3) | Major (2)
+const mhdrRFU = 0x1c
+
+// uplinkFCtrlRFU is the RFU bit of the FCtrl of uplinks: ADR | ADRACKReq | ACK | RFU | FOptsLen (4). In LoRaWAN
+// 1.1 the bit is ClassB, which the NetworkServer does not support. It is at the position of FPending in downlinks.
+const uplinkFCtrlRFU = 0x10
+
+// dlSettingsRFU is the RFU bit of the DLSettings of the RXParamSetupReq: RFU | RX1DROffset (3) | RX2DataRate (4)
+const dlSettingsRFU = 0x80
+
+// ErrRFUBitsSet is returned for uplinks that have RFU bits set if the RFUBits policy is to reject them
+var ErrRFUBitsSet = errors.NewErrInvalidArgument("Uplink", "RFU bits are set")
+
+// uplinkRFUBitsSet returns true if RFU bits are set in the MHDR or FCtrl of an uplink:
+// MHDR (1) | DevAddr (4) | FCtrl (1) | ...
+func uplinkRFUBitsSet(payload []byte, mac *pb_lorawan.MACPayload, dev *device.Device) bool {
+	if len(payload) > 0 && payload[0]&mhdrRFU != 0 {
+		return true
+	}
+	if dev.MinorVersion != device.LoRaWAN1_0 {
+		return false
+	}
+	return mac.FPending || (len(payload) > 5 && payload[5]&uplinkFCtrlRFU != 0)
+}
+
+// handleUplinkRFUBits rejects uplinks that have RFU bits set if the RFUBits policy is to reject them, and otherwise
+// masks the RFU bit of the FCtrl, which is decoded as FPending. The RFU bits of the MHDR are not decoded.
+func handleUplinkRFUBits(payload []byte, mac *pb_lorawan.MACPayload, dev *device.Device) error {
+	if RFUBits == RejectRFUBits && uplinkRFUBitsSet(payload, mac, dev) {
+		return ErrRFUBitsSet
+	}
+	mac.FPending = false
+	return nil
+}
+
+// zeroDownlinkRFUBits zeroes the RFU bits of a downlink. The FCtrl of downlinks is
+// ADR | RFU | ACK | FPending | FOptsLen (4), where the RFU bit is encoded from ADRACKReq. The RFU bits of the
+// MHDR and of the DLSettings of the JoinAccept are not encoded in the message, so they are always zero.
+func zeroDownlinkRFUBits(mac *pb_lorawan.MACPayload) {
+	mac.AdrAckReq = false
+	for i, cmd := range mac.FOpts {
+		if cmd.Cid != uint32(lorawan.RXParamSetupReq) || len(cmd.Payload) == 0 || cmd.Payload[0]&dlSettingsRFU == 0 {
+			continue
+		}
+		payload := make([]byte, len(cmd.Payload))
+		copy(payload, cmd.Payload)
+		payload[0] &^= dlSettingsRFU
+		mac.FOpts[i].Payload = payload
+	}
+}
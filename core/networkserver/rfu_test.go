@@ -0,0 +1,131 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestHandleUplinkRFUBits(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkRFUBits"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-rfu-bits"),
+	}
+	ns.InitStatus()
+
+	defer func(policy RFUBitsPolicy) {
+		RFUBits = policy
+	}(RFUBits)
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// uplink sends an uplink of which the MHDR and FCtrl have the given RFU bits set
+	var fCnt uint32
+	uplink := func(mhdrRFU, fCtrlRFU byte) (*pb_broker.DeduplicatedUplinkMessage, error) {
+		fCnt++
+		phy := lorawan.PHYPayload{
+			MHDR: lorawan.MHDR{MType: lorawan.UnconfirmedDataUp, Major: lorawan.LoRaWANR1},
+			MACPayload: &lorawan.MACPayload{
+				FHDR: lorawan.FHDR{DevAddr: lorawan.DevAddr([4]byte{1, 2, 3, 4}), FCnt: fCnt},
+			},
+		}
+		bytes, err := phy.MarshalBinary()
+		a.So(err, ShouldBeNil)
+		bytes[0] |= mhdrRFU
+		bytes[5] |= fCtrlRFU
+		message := uplinkMACInitMessage(appEUI, devEUI)
+		message.Message = nil
+		message.Payload = bytes
+		return ns.HandleUplink(message)
+	}
+
+	// The RFU bits are ignored when parsing
+	res, err := uplink(0x1c, 0x10)
+	a.So(err, ShouldBeNil)
+	mac := res.Message.GetLorawan().GetMacPayload()
+	a.So(mac.FCnt, ShouldEqual, 1)
+	a.So(mac.FPending, ShouldBeFalse)
+
+	// Uplinks with RFU bits are rejected
+	RFUBits = RejectRFUBits
+	_, err = uplink(0x04, 0)
+	a.So(err, ShouldEqual, ErrRFUBitsSet)
+	_, err = uplink(0, 0x10)
+	a.So(err, ShouldEqual, ErrRFUBitsSet)
+	_, err = uplink(0, 0)
+	a.So(err, ShouldBeNil)
+}
+
+func TestHandleDownlinkRFUBits(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-downlink-rfu-bits"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+
+	// RXParamSetupReq with the RFU bit of the DLSettings set, RX2 at 869.525 MHz
+	rxParamSetupReq := []byte{0x83, 0x52, 0xad, 0x84}
+	ns.devices.Set(&device.Device{
+		DevAddr: devAddr,
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		MACCommands: []device.MACCommand{
+			{CID: uint8(lorawan.RXParamSetupReq), Payload: rxParamSetupReq, Sticky: true},
+		},
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	message := &pb_broker.DownlinkMessage{
+		AppEui:  &appEUI,
+		DevEui:  &devEUI,
+		Message: new(pb_protocol.Message),
+	}
+	mac := message.Message.InitLoRaWAN().InitDownlink()
+	mac.DevAddr = devAddr
+	mac.FPort = 1
+	mac.FrmPayload = []byte{1, 2, 3}
+	mac.AdrAckReq = true
+
+	res, err := ns.HandleDownlink(message)
+	a.So(err, ShouldBeNil)
+
+	// MHDR (1) | DevAddr (4) | FCtrl (1) | FCnt (2) | FOpts: CID (1) | DLSettings (1) | Frequency (3) | ...
+	a.So(res.Payload[0]&0x1c, ShouldEqual, 0)
+	a.So(res.Payload[5]&0x40, ShouldEqual, 0)
+	a.So(res.Payload[8], ShouldEqual, byte(lorawan.RXParamSetupReq))
+	a.So(res.Payload[9], ShouldEqual, 0x03)
+
+	// The queued command is not changed
+	dev, err := ns.devices.Get(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(dev.MACCommands[0].Payload, ShouldResemble, rxParamSetupReq)
+}
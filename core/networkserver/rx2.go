@@ -0,0 +1,50 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	"github.com/TheThingsNetwork/ttn/core/band"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+)
+
+// dataRateName returns the name of the data rate index in the band, or an empty string if the band or the index
+// is not known
+func dataRateName(region string, drIdx int) string {
+	fp, err := band.Get(region)
+	if err != nil || drIdx < 0 || drIdx >= len(fp.DataRates) {
+		return ""
+	}
+	dataRate, err := fp.GetDataRateStringForIndex(drIdx)
+	if err != nil {
+		return ""
+	}
+	return dataRate
+}
+
+// setRX2Parameters sets the RX2 frequency and data rate of the band of the device in the option. The RX2
+// frequency and data rate of the session of the device override the ones of the band.
+func setRX2Parameters(option *pb_broker.DownlinkOption, dev *device.Device) {
+	fp, err := band.Get(dev.ADR.Band)
+	if option.GatewayConfig != nil {
+		switch {
+		case dev.RX2Frequency != 0:
+			option.GatewayConfig.Frequency = uint64(dev.RX2Frequency)
+		case err == nil:
+			option.GatewayConfig.Frequency = uint64(fp.RX2Frequency)
+		}
+	}
+	lorawan := option.GetProtocolConfig().GetLorawan()
+	if lorawan == nil {
+		return
+	}
+	switch {
+	case dev.RX2DataRate != "":
+		lorawan.DataRate = dev.RX2DataRate
+	case err == nil:
+		if dataRate, err := fp.GetDataRateStringForIndex(fp.RX2DataRate); err == nil {
+			lorawan.DataRate = dataRate
+		}
+	}
+}
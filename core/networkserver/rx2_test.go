@@ -0,0 +1,78 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestRX2Frequency(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestRX2Frequency"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-rx2-frequency"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	// RX2 on 869.1 MHz (8691000 * 100 Hz) with DR5
+	dev := &device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		ADR:     device.ADRSettings{Band: pb_lorawan.FrequencyPlan_EU_863_870.String()},
+	}
+	queueMACCommand(dev, lorawan.RXParamSetupReq, []byte{0x05, 0x38, 0x9d, 0x84}, true)
+	ns.devices.Set(dev)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	rx2 := func(dev *device.Device) *pb_broker.DownlinkOption {
+		option := &pb_broker.DownlinkOption{
+			GatewayConfig: &pb_gateway.TxConfiguration{Frequency: 868100000},
+			ProtocolConfig: &pb_protocol.TxConfiguration{Protocol: &pb_protocol.TxConfiguration_Lorawan{
+				Lorawan: &pb_lorawan.TxConfiguration{DataRate: "SF7BW125"},
+			}},
+		}
+		setRX2Parameters(option, dev)
+		return option
+	}
+
+	// Until the device accepts the RXParamSetupReq, the RX2 frequency and data rate of the band are used
+	option := rx2(dev)
+	a.So(option.GatewayConfig.Frequency, ShouldEqual, 869525000)
+	a.So(option.GetProtocolConfig().GetLorawan().DataRate, ShouldEqual, "SF9BW125")
+
+	_, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, pb_lorawan.MACCommand{
+		Cid:     uint32(lorawan.RXParamSetupAns),
+		Payload: []byte{0x07},
+	}))
+	a.So(err, ShouldBeNil)
+
+	dev, err = ns.devices.Get(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(dev.RX2Frequency, ShouldEqual, 869100000)
+	a.So(dev.RX2DataRate, ShouldEqual, "SF7BW125")
+	a.So(dev.MACCommands, ShouldBeEmpty)
+
+	option = rx2(dev)
+	a.So(option.GatewayConfig.Frequency, ShouldEqual, 869100000)
+	a.So(option.GetProtocolConfig().GetLorawan().DataRate, ShouldEqual, "SF7BW125")
+}
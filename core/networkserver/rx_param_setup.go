@@ -0,0 +1,40 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/brocaar/lorawan"
+)
+
+// rxParamSetupFrequency decodes the RX2 frequency (in Hz) of the payload of a RXParamSetupReq:
+// DLSettings (1) | Frequency (3, little-endian, in units of 100 Hz)
+func rxParamSetupFrequency(payload []byte) (uint32, bool) {
+	if len(payload) != 4 {
+		return 0, false
+	}
+	return (uint32(payload[1]) | uint32(payload[2])<<8 | uint32(payload[3])<<16) * 100, true
+}
+
+// handleRXParamSetupAns applies the RX2 frequency and data rate of the queued RXParamSetupReq to the device if the
+// device accepted all of the request
+func handleRXParamSetupAns(dev *device.Device, answer []byte) {
+	// Status: RFU (5 bits) | RX1DROffset ACK | RX2 Data rate ACK | Channel ACK
+	if len(answer) != 1 || answer[0]&0x07 != 0x07 {
+		answerMACCommand(dev, lorawan.RXParamSetupReq)
+		return
+	}
+	for _, queued := range dev.MACCommands {
+		if queued.CID != uint8(lorawan.RXParamSetupReq) {
+			continue
+		}
+		if frequency, ok := rxParamSetupFrequency(queued.Payload); ok {
+			dev.RX2Frequency = frequency
+			if dataRate := dataRateName(dev.ADR.Band, int(queued.Payload[0]&0x0f)); dataRate != "" {
+				dev.RX2DataRate = dataRate
+			}
+		}
+	}
+	confirmMACCommand(dev, lorawan.RXParamSetupReq)
+}
@@ -55,7 +55,7 @@ func (s *networkServerRPC) GetDevices(ctx context.Context, req *pb.DevicesReques
 	if err := req.Validate(); err != nil {
 		return nil, errors.Wrap(err, "Invalid Devices Request")
 	}
-	res, err := s.networkServer.HandleGetDevices(req)
+	res, err := s.networkServer.HandleGetDevices(req, &GetDevicesOptions{IncludeInactive: req.IncludeInactive})
 	if err != nil {
 		return nil, err
 	}
@@ -97,6 +97,11 @@ func (s *networkServerRPC) Uplink(ctx context.Context, message *broker.Deduplica
 	if err := message.Validate(); err != nil {
 		return nil, errors.Wrap(err, "Invalid Uplink")
 	}
+	release, err := s.networkServer.(*networkServer).acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 	res, err := s.networkServer.HandleUplink(message)
 	if err != nil {
 		return nil, err
@@ -111,6 +116,11 @@ func (s *networkServerRPC) Downlink(ctx context.Context, message *broker.Downlin
 	if err := message.Validate(); err != nil {
 		return nil, errors.Wrap(err, "Invalid Downlink")
 	}
+	release, err := s.networkServer.(*networkServer).acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 	res, err := s.networkServer.HandleDownlink(message)
 	if err != nil {
 		return nil, err
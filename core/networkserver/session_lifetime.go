@@ -0,0 +1,44 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// MaxSessionLifetime is the maximum age of a session. Uplinks of devices with an older session are rejected with
+// ErrSessionExpired until the device joins again, which forces it to use new session keys. Sessions without start
+// time, which were set up before it was recorded, do not expire. The lifetime is unlimited if 0.
+var MaxSessionLifetime time.Duration
+
+// SessionExpiryGracePeriod is how long uplinks of an expired session are still accepted, counted from the first
+// uplink after the session expired, so that the device stays reachable until it joins again. Uplinks are rejected
+// as soon as the session expired if 0.
+var SessionExpiryGracePeriod time.Duration
+
+// sessionGraceEvent is the trace event for uplinks of an expired session that are accepted in the grace period
+const sessionGraceEvent = "session expired, in grace period"
+
+// ErrSessionExpired is returned for uplinks of devices of which the session is older than the MaxSessionLifetime
+var ErrSessionExpired = errors.NewErrPermissionDenied("session expired, device must rejoin")
+
+// sessionExpired returns whether the session of the device is older than the MaxSessionLifetime
+func (n *networkServer) sessionExpired(dev *device.Device) bool {
+	if MaxSessionLifetime <= 0 || dev.SessionStartedAt.IsZero() {
+		return false
+	}
+	return !n.now().Before(dev.SessionStartedAt.Add(MaxSessionLifetime))
+}
+
+// sessionGraceDeadline returns until when uplinks of the expired session of the device are accepted, which is
+// SessionExpiryGracePeriod after the first uplink after the session expired
+func (n *networkServer) sessionGraceDeadline(dev *device.Device) time.Time {
+	if !dev.SessionGraceDeadline.IsZero() {
+		return dev.SessionGraceDeadline
+	}
+	return n.now().Add(SessionExpiryGracePeriod)
+}
@@ -0,0 +1,151 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	pb_handler "github.com/TheThingsNetwork/ttn/api/handler"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestHandleUplinkSessionLifetime(t *testing.T) {
+	a := New(t)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkSessionLifetime"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-session-lifetime"),
+		clock:   func() time.Time { return now },
+	}
+	ns.InitStatus()
+
+	defer func(lifetime time.Duration) {
+		MaxSessionLifetime = lifetime
+	}(MaxSessionLifetime)
+	MaxSessionLifetime = 24 * time.Hour
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+
+	ns.devices.Set(&device.Device{
+		AppEUI: appEUI,
+		DevEUI: devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	activate := func(key byte) {
+		var nwkSKey types.NwkSKey
+		nwkSKey[15] = key
+		_, err := ns.HandleActivate(&pb_handler.DeviceActivationResponse{
+			ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+				Lorawan: &pb_lorawan.ActivationMetadata{
+					AppEui:  &appEUI,
+					DevEui:  &devEUI,
+					DevAddr: &devAddr,
+					NwkSKey: &nwkSKey,
+				},
+			}},
+		})
+		a.So(err, ShouldBeNil)
+	}
+
+	activate(1)
+	dev, err := ns.devices.Get(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(dev.SessionStartedAt.Equal(now), ShouldBeTrue)
+
+	_, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldBeNil)
+
+	// The session expired, so the device must join again
+	now = now.Add(24 * time.Hour)
+	_, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldEqual, ErrSessionExpired)
+
+	activate(2)
+	_, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldBeNil)
+
+	// Sessions are not limited if there is no lifetime
+	now = now.Add(48 * time.Hour)
+	MaxSessionLifetime = 0
+	_, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldBeNil)
+}
+
+func TestHandleUplinkSessionGracePeriod(t *testing.T) {
+	a := New(t)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkSessionGracePeriod"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-session-grace-period"),
+		clock:   func() time.Time { return now },
+	}
+	ns.InitStatus()
+
+	defer func(lifetime, grace time.Duration) {
+		MaxSessionLifetime, SessionExpiryGracePeriod = lifetime, grace
+	}(MaxSessionLifetime, SessionExpiryGracePeriod)
+	MaxSessionLifetime = 24 * time.Hour
+	SessionExpiryGracePeriod = time.Hour
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		AppEUI:           appEUI,
+		DevEUI:           devEUI,
+		DevAddr:          getDevAddr(1, 2, 3, 4),
+		SessionStartedAt: now,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// The grace period starts with the first uplink after the session expired
+	now = now.Add(48 * time.Hour)
+	res, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldBeNil)
+	var deadline string
+	for _, trace := range res.Trace.Flatten() {
+		if trace.Event == sessionGraceEvent {
+			deadline = trace.Metadata["deadline"]
+		}
+	}
+	a.So(deadline, ShouldNotBeEmpty)
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	a.So(dev.SessionGraceDeadline.Equal(now.Add(time.Hour)), ShouldBeTrue)
+
+	// Uplinks are accepted within the grace period
+	now = now.Add(59 * time.Minute)
+	_, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldBeNil)
+
+	// And rejected after it
+	now = now.Add(time.Minute)
+	_, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldEqual, ErrSessionExpired)
+
+	// Without grace period, uplinks are rejected immediately
+	SessionExpiryGracePeriod = 0
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	dev.SessionGraceDeadline = time.Time{}
+	a.So(ns.devices.Set(dev), ShouldBeNil)
+	_, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldEqual, ErrSessionExpired)
+}
@@ -0,0 +1,36 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import "github.com/TheThingsNetwork/ttn/core/networkserver/device"
+
+// ReportSkippedFrames makes the NetworkServer count the frames that are skipped when an uplink has a higher frame
+// counter than the next expected one. Such uplinks are accepted within the frame counter window either way, but
+// a lot of skipped frames indicates a lossy link.
+var ReportSkippedFrames = false
+
+// skippedFramesEvent is the trace event for uplinks after skipped frames
+const skippedFramesEvent = "skipped frames"
+
+// skippedFrames returns the number of frames between the stored and the new frame counter
+func skippedFrames(stored, fCnt uint32) uint32 {
+	if fCnt <= stored || fCnt-stored == 1 {
+		return 0
+	}
+	return fCnt - stored - 1
+}
+
+// countSkippedFrames counts the frames that the device skipped if ReportSkippedFrames is set, and returns the number
+func (n *networkServer) countSkippedFrames(dev *device.Device, stored, fCnt uint32) uint32 {
+	if !ReportSkippedFrames {
+		return 0
+	}
+	skipped := skippedFrames(stored, fCnt)
+	if skipped == 0 {
+		return 0
+	}
+	n.status.skippedFrames.Inc(int64(skipped))
+	n.Ctx.WithField("DevEUI", dev.DevEUI).WithField("Skipped", skipped).Warn("Device skipped frames")
+	return skipped
+}
@@ -0,0 +1,79 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestSkippedFrames(t *testing.T) {
+	a := New(t)
+	a.So(skippedFrames(0, 0), ShouldEqual, 0)
+	a.So(skippedFrames(1, 2), ShouldEqual, 0)
+	a.So(skippedFrames(2, 2), ShouldEqual, 0)
+	a.So(skippedFrames(2, 1), ShouldEqual, 0)
+	a.So(skippedFrames(2, 6), ShouldEqual, 3)
+	a.So(skippedFrames(1<<32-1, 1<<32-1), ShouldEqual, 0)
+}
+
+func TestHandleUplinkSkippedFrames(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkSkippedFrames"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-skipped-frames"),
+	}
+	ns.InitStatus()
+
+	defer func(report bool) {
+		ReportSkippedFrames = report
+	}(ReportSkippedFrames)
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	uplink := func(fCnt uint32) {
+		message := uplinkMACInitMessage(appEUI, devEUI)
+		message.Message.GetLorawan().GetMacPayload().FCnt = fCnt
+		_, err := ns.HandleUplink(message)
+		a.So(err, ShouldBeNil)
+	}
+
+	// Skipped frames are not counted by default
+	uplink(1)
+	uplink(3)
+	a.So(ns.status.skippedFrames.Count(), ShouldEqual, 0)
+
+	ReportSkippedFrames = true
+	uplink(4)
+	a.So(ns.status.skippedFrames.Count(), ShouldEqual, 0)
+
+	// The gap of 5, 6 and 7 is counted
+	uplink(8)
+	a.So(ns.status.skippedFrames.Count(), ShouldEqual, 3)
+
+	// Retransmissions do not skip frames
+	uplink(8)
+	uplink(9)
+	a.So(ns.status.skippedFrames.Count(), ShouldEqual, 3)
+
+	uplink(19)
+	a.So(ns.status.skippedFrames.Count(), ShouldEqual, 12)
+}
@@ -0,0 +1,42 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+)
+
+// DeviceSnapshot is the state of a single device at one point in time, for a backup of the device or for a
+// support bundle. The Device contains the session keys, frame counters, ADR, RX and channel settings, MAC
+// commands, options and usage. It can be serialized with encoding/json.
+type DeviceSnapshot struct {
+	Time   time.Time       `json:"time"`
+	Device *device.Device  `json:"device"`
+	Frames []*device.Frame `json:"frames,omitempty"` // Recent uplinks that are used for ADR, the newest first
+}
+
+// GetDeviceSnapshot returns the state of a device. The device is returned in the same way as by HandleGetDevice,
+// with its usage in the current window, the state of its MAC commands and the frame counter in memory.
+func (n *networkServer) GetDeviceSnapshot(appEUI types.AppEUI, devEUI types.DevEUI) (*DeviceSnapshot, error) {
+	dev, err := n.HandleGetDevice(appEUI, devEUI)
+	if err != nil {
+		return nil, err
+	}
+	history, err := n.devices.Frames(appEUI, devEUI)
+	if err != nil {
+		return nil, err
+	}
+	frames, err := history.Get()
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceSnapshot{
+		Time:   n.now(),
+		Device: dev,
+		Frames: frames,
+	}, nil
+}
@@ -0,0 +1,104 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"encoding/json"
+	"testing"
+
+	pb_handler "github.com/TheThingsNetwork/ttn/api/handler"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestGetDeviceSnapshot(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestGetDeviceSnapshot"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-get-device-snapshot"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devAddr := getDevAddr(1, 2, 3, 4)
+	nwkSKey := types.NwkSKey{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+
+	_, err := ns.GetDeviceSnapshot(appEUI, devEUI)
+	a.So(err, ShouldNotBeNil)
+
+	a.So(ns.devices.Set(&device.Device{
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		AppID:   "app",
+		DevID:   "dev",
+		Options: device.Options{Uses32BitFCnt: true},
+	}), ShouldBeNil)
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+		history, _ := ns.devices.Frames(appEUI, devEUI)
+		history.Clear()
+	}()
+
+	// Activation
+	_, err = ns.HandleActivate(&pb_handler.DeviceActivationResponse{
+		ActivationMetadata: &pb_protocol.ActivationMetadata{Protocol: &pb_protocol.ActivationMetadata_Lorawan{
+			Lorawan: &pb_lorawan.ActivationMetadata{
+				AppEui:  &appEUI,
+				DevEui:  &devEUI,
+				DevAddr: &devAddr,
+				NwkSKey: &nwkSKey,
+			},
+		}},
+	})
+	a.So(err, ShouldBeNil)
+
+	// Uplink with ADR and a MAC command
+	message := uplinkMACInitMessage(appEUI, devEUI, pb_lorawan.MACCommand{Cid: uint32(lorawan.LinkCheckReq)})
+	message.Message.GetLorawan().GetMacPayload().Adr = true
+	_, err = ns.HandleUplink(message)
+	a.So(err, ShouldBeNil)
+
+	// Queued MAC command
+	dev, err := ns.devices.Get(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	dev.StartUpdate()
+	a.So(configureChannel(dev, device.Channel{Index: 3, Frequency: 867100000, MaxDR: 5}), ShouldBeNil)
+	a.So(ns.devices.Set(dev), ShouldBeNil)
+
+	snapshot, err := ns.GetDeviceSnapshot(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(snapshot.Time.IsZero(), ShouldBeFalse)
+	a.So(snapshot.Device.AppID, ShouldEqual, "app")
+	a.So(snapshot.Device.DevID, ShouldEqual, "dev")
+	a.So(snapshot.Device.DevAddr, ShouldEqual, devAddr)
+	a.So(snapshot.Device.NwkSKey, ShouldEqual, nwkSKey)
+	a.So(snapshot.Device.FCntUp, ShouldEqual, 1)
+	a.So(snapshot.Device.LastSeen.IsZero(), ShouldBeFalse)
+	a.So(snapshot.Device.Options.Uses32BitFCnt, ShouldBeTrue)
+	a.So(snapshot.Device.ADR.DataRate, ShouldEqual, "SF7BW125")
+	a.So(snapshot.Device.DataRates, ShouldResemble, []string{"SF7BW125"})
+	a.So(snapshot.Device.Usage.UplinkMessages, ShouldEqual, 1)
+	a.So(snapshot.Device.MACCommands, ShouldNotBeEmpty)
+	a.So(snapshot.Device.MACState, ShouldHaveLength, len(snapshot.Device.MACCommands))
+	a.So(snapshot.Frames, ShouldHaveLength, 1)
+	a.So(snapshot.Frames[0].FCnt, ShouldEqual, 1)
+
+	// The snapshot can be serialized
+	data, err := json.Marshal(snapshot)
+	a.So(err, ShouldBeNil)
+	var restored DeviceSnapshot
+	a.So(json.Unmarshal(data, &restored), ShouldBeNil)
+	a.So(restored.Device.NwkSKey, ShouldEqual, nwkSKey)
+	a.So(restored.Device.MACCommands, ShouldResemble, snapshot.Device.MACCommands)
+	a.So(restored.Frames, ShouldResemble, snapshot.Frames)
+}
@@ -11,16 +11,24 @@ import (
 )
 
 type status struct {
-	uplink      metrics.Meter
-	downlink    metrics.Meter
-	activations metrics.Meter
+	uplink        metrics.Meter
+	downlink      metrics.Meter
+	activations   metrics.Meter
+	skippedFrames metrics.Counter
+
+	activationLatency map[ActivationPhase]metrics.Histogram
+	downlinkWindows   map[int]metrics.Counter
 }
 
 func (n *networkServer) InitStatus() {
 	n.status = &status{
-		uplink:      metrics.NewMeter(),
-		downlink:    metrics.NewMeter(),
-		activations: metrics.NewMeter(),
+		uplink:        metrics.NewMeter(),
+		downlink:      metrics.NewMeter(),
+		activations:   metrics.NewMeter(),
+		skippedFrames: metrics.NewCounter(),
+
+		activationLatency: newActivationLatency(),
+		downlinkWindows:   newDownlinkWindowCounters(),
 	}
 }
 
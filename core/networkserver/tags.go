@@ -0,0 +1,66 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// UpdateTags sets the tags of a device. Tags with an empty value are removed, other tags of the device are kept.
+func (n *networkServer) UpdateTags(appEUI types.AppEUI, devEUI types.DevEUI, tags map[string]string) error {
+	if err := validateEUIs(&appEUI, &devEUI); err != nil {
+		return err
+	}
+	for key := range tags {
+		if key == "" {
+			return errors.NewErrInvalidArgument("Tags", "empty key")
+		}
+	}
+	dev, err := n.devices.Get(appEUI, devEUI)
+	if err != nil {
+		return err
+	}
+	dev.StartUpdate()
+	// The old state of the device shares the map, so the tags are updated in a copy
+	updated := make(map[string]string, len(dev.Tags)+len(tags))
+	for key, value := range dev.Tags {
+		updated[key] = value
+	}
+	for key, value := range tags {
+		if value == "" {
+			delete(updated, key)
+			continue
+		}
+		updated[key] = value
+	}
+	dev.Tags = updated
+	return n.devices.Set(dev)
+}
+
+// hasTags returns whether the device has all the tags
+func hasTags(dev *device.Device, tags map[string]string) bool {
+	for key, value := range tags {
+		if dev.Tags[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ListDevicesByAppEUI lists the devices with the AppEUI that have all the given tags
+func (n *networkServer) ListDevicesByAppEUI(appEUI types.AppEUI, tags map[string]string) ([]*device.Device, error) {
+	devices, err := n.devices.ListForAppEUI(appEUI)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*device.Device, 0, len(devices))
+	for _, dev := range devices {
+		if hasTags(dev, tags) {
+			res = append(res, dev)
+		}
+	}
+	return res, nil
+}
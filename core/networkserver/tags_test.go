@@ -0,0 +1,63 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestDeviceTags(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-device-tags"),
+	}
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 10, 1))
+	otherAppEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 10, 2))
+	devEUIs := []types.DevEUI{
+		types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 10, 1)),
+		types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 10, 2)),
+	}
+	for _, devEUI := range devEUIs {
+		a.So(ns.devices.Set(&device.Device{AppEUI: appEUI, DevEUI: devEUI}), ShouldBeNil)
+		defer ns.devices.Delete(appEUI, devEUI)
+	}
+	a.So(ns.devices.Set(&device.Device{AppEUI: otherAppEUI, DevEUI: devEUIs[0], Tags: map[string]string{"owner": "alice"}}), ShouldBeNil)
+	defer ns.devices.Delete(otherAppEUI, devEUIs[0])
+
+	// Set
+	a.So(ns.UpdateTags(appEUI, devEUIs[0], map[string]string{"owner": "alice", "location": "roof"}), ShouldBeNil)
+	a.So(ns.UpdateTags(appEUI, devEUIs[1], map[string]string{"owner": "bob", "firmware": "1.0"}), ShouldBeNil)
+	a.So(ns.UpdateTags(appEUI, devEUIs[0], map[string]string{"": "empty"}), ShouldNotBeNil)
+
+	// Get
+	dev, err := ns.HandleGetDevice(appEUI, devEUIs[0])
+	a.So(err, ShouldBeNil)
+	a.So(dev.Tags, ShouldResemble, map[string]string{"owner": "alice", "location": "roof"})
+
+	// Update and remove
+	a.So(ns.UpdateTags(appEUI, devEUIs[0], map[string]string{"location": "", "firmware": "1.1"}), ShouldBeNil)
+	dev, err = ns.HandleGetDevice(appEUI, devEUIs[0])
+	a.So(err, ShouldBeNil)
+	a.So(dev.Tags, ShouldResemble, map[string]string{"owner": "alice", "firmware": "1.1"})
+
+	// Filter
+	devices, err := ns.ListDevicesByAppEUI(appEUI, nil)
+	a.So(err, ShouldBeNil)
+	a.So(devices, ShouldHaveLength, 2)
+
+	devices, err = ns.ListDevicesByAppEUI(appEUI, map[string]string{"owner": "alice"})
+	a.So(err, ShouldBeNil)
+	a.So(devices, ShouldHaveLength, 1)
+	a.So(devices[0].DevEUI, ShouldEqual, devEUIs[0])
+
+	devices, err = ns.ListDevicesByAppEUI(appEUI, map[string]string{"owner": "bob", "firmware": "1.1"})
+	a.So(err, ShouldBeNil)
+	a.So(devices, ShouldBeEmpty)
+}
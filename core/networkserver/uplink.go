@@ -11,7 +11,35 @@ import (
 	"github.com/TheThingsNetwork/ttn/utils/errors"
 )
 
+// SyntheticUplinksUpdateLastSeen makes synthetic uplinks update the last seen time of devices
+var SyntheticUplinksUpdateLastSeen = false
+
 func (n *networkServer) HandleUplink(message *pb_broker.DeduplicatedUplinkMessage) (*pb_broker.DeduplicatedUplinkMessage, error) {
+	if err := validateEUIs(message.AppEui, message.DevEui); err != nil {
+		return nil, err
+	}
+	return n.uplinkChain(func(message *pb_broker.DeduplicatedUplinkMessage) (*pb_broker.DeduplicatedUplinkMessage, error) {
+		return n.handleUplink(message, false)
+	}, false)(message)
+}
+
+// InjectUplink handles a synthetic uplink, for example for testing or keep-alive. Synthetic uplinks go
+// through the same path and middleware as normal uplinks, but do not change the frame counter, do not count towards
+// the usage and quota of the device, and only update the last seen time if SyntheticUplinksUpdateLastSeen is set.
+func (n *networkServer) InjectUplink(message *pb_broker.DeduplicatedUplinkMessage) (*pb_broker.DeduplicatedUplinkMessage, error) {
+	if err := validateEUIs(message.AppEui, message.DevEui); err != nil {
+		return nil, err
+	}
+	message.Trace = message.Trace.WithEvent("synthetic uplink")
+	return n.uplinkChain(func(message *pb_broker.DeduplicatedUplinkMessage) (*pb_broker.DeduplicatedUplinkMessage, error) {
+		return n.handleUplink(message, true)
+	}, true)(message)
+}
+
+func (n *networkServer) handleUplink(message *pb_broker.DeduplicatedUplinkMessage, synthetic bool) (*pb_broker.DeduplicatedUplinkMessage, error) {
+	if message.GetMessage() == nil && len(message.Payload) == 0 {
+		return nil, errors.NewErrInvalidArgument("Uplink", "empty payload")
+	}
 	err := message.UnmarshalPayload()
 	if err != nil {
 		return nil, err
@@ -21,18 +49,47 @@ func (n *networkServer) HandleUplink(message *pb_broker.DeduplicatedUplinkMessag
 		return nil, errors.NewErrInvalidArgument("Uplink", "does not contain a MAC payload")
 	}
 
-	n.status.uplink.Mark(1)
+	if !synthetic {
+		n.status.uplink.Mark(1)
+	}
+
+	// Gateways that reported the uplink more than once are counted once, for example in LinkCheckAns
+	message.GatewayMetadata = dedupeGatewayMetadata(message.GatewayMetadata)
 
 	// Get Device
 	dev, err := n.devices.Get(*message.AppEui, *message.DevEui)
 	if err != nil {
 		return nil, err
 	}
+	if dev.Blocked {
+		message.Trace = message.Trace.WithEvent(trace.DropEvent, "reason", "device blocked")
+		return nil, ErrDeviceBlocked
+	}
+	var graceDeadline time.Time
+	if n.sessionExpired(dev) {
+		graceDeadline = n.sessionGraceDeadline(dev)
+		if !n.now().Before(graceDeadline) {
+			message.Trace = message.Trace.WithEvent(trace.DropEvent, "reason", "session expired")
+			return nil, ErrSessionExpired
+		}
+		message.Trace = message.Trace.WithEvent(sessionGraceEvent, "deadline", graceDeadline)
+	}
+	if err = handleUplinkRFUBits(message.Payload, lorawanUplinkMac, dev); err != nil {
+		message.Trace = message.Trace.WithEvent(trace.DropEvent, "reason", "RFU bits set")
+		return nil, err
+	}
 
 	message.Trace = message.Trace.WithEvent(trace.UpdateStateEvent)
 
 	dev.StartUpdate()
+	n.restoreFCnt(dev)
+	if !graceDeadline.IsZero() {
+		dev.SessionGraceDeadline = graceDeadline
+	}
 	defer func() {
+		if !synthetic {
+			n.batchFCnt(dev)
+		}
 		setErr := n.devices.Set(dev)
 		if setErr != nil {
 			n.Ctx.WithError(setErr).Error("Could not update device state")
@@ -42,10 +99,34 @@ func (n *networkServer) HandleUplink(message *pb_broker.DeduplicatedUplinkMessag
 		}
 	}()
 
-	dev.FCntUp = lorawanUplinkMac.FCnt
-	dev.LastSeen = time.Now()
+	// The frame counter of the uplink, the FCntUp of the device may be kept at a higher value
+	fCnt := uplinkFCnt(dev, lorawanUplinkMac.FCnt)
+	if !synthetic {
+		fCntUp := dev.FCntUp
+		dev.FCntUp = fCnt
+		if keepFCntUp(dev, fCntUp) {
+			message.Trace = message.Trace.WithEvent(outOfOrderEvent, "fcnt", lorawanUplinkMac.FCnt)
+		}
+		if n.checkFCntCeiling(dev, FCntDirectionUp, fCntUp, dev.FCntUp) {
+			message.Trace = message.Trace.WithEvent(fCntCeilingEvent, "direction", FCntDirectionUp, "fcnt", dev.FCntUp)
+		}
+		if skipped := n.countSkippedFrames(dev, fCntUp, dev.FCntUp); skipped > 0 {
+			message.Trace = message.Trace.WithEvent(skippedFramesEvent, "skipped", skipped)
+		}
+	}
+	if !synthetic || SyntheticUplinksUpdateLastSeen {
+		dev.LastSeen = n.now()
+	}
+
+	if !synthetic {
+		n.accountUplink(dev, len(message.Payload))
+		recordDataRate(dev, message.GetProtocolMetadata().GetLorawan().GetDataRate())
+		n.checkUplinkDataRate(message, dev)
+		recordUplinkChannel(dev, message.GatewayMetadata)
+	}
 
 	// Prepare Downlink
+	missingTemplate := message.ResponseTemplate == nil
 	message.InitResponseTemplate()
 	lorawanDownlinkMsg := message.ResponseTemplate.Message.InitLoRaWAN()
 	lorawanDownlinkMac := lorawanDownlinkMsg.InitDownlink()
@@ -56,10 +137,58 @@ func (n *networkServer) HandleUplink(message *pb_broker.DeduplicatedUplinkMessag
 		lorawan.FCnt = dev.FCntDown
 	}
 
-	err = n.handleUplinkMAC(message, dev)
+	err = n.handleUplinkMAC(message, dev, fCnt)
 	if err != nil {
 		return nil, err
 	}
+	queue := dev.MACCommands
+	addQueuedMACCommands(message, dev)
+
+	// Without response template, there is no downlink for the MAC commands, so they stay queued
+	if missingTemplate {
+		err = n.handleMissingResponseTemplate(message, dev)
+		dev.MACCommands = queue
+		if err != nil {
+			message.Trace = message.Trace.WithEvent(trace.DropEvent, "reason", "missing response template")
+			return nil, err
+		}
+	}
+
+	// Select the gateway for the downlink among the gateways that have an option, and compute the timestamp in
+	// its time base
+	if option := message.ResponseTemplate.GetDownlinkOption(); option != nil {
+		// Rank the RX1 and RX2 options of all gateways, so that another gateway or window can be used if the
+		// selected one turns out to be unavailable
+		ranked := n.rankedDownlinkOptions(option, message.GatewayMetadata, dev)
+		issued := issuedGateways(option, message.GatewayMetadata)
+		gateway := n.selectDownlinkGateway(issued)
+		if gateway == nil && len(issued) > 0 {
+			message.Trace = message.Trace.WithEvent(trace.DropEvent, "reason", "no duty-cycle budget")
+			message.ResponseTemplate.DownlinkOption = nil
+		}
+		if gateway != nil {
+			setDownlinkTimestamp(option, message.GatewayMetadata, gateway, dev.RXDelay)
+			if setDownlinkFrequency(option, gateway, dev) {
+				message.Trace = message.Trace.WithEvent(downlinkWindowEvent, "window", 2, "reason", "uplink channel unknown")
+			}
+			window, ok := n.scheduleDownlinkWindow(message, option, gateway, dev)
+			switch {
+			case !ok:
+				message.Trace = message.Trace.WithEvent(trace.DropEvent, "reason", "receive windows passed")
+				message.ResponseTemplate.DownlinkOption = nil
+			case window != 0:
+				message.Trace = message.Trace.WithEvent(downlinkWindowEvent, "window", window)
+			}
+			if message.ResponseTemplate.DownlinkOption != nil {
+				message.ResponseTemplate.DownlinkOptions = ranked
+				n.useDownlinkGateway(gateway.GatewayId)
+				n.countDownlinkWindow(window)
+				if setDownlinkPower(option, gateway, dev) {
+					message.Trace = message.Trace.WithEvent(downlinkPowerEvent, "power", option.GatewayConfig.Power)
+				}
+			}
+		}
+	}
 
 	message.ResponseTemplate.Payload, err = lorawanDownlinkMsg.PHYPayload().MarshalBinary()
 	if err != nil {
@@ -71,5 +200,17 @@ func (n *networkServer) HandleUplink(message *pb_broker.DeduplicatedUplinkMessag
 		message.ResponseTemplate = nil
 	}
 
+	// Unset response if downlink is disabled for the device, the handler keeps
+	// any queued downlink until the next uplink with a response template
+	if message.ResponseTemplate != nil && dev.Options.DownlinkDisabled {
+		message.Trace = message.Trace.WithEvent(trace.DropEvent, "reason", "downlink disabled")
+		message.ResponseTemplate = nil
+	}
+
+	// Without downlink, the MAC commands stay queued for the next one
+	if message.ResponseTemplate == nil {
+		dev.MACCommands = queue
+	}
+
 	return message, nil
 }
@@ -0,0 +1,101 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+	"github.com/TheThingsNetwork/ttn/core/band"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+)
+
+// deviceBand returns the name of the band of the device, or the band that is guessed from the frequency
+func deviceBand(dev *device.Device, frequency uint64) string {
+	if dev.ADR.Band != "" {
+		return dev.ADR.Band
+	}
+	return band.Guess(frequency)
+}
+
+// recordUplinkChannel records the channel of an uplink from the frequency in the gateway metadata. The index is the
+// index of the channel in the band, or in the channels that were added to the channel plan of the device.
+func recordUplinkChannel(dev *device.Device, metadata []*pb_gateway.RxMetadata) {
+	var frequency uint64
+	for _, gateway := range metadata {
+		if gateway != nil && gateway.Frequency != 0 {
+			frequency = gateway.Frequency
+			break
+		}
+	}
+	if frequency == 0 {
+		return
+	}
+	channel := device.UplinkChannel{Index: -1, Frequency: uint32(frequency)}
+	if fp, err := band.Get(deviceBand(dev, frequency)); err == nil {
+		for i, ch := range fp.UplinkChannels {
+			if uint64(ch.Frequency) == frequency {
+				channel.Index = i
+				break
+			}
+		}
+	}
+	if channel.Index == -1 {
+		for _, ch := range dev.Channels {
+			if uint64(ch.Frequency) == frequency {
+				channel.Index = int(ch.Index)
+				break
+			}
+		}
+	}
+	dev.UplinkChannel = channel
+}
+
+// rx1Frequency returns the RX1 frequency that belongs to the channel of the last uplink of the device
+func rx1Frequency(dev *device.Device) (uint64, bool) {
+	if dev.UplinkChannel.Frequency == 0 {
+		return 0, false
+	}
+	fp, err := band.Get(deviceBand(dev, uint64(dev.UplinkChannel.Frequency)))
+	if err != nil {
+		return 0, false
+	}
+	frequency, err := fp.GetRX1Frequency(int(dev.UplinkChannel.Frequency))
+	if err != nil {
+		return 0, false
+	}
+	return uint64(frequency), true
+}
+
+// setRX1Frequency sets the RX1 frequency that belongs to the last uplink channel of the device in an RX1 option. If
+// the uplink channel is not known, the frequency that the Router set is kept. It returns false if the option has no
+// RX1 frequency at all and the band of the device is known, so that the option can fall back to RX2.
+func setRX1Frequency(option *pb_broker.DownlinkOption, dev *device.Device) bool {
+	if option.GatewayConfig == nil {
+		return true
+	}
+	if frequency, ok := rx1Frequency(dev); ok {
+		option.GatewayConfig.Frequency = frequency
+		return true
+	}
+	if option.GatewayConfig.Frequency != 0 {
+		return true
+	}
+	_, err := band.Get(dev.ADR.Band)
+	return err != nil
+}
+
+// setDownlinkFrequency sets the RX1 frequency in an RX1 option for the gateway, or moves the option to RX2 if there
+// is no RX1 frequency. It returns whether the option was moved to RX2.
+func setDownlinkFrequency(option *pb_broker.DownlinkOption, gateway *pb_gateway.RxMetadata, dev *device.Device) bool {
+	if option.GatewayConfig == nil {
+		return false
+	}
+	rx1Timestamp, rx2Timestamp := downlinkTimestamps(gateway.Timestamp, dev.RXDelay)
+	if option.GatewayConfig.Timestamp != rx1Timestamp || setRX1Frequency(option, dev) {
+		return false
+	}
+	option.GatewayConfig.Timestamp = rx2Timestamp
+	setRX2Parameters(option, dev)
+	return true
+}
@@ -0,0 +1,94 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestRecordUplinkChannel(t *testing.T) {
+	a := New(t)
+
+	dev := &device.Device{
+		ADR:      device.ADRSettings{Band: pb_lorawan.FrequencyPlan_EU_863_870.String()},
+		Channels: []device.Channel{{Index: 9, Frequency: 869000000}},
+	}
+
+	recordUplinkChannel(dev, []*pb_gateway.RxMetadata{{GatewayId: "gateway", Frequency: 867300000}})
+	a.So(dev.UplinkChannel, ShouldResemble, device.UplinkChannel{Index: 4, Frequency: 867300000})
+
+	// A channel that was added with a NewChannelReq
+	recordUplinkChannel(dev, []*pb_gateway.RxMetadata{{GatewayId: "gateway", Frequency: 869000000}})
+	a.So(dev.UplinkChannel, ShouldResemble, device.UplinkChannel{Index: 9, Frequency: 869000000})
+
+	// A frequency that is not in the channel plan
+	recordUplinkChannel(dev, []*pb_gateway.RxMetadata{{GatewayId: "gateway", Frequency: 869100000}})
+	a.So(dev.UplinkChannel, ShouldResemble, device.UplinkChannel{Index: -1, Frequency: 869100000})
+
+	// Without frequency, the last channel is kept
+	recordUplinkChannel(dev, []*pb_gateway.RxMetadata{{GatewayId: "gateway"}})
+	a.So(dev.UplinkChannel.Frequency, ShouldEqual, 869100000)
+}
+
+func TestHandleUplinkRX1Frequency(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkRX1Frequency"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-rx1-frequency"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		ADR:     device.ADRSettings{Band: pb_lorawan.FrequencyPlan_EU_863_870.String()},
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// uplink sends an uplink on the frequency with an RX1 option without frequency
+	uplink := func(frequency uint64) *pb_gateway.TxConfiguration {
+		message := uplinkMACInitMessage(appEUI, devEUI)
+		message.GatewayMetadata = []*pb_gateway.RxMetadata{
+			&pb_gateway.RxMetadata{GatewayId: "gateway", Timestamp: 1000, Frequency: frequency},
+		}
+		message.ResponseTemplate.DownlinkOption = &pb_broker.DownlinkOption{
+			GatewayId:     "gateway",
+			GatewayConfig: &pb_gateway.TxConfiguration{Timestamp: 1001000},
+		}
+		res, err := ns.HandleUplink(message)
+		a.So(err, ShouldBeNil)
+		return res.ResponseTemplate.DownlinkOption.GatewayConfig
+	}
+
+	// The uplink channel is not known, so RX2 is used
+	config := uplink(0)
+	a.So(config.Timestamp, ShouldEqual, 2001000)
+	a.So(config.Frequency, ShouldEqual, 869525000)
+
+	// The RX1 frequency is the frequency of the uplink channel
+	config = uplink(867300000)
+	a.So(config.Timestamp, ShouldEqual, 1001000)
+	a.So(config.Frequency, ShouldEqual, 867300000)
+
+	dev, err := ns.devices.Get(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(dev.UplinkChannel, ShouldResemble, device.UplinkChannel{Index: 4, Frequency: 867300000})
+}
@@ -11,10 +11,41 @@ import (
 	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
 	"github.com/TheThingsNetwork/ttn/api/trace"
 	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
 	"github.com/brocaar/lorawan"
 )
 
-func (n *networkServer) handleUplinkMAC(message *pb_broker.DeduplicatedUplinkMessage, dev *device.Device) error {
+// UnknownMACCommandPolicy determines what happens to uplink MAC commands that the NetworkServer does not know.
+// As the length of an unknown command is not known, the commands after it can not be interpreted, so they are
+// lost under every policy.
+type UnknownMACCommandPolicy int
+
+// Policies for unknown MAC commands
+const (
+	// IgnoreUnknownMACCommands skips the unknown command and the rest of the FOpts
+	IgnoreUnknownMACCommands UnknownMACCommandPolicy = iota
+	// DropUnknownMACCommands logs the unknown command and drops the frame
+	DropUnknownMACCommands
+	// ForwardUnknownMACCommands passes the unknown command, with the rest of the FOpts as its payload, to the
+	// MACCommandHandler
+	ForwardUnknownMACCommands
+)
+
+// UnknownMACCommands is the policy for unknown MAC commands; the default is forward-compatible
+var UnknownMACCommands = IgnoreUnknownMACCommands
+
+// RejectTruncatedMACCommands makes the NetworkServer reject uplinks that end with a truncated MAC command,
+// by default the truncated command is ignored
+var RejectTruncatedMACCommands = false
+
+// MACCommandHandler handles MAC commands that are not handled by the NetworkServer itself
+type MACCommandHandler func(dev *device.Device, cmd pb_lorawan.MACCommand) error
+
+func (n *networkServer) SetMACCommandHandler(handler MACCommandHandler) {
+	n.macCommandHandler = handler
+}
+
+func (n *networkServer) handleUplinkMAC(message *pb_broker.DeduplicatedUplinkMessage, dev *device.Device, fCnt uint32) error {
 	lorawanUplinkMsg := message.GetMessage().GetLorawan()
 	lorawanUplinkMac := lorawanUplinkMsg.GetMacPayload()
 	lorawanDownlinkMsg := message.GetResponseTemplate().GetMessage().GetLorawan()
@@ -39,7 +70,35 @@ func (n *networkServer) handleUplinkMAC(message *pb_broker.DeduplicatedUplinkMes
 	}
 
 	// MAC Commands
-	for _, cmd := range lorawanUplinkMac.FOpts {
+	fOpts := lorawanUplinkMac.FOpts
+	if raw := uplinkFOpts(message.Payload); len(raw) > 0 {
+		var err error
+		fOpts, err = parseUplinkFOpts(raw)
+		if err != nil {
+			if RejectTruncatedMACCommands {
+				return err
+			}
+			ctx.WithError(err).Warn("Ignoring truncated MAC command")
+		}
+	}
+	if lorawanUplinkMac.FPort == 0 && len(lorawanUplinkMac.FrmPayload) > 0 {
+		// MAC commands in the FRMPayload, encrypted with the NwkSKey
+		raw, err := decryptUplinkFPort0(dev.NwkSKey, dev.DevAddr, fCnt, lorawanUplinkMac.FrmPayload)
+		if err != nil {
+			return err
+		}
+		cmds, err := parseUplinkFOpts(raw)
+		if err != nil {
+			if RejectTruncatedMACCommands {
+				return err
+			}
+			ctx.WithError(err).Warn("Ignoring truncated MAC command")
+		}
+		fOpts = append(fOpts, cmds...)
+	}
+	var deviceModeIndicated bool
+commands:
+	for _, cmd := range fOpts {
 		switch cmd.Cid {
 		case uint32(lorawan.LinkCheckReq):
 			response := &lorawan.LinkCheckAnsPayload{
@@ -62,23 +121,96 @@ func (n *networkServer) handleUplinkMAC(message *pb_broker.DeduplicatedUplinkMes
 				"power-ack", answer.PowerACK,
 				"channel-mask-ack", answer.ChannelMaskACK,
 			)
+			// Negative answers are counted by ADR, the request is not re-sent
 			if answer.DataRateACK && answer.PowerACK && answer.ChannelMaskACK {
+				confirmMACCommand(dev, lorawan.LinkADRReq)
 				dev.ADR.Failed = 0
 				dev.ADR.SendReq = false
 			} else {
+				answerMACCommand(dev, lorawan.LinkADRReq)
 				dev.ADR.Failed++
 				ctx.
 					WithField("Answer", fmt.Sprintf("%v/%v/%v", answer.DataRateACK, answer.PowerACK, answer.ChannelMaskACK)).
 					Warn("Negative LinkADRAns")
 			}
+		case uint32(deviceModeInd):
+			if len(cmd.Payload) != 1 {
+				break
+			}
+			deviceModeIndicated = true
+			// Only Class A and Class C can be selected with DeviceModeInd, otherwise we confirm the current class
+			switch requested := device.Class(cmd.Payload[0]); requested {
+			case device.ClassA, device.ClassC:
+				dev.Class = requested
+			default:
+				ctx.WithField("Class", requested).Warn("Invalid DeviceModeInd")
+			}
+			lorawanDownlinkMac.FOpts = append(lorawanDownlinkMac.FOpts, pb_lorawan.MACCommand{
+				Cid:     uint32(deviceModeConf),
+				Payload: []byte{byte(dev.Class)},
+			})
+			message.Trace = message.Trace.WithEvent(trace.HandleMACEvent, macCMD, "device-mode", "class", dev.Class)
+		case uint32(txParamSetupAns):
+			// The answer has no payload, the device accepted the queued TxParamSetupReq
+			for _, queued := range dev.MACCommands {
+				if queued.CID == uint8(txParamSetupReq) && len(queued.Payload) == 1 {
+					dev.TxParams = txParams(queued.Payload[0])
+				}
+			}
+			confirmMACCommand(dev, txParamSetupReq)
+			message.Trace = message.Trace.WithEvent(trace.HandleMACEvent, macCMD, "tx-param-setup",
+				"uplink-dwell-time", dev.TxParams.UplinkDwellTime,
+				"downlink-dwell-time", dev.TxParams.DownlinkDwellTime,
+			)
+		case uint32(lorawan.NewChannelAns):
+			var answer lorawan.NewChannelAnsPayload
+			if err := answer.UnmarshalBinary(cmd.Payload); err != nil {
+				break
+			}
+			handleNewChannelAns(dev, answer)
+			message.Trace = message.Trace.WithEvent(trace.HandleMACEvent, macCMD, "new-channel",
+				"channel-frequency-ok", answer.ChannelFrequencyOK,
+				"data-rate-range-ok", answer.DataRateRangeOK,
+			)
+		case uint32(lorawan.RXParamSetupAns):
+			handleRXParamSetupAns(dev, cmd.Payload)
+			message.Trace = message.Trace.WithEvent(trace.HandleMACEvent, macCMD, "rx-param-setup", "rx2-frequency", dev.RX2Frequency, "rx2-data-rate", dev.RX2DataRate)
+		case uint32(lorawan.DutyCycleAns), uint32(lorawan.DevStatusAns), uint32(lorawan.RXTimingSetupAns):
+			// Known, but not (yet) handled
+			answerMACCommand(dev, lorawan.CID(cmd.Cid))
 		default:
+			switch UnknownMACCommands {
+			case DropUnknownMACCommands:
+				ctx.WithField("CID", cmd.Cid).Warn("Dropping frame with unknown MAC command")
+				return errors.NewErrInvalidArgument("Uplink", fmt.Sprintf("unknown MAC command 0x%02x", cmd.Cid))
+			case ForwardUnknownMACCommands:
+				message.Trace = message.Trace.WithEvent(trace.HandleMACEvent, macCMD, "forward", "cid", cmd.Cid)
+				if n.macCommandHandler != nil {
+					if err := n.macCommandHandler(dev, cmd); err != nil {
+						return err
+					}
+				}
+			default:
+				message.Trace = message.Trace.WithEvent(trace.HandleMACEvent, macCMD, "unknown", "cid", cmd.Cid)
+			}
+			// We don't know the length of the unknown command, so we can't interpret the rest of the FOpts
+			break commands
 		}
 	}
-
-	// We can't send MAC on port 0; send them on port 1
-	if len(lorawanDownlinkMac.FOpts) != 0 && lorawanDownlinkMac.FPort == 0 {
-		lorawanDownlinkMac.FPort = 1
-	}
+	confirmClassSwitch(dev, deviceModeIndicated)
 
 	return nil
 }
+
+// addQueuedMACCommands adds the queued MAC commands of the device to the response to the uplink. The caller
+// restores the queue if the response is not sent. The FPort of a response without application payload is set by
+// HandleDownlink, according to the MACOnlyDownlinkMode of the device.
+func addQueuedMACCommands(message *pb_broker.DeduplicatedUplinkMessage, dev *device.Device) {
+	lorawanDownlinkMac := message.GetResponseTemplate().GetMessage().GetLorawan().GetMacPayload()
+	if !dev.Options.DownlinkDisabled {
+		lorawanDownlinkMac.FOpts = drainMACCommands(dev, lorawanDownlinkMac.FOpts)
+		if macCommandsDeferred(dev, lorawanDownlinkMac.FOpts) {
+			lorawanDownlinkMac.FPending = true
+		}
+	}
+}
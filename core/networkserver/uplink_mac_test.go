@@ -0,0 +1,220 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	pb_gateway "github.com/TheThingsNetwork/ttn/api/gateway"
+	pb_protocol "github.com/TheThingsNetwork/ttn/api/protocol"
+	pb_lorawan "github.com/TheThingsNetwork/ttn/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func uplinkMACInitMessage(appEUI types.AppEUI, devEUI types.DevEUI, fOpts ...pb_lorawan.MACCommand) *pb_broker.DeduplicatedUplinkMessage {
+	message := &pb_broker.DeduplicatedUplinkMessage{
+		AppEui:           &appEUI,
+		DevEui:           &devEUI,
+		Message:          new(pb_protocol.Message),
+		ResponseTemplate: &pb_broker.DownlinkMessage{DownlinkOption: &pb_broker.DownlinkOption{}},
+		ProtocolMetadata: &pb_protocol.RxMetadata{Protocol: &pb_protocol.RxMetadata_Lorawan{
+			Lorawan: &pb_lorawan.Metadata{
+				DataRate: "SF7BW125",
+			},
+		}},
+		GatewayMetadata: []*pb_gateway.RxMetadata{
+			&pb_gateway.RxMetadata{},
+		},
+	}
+	mac := message.Message.InitLoRaWAN().InitUplink()
+	mac.DevAddr = getDevAddr(1, 2, 3, 4)
+	mac.FCnt = 1
+	mac.FOpts = fOpts
+	return message
+}
+
+func TestHandleUplinkDeviceMode(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkDeviceMode"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-device-mode"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	deviceMode := func(class device.Class) pb_lorawan.MACCommand {
+		return pb_lorawan.MACCommand{Cid: uint32(deviceModeInd), Payload: []byte{byte(class)}}
+	}
+
+	// Switch to Class C
+	res, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, deviceMode(device.ClassC)))
+	a.So(err, ShouldBeNil)
+	fOpts := res.ResponseTemplate.Message.GetLorawan().GetMacPayload().FOpts
+	a.So(fOpts, ShouldHaveLength, 1)
+	a.So(fOpts[0].Cid, ShouldEqual, uint32(deviceModeConf))
+	a.So(fOpts[0].Payload, ShouldResemble, []byte{byte(device.ClassC)})
+
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	a.So(dev.Class, ShouldEqual, device.ClassC)
+
+	// Class B can not be selected with DeviceModeInd, the current class is confirmed
+	res, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, deviceMode(device.ClassB)))
+	a.So(err, ShouldBeNil)
+	fOpts = res.ResponseTemplate.Message.GetLorawan().GetMacPayload().FOpts
+	a.So(fOpts, ShouldHaveLength, 1)
+	a.So(fOpts[0].Payload, ShouldResemble, []byte{byte(device.ClassC)})
+
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.Class, ShouldEqual, device.ClassC)
+
+	// Back to Class A
+	res, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, deviceMode(device.ClassA)))
+	a.So(err, ShouldBeNil)
+	fOpts = res.ResponseTemplate.Message.GetLorawan().GetMacPayload().FOpts
+	a.So(fOpts[0].Payload, ShouldResemble, []byte{byte(device.ClassA)})
+
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.Class, ShouldEqual, device.ClassA)
+}
+
+func TestHandleUplinkUnknownMACCommand(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkUnknownMACCommand"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-unknown-mac-command"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	defer func(policy UnknownMACCommandPolicy) {
+		UnknownMACCommands = policy
+	}(UnknownMACCommands)
+
+	unknown := pb_lorawan.MACCommand{Cid: 0x7f, Payload: []byte{0x01}}
+	linkCheck := pb_lorawan.MACCommand{Cid: uint32(lorawan.LinkCheckReq)}
+
+	// Ignore: the rest of the FOpts is skipped
+	UnknownMACCommands = IgnoreUnknownMACCommands
+	res, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, unknown, linkCheck))
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate.Message.GetLorawan().GetMacPayload().FOpts, ShouldBeEmpty)
+
+	// Drop: the frame is rejected
+	UnknownMACCommands = DropUnknownMACCommands
+	_, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, unknown, linkCheck))
+	a.So(err, ShouldNotBeNil)
+
+	// Forward without a handler: the rest of the FOpts is skipped
+	UnknownMACCommands = ForwardUnknownMACCommands
+	res, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, unknown, linkCheck))
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate.Message.GetLorawan().GetMacPayload().FOpts, ShouldBeEmpty)
+
+	// Forward: the handler gets the command, the rest of the FOpts is still skipped
+	var forwarded []pb_lorawan.MACCommand
+	ns.SetMACCommandHandler(func(dev *device.Device, cmd pb_lorawan.MACCommand) error {
+		forwarded = append(forwarded, cmd)
+		return nil
+	})
+	res, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, unknown, linkCheck))
+	a.So(err, ShouldBeNil)
+	a.So(forwarded, ShouldHaveLength, 1)
+	a.So(forwarded[0].Cid, ShouldEqual, 0x7f)
+	a.So(res.ResponseTemplate.Message.GetLorawan().GetMacPayload().FOpts, ShouldBeEmpty)
+
+	// Known commands before the unknown command are handled
+	res, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI, linkCheck, unknown))
+	a.So(err, ShouldBeNil)
+	fOpts := res.ResponseTemplate.Message.GetLorawan().GetMacPayload().FOpts
+	a.So(fOpts, ShouldHaveLength, 1)
+	a.So(fOpts[0].Cid, ShouldEqual, uint32(lorawan.LinkCheckAns))
+}
+
+func TestHandleUplinkMultipleMACCommands(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkMultipleMACCommands"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-multiple-mac-commands"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		ADR:     device.ADRSettings{SendReq: true, Failed: 1},
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	defer func(reject bool) {
+		RejectTruncatedMACCommands = reject
+	}(RejectTruncatedMACCommands)
+
+	uplink := func(fOpts ...byte) *pb_broker.DeduplicatedUplinkMessage {
+		message := uplinkMACInitMessage(appEUI, devEUI)
+		message.Payload = append([]byte{0x40, 4, 3, 2, 1, byte(len(fOpts)), 1, 0}, fOpts...)
+		message.Payload = append(message.Payload, 0, 0, 0, 0) // MIC
+		return message
+	}
+
+	// LinkCheckReq + DevStatusAns + LinkADRAns
+	res, err := ns.HandleUplink(uplink(0x02, 0x06, 0xff, 0x05, 0x03, 0x07))
+	a.So(err, ShouldBeNil)
+	fOpts := res.ResponseTemplate.Message.GetLorawan().GetMacPayload().FOpts
+	a.So(fOpts, ShouldHaveLength, 1)
+	a.So(fOpts[0].Cid, ShouldEqual, uint32(lorawan.LinkCheckAns))
+
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	a.So(dev.ADR.SendReq, ShouldBeFalse)
+	a.So(dev.ADR.Failed, ShouldEqual, 0)
+
+	// Truncated DevStatusAns is ignored
+	res, err = ns.HandleUplink(uplink(0x02, 0x06, 0xff))
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate.Message.GetLorawan().GetMacPayload().FOpts, ShouldHaveLength, 1)
+
+	// Or rejected
+	RejectTruncatedMACCommands = true
+	_, err = ns.HandleUplink(uplink(0x02, 0x06, 0xff))
+	a.So(err, ShouldNotBeNil)
+}
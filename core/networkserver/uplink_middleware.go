@@ -0,0 +1,58 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"time"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	"github.com/TheThingsNetwork/ttn/api/ratelimit"
+	"github.com/TheThingsNetwork/ttn/api/trace"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// UplinkHandler handles an uplink message
+type UplinkHandler func(message *pb_broker.DeduplicatedUplinkMessage) (*pb_broker.DeduplicatedUplinkMessage, error)
+
+// UplinkMiddleware is invoked for uplink messages that are handled by HandleUplink or InjectUplink. It can inspect, change or reject
+// the message, and calls next to continue handling it.
+type UplinkMiddleware func(message *pb_broker.DeduplicatedUplinkMessage, next UplinkHandler) (*pb_broker.DeduplicatedUplinkMessage, error)
+
+// UseUplinkMiddleware adds middleware to HandleUplink and InjectUplink. Middleware is invoked in the order in which
+// it was added, after the built-in quota middleware.
+func (n *networkServer) UseUplinkMiddleware(middleware ...UplinkMiddleware) {
+	n.uplinkMiddleware = append(n.uplinkMiddleware, middleware...)
+}
+
+// uplinkChain wraps the handler in the built-in and added middleware. Synthetic uplinks do not count towards the
+// quota of the device, so they skip the built-in quota middleware.
+func (n *networkServer) uplinkChain(handler UplinkHandler, synthetic bool) UplinkHandler {
+	var middleware []UplinkMiddleware
+	if !synthetic {
+		middleware = append(middleware, n.quotaMiddleware)
+	}
+	middleware = append(middleware, n.uplinkMiddleware...)
+	for i := len(middleware) - 1; i >= 0; i-- {
+		current, next := middleware[i], handler
+		handler = func(message *pb_broker.DeduplicatedUplinkMessage) (*pb_broker.DeduplicatedUplinkMessage, error) {
+			return current(message, next)
+		}
+	}
+	return handler
+}
+
+// ErrUplinkRateLimited is returned for uplink of devices that exceeded their rate limit
+var ErrUplinkRateLimited = errors.NewErrPermissionDenied("device exceeded its uplink rate limit")
+
+// UplinkRateLimit returns UplinkMiddleware that rejects uplink of devices that send more than rate messages per duration
+func UplinkRateLimit(rate int, per time.Duration) UplinkMiddleware {
+	registry := ratelimit.NewRegistry(rate, per)
+	return func(message *pb_broker.DeduplicatedUplinkMessage, next UplinkHandler) (*pb_broker.DeduplicatedUplinkMessage, error) {
+		if message.DevEui != nil && registry.Limit(message.DevEui.String()) {
+			message.Trace = message.Trace.WithEvent(trace.DropEvent, "reason", "rate limit exceeded")
+			return nil, ErrUplinkRateLimited
+		}
+		return next(message)
+	}
+}
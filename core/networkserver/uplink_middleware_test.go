@@ -0,0 +1,104 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestUplinkMiddleware(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestUplinkMiddleware"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-uplink-middleware"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	var invoked []string
+	errRejected := errors.NewErrPermissionDenied("rejected by middleware")
+	reject := true
+	ns.UseUplinkMiddleware(
+		func(message *pb_broker.DeduplicatedUplinkMessage, next UplinkHandler) (*pb_broker.DeduplicatedUplinkMessage, error) {
+			invoked = append(invoked, "first")
+			if reject {
+				return nil, errRejected
+			}
+			return next(message)
+		},
+		func(message *pb_broker.DeduplicatedUplinkMessage, next UplinkHandler) (*pb_broker.DeduplicatedUplinkMessage, error) {
+			invoked = append(invoked, "second")
+			return next(message)
+		},
+	)
+
+	// The message is rejected before it reaches the core handler
+	_, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldEqual, errRejected)
+	a.So(invoked, ShouldResemble, []string{"first"})
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	a.So(dev.FCntUp, ShouldEqual, 0)
+	a.So(dev.LastSeen.IsZero(), ShouldBeTrue)
+	a.So(dev.Usage.UplinkMessages, ShouldEqual, 0)
+
+	// The middleware is invoked in order, followed by the core handler
+	invoked = nil
+	reject = false
+	res, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldBeNil)
+	a.So(res, ShouldNotBeNil)
+	a.So(invoked, ShouldResemble, []string{"first", "second"})
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.FCntUp, ShouldEqual, 1)
+	a.So(dev.Usage.UplinkMessages, ShouldEqual, 1)
+
+	// Synthetic uplinks go through the middleware as well
+	invoked = nil
+	reject = true
+	_, err = ns.InjectUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldEqual, errRejected)
+	a.So(invoked, ShouldResemble, []string{"first"})
+}
+
+func TestUplinkRateLimit(t *testing.T) {
+	a := New(t)
+
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	handled := 0
+	handler := func(message *pb_broker.DeduplicatedUplinkMessage) (*pb_broker.DeduplicatedUplinkMessage, error) {
+		handled++
+		return message, nil
+	}
+
+	rateLimit := UplinkRateLimit(2, time.Hour)
+	for i := 0; i < 2; i++ {
+		_, err := rateLimit(&pb_broker.DeduplicatedUplinkMessage{DevEui: &devEUI}, handler)
+		a.So(err, ShouldBeNil)
+	}
+	_, err := rateLimit(&pb_broker.DeduplicatedUplinkMessage{DevEui: &devEUI}, handler)
+	a.So(err, ShouldEqual, ErrUplinkRateLimited)
+	a.So(handled, ShouldEqual, 2)
+}
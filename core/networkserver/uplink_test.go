@@ -14,6 +14,7 @@ import (
 	"github.com/TheThingsNetwork/ttn/core/component"
 	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
 	"github.com/TheThingsNetwork/ttn/core/types"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
 	. "github.com/TheThingsNetwork/ttn/utils/testing"
 	"github.com/brocaar/lorawan"
 	. "github.com/smartystreets/assertions"
@@ -118,3 +119,203 @@ func TestHandleUplink(t *testing.T) {
 	a.So(dev.FCntUp, ShouldEqual, 1)
 	a.So(time.Now().Sub(dev.LastSeen), ShouldBeLessThan, 1*time.Second)
 }
+
+func TestHandleUplinkFCntWidth(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkFCntWidth"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-fcnt-width"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	dev16EUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 1))
+	dev32EUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 2))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  dev16EUI,
+		FCntUp:  0xfff0,
+	})
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  dev32EUI,
+		FCntUp:  0x1fff0,
+		Options: device.Options{Uses32BitFCnt: true},
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, dev16EUI)
+		ns.devices.Delete(appEUI, dev32EUI)
+	}()
+
+	// The same FCnt with (wrong) upper bits for both devices
+	uplink := func(devEUI types.DevEUI) {
+		message := uplinkMACInitMessage(appEUI, devEUI)
+		message.Message.GetLorawan().GetMacPayload().FCnt = 0x20005
+		_, err := ns.HandleUplink(message)
+		a.So(err, ShouldBeNil)
+	}
+
+	uplink(dev16EUI)
+	dev, _ := ns.devices.Get(appEUI, dev16EUI)
+	a.So(dev.FCntUp, ShouldEqual, 0x5)
+
+	uplink(dev32EUI)
+	dev, _ = ns.devices.Get(appEUI, dev32EUI)
+	a.So(dev.FCntUp, ShouldEqual, 0x20005)
+}
+
+func TestHandleUplinkDownlinkDisabled(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkDownlinkDisabled"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-downlink-disabled"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		Options: device.Options{DownlinkDisabled: true},
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// Disabled: no response template, so the handler keeps its queue
+	res, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate, ShouldBeNil)
+
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	dev.StartUpdate()
+	dev.Options.DownlinkDisabled = false
+	ns.devices.Set(dev)
+
+	// Enabled again
+	res, err = ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate, ShouldNotBeNil)
+}
+
+func TestHandleUplinkDownlinkTimestamp(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkDownlinkTimestamp"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-downlink-timestamp"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		RXDelay: 3,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	message := uplinkMACInitMessage(appEUI, devEUI)
+	message.GatewayMetadata = []*pb_gateway.RxMetadata{
+		&pb_gateway.RxMetadata{GatewayId: "gateway", Timestamp: 1000},
+	}
+	message.ResponseTemplate.DownlinkOption = &pb_broker.DownlinkOption{
+		GatewayId:     "gateway",
+		GatewayConfig: &pb_gateway.TxConfiguration{Timestamp: 1001000}, // RX1 with the default delay
+	}
+
+	res, err := ns.HandleUplink(message)
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate.DownlinkOption.GatewayConfig.Timestamp, ShouldEqual, 1000+3000000)
+}
+
+func TestInjectUplink(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestInjectUplink"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-inject-uplink"),
+	}
+	ns.InitStatus()
+
+	defer func(updateLastSeen bool) {
+		SyntheticUplinksUpdateLastSeen = updateLastSeen
+	}(SyntheticUplinksUpdateLastSeen)
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+		FCntUp:  10,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// Synthetic uplinks are not subject to the quota
+	ns.SetQuotaPolicy(testQuotaPolicy(0))
+
+	// The synthetic uplink results in a downlink
+	res, err := ns.InjectUplink(uplinkMACInitMessage(appEUI, devEUI, pb_lorawan.MACCommand{Cid: uint32(lorawan.LinkCheckReq)}))
+	a.So(err, ShouldBeNil)
+	a.So(res.ResponseTemplate, ShouldNotBeNil)
+	fOpts := res.ResponseTemplate.Message.GetLorawan().GetMacPayload().FOpts
+	a.So(fOpts, ShouldHaveLength, 1)
+	a.So(fOpts[0].Cid, ShouldEqual, uint32(lorawan.LinkCheckAns))
+
+	dev, _ := ns.devices.Get(appEUI, devEUI)
+	a.So(dev.FCntUp, ShouldEqual, 10)
+	a.So(dev.LastSeen.IsZero(), ShouldBeTrue)
+	a.So(dev.Usage.UplinkMessages, ShouldEqual, 0)
+
+	SyntheticUplinksUpdateLastSeen = true
+	_, err = ns.InjectUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldBeNil)
+
+	dev, _ = ns.devices.Get(appEUI, devEUI)
+	a.So(dev.LastSeen.IsZero(), ShouldBeFalse)
+}
+
+func TestHandleUplinkEmptyPayload(t *testing.T) {
+	a := New(t)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestHandleUplinkEmptyPayload"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-handle-uplink-empty-payload"),
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	for _, payload := range [][]byte{nil, []byte{}} {
+		_, err := ns.HandleUplink(&pb_broker.DeduplicatedUplinkMessage{
+			AppEui:  &appEUI,
+			DevEui:  &devEUI,
+			Payload: payload,
+		})
+		a.So(err, ShouldNotBeNil)
+		a.So(errors.GetErrType(err), ShouldEqual, errors.InvalidArgument)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"time"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	"github.com/TheThingsNetwork/ttn/api/trace"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/utils/errors"
+)
+
+// UsageWindow is the period over which messages and bytes of a device are counted
+var UsageWindow = 24 * time.Hour
+
+// currentUsage returns the usage of the device in the current window
+func currentUsage(usage device.Usage, now time.Time) device.Usage {
+	if usage.Since.IsZero() || !now.Before(usage.Since.Add(UsageWindow)) {
+		return device.Usage{Since: now}
+	}
+	return usage
+}
+
+func (n *networkServer) accountUplink(dev *device.Device, bytes int) {
+	dev.Usage = currentUsage(dev.Usage, n.now())
+	dev.Usage.UplinkMessages++
+	dev.Usage.UplinkBytes += uint64(bytes)
+}
+
+func (n *networkServer) accountDownlink(dev *device.Device, bytes int) {
+	dev.Usage = currentUsage(dev.Usage, n.now())
+	dev.Usage.DownlinkMessages++
+	dev.Usage.DownlinkBytes += uint64(bytes)
+}
+
+// QuotaDecision is the decision of a QuotaPolicy
+type QuotaDecision int
+
+// Quota decisions
+const (
+	QuotaAllow QuotaDecision = iota // The device is within its quota
+	QuotaFlag                       // The device exceeded its quota, but its uplink is still accepted
+	QuotaDeny                       // The device exceeded its quota, its uplink is rejected
+)
+
+// QuotaPolicy decides whether a device is within its fair-use quota, based on its (updated) usage
+type QuotaPolicy interface {
+	Check(dev *device.Device) QuotaDecision
+}
+
+// ErrQuotaExceeded is returned for uplink of devices that exceeded their quota
+var ErrQuotaExceeded = errors.NewErrPermissionDenied("device exceeded its fair-use quota")
+
+func (n *networkServer) SetQuotaPolicy(policy QuotaPolicy) {
+	n.quotaPolicy = policy
+}
+
+// quotaMiddleware is the built-in UplinkMiddleware that rejects uplink of devices that exceeded their quota. The
+// usage of a rejected uplink is still stored, the usage of an accepted uplink is accounted by handleUplink.
+func (n *networkServer) quotaMiddleware(message *pb_broker.DeduplicatedUplinkMessage, next UplinkHandler) (*pb_broker.DeduplicatedUplinkMessage, error) {
+	if n.quotaPolicy == nil || message.AppEui == nil || message.DevEui == nil {
+		return next(message)
+	}
+	dev, err := n.devices.Get(*message.AppEui, *message.DevEui)
+	if err != nil || dev.Blocked {
+		return next(message)
+	}
+	dev.StartUpdate()
+	n.accountUplink(dev, len(message.Payload))
+	switch n.quotaPolicy.Check(dev) {
+	case QuotaFlag:
+		message.Trace = message.Trace.WithEvent("quota exceeded")
+		n.Ctx.WithField("DevEUI", dev.DevEUI).Warn("Device exceeded its quota")
+	case QuotaDeny:
+		message.Trace = message.Trace.WithEvent(trace.DropEvent, "reason", "quota exceeded")
+		if err := n.devices.Set(dev); err != nil {
+			n.Ctx.WithError(err).Error("Could not update device state")
+		}
+		return nil, ErrQuotaExceeded
+	}
+	return next(message)
+}
@@ -0,0 +1,152 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package networkserver
+
+import (
+	"testing"
+	"time"
+
+	pb_broker "github.com/TheThingsNetwork/ttn/api/broker"
+	"github.com/TheThingsNetwork/ttn/core/component"
+	"github.com/TheThingsNetwork/ttn/core/networkserver/device"
+	"github.com/TheThingsNetwork/ttn/core/types"
+	. "github.com/TheThingsNetwork/ttn/utils/testing"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/assertions"
+)
+
+func TestUsage(t *testing.T) {
+	a := New(t)
+
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestUsage"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-usage"),
+		clock:   func() time.Time { return now },
+	}
+	ns.InitStatus()
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	uplink := func() {
+		message := uplinkMACInitMessage(appEUI, devEUI)
+		message.Payload = make([]byte, 20)
+		_, err := ns.HandleUplink(message)
+		a.So(err, ShouldBeNil)
+	}
+
+	downlink := func() {
+		phy := lorawan.PHYPayload{
+			MHDR: lorawan.MHDR{
+				MType: lorawan.UnconfirmedDataDown,
+				Major: lorawan.LoRaWANR1,
+			},
+			MACPayload: &lorawan.MACPayload{
+				FHDR: lorawan.FHDR{
+					DevAddr: lorawan.DevAddr([4]byte{1, 2, 3, 4}),
+				},
+			},
+		}
+		bytes, _ := phy.MarshalBinary()
+		_, err := ns.HandleDownlink(&pb_broker.DownlinkMessage{
+			AppEui:  &appEUI,
+			DevEui:  &devEUI,
+			Payload: bytes,
+		})
+		a.So(err, ShouldBeNil)
+	}
+
+	uplink()
+	uplink()
+	downlink()
+
+	dev, err := ns.HandleGetDevice(appEUI, devEUI)
+	a.So(err, ShouldBeNil)
+	a.So(dev.Usage.Since.Equal(now), ShouldBeTrue)
+	a.So(dev.Usage.UplinkMessages, ShouldEqual, 2)
+	a.So(dev.Usage.UplinkBytes, ShouldEqual, 40)
+	a.So(dev.Usage.DownlinkMessages, ShouldEqual, 1)
+	a.So(dev.Usage.DownlinkBytes, ShouldEqual, 12) // MHDR, FHDR and MIC
+
+	// Still in the window
+	now = now.Add(UsageWindow - time.Second)
+	uplink()
+	dev, _ = ns.HandleGetDevice(appEUI, devEUI)
+	a.So(dev.Usage.UplinkMessages, ShouldEqual, 3)
+
+	// At the window boundary, the totals are reset
+	now = now.Add(time.Second)
+	dev, _ = ns.HandleGetDevice(appEUI, devEUI)
+	a.So(dev.Usage.UplinkMessages, ShouldEqual, 0)
+	a.So(dev.Usage.DownlinkMessages, ShouldEqual, 0)
+
+	uplink()
+	dev, _ = ns.HandleGetDevice(appEUI, devEUI)
+	a.So(dev.Usage.Since.Equal(now), ShouldBeTrue)
+	a.So(dev.Usage.UplinkMessages, ShouldEqual, 1)
+	a.So(dev.Usage.UplinkBytes, ShouldEqual, 20)
+	a.So(dev.Usage.DownlinkMessages, ShouldEqual, 0)
+}
+
+type testQuotaPolicy uint64 // maximum number of uplink messages
+
+func (q testQuotaPolicy) Check(dev *device.Device) QuotaDecision {
+	if dev.Usage.UplinkMessages > uint64(q) {
+		return QuotaDeny
+	}
+	return QuotaAllow
+}
+
+func TestQuotaPolicy(t *testing.T) {
+	a := New(t)
+
+	ns := &networkServer{
+		Component: &component.Component{
+			Ctx: GetLogger(t, "TestQuotaPolicy"),
+		},
+		devices: device.NewRedisDeviceStore(GetRedisClient(), "ns-test-quota-policy"),
+	}
+	ns.InitStatus()
+	ns.SetQuotaPolicy(testQuotaPolicy(2))
+
+	appEUI := types.AppEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+	devEUI := types.DevEUI(getEUI(1, 2, 3, 4, 5, 6, 7, 8))
+
+	ns.devices.Set(&device.Device{
+		DevAddr: getDevAddr(1, 2, 3, 4),
+		AppEUI:  appEUI,
+		DevEUI:  devEUI,
+	})
+	defer func() {
+		ns.devices.Delete(appEUI, devEUI)
+	}()
+
+	// Allowed
+	for i := 0; i < 2; i++ {
+		res, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+		a.So(err, ShouldBeNil)
+		a.So(res, ShouldNotBeNil)
+	}
+
+	// Denied
+	_, err := ns.HandleUplink(uplinkMACInitMessage(appEUI, devEUI))
+	a.So(err, ShouldEqual, ErrQuotaExceeded)
+
+	// The usage of the rejected uplink is still stored
+	dev, _ := ns.HandleGetDevice(appEUI, devEUI)
+	a.So(dev.Usage.UplinkMessages, ShouldEqual, 3)
+	a.So(dev.FCntUp, ShouldEqual, 1)
+}
@@ -201,6 +201,20 @@ func (s *RedisMapStore) Set(key string, value interface{}, properties ...string)
 	return s.client.HMSet(key, vmap).Err()
 }
 
+// SetPipelined queues setting a record in the pipeline, prepending the prefix to the key if necessary, optionally
+// setting only the given properties
+func (s *RedisMapStore) SetPipelined(pipe *redis.Pipeline, key string, value interface{}, properties ...string) error {
+	key, vmap, err := s.prepare(key, value, properties...)
+	if err != nil {
+		return err
+	}
+	if len(vmap) == 0 {
+		return nil
+	}
+	pipe.HMSet(key, vmap)
+	return nil
+}
+
 // Create a new record, prepending the prefix to the key if necessary, optionally setting only the given properties
 // This function returns an error if the record already exists
 func (s *RedisMapStore) Create(key string, value interface{}, properties ...string) error {
@@ -131,3 +131,22 @@ func (s *RedisSetStore) Remove(key string, values ...string) error {
 	}
 	return s.client.SRem(key, valuesI...).Err()
 }
+
+// AddPipelined queues adding one or more values to the set in the pipeline, prepending the prefix to the key if necessary
+func (s *RedisSetStore) AddPipelined(pipe *redis.Pipeline, key string, values ...string) {
+	valuesI := make([]interface{}, len(values))
+	for i, v := range values {
+		valuesI[i] = v
+	}
+	pipe.SAdd(s.Key(key), valuesI...)
+}
+
+// RemovePipelined queues removing one or more values from the set in the pipeline, prepending the prefix to the key
+// if necessary
+func (s *RedisSetStore) RemovePipelined(pipe *redis.Pipeline, key string, values ...string) {
+	valuesI := make([]interface{}, len(values))
+	for i, v := range values {
+		valuesI[i] = v
+	}
+	pipe.SRem(s.Key(key), valuesI...)
+}
@@ -26,6 +26,14 @@ func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
 	}
 }
 
+// Key returns the key, prepending the prefix if necessary
+func (s *RedisStore) Key(key string) string {
+	if !strings.HasPrefix(key, s.prefix) {
+		key = s.prefix + key
+	}
+	return key
+}
+
 // Keys matching the selector, prepending the prefix to the selector if necessary
 func (s *RedisStore) Keys(selector string) ([]string, error) {
 	if selector == "" {
@@ -66,3 +74,8 @@ func (s *RedisStore) Delete(key string) error {
 	}
 	return s.client.Del(key).Err()
 }
+
+// DeletePipelined queues the deletion of a record in the pipeline, prepending the prefix to the key if necessary
+func (s *RedisStore) DeletePipelined(pipe *redis.Pipeline, key string) {
+	pipe.Del(s.Key(key))
+}
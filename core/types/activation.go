@@ -6,6 +6,7 @@ package types
 import (
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"strings"
 )
 
@@ -182,6 +183,47 @@ func (n NetID) IsEmpty() bool {
 	return n == emptyNetID
 }
 
+// nwkIDBits is the number of NwkID bits in a DevAddr for each NetID type
+var nwkIDBits = [8]uint{6, 6, 9, 11, 12, 13, 15, 17}
+
+// Type returns the type (0-7) of the NetID, which is in its 3 most significant bits
+func (n NetID) Type() int {
+	return int(n[0] >> 5)
+}
+
+// NwkID returns the NwkID of the NetID: the least significant bits of the NetID that are in the DevAddrs of
+// the network. The number of bits depends on the type of the NetID.
+func (n NetID) NwkID() uint32 {
+	id := uint32(n[0])<<16 | uint32(n[1])<<8 | uint32(n[2])
+	return id & (1<<nwkIDBits[n.Type()] - 1)
+}
+
+// DevAddrPrefix returns the prefix of the DevAddrs of the network: the type prefix of the NetID (as many ones
+// as the type, followed by a zero), followed by the NwkID
+func (n NetID) DevAddrPrefix() DevAddrPrefix {
+	netIDType := uint(n.Type())
+	typeBits, idBits := netIDType+1, nwkIDBits[netIDType]
+	typePrefix := uint32(1<<netIDType-1) << 1
+	addr := typePrefix<<(32-typeBits) | n.NwkID()<<(32-typeBits-idBits)
+	return DevAddrPrefix{
+		DevAddr: DevAddr{byte(addr >> 24), byte(addr >> 16), byte(addr >> 8), byte(addr)},
+		Length:  int(typeBits + idBits),
+	}
+}
+
+// idBits is the number of bits of the 21-bit ID of a NetID that are used for each NetID type, the others are RFU
+var idBits = [8]uint{6, 6, 9, 21, 21, 21, 21, 21}
+
+// Validate returns an error if the RFU bits of the NetID are set. NetIDs of type 0, 1 and 2 only use the NwkID
+// bits of their ID.
+func (n NetID) Validate() error {
+	id := uint32(n[0]&0x1f)<<16 | uint32(n[1])<<8 | uint32(n[2])
+	if id>>idBits[n.Type()] != 0 {
+		return errors.New(fmt.Sprintf("ttn/core: NetID %s of type %d has RFU bits set", n, n.Type()))
+	}
+	return nil
+}
+
 // GoString implements the GoStringer interface.
 func (n NetID) GoString() string {
 	return n.String()
@@ -182,3 +182,44 @@ func TestNetID(t *testing.T) {
 	a.So(err, ShouldBeNil)
 	a.So(uOut, ShouldResemble, &nid)
 }
+
+func TestNetIDDevAddrPrefix(t *testing.T) {
+	a := New(t)
+
+	for _, tt := range []struct {
+		netID  NetID
+		typ    int
+		nwkID  uint32
+		prefix DevAddrPrefix
+	}{
+		{NetID{0x00, 0x00, 0x13}, 0, 0x13, DevAddrPrefix{DevAddr{0x26, 0x00, 0x00, 0x00}, 7}},
+		{NetID{0x20, 0x00, 0x3f}, 1, 0x3f, DevAddrPrefix{DevAddr{0xbf, 0x00, 0x00, 0x00}, 8}},
+		{NetID{0x40, 0x01, 0x05}, 2, 0x105, DevAddrPrefix{DevAddr{0xd0, 0x50, 0x00, 0x00}, 12}},
+		{NetID{0x60, 0x00, 0x2d}, 3, 0x2d, DevAddrPrefix{DevAddr{0xe0, 0x5a, 0x00, 0x00}, 15}},
+		{NetID{0xc0, 0x00, 0x50}, 6, 0x50, DevAddrPrefix{DevAddr{0xfc, 0x01, 0x40, 0x00}, 22}},
+		{NetID{0xe1, 0xff, 0xff}, 7, 0x1ffff, DevAddrPrefix{DevAddr{0xfe, 0xff, 0xff, 0x80}, 25}},
+	} {
+		a.So(tt.netID.Type(), ShouldEqual, tt.typ)
+		a.So(tt.netID.NwkID(), ShouldEqual, tt.nwkID)
+		a.So(tt.netID.DevAddrPrefix(), ShouldResemble, tt.prefix)
+
+		// The NwkID can be extracted from any DevAddr with the prefix
+		devAddr := DevAddr{0xff, 0xff, 0xff, 0xff}.WithPrefix(tt.prefix)
+		a.So(devAddr.NetIDType(), ShouldEqual, tt.typ)
+		a.So(devAddr.NwkID(), ShouldEqual, tt.nwkID)
+	}
+}
+
+func TestNetIDValidate(t *testing.T) {
+	a := New(t)
+
+	a.So(NetID{0x00, 0x00, 0x13}.Validate(), ShouldBeNil)
+	a.So(NetID{0x00, 0x00, 0x40}.Validate(), ShouldNotBeNil)
+	a.So(NetID{0x01, 0x02, 0x13}.Validate(), ShouldNotBeNil)
+	a.So(NetID{0x20, 0x00, 0x3f}.Validate(), ShouldBeNil)
+	a.So(NetID{0x20, 0x01, 0x3f}.Validate(), ShouldNotBeNil)
+	a.So(NetID{0x40, 0x01, 0x05}.Validate(), ShouldBeNil)
+	a.So(NetID{0x40, 0x02, 0x05}.Validate(), ShouldNotBeNil)
+	a.So(NetID{0x60, 0x00, 0x2d}.Validate(), ShouldBeNil)
+	a.So(NetID{0x7f, 0xff, 0xff}.Validate(), ShouldBeNil)
+}
@@ -213,6 +213,24 @@ func (addr DevAddr) WithPrefix(prefix DevAddrPrefix) (prefixed DevAddr) {
 	return
 }
 
+// NetIDType returns the type of the NetID of the DevAddr, which is the number of leading ones of the DevAddr
+func (addr DevAddr) NetIDType() int {
+	for netIDType := uint(0); netIDType < 7; netIDType++ {
+		if addr[0]&(0x80>>netIDType) == 0 {
+			return int(netIDType)
+		}
+	}
+	return 7
+}
+
+// NwkID returns the NwkID in the DevAddr, which follows the type prefix of the NetID
+func (addr DevAddr) NwkID() uint32 {
+	netIDType := uint(addr.NetIDType())
+	typeBits, idBits := netIDType+1, nwkIDBits[netIDType]
+	value := uint32(addr[0])<<24 | uint32(addr[1])<<16 | uint32(addr[2])<<8 | uint32(addr[3])
+	return value >> (32 - typeBits - idBits) & (1<<idBits - 1)
+}
+
 // HasPrefix returns true if the DevAddr has a prefix of given length
 func (addr DevAddr) HasPrefix(prefix DevAddrPrefix) bool {
 	return addr.Mask(prefix.Length) == prefix.DevAddr.Mask(prefix.Length)
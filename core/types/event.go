@@ -62,4 +62,5 @@ type DownlinkEventData struct {
 	Message   *DownlinkMessage        `json:"message,omitempty"`
 	GatewayID string                  `json:"gateway_id,omitempty"`
 	Config    DownlinkEventConfigInfo `json:"config,omitempty"`
+	AckTime   JSONTime                `json:"ack_time,omitempty"`
 }